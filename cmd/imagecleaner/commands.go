@@ -0,0 +1,159 @@
+package main
+
+import (
+	// Импорт стандартных библиотек
+	"errors"        // Для проверки результата поиска водяного знака
+	"fmt"           // Для вывода результатов команд
+	"image"         // Для декодирования проверяемого изображения
+	"os"            // Для вывода ошибок в stderr и чтения файлов
+	"path/filepath" // Для имени файла в метке хеша
+	"strings"       // Для разбора аргументов
+
+	// Импорт внутренних пакетов проекта
+	"imagecleaner/internal/database" // Для изменения настроек пользователей
+	"imagecleaner/internal/services" // Для проверки списка полей метаданных
+)
+
+// Административные команды запускаются тем же бинарным файлом вместо сервера:
+//
+//	imagecleaner set-metadata-allowlist <username> <поля|default>
+//	imagecleaner detect <файл>...
+//	imagecleaner phash <файл>...
+//
+// Команды используют ту же базу данных (DB_PATH), что и сервер.
+
+// runCommand выполняет административную команду и возвращает код завершения процесса.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "set-metadata-allowlist":
+		return runSetMetadataAllowlist(args[1:])
+	case "detect":
+		return runDetect(args[1:])
+	case "phash":
+		return runPHash(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "Неизвестная команда: %s\nДоступные команды:\n  set-metadata-allowlist <username> <поля|default>\n  detect <файл>...\n  phash <файл>...\n", args[0])
+	return 2
+}
+
+// runSetMetadataAllowlist задает пользователю собственный список разрешенных полей метаданных.
+// "default" сбрасывает список (используется глобальный METADATA_ALLOWLIST),
+// "none" запрещает сохранение любых полей независимо от глобального списка.
+func runSetMetadataAllowlist(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "Использование: set-metadata-allowlist <username> <поля|default>\nДоступные поля: %s\nСокращения: artist, copyright, description, credit; none - удалять все.\n", strings.Join(services.MetadataFieldNames(), ", "))
+		return 2
+	}
+	username, value := args[0], strings.Join(args[1:], ",")
+
+	var stored *string
+	if !strings.EqualFold(value, "default") {
+		allowlist, err := services.ParseMetadataAllowlist(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			return 1
+		}
+		// Пустая строка хранится явно: она отличается от NULL (глобального списка).
+		canonical := allowlist.String()
+		stored = &canonical
+	}
+	if err := database.SetUserMetadataAllowlist(username, stored); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	switch {
+	case stored == nil:
+		fmt.Printf("Пользователь %s: используется глобальный список разрешенных метаданных\n", username)
+	case *stored == "":
+		fmt.Printf("Пользователь %s: все метаданные удаляются\n", username)
+	default:
+		fmt.Printf("Пользователь %s: сохраняются поля %s\n", username, *stored)
+	}
+	return 0
+}
+
+// runDetect извлекает невидимый водяной знак из подозрительных изображений (например,
+// найденных в открытом доступе) и ищет по нему ссылки, через которые они были выданы.
+// Нужен тот же WATERMARK_KEY, что и у сервера. Код завершения 0, если знак найден
+// хотя бы в одном файле.
+func runDetect(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Использование: detect <файл>...\n")
+		return 2
+	}
+	code := 1
+	for _, path := range args {
+		if detectFile(path) {
+			code = 0
+		}
+	}
+	return code
+}
+
+// detectFile проверяет один файл и выводит найденные ссылки. Возвращает true, если знак найден.
+func detectFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: ошибка: %v\n", path, err)
+		return false
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: не удалось декодировать изображение: %v\n", path, err)
+		return false
+	}
+
+	watermarkID, confidence, err := services.DetectWatermark(img)
+	if err != nil {
+		if errors.Is(err, services.ErrWatermarkNotFound) {
+			fmt.Printf("%s: водяной знак не найден (уверенность %.1f)\n", path, confidence)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: ошибка: %v\n", path, err)
+		}
+		return false
+	}
+	fmt.Printf("%s: водяной знак %08x (уверенность %.1f)\n", path, watermarkID, confidence)
+
+	matches, err := database.FindImagesByWatermarkID(watermarkID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: ошибка поиска в базе данных: %v\n", path, err)
+		return true
+	}
+	if len(matches) == 0 {
+		fmt.Printf("  в базе данных нет изображений с этим водяным знаком (другой сервер или удаленная запись)\n")
+	}
+	for _, m := range matches {
+		viewed := "не просмотрено"
+		if m.Image.ViewedAt.Valid {
+			viewed = "просмотрено " + m.Image.ViewedAt.Time.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  ID %d, пользователь %s, файл '%s', загружено %s, статус %s (%s), токен %s\n",
+			m.Image.ID, m.Username, m.Image.OriginalFilename, m.Image.CreatedAt.Format("2006-01-02 15:04:05"),
+			m.Image.Status, viewed, m.Image.AccessToken)
+	}
+	return true
+}
+
+// runPHash выводит перцептивные хеши изображений в формате файла списка блокировки
+// (хеш и имя файла в качестве метки), чтобы оператор мог пополнить список.
+func runPHash(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Использование: phash <файл>...\n")
+		return 2
+	}
+	code := 0
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var hash uint64
+			if hash, err = services.PerceptualHashFile(data); err == nil {
+				fmt.Printf("%016x %s\n", hash, filepath.Base(path))
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: ошибка: %v\n", path, err)
+		code = 1
+	}
+	return code
+}
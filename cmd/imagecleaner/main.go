@@ -5,11 +5,14 @@ import (
 	"log"        // Для логирования
 	"os"         // Для работы с переменными окружения и файловой системой
 	"path/filepath" // Для работы с путями к файлам (получение директории)
+	"strconv"       // Для разбора числовых параметров конфигурации
+	"time"          // Для интервала перезагрузки списка блокировки
 
 	// Импорт внутренних пакетов проекта
 	"imagecleaner/internal/database"   // Для работы с базой данных
 	"imagecleaner/internal/handlers"   // Для обработчиков HTTP-запросов
 	"imagecleaner/internal/middleware" // Для middleware (например, проверки аутентификации)
+	"imagecleaner/internal/services"   // Для настройки бюджета памяти на декодирование изображений
 
 	// Импорт сторонних библиотек
 	"github.com/gin-contrib/sessions"        // Middleware для управления сессиями в Gin
@@ -80,6 +83,52 @@ func main() {
 	dbPath := getEnv("DB_PATH", "/app/data/service.db")                             // Путь к файлу БД (внутри volume)
 	listenPort := getEnv("LISTEN_PORT", "8080")                                     // Порт для прослушивания внутри контейнера
 	uploadPath := getEnv("UPLOAD_PATH", "/app/uploads")                             // Путь для загружаемых файлов (внутри volume)
+	decodeBudgetMB := getEnv("DECODE_MEMORY_BUDGET_MB", strconv.Itoa(services.DefaultDecodeMemoryBudget>>20)) // Общий бюджет памяти на декодирование изображений, МБ
+
+	// Ограничиваем суммарную память, которую одновременно могут занять декодируемые изображения.
+	if mb, err := strconv.ParseInt(decodeBudgetMB, 10, 64); err == nil && mb > 0 {
+		services.SetDecodeMemoryBudget(mb << 20)
+	} else {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: DECODE_MEMORY_BUDGET_MB: некорректное значение '%s'. Используется %d МБ.", decodeBudgetMB, services.DefaultDecodeMemoryBudget>>20)
+	}
+
+	// Детектор лиц для автоматического размытия (необязательно). Каскад в формате PICO/pigo.
+	if cascadePath := getEnv("FACE_CASCADE_PATH", ""); cascadePath != "" {
+		if err := services.LoadFaceCascade(cascadePath); err != nil {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ: %v. Автоматическое размытие лиц будет недоступно.", err)
+		}
+	}
+
+	// Секретный ключ невидимого водяного знака (нужен и серверу, и команде detect).
+	// Если водяной знак включен для всех загрузок, без ключа сервер не запускается:
+	// с пустым или опубликованным ключом знак может извлечь и удалить кто угодно.
+	if err := services.SetWatermarkKey(getEnv("WATERMARK_KEY", "")); err != nil {
+		if watermarkAll, _ := strconv.ParseBool(getEnv("WATERMARK", "false")); watermarkAll {
+			log.Fatalf("КРИТИЧЕСКАЯ ОШИБКА: WATERMARK=true, но %v", err)
+		}
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: %v. Невидимый водяной знак недоступен.", err)
+	}
+
+	// Список блокировки по перцептивным хешам (необязательно). Если он задан, но не загружается,
+	// сервер не запускается: иначе запрещенные изображения молча принимались бы.
+	if blocklistPath := getEnv("HASH_BLOCKLIST_PATH", ""); blocklistPath != "" {
+		distance := services.DefaultBlocklistDistance
+		if value := getEnv("HASH_BLOCKLIST_MAX_DISTANCE", ""); value != "" {
+			if parsed, err := services.ParseBlocklistDistance(value); err == nil {
+				distance = parsed
+			} else {
+				log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: HASH_BLOCKLIST_MAX_DISTANCE: %v. Используется %d.", err, distance)
+			}
+		}
+		reloadSeconds, err := strconv.Atoi(getEnv("HASH_BLOCKLIST_RELOAD_SECONDS", "30"))
+		if err != nil || reloadSeconds < 0 {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: HASH_BLOCKLIST_RELOAD_SECONDS: некорректное значение. Используется 30 секунд.")
+			reloadSeconds = 30
+		}
+		if err := services.LoadHashBlocklist(blocklistPath, distance, time.Duration(reloadSeconds)*time.Second); err != nil {
+			log.Fatalf("КРИТИЧЕСКАЯ ОШИБКА: %v", err)
+		}
+	}
 
 	// Проверяем и создаем необходимые директории ДО инициализации зависимых компонентов (БД).
 	log.Printf("Проверка директории для БД: %s", filepath.Dir(dbPath)) // Логируем путь к папке БД
@@ -95,6 +144,13 @@ func main() {
 	}
 	// defer database.DB.Close() // Закрытие БД при завершении main (хотя при Fatalf не выполнится)
 
+	// Если указана команда (например, set-metadata-allowlist), выполняем ее вместо запуска сервера.
+	if len(os.Args) > 1 {
+		code := runCommand(os.Args[1:])
+		database.DB.Close()
+		os.Exit(code)
+	}
+
 	// Устанавливаем режим работы Gin (ReleaseMode для продакшена - меньше логов, выше производительность).
 	gin.SetMode(gin.ReleaseMode)
 	// Создаем экземпляр Gin engine с настройками по умолчанию (логгер, восстановление после паник).
@@ -157,6 +213,9 @@ func main() {
 		// Маршруты для просмотра изображений (токен в URL)
 		public.GET("/view/:token", handlers.ShowConfirmViewPage) // Страница подтверждения просмотра (GET)
 		public.POST("/view/:token", handlers.HandleConfirmView)  // Обработка подтверждения и отдача файла (POST)
+
+		// Метрики Prometheus (доступ по METRICS_TOKEN, без него маршрут отвечает 404)
+		public.GET("/metrics", handlers.HandleMetrics)
 	}
 
 	// Группа маршрутов, требующих аутентификации пользователя.
@@ -6,6 +6,7 @@ require (
 	github.com/gin-contrib/sessions v1.0.3
 	github.com/gin-gonic/gin v1.10.0
 	golang.org/x/crypto v0.37.0
+	golang.org/x/image v0.25.0
 	modernc.org/sqlite v1.37.0
 )
 
@@ -138,6 +138,50 @@ func createTables() error {
 		return fmt.Errorf("ошибка при создании индекса user_id_status images: %w", err)
 	}
 
+	// --- Столбцы, добавленные после первой версии схемы ---
+	// CREATE TABLE IF NOT EXISTS не меняет существующие таблицы, поэтому новые столбцы
+	// добавляются в уже созданные базы отдельно.
+	// metadata_allowlist: список разрешенных полей метаданных пользователя (NULL - использовать глобальный).
+	if err = ensureColumn("users", "metadata_allowlist", "TEXT NULL"); err != nil {
+		return err
+	}
+	// watermark_id: идентификатор, встроенный в пиксели невидимым водяным знаком (NULL - без знака).
+	if err = ensureColumn("images", "watermark_id", "INTEGER NULL"); err != nil {
+		return err
+	}
+	// Индекс для поиска ссылки по водяному знаку утекшей копии (команда detect).
+	_, err = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_images_watermark_id ON images (watermark_id);`)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании индекса watermark_id images: %w", err)
+	}
+
+	// width, height: размеры сохраненного изображения (после уменьшения, если оно выполнялось).
+	if err = ensureColumn("images", "width", "INTEGER NULL"); err != nil {
+		return err
+	}
+	if err = ensureColumn("images", "height", "INTEGER NULL"); err != nil {
+		return err
+	}
+
+	// Журнал отклоненных по списку блокировки загрузок. Сами изображения не сохраняются,
+	// только хеши. Внешнего ключа на users нет: записи журнала не должны удаляться
+	// вместе с пользователем, поэтому имя пользователя копируется.
+	blocklistAuditSQL := `
+	CREATE TABLE IF NOT EXISTS blocklist_audit (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,  -- Уникальный ID записи
+		user_id INTEGER NOT NULL,                      -- ID пользователя, загрузившего файл
+		username TEXT NOT NULL,                        -- Имя пользователя на момент загрузки
+		original_filename TEXT,                        -- Исходное имя файла
+		image_hash TEXT NOT NULL,                      -- Перцептивный хеш загруженного изображения
+		matched_hash TEXT NOT NULL,                    -- Совпавший хеш из списка
+		matched_label TEXT,                            -- Метка записи списка
+		distance INTEGER NOT NULL,                     -- Расстояние Хэмминга
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP  -- Время попытки загрузки
+	);`
+	if _, err = DB.Exec(blocklistAuditSQL); err != nil {
+		return fmt.Errorf("ошибка при создании таблицы blocklist_audit: %w", err)
+	}
+
 	return nil // Все таблицы и индексы созданы успешно
 }
 
@@ -224,14 +268,16 @@ func GetUserByUsername(username string) (*models.User, error) {
 }
 
 // CreateImageRecord сохраняет информацию о загруженном изображении в БД.
-// Принимает ID пользователя, оригинальное имя файла, сгенерированное имя файла на сервере и токен доступа.
+// Принимает ID пользователя, оригинальное имя файла, сгенерированное имя файла на сервере, токен доступа
+// идентификатор водяного знака (0 - водяной знак не встраивался, сохраняется NULL)
+// и размеры сохраненного изображения.
 // Устанавливает статус 'pending' по умолчанию.
 // Возвращает ID созданной записи или ошибку.
-func CreateImageRecord(userID int64, originalFilename, storedFilename, accessToken string) (int64, error) {
+func CreateImageRecord(userID int64, originalFilename, storedFilename, accessToken string, watermarkID uint32, width, height int) (int64, error) {
 	// Подготавливаем запрос на вставку.
 	stmt, err := DB.Prepare(`
-		INSERT INTO images(user_id, original_filename, stored_filename, access_token, status)
-		VALUES(?, ?, ?, ?, 'pending')
+		INSERT INTO images(user_id, original_filename, stored_filename, access_token, watermark_id, width, height, status)
+		VALUES(?, ?, ?, ?, ?, ?, ?, 'pending')
 	`)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка подготовки запроса CreateImageRecord: %w", err)
@@ -239,7 +285,11 @@ func CreateImageRecord(userID int64, originalFilename, storedFilename, accessTok
 	defer stmt.Close()
 
 	// Выполняем запрос.
-	res, err := stmt.Exec(userID, originalFilename, storedFilename, accessToken)
+	var watermark sql.NullInt64
+	if watermarkID != 0 {
+		watermark = sql.NullInt64{Int64: int64(watermarkID), Valid: true}
+	}
+	res, err := stmt.Exec(userID, originalFilename, storedFilename, accessToken, watermark, width, height)
 	if err != nil {
 		// Проверяем ошибки нарушения UNIQUE constraint для полей stored_filename и access_token.
 		// Эти ошибки не должны происходить при правильной генерации имен и токенов, но проверяем на всякий случай.
@@ -383,4 +433,129 @@ func UpdateImageStatus(imageID int64, newStatus string) error {
 	}
 
 	return nil // Успех или некритичная ситуация (ID не найден)
-}
\ No newline at end of file
+}
+// ensureColumn добавляет столбец в существующую таблицу, если его еще нет.
+// Имена таблицы и столбца задаются в коде (не пользователем), поэтому подставляются в запрос напрямую.
+func ensureColumn(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("ошибка получения структуры таблицы %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// PRAGMA table_info возвращает: cid, name, type, notnull, dflt_value, pk.
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("ошибка чтения структуры таблицы %s: %w", table, err)
+		}
+		if name == column {
+			return nil // Столбец уже есть
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения структуры таблицы %s: %w", table, err)
+	}
+	rows.Close() // Освобождаем единственное соединение пула перед ALTER TABLE
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("ошибка при добавлении столбца %s в таблицу %s: %w", column, table, err)
+	}
+	log.Printf("В таблицу %s добавлен столбец %s", table, column)
+	return nil
+}
+
+// GetUserMetadataAllowlist возвращает список разрешенных полей метаданных пользователя.
+// Второе значение false означает, что у пользователя нет своего списка
+// (или пользователь не найден) и используется глобальный список.
+func GetUserMetadataAllowlist(userID int64) (string, bool, error) {
+	var allowlist sql.NullString
+	err := DB.QueryRow("SELECT metadata_allowlist FROM users WHERE id = ?", userID).Scan(&allowlist)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("ошибка получения списка разрешенных метаданных для пользователя ID %d: %w", userID, err)
+	}
+	return allowlist.String, allowlist.Valid, nil
+}
+
+// SetUserMetadataAllowlist задает список разрешенных полей метаданных пользователя.
+// allowlist == nil сбрасывает список пользователя (используется глобальный).
+// Вызывается только администратором (см. команду set-metadata-allowlist).
+func SetUserMetadataAllowlist(username string, allowlist *string) error {
+	var value sql.NullString
+	if allowlist != nil {
+		value = sql.NullString{String: *allowlist, Valid: true}
+	}
+	res, err := DB.Exec("UPDATE users SET metadata_allowlist = ? WHERE username = ?", value, username)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления списка разрешенных метаданных для %s: %w", username, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка получения rowsAffected в SetUserMetadataAllowlist для %s: %w", username, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("пользователь '%s' не найден", username)
+	}
+	return nil
+}
+
+// WatermarkMatch - изображение, найденное по водяному знаку, и имя загрузившего его пользователя.
+type WatermarkMatch struct {
+	Image    models.Image
+	Username string
+}
+
+// FindImagesByWatermarkID ищет изображения с заданным идентификатором водяного знака.
+// Обычно находится не больше одной записи (идентификатор случайный), но совпадения
+// возможны, поэтому возвращаются все, от новых к старым.
+func FindImagesByWatermarkID(watermarkID uint32) ([]WatermarkMatch, error) {
+	rows, err := DB.Query(`
+		SELECT i.id, i.user_id, i.original_filename, i.stored_filename, i.access_token, i.created_at, i.viewed_at, i.status, u.username
+		FROM images i JOIN users u ON u.id = i.user_id
+		WHERE i.watermark_id = ?
+		ORDER BY i.created_at DESC, i.id DESC`, int64(watermarkID))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска изображений по водяному знаку %08x: %w", watermarkID, err)
+	}
+	defer rows.Close()
+
+	var matches []WatermarkMatch
+	for rows.Next() {
+		var m WatermarkMatch
+		var originalFilename sql.NullString
+		err := rows.Scan(&m.Image.ID, &m.Image.UserID, &originalFilename, &m.Image.StoredFilename,
+			&m.Image.AccessToken, &m.Image.CreatedAt, &m.Image.ViewedAt, &m.Image.Status, &m.Username)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования FindImagesByWatermarkID: %w", err)
+		}
+		m.Image.OriginalFilename = originalFilename.String
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения результатов FindImagesByWatermarkID: %w", err)
+	}
+	return matches, nil
+}
+
+// RecordBlockedUpload записывает в журнал загрузку, отклоненную по списку блокировки.
+// Хеши хранятся в шестнадцатеричном виде (как в файле списка).
+func RecordBlockedUpload(userID int64, username, originalFilename string, imageHash, matchedHash uint64, label string, distance int) error {
+	_, err := DB.Exec(`
+		INSERT INTO blocklist_audit(user_id, username, original_filename, image_hash, matched_hash, matched_label, distance)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		userID, username, originalFilename, fmt.Sprintf("%016x", imageHash), fmt.Sprintf("%016x", matchedHash), label, distance)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в журнал списка блокировки: %w", err)
+	}
+	return nil
+}
@@ -2,11 +2,17 @@ package handlers
 
 import (
 	// Стандартные библиотеки
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +30,17 @@ import (
 const MaxUploadSize = 10 << 20 // 10 МБ
 const MaxFiles = 10            // Максимальное количество файлов
 
+// DefaultMaxUploadItems - сколько изображений (с учетом содержимого архивов) обрабатывается
+// за одну загрузку по умолчанию (переопределяется переменной окружения UPLOAD_MAX_ITEMS).
+// Все они обрабатываются в рамках одного запроса, поэтому значение меньше ARCHIVE_MAX_ENTRIES.
+const DefaultMaxUploadItems = 20
+
+// DefaultAudioInlineMaxMB - аудиофайлы не больше этого размера (МБ) показываются на странице
+// проигрывателя: файл встраивается в страницу как data:-адрес, и base64 увеличивает ее
+// объем на треть. Файлы больше отдаются напрямую, как изображения, и браузер открывает
+// их встроенным проигрывателем. Переопределяется переменной окружения AUDIO_INLINE_MAX_MB.
+const DefaultAudioInlineMaxMB = 4
+
 // getEnv - локальная вспомогательная функция для получения переменных окружения.
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
@@ -32,6 +49,179 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// processOptionsFromEnv формирует параметры обработки изображений из переменных окружения.
+// Некорректные значения логируются и заменяются значениями по умолчанию.
+func processOptionsFromEnv() services.ProcessOptions {
+	opts := services.DefaultProcessOptions()
+	opts.JPEGMode = cleanModeFromEnv("JPEG_CLEAN_MODE", opts.JPEGMode)
+	opts.PNGMode = cleanModeFromEnv("PNG_CLEAN_MODE", opts.PNGMode)
+	if value := getEnv("CONVERT_OUTPUT_FORMAT", ""); value != "" {
+		if format, err := services.ParseOutputFormat(value); err == nil {
+			opts.ConvertFormat = format
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: CONVERT_OUTPUT_FORMAT: %v. Используется формат '%s'.", err, opts.ConvertFormat)
+		}
+	}
+	if value := getEnv("OUTPUT_POLICY", ""); value != "" {
+		if policy, err := services.ParseOutputPolicy(value); err == nil {
+			opts.OutputPolicy = policy
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: OUTPUT_POLICY: %v. Используется политика '%s'.", err, opts.OutputPolicy)
+		}
+	}
+	if value := getEnv("JPEG_QUALITY", ""); value != "" {
+		if quality, err := services.ParseJPEGQuality(value); err == nil {
+			opts.JPEGQuality = quality
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: JPEG_QUALITY: %v. Используется качество %d.", err, opts.JPEGQuality)
+		}
+	}
+	if value := getEnv("PNG_COMPRESSION", ""); value != "" {
+		if level, err := services.ParsePNGCompression(value); err == nil {
+			opts.PNGCompression = level
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: PNG_COMPRESSION: %v. Используется уровень по умолчанию.", err)
+		}
+	}
+	opts.JPEGProgressive = boolFromEnv("JPEG_PROGRESSIVE", opts.JPEGProgressive)
+	opts.Scrub.Enabled = boolFromEnv("DEEP_SCRUB", opts.Scrub.Enabled)
+	opts.AntiFingerprint = boolFromEnv("ANTI_FINGERPRINT", opts.AntiFingerprint)
+	opts.Watermark = boolFromEnv("WATERMARK", opts.Watermark)
+	opts.SVGRasterize = boolFromEnv("SVG_RASTERIZE", opts.SVGRasterize)
+	if value := getEnv("GPS_PRECISION", ""); value != "" {
+		if precision, err := services.ParseGPSPrecision(value); err == nil {
+			opts.GPSPrecision = precision
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: GPS_PRECISION: %v. Координаты будут удаляться полностью.", err)
+		}
+	}
+	if value := getEnv("METADATA_ALLOWLIST", ""); value != "" {
+		if allowlist, err := services.ParseMetadataAllowlist(value); err == nil {
+			opts.MetadataAllowlist = allowlist
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: METADATA_ALLOWLIST: %v. Метаданные будут удаляться полностью.", err)
+		}
+	}
+	if value := getEnv("ANTI_FINGERPRINT_STRENGTH", ""); value != "" {
+		if strength, err := services.ParseFingerprintStrength(value); err == nil {
+			opts.AntiFingerprintStrength = strength
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: ANTI_FINGERPRINT_STRENGTH: %v. Используется сила '%s'.", err, opts.AntiFingerprintStrength)
+		}
+	}
+	if value := getEnv("OVERLAY_POSITION", ""); value != "" {
+		if position, err := services.ParseOverlayPosition(value); err == nil {
+			opts.Overlay.Position = position
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: OVERLAY_POSITION: %v. Используется расположение '%s'.", err, opts.Overlay.Position)
+		}
+	}
+	if value := getEnv("OVERLAY_OPACITY", ""); value != "" {
+		if opacity, err := services.ParseOverlayOpacity(value); err == nil {
+			opts.Overlay.Opacity = opacity
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: OVERLAY_OPACITY: %v. Используется непрозрачность %.0f%%.", err, opts.Overlay.Opacity*100)
+		}
+	}
+	if value := getEnv("RESIZE_PRESET", ""); value != "" {
+		if edge, err := services.ParseResizePreset(value); err == nil {
+			opts.MaxLongEdge = edge
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: RESIZE_PRESET: %v. Изображения не уменьшаются.", err)
+		}
+	}
+	// Явно заданная длинная сторона имеет приоритет над вариантом.
+	if value := getEnv("MAX_LONG_EDGE", ""); value != "" {
+		if edge, err := services.ParseMaxLongEdge(value); err == nil {
+			opts.MaxLongEdge = edge
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: MAX_LONG_EDGE: %v. Используется %d.", err, opts.MaxLongEdge)
+		}
+	}
+	opts.Scrub.ReduceDepth = boolFromEnv("DEEP_SCRUB_REDUCE_DEPTH", opts.Scrub.ReduceDepth)
+	opts.Scrub.RandomizeLSB = boolFromEnv("DEEP_SCRUB_RANDOMIZE_LSB", opts.Scrub.RandomizeLSB)
+	opts.MaxWidth = int(intFromEnv("MAX_IMAGE_WIDTH", int64(opts.MaxWidth)))
+	opts.MaxHeight = int(intFromEnv("MAX_IMAGE_HEIGHT", int64(opts.MaxHeight)))
+	opts.MaxPixels = intFromEnv("MAX_IMAGE_PIXELS", opts.MaxPixels)
+	return opts
+}
+
+// intFromEnv читает неотрицательное целое число из переменной окружения key.
+// Если переменная не задана или содержит некорректное значение, возвращает fallback.
+func intFromEnv(key string, fallback int64) int64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: %s: некорректное значение '%s'. Используется %d.", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// cleanModeFromEnv читает режим очистки из переменной окружения key.
+// Если переменная не задана или содержит некорректное значение, возвращает fallback.
+func cleanModeFromEnv(key string, fallback services.CleanMode) services.CleanMode {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	mode, err := services.ParseCleanMode(value)
+	if err != nil {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: %s: %v. Используется режим '%s'.", key, err, fallback)
+		return fallback
+	}
+	return mode
+}
+
+// boolFromEnv читает логическое значение (true/false, 1/0) из переменной окружения key.
+// Если переменная не задана или содержит некорректное значение, возвращает fallback.
+func boolFromEnv(key string, fallback bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: %s: некорректное значение '%s'. Используется %t.", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+// applyFormOutputPolicy переопределяет политику сохранения значениями из формы загрузки.
+// Пустые поля означают "как настроено на сервере". Некорректные значения возвращаются
+// ошибкой с текстом для пользователя.
+func applyFormOutputPolicy(c *gin.Context, opts *services.ProcessOptions) error {
+	if value := c.PostForm("output_policy"); value != "" {
+		policy, err := services.ParseOutputPolicy(value)
+		if err != nil {
+			return fmt.Errorf("Некорректный формат сохранения: %s", value)
+		}
+		opts.OutputPolicy = policy
+	}
+	if value := c.PostForm("jpeg_quality"); value != "" {
+		quality, err := services.ParseJPEGQuality(value)
+		if err != nil {
+			return errors.New("Качество JPEG должно быть числом от 1 до 100.")
+		}
+		opts.JPEGQuality = quality
+	}
+	if value := c.PostForm("png_compression"); value != "" {
+		level, err := services.ParsePNGCompression(value)
+		if err != nil {
+			return fmt.Errorf("Некорректный уровень сжатия PNG: %s", value)
+		}
+		opts.PNGCompression = level
+	}
+	if c.PostForm("jpeg_progressive") != "" {
+		opts.JPEGProgressive = true
+	}
+	return nil
+}
+
 // ShowLoginPage отображает страницу входа.
 // Больше не обрабатывает flash-сообщения.
 func ShowLoginPage(c *gin.Context) {
@@ -178,6 +368,42 @@ func HandleLogin(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/upload") // Редирект на страницу загрузки
 }
 
+// uploadResult - результат обработки одного успешно загруженного файла.
+// Используется и в шаблоне upload.html, и в JSON-ответе API.
+type uploadResult struct {
+	Filename string                   `json:"filename"`         // Оригинальное имя файла
+	URL      string                   `json:"url"`              // Одноразовая ссылка для просмотра
+	Report   *services.MetadataReport `json:"report,omitempty"` // Отчет о найденных и удаленных метаданных
+}
+
+// uploadItem - файл для обработки: загруженный напрямую или изображение из ZIP-архива.
+type uploadItem struct {
+	name   string                 // Имя для сообщений и отчета (для архива - "архив.zip/путь")
+	header *multipart.FileHeader  // Загруженный файл (nil для изображения из архива)
+	entry  *services.ArchiveEntry // Изображение из архива
+}
+
+// renderUploadPage отображает страницу загрузки с результатами.
+// Если клиент запросил JSON (заголовок Accept: application/json), те же данные
+// возвращаются в виде JSON - так загрузкой можно пользоваться как API.
+func renderUploadPage(c *gin.Context, status int, title, username string, errors []string, results []uploadResult) {
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(status, gin.H{
+			"errors":  errors,
+			"results": results,
+		})
+		return
+	}
+	c.HTML(status, "upload.html", gin.H{
+		"title":     title,
+		"username":  username,
+		"errors":    errors,
+		"results":   results,
+		"watermark": services.WatermarkAvailable(),
+		"faces":     services.FaceDetectionAvailable(),
+	})
+}
+
 // ShowUploadPage отображает страницу загрузки (без flash).
 func ShowUploadPage(c *gin.Context) {
 	session := sessions.Default(c) // Нужна только для получения username
@@ -185,10 +411,12 @@ func ShowUploadPage(c *gin.Context) {
 	usernameStr, _ := username.(string)
 
 	c.HTML(http.StatusOK, "upload.html", gin.H{
-		"title":        "Загрузка изображения",
-		"username":     usernameStr,
-		"errors":       nil, // Нет ошибок при GET
-		"success_urls": nil, // Нет URL при GET
+		"title":     "Загрузка изображения",
+		"username":  usernameStr,
+		"errors":    nil, // Нет ошибок при GET
+		"results":   nil, // Нет результатов при GET
+		"watermark": services.WatermarkAvailable(),
+		"faces":     services.FaceDetectionAvailable(),
 	})
 }
 
@@ -222,109 +450,350 @@ func HandleUpload(c *gin.Context) {
 		} else if strings.Contains(err.Error(), "multipart: NextPart") || strings.Contains(err.Error(), "unexpected EOF") || strings.Contains(err.Error(), "EOF") {
 			errorMsg = fmt.Sprintf("Ошибка чтения данных файла. Возможно, один из файлов слишком большой (макс. %d MB на файл) или произошла ошибка передачи.", MaxUploadSize/1024/1024)
 		}
-		c.HTML(http.StatusBadRequest, "upload.html", gin.H{
-			"title":        "Ошибка загрузки",
-			"username":     usernameStr,
-			"errors":       []string{errorMsg},
-			"success_urls": nil,
-		})
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{errorMsg}, nil)
 		return
 	}
 
 	files := c.Request.MultipartForm.File["imagefiles"]
 
 	if len(files) == 0 {
-		c.HTML(http.StatusBadRequest, "upload.html", gin.H{
-			"title":        "Ошибка загрузки",
-			"username":     usernameStr,
-			"errors":       []string{"Вы не выбрали ни одного файла."},
-			"success_urls": nil,
-		})
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Вы не выбрали ни одного файла."}, nil)
 		return
 	}
 	if len(files) > MaxFiles {
-		c.HTML(http.StatusBadRequest, "upload.html", gin.H{
-			"title":        "Ошибка загрузки",
-			"username":     usernameStr,
-			"errors":       []string{fmt.Sprintf("Можно загрузить не более %d файлов одновременно.", MaxFiles)},
-			"success_urls": nil,
-		})
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{fmt.Sprintf("Можно загрузить не более %d файлов одновременно.", MaxFiles)}, nil)
 		return
 	}
 
 	// --- Обработка каждого файла ---
-	var successURLs []string
+	var results []uploadResult
 	var errorMessages []string
 	uploadPath := getEnv("UPLOAD_PATH", "/app/uploads")
 	baseURL := getEnv("BASE_URL", "")
+	processOpts := processOptionsFromEnv()
+	// Параметры сохранения, выбранные в форме, имеют приоритет над настройками сервера.
+	if errForm := applyFormOutputPolicy(c, &processOpts); errForm != nil {
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{errForm.Error()}, nil)
+		return
+	}
+	// Автоматическое размытие лиц требует загруженного каскада детектора.
+	if c.PostForm("blur_faces") != "" {
+		if !services.FaceDetectionAvailable() {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Автоматическое размытие лиц недоступно на этом сервере. Файлы не загружены."}, nil)
+			return
+		}
+		processOpts.BlurFaces = true
+	}
+	// Глубокая очистка пикселей: форма может только включить ее (но не выключить, если она
+	// включена на сервере). Дополнительные режимы без основного не имеют смысла и включают его.
+	if c.PostForm("deep_scrub") != "" {
+		processOpts.Scrub.Enabled = true
+	}
+	if c.PostForm("scrub_reduce_depth") != "" {
+		processOpts.Scrub.Enabled = true
+		processOpts.Scrub.ReduceDepth = true
+	}
+	if c.PostForm("scrub_randomize_lsb") != "" {
+		processOpts.Scrub.Enabled = true
+		processOpts.Scrub.RandomizeLSB = true
+	}
+	// Точность сохраняемых координат (пустое значение - настройка сервера).
+	if value := c.PostForm("gps_precision"); value != "" {
+		precision, errPrecision := services.ParseGPSPrecision(value)
+		if errPrecision != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Некорректная точность координат: " + value}, nil)
+			return
+		}
+		processOpts.GPSPrecision = precision
+	}
+	// Подавление отпечатка сенсора камеры; сила по умолчанию задается на сервере.
+	if c.PostForm("anti_fingerprint") != "" {
+		processOpts.AntiFingerprint = true
+	}
+	if value := c.PostForm("anti_fingerprint_strength"); value != "" {
+		strength, errStrength := services.ParseFingerprintStrength(value)
+		if errStrength != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Некорректная сила защиты от идентификации камеры: " + value}, nil)
+			return
+		}
+		processOpts.AntiFingerprintStrength = strength
+	}
+	// Ограничение размера: вариант ("chat", "screen", "original") или длинная сторона
+	// в пикселях (имеет приоритет). Пустые значения - настройка сервера.
+	if value := c.PostForm("resize"); value != "" {
+		edge, errResize := services.ParseResizePreset(value)
+		if errResize != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Некорректный размер: " + value}, nil)
+			return
+		}
+		processOpts.MaxLongEdge = edge
+	}
+	if value := c.PostForm("max_long_edge"); value != "" {
+		edge, errEdge := services.ParseMaxLongEdge(value)
+		if errEdge != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{errEdge.Error()}, nil)
+			return
+		}
+		processOpts.MaxLongEdge = edge
+	}
+	// Невидимый водяной знак: форма может только включить его (как и глубокую очистку).
+	if c.PostForm("watermark") != "" {
+		processOpts.Watermark = true
+	}
+	if processOpts.Watermark && !services.WatermarkAvailable() {
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Невидимый водяной знак недоступен на этом сервере. Файлы не загружены."}, nil)
+		return
+	}
+	// Растеризация SVG в PNG вместо сохранения очищенного SVG.
+	if c.PostForm("svg_rasterize") != "" {
+		processOpts.SVGRasterize = true
+	}
+	// Видимая надпись (например, имя получателя и дата); расположение и непрозрачность
+	// по умолчанию задаются на сервере.
+	overlayText, errOverlay := services.NormalizeOverlayText(c.PostForm("overlay_text"))
+	if errOverlay != nil {
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Надпись: " + errOverlay.Error()}, nil)
+		return
+	}
+	processOpts.Overlay.Text = overlayText
+	if value := c.PostForm("overlay_position"); value != "" {
+		position, errPosition := services.ParseOverlayPosition(value)
+		if errPosition != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Некорректное расположение надписи: " + value}, nil)
+			return
+		}
+		processOpts.Overlay.Position = position
+	}
+	if value := c.PostForm("overlay_opacity"); value != "" {
+		opacity, errOpacity := services.ParseOverlayOpacity(value)
+		if errOpacity != nil {
+			renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Некорректная непрозрачность надписи: " + value}, nil)
+			return
+		}
+		processOpts.Overlay.Opacity = opacity
+	}
+	// Список разрешенных полей метаданных: у пользователя может быть свой список,
+	// заданный администратором; иначе действует глобальный (METADATA_ALLOWLIST).
+	if value, ok, errAllow := database.GetUserMetadataAllowlist(userID64); errAllow != nil {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ: не удалось получить список разрешенных метаданных userID %d: %v. Используется глобальный список.", userID64, errAllow)
+	} else if ok {
+		if allowlist, errParse := services.ParseMetadataAllowlist(value); errParse == nil {
+			processOpts.MetadataAllowlist = allowlist
+		} else {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ: некорректный список разрешенных метаданных userID %d: %v. Используется глобальный список.", userID64, errParse)
+		}
+	}
+	// Области скрытия задаются JSON-объектом, ключ - исходное имя файла.
+	redactions, errRedact := services.ParseRedactions(c.PostForm("redactions"))
+	if errRedact != nil {
+		log.Printf("Некорректные области скрытия от userID %d: %v", userID64, errRedact)
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{"Области скрытия: " + errRedact.Error()}, nil)
+		return
+	}
+	// ZIP-архивы заменяются изображениями из них: каждое обрабатывается как отдельный файл
+	// и получает свою ссылку. Количество файлов в архиве ограничено (ARCHIVE_MAX_ENTRIES),
+	// размер каждого после распаковки - так же, как размер загруженного файла.
+	// Все файлы обрабатываются в рамках запроса, поэтому общее количество изображений
+	// в загрузке ограничено отдельно и меньшим значением (UPLOAD_MAX_ITEMS): иначе один
+	// запрос держал бы обработчик на время обработки MaxFiles x ARCHIVE_MAX_ENTRIES файлов.
+	archiveLimits := services.ArchiveLimits{
+		MaxEntries:   int(intFromEnv("ARCHIVE_MAX_ENTRIES", services.DefaultArchiveMaxEntries)),
+		MaxEntrySize: MaxUploadSize,
+	}
+	maxItems := int(intFromEnv("UPLOAD_MAX_ITEMS", DefaultMaxUploadItems))
+	if maxItems < 1 {
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ КОНФИГУРАЦИИ: UPLOAD_MAX_ITEMS: значение должно быть не меньше 1. Используется %d.", DefaultMaxUploadItems)
+		maxItems = DefaultMaxUploadItems
+	}
+	var items []uploadItem
+	for _, fileHeader := range files {
+		if fileHeader.Size > 0 && fileHeader.Size <= MaxUploadSize {
+			archive, errArchive := services.OpenImageArchive(fileHeader, archiveLimits)
+			if errArchive != nil {
+				log.Printf("Архив '%s' от userID %d отклонен: %v", fileHeader.Filename, userID64, errArchive)
+				errMsg := "Не удалось прочитать ZIP-архив или архив поврежден."
+				if errors.Is(errArchive, services.ErrArchiveLimit) {
+					errMsg = errArchive.Error() + "."
+				}
+				errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': %s", fileHeader.Filename, errMsg))
+				continue
+			}
+			if archive != nil {
+				log.Printf("Архив '%s': изображений %d, пропущено файлов %d (UserID: %d)", fileHeader.Filename, len(archive.Entries), len(archive.Skipped), userID64)
+				errorMessages = append(errorMessages, archive.Skipped...)
+				if len(archive.Entries) == 0 {
+					errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': в архиве нет изображений.", fileHeader.Filename))
+				}
+				for _, entry := range archive.Entries {
+					items = append(items, uploadItem{name: entry.Name, entry: entry})
+				}
+				continue
+			}
+		}
+		items = append(items, uploadItem{name: fileHeader.Filename, header: fileHeader})
+	}
+	// Архивы на этом этапе только прочитаны (каждый не больше MaxUploadSize), изображения
+	// из них еще не распакованы, поэтому загрузка отклоняется целиком до обработки.
+	if len(items) > maxItems {
+		log.Printf("Загрузка от userID %d отклонена: %d файлов с учетом архивов, допустимо %d", userID64, len(items), maxItems)
+		renderUploadPage(c, http.StatusBadRequest, "Ошибка загрузки", usernameStr, []string{fmt.Sprintf("Слишком много файлов: с учетом содержимого архивов загружено %d, за одну загрузку можно обработать не более %d.", len(items), maxItems)}, nil)
+		return
+	}
+
+	// Если область указана для файла, которого нет среди загруженных, пользователь
+	// должен об этом узнать: иначе он будет считать, что данные скрыты.
+	// Для изображения из архива имя файла - "архив.zip/путь/в/архиве.jpg".
+	uploadedNames := make(map[string]bool, len(items))
+	for _, item := range items {
+		uploadedNames[item.name] = true
+	}
+	for name := range redactions {
+		if !uploadedNames[name] {
+			errorMessages = append(errorMessages, fmt.Sprintf("Области скрытия указаны для файла '%s', который не был загружен.", name))
+		}
+	}
 
 	if baseURL == "" {
 		log.Printf("КРИТИЧЕСКАЯ ОШИБКА КОНФИГУРАЦИИ: Переменная окружения BASE_URL не установлена!")
 		errorMessages = append(errorMessages, "Ошибка конфигурации сервера: невозможно сгенерировать ссылки.")
 	}
 
-	for _, fileHeader := range files {
-		log.Printf("Обработка файла: %s, Размер: %d байт (UserID: %d)",
-			fileHeader.Filename, fileHeader.Size, userID64)
+	for _, item := range items {
+		if fileHeader := item.header; fileHeader != nil {
+			log.Printf("Обработка файла: %s, Размер: %d байт (UserID: %d)",
+				fileHeader.Filename, fileHeader.Size, userID64)
+
+			if fileHeader.Size == 0 {
+				errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': пустой и не будет обработан.", fileHeader.Filename))
+				continue
+			}
+			if fileHeader.Size > MaxUploadSize {
+				errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': слишком большой (%.2f MB > %.2f MB).", fileHeader.Filename, float64(fileHeader.Size)/1024/1024, float64(MaxUploadSize)/1024/1024))
+				continue
+			}
+		} else {
+			log.Printf("Обработка файла из архива: %s (UserID: %d)", item.name, userID64)
+		}
 
-		if fileHeader.Size == 0 {
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': пустой и не будет обработан.", fileHeader.Filename))
-			continue
+		fileOpts := processOpts
+		fileOpts.Redactions = redactions[item.name]
+		if fileOpts.Watermark {
+			fileOpts.WatermarkID = services.NewWatermarkID() // Свой идентификатор у каждой ссылки
 		}
-		if fileHeader.Size > MaxUploadSize {
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': слишком большой (%.2f MB > %.2f MB).", fileHeader.Filename, float64(fileHeader.Size)/1024/1024, float64(MaxUploadSize)/1024/1024))
-			continue
+		var storedFilename string
+		var report *services.MetadataReport
+		var errProc error
+		if item.entry != nil {
+			// Изображение распаковывается только сейчас: в памяти одновременно находится одно.
+			var data []byte
+			if data, errProc = item.entry.Read(); errProc == nil {
+				storedFilename, report, errProc = services.ProcessAndSaveData(item.name, data, uploadPath, fileOpts)
+			}
+		} else {
+			storedFilename, report, errProc = services.ProcessAndSaveImage(item.header, uploadPath, fileOpts)
 		}
-
-		storedFilename, errProc := services.ProcessAndSaveImage(fileHeader, uploadPath)
 		if errProc != nil {
-			log.Printf("Ошибка обработки/сохранения файла '%s' для userID %d: %v", fileHeader.Filename, userID64, errProc)
+			// Совпадение со списком блокировки записывается в журнал (само изображение не сохраняется).
+			var blocked *services.BlockedContentError
+			if errors.As(errProc, &blocked) {
+				log.Printf("ПРЕДУПРЕЖДЕНИЕ: файл '%s' от userID %d (%s) отклонен по списку блокировки: %v", item.name, userID64, usernameStr, errProc)
+				if errAudit := database.RecordBlockedUpload(userID64, usernameStr, item.name, blocked.Hash, blocked.Matched, blocked.Label, blocked.Distance); errAudit != nil {
+					log.Printf("КРИТИЧЕСКАЯ ОШИБКА: %v", errAudit)
+				}
+				errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': отклонен правилами сервиса.", item.name))
+				continue
+			}
+			log.Printf("Ошибка обработки/сохранения файла '%s' для userID %d: %v", item.name, userID64, errProc)
 			errMsg := "Ошибка обработки файла."
-			if strings.Contains(errProc.Error(), "Недопустимый тип файла") { errMsg = "Недопустимый тип файла (разрешены JPEG, PNG, GIF)." }
-			if strings.Contains(errProc.Error(), "Не удалось декодировать") { errMsg = "Не удалось распознать формат файла или файл поврежден." }
-			if strings.Contains(errProc.Error(), "не удалось создать файл") { errMsg = "Внутренняя ошибка сервера при сохранении файла." }
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': %s", fileHeader.Filename, errMsg))
+			if strings.Contains(errProc.Error(), "недопустимый тип файла") {
+				errMsg = "Недопустимый тип файла (разрешены JPEG, PNG, GIF, WebP, BMP, TIFF, SVG, PDF, DOCX, XLSX, PPTX, MP3, FLAC, OGG и ZIP-архивы с изображениями)."
+			}
+			if errors.Is(errProc, services.ErrInvalidSVG) {
+				errMsg = "Не удалось разобрать SVG или файл поврежден."
+			}
+			if errors.Is(errProc, services.ErrInvalidPDF) {
+				errMsg = "Не удалось разобрать PDF или файл поврежден."
+			}
+			if errors.Is(errProc, services.ErrEncryptedPDF) {
+				errMsg = "Зашифрованные PDF (защищенные паролем) не поддерживаются."
+			}
+			if errors.Is(errProc, services.ErrInvalidOOXML) {
+				errMsg = "Не удалось разобрать документ Office или файл поврежден."
+			}
+			if errors.Is(errProc, services.ErrOOXMLMacros) {
+				errMsg = "Документы Office с макросами (DOCM, XLSM, PPTM) не поддерживаются."
+			}
+			if errors.Is(errProc, services.ErrInvalidAudio) {
+				errMsg = "Не удалось разобрать аудиофайл или файл поврежден (поддерживаются MP3, FLAC, Ogg Vorbis и Ogg Opus)."
+			}
+			if errors.Is(errProc, services.ErrInvalidArchive) {
+				errMsg = "Не удалось распаковать файл из архива: архив поврежден."
+			}
+			if errors.Is(errProc, services.ErrArchiveLimit) {
+				errMsg = errProc.Error() + "."
+			}
+			if strings.Contains(errProc.Error(), "не удалось декодировать") {
+				errMsg = "Не удалось распознать формат файла или файл поврежден."
+			}
+			if strings.Contains(errProc.Error(), "не удалось создать файл") {
+				errMsg = "Внутренняя ошибка сервера при сохранении файла."
+			}
+			// Ошибки ограничений содержат понятное пользователю описание (размеры, объем памяти).
+			if errors.Is(errProc, services.ErrImageTooLarge) || errors.Is(errProc, services.ErrServerBusy) || errors.Is(errProc, services.ErrFaceDetectionUnavailable) {
+				errMsg = errProc.Error() + "."
+			}
+			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': %s", item.name, errMsg))
+			continue
+		}
+
+		// Независимая проверка: сохраненный файл перечитывается с диска и проверяется
+		// на остатки метаданных. Ссылка и запись в БД создаются только для чистых файлов.
+		if errVerify := services.VerifyCleanFile(filepath.Join(uploadPath, storedFilename), fileOpts); errVerify != nil {
+			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: файл '%s' userID %d не прошел проверку очистки, ссылка не создана: %v", item.name, userID64, errVerify)
+			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': не прошел проверку очистки метаданных, ссылка не создана.", item.name))
+			cleanupFile(filepath.Join(uploadPath, storedFilename))
 			continue
 		}
 
 		accessToken, errToken := services.GenerateSecureToken(32)
 		if errToken != nil {
-			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: не удалось сгенерировать токен для файла '%s' userID %d: %v", fileHeader.Filename, userID64, errToken)
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': Внутренняя ошибка сервера (токен).", fileHeader.Filename))
+			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: не удалось сгенерировать токен для файла '%s' userID %d: %v", item.name, userID64, errToken)
+			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': Внутренняя ошибка сервера (токен).", item.name))
 			cleanupFile(filepath.Join(uploadPath, storedFilename))
 			continue
 		}
 
-		imageID, errDB := database.CreateImageRecord(userID64, fileHeader.Filename, storedFilename, accessToken)
+		// Идентификатор водяного знака сохраняется, только если знак действительно встроен
+		// (GIF и слишком маленькие изображения сохраняются без него).
+		var watermarkID uint32
+		if report.Watermarked {
+			watermarkID = fileOpts.WatermarkID
+		}
+		imageID, errDB := database.CreateImageRecord(userID64, item.name, storedFilename, accessToken, watermarkID, report.Width, report.Height)
 		if errDB != nil {
-			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: не удалось сохранить запись в БД для файла '%s' userID %d: %v", fileHeader.Filename, userID64, errDB)
+			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: не удалось сохранить запись в БД для файла '%s' userID %d: %v", item.name, userID64, errDB)
 			errMsg := "Внутренняя ошибка сервера (БД)."
 			if strings.Contains(errDB.Error(), "конфликт") { errMsg = "Внутренняя ошибка сервера (конфликт данных)." }
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': %s", fileHeader.Filename, errMsg))
+			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': %s", item.name, errMsg))
 			cleanupFile(filepath.Join(uploadPath, storedFilename))
 			continue
 		}
 
 		if baseURL != "" {
 			viewURL := fmt.Sprintf("%s/view/%s", baseURL, accessToken)
-			successURLs = append(successURLs, viewURL)
-			log.Printf("Файл '%s' (ID: %d) успешно обработан userID %d. URL: %s", fileHeader.Filename, imageID, userID64, viewURL)
+			results = append(results, uploadResult{Filename: item.name, URL: viewURL, Report: report})
+			log.Printf("Файл '%s' (ID: %d) успешно обработан userID %d. URL: %s", item.name, imageID, userID64, viewURL)
 		} else {
-			log.Printf("Файл '%s' (ID: %d) успешно обработан userID %d, но URL не сформирован (BASE_URL не задан).", fileHeader.Filename, imageID, userID64)
-			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': успешно загружен, но ссылка не создана (ошибка конфигурации).", fileHeader.Filename))
+			log.Printf("Файл '%s' (ID: %d) успешно обработан userID %d, но URL не сформирован (BASE_URL не задан).", item.name, imageID, userID64)
+			errorMessages = append(errorMessages, fmt.Sprintf("Файл '%s': успешно загружен, но ссылка не создана (ошибка конфигурации).", item.name))
 		}
 	} // Конец цикла for по файлам
 
 	log.Printf("Завершена обработка %d файлов для userID %d. Успешно с URL: %d, Ошибки: %d.",
-		len(files), userID64, len(successURLs), len(errorMessages))
+		len(items), userID64, len(results), len(errorMessages))
 
 	// --- ОТРИСОВКА РЕЗУЛЬТАТА ---
-	c.HTML(http.StatusOK, "upload.html", gin.H{
-		"title":        "Результаты загрузки",
-		"username":     usernameStr,
-		"errors":       errorMessages,
-		"success_urls": successURLs,
-	})
+	renderUploadPage(c, http.StatusOK, "Результаты загрузки", usernameStr, errorMessages, results)
 }
 
 // HandleLogout использует редирект
@@ -345,6 +814,38 @@ func HandleLogout(c *gin.Context) {
 }
 
 
+// HandleMetrics отдает метрики в текстовом формате Prometheus.
+// Доступ только с заголовком "Authorization: Bearer <METRICS_TOKEN>";
+// если METRICS_TOKEN не задан, метрики отключены (404).
+func HandleMetrics(c *gin.Context) {
+	token := getEnv("METRICS_TOKEN", "")
+	if token == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	stats := services.BlocklistMetrics()
+	enabled := 0
+	if stats.Enabled {
+		enabled = 1
+	}
+	var b strings.Builder
+	writeMetric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+	writeMetric("imagecleaner_blocklist_enabled", "gauge", "Whether the perceptual hash blocklist is loaded.", int64(enabled))
+	writeMetric("imagecleaner_blocklist_entries", "gauge", "Number of hashes in the loaded blocklist.", int64(stats.Entries))
+	writeMetric("imagecleaner_blocklist_checks_total", "counter", "Images checked against the blocklist.", stats.Checks)
+	writeMetric("imagecleaner_blocklist_matches_total", "counter", "Images rejected because they matched the blocklist.", stats.Matches)
+	writeMetric("imagecleaner_blocklist_reloads_total", "counter", "Successful blocklist loads.", stats.Reloads)
+	writeMetric("imagecleaner_blocklist_reload_errors_total", "counter", "Failed blocklist loads.", stats.ReloadErrors)
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
 // cleanupFile - вспомогательная функция для удаления файла по полному пути.
 func cleanupFile(fullPath string) {
 	if fullPath != "" {
@@ -431,7 +932,8 @@ func HandleConfirmView(c *gin.Context) {
 	filePath := filepath.Join(uploadPath, img.StoredFilename)
 
 	// 4.1 Проверяем существование файла
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	fileInfo, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
 		log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Файл %s не найден на диске для токена %s (ImageID: %d)!", filePath, token, img.ID)
 		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"title": "Ошибка сервера", "message": "Ошибка: файл изображения не найден на сервере."})
 		c.Abort()
@@ -447,10 +949,46 @@ func HandleConfirmView(c *gin.Context) {
 	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate, max-age=0")
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
+	// Content-Type задается явно по расширению сохраненного файла (оно соответствует
+	// формату сохранения), чтобы не зависеть от mime-таблиц системы и не допускать
+	// "угадывания" типа браузером.
+	contentType := services.ContentTypeForFilename(img.StoredFilename)
+	inlineAudio := strings.HasPrefix(contentType, "audio/") &&
+		fileInfo.Size() <= intFromEnv("AUDIO_INLINE_MAX_MB", DefaultAudioInlineMaxMB)<<20
+	if inlineAudio {
+		// 4.3 Аудиофайл показывается на странице с проигрывателем. Файл встраивается в страницу
+		//     (data:-адрес), поэтому отдельной ссылки на него нет: после просмотра страницы
+		//     он удаляется так же, как изображение. Большие файлы (см. DefaultAudioInlineMaxMB)
+		//     отдаются напрямую в ветке ниже.
+		audio, errRead := os.ReadFile(filePath)
+		if errRead != nil {
+			log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Ошибка чтения файла %s для токена %s (ImageID: %d): %v", filePath, token, img.ID, errRead)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{"title": "Ошибка сервера", "message": "Ошибка доступа к файлу на сервере."})
+			c.Abort()
+			return
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		// Странице нужны только стили и сам аудиофайл.
+		c.Header("Content-Security-Policy", "default-src 'none'; media-src data:; style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; font-src https://cdn.jsdelivr.net")
+		log.Printf("Отправка страницы проигрывателя для файла %s клиенту (Token: %s, ImageID: %d)", filePath, token, img.ID)
+		c.HTML(http.StatusOK, "audio_view.html", gin.H{
+			"title":     "Прослушивание",
+			"audioType": contentType,
+			"audioSrc":  template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(audio)),
+		})
+	} else {
+		c.Header("Content-Type", contentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		// SVG открывается браузером как документ: даже после очистки запрещаем скрипты,
+		// внешние ресурсы и переходы (разрешены только встроенные стили и data:-изображения).
+		if contentType == "image/svg+xml" {
+			c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox")
+		}
 
-	log.Printf("Отправка файла %s клиенту (Token: %s, ImageID: %d)", filePath, token, img.ID)
-	// 4.3 Отправляем файл
-	c.File(filePath)
+		log.Printf("Отправка файла %s клиенту (Token: %s, ImageID: %d)", filePath, token, img.ID)
+		// 4.3 Отправляем файл
+		c.File(filePath)
+	}
 
 	// 5. Запускаем удаление файла в горутине
 	go func(pathToDelete string, imageID int64, tokenToDelete string) {
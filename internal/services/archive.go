@@ -0,0 +1,235 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"archive/zip"    // Для чтения ZIP-архивов
+	"bytes"          // Для чтения архива из памяти и проверки сигнатур
+	"errors"         // Для определения ошибок
+	"fmt"            // Для форматирования ошибок
+	"io"             // Для чтения файлов архива с ограничением
+	"mime/multipart" // Для загруженного файла
+	"path"           // Для имен файлов внутри архива
+	"strings"        // Для проверки путей
+)
+
+// Загрузка ZIP-архивов с изображениями.
+//
+// Архив не распаковывается на диск: он целиком находится в памяти (его размер ограничен
+// так же, как размер любого загруженного файла), а изображения распаковываются по одному
+// непосредственно перед обработкой (ProcessAndSaveData). Имена файлов в архиве нигде
+// не используются как пути - только для показа пользователю, поэтому "../" в имени не
+// может вывести запись за пределы каталога загрузок; такие файлы все равно пропускаются
+// как признак вредоносного архива.
+// Защита от "zip-бомб" не полагается на размеры, объявленные в архиве: распакованные
+// данные читаются с ограничением, а ограничены и размер каждого файла, и суммарный
+// объем распакованных данных, и количество файлов. Вложенные архивы не распаковываются.
+
+// ErrInvalidArchive - архив не удалось прочитать.
+var ErrInvalidArchive = errors.New("некорректный ZIP-архив")
+
+// ErrArchiveLimit - архив превышает ограничения (количество файлов, объем распакованных
+// данных). Текст ошибки понятен пользователю и показывается как есть.
+var ErrArchiveLimit = errors.New("архив превышает ограничения")
+
+const (
+	// DefaultArchiveMaxEntries - максимальное количество файлов в архиве по умолчанию
+	// (переопределяется переменной окружения ARCHIVE_MAX_ENTRIES).
+	DefaultArchiveMaxEntries = 100
+	archiveMaxUnpacked       = 256 << 20 // Суммарный объем распакованных данных одного архива
+)
+
+// ArchiveLimits - ограничения распаковки архива.
+type ArchiveLimits struct {
+	MaxEntries   int   // Максимальное количество файлов в архиве (0 - архивы не принимаются)
+	MaxEntrySize int64 // Максимальный размер файла после распаковки
+}
+
+// ImageArchive - загруженный ZIP-архив с изображениями.
+type ImageArchive struct {
+	Entries  []*ArchiveEntry // Изображения в порядке следования в архиве
+	Skipped  []string        // Пропущенные файлы с причиной (для показа пользователю)
+	limits   ArchiveLimits
+	unpacked int64 // Распаковано байт (для archiveMaxUnpacked)
+}
+
+// ArchiveEntry - изображение в архиве.
+type ArchiveEntry struct {
+	Name    string // Имя для показа: имя архива и путь внутри него
+	file    *zip.File
+	archive *ImageArchive
+}
+
+// archiveJunkNames - служебные файлы, которые добавляют архиваторы и файловые менеджеры;
+// они пропускаются без сообщения.
+var archiveJunkNames = map[string]bool{
+	".ds_store":   true,
+	"thumbs.db":   true,
+	"desktop.ini": true,
+}
+
+// OpenImageArchive открывает загруженный файл как ZIP-архив с изображениями.
+// Если файл не является ZIP-архивом (в том числе если это документ Office, который
+// тоже хранится в ZIP), возвращает nil без ошибки: файл обрабатывается как обычно.
+func OpenImageArchive(fileHeader *multipart.FileHeader, limits ArchiveLimits) (*ImageArchive, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть загруженный файл '%s': %w", fileHeader.Filename, err)
+	}
+	defer file.Close()
+
+	// Размер загруженного файла ограничен в хендлере, поэтому архив читается целиком.
+	signature := make([]byte, 4)
+	if _, err := io.ReadFull(file, signature); err != nil || !bytes.Equal(signature, []byte("PK\x03\x04")) {
+		return nil, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("не удалось сбросить указатель чтения файла '%s' в начало: %w", fileHeader.Filename, err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл '%s': %w", fileHeader.Filename, err)
+	}
+	if detectOOXMLContentType(data) != "" {
+		return nil, nil
+	}
+	if limits.MaxEntries <= 0 {
+		return nil, fmt.Errorf("%w: загрузка архивов отключена", ErrArchiveLimit)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) { // Небезопасные пути проверяются ниже по каждому файлу
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	// Количество файлов проверяется до распаковки.
+	var files []*zip.File
+	for _, f := range reader.File {
+		if !f.FileInfo().IsDir() && !isArchiveJunk(f.Name) {
+			files = append(files, f)
+		}
+	}
+	if len(files) > limits.MaxEntries {
+		return nil, fmt.Errorf("%w: в архиве %d файлов, допустимо не больше %d", ErrArchiveLimit, len(files), limits.MaxEntries)
+	}
+
+	archive := &ImageArchive{limits: limits}
+	for _, f := range files {
+		name := fileHeader.Filename + "/" + strings.ToValidUTF8(f.Name, "?")
+		skip := func(reason string) {
+			archive.Skipped = append(archive.Skipped, fmt.Sprintf("Файл '%s': %s.", name, reason))
+		}
+		switch {
+		case !isSafeArchivePath(f.Name):
+			skip("небезопасный путь в архиве, файл пропущен")
+			continue
+		case f.Flags&0x1 != 0:
+			skip("зашифрован, файл пропущен")
+			continue
+		case f.Method != zip.Store && f.Method != zip.Deflate:
+			skip("неподдерживаемый метод сжатия, файл пропущен")
+			continue
+		case f.UncompressedSize64 > uint64(limits.MaxEntrySize):
+			skip(fmt.Sprintf("больше %.0f МБ после распаковки, файл пропущен", float64(limits.MaxEntrySize)/1024/1024))
+			continue
+		}
+
+		// Тип определяется по первым байтам файла, как и у загруженных файлов.
+		head, err := readArchiveHead(f)
+		if err != nil {
+			skip("не удалось распаковать, файл пропущен")
+			continue
+		}
+		contentType := detectImageContentType(head)
+		switch {
+		case isArchiveSignature(head, contentType):
+			skip("вложенные архивы не распаковываются")
+		case !AllowedImageTypes[contentType]:
+			skip("не является изображением поддерживаемого формата, файл пропущен")
+		default:
+			archive.Entries = append(archive.Entries, &ArchiveEntry{Name: name, file: f, archive: archive})
+		}
+	}
+	return archive, nil
+}
+
+// readArchiveHead распаковывает первые 512 байт файла для определения типа.
+func readArchiveHead(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// Read распаковывает изображение. Размер проверяется по фактически распакованным данным,
+// а не по размеру, объявленному в архиве.
+func (e *ArchiveEntry) Read() ([]byte, error) {
+	rc, err := e.file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, e.file.Name, err)
+	}
+	defer rc.Close()
+	limit := min(e.archive.limits.MaxEntrySize, archiveMaxUnpacked-e.archive.unpacked)
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	e.archive.unpacked += int64(len(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, e.file.Name, err)
+	}
+	if int64(len(data)) > e.archive.limits.MaxEntrySize {
+		return nil, fmt.Errorf("%w: файл больше %.0f МБ после распаковки", ErrArchiveLimit, float64(e.archive.limits.MaxEntrySize)/1024/1024)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: объем распакованных данных архива больше %d МБ", ErrArchiveLimit, archiveMaxUnpacked>>20)
+	}
+	return data, nil
+}
+
+// isArchiveJunk сообщает, является ли файл служебным (метаданные macOS, миниатюры Windows).
+func isArchiveJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || archiveJunkNames[strings.ToLower(path.Base(name))] || strings.HasPrefix(path.Base(name), "._")
+}
+
+// isSafeArchivePath проверяет имя файла в архиве: относительный путь без переходов
+// в родительский каталог, обратных косых черт и имен дисков Windows.
+func isSafeArchivePath(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) || len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// archiveSignatures - сигнатуры архивов, которые не определяет http.DetectContentType
+// (7z, xz, bzip2).
+var archiveSignatures = [][]byte{
+	[]byte("7z\xBC\xAF\x27\x1C"),
+	[]byte("\xFD7zXZ\x00"),
+	[]byte("BZh"),
+}
+
+// isArchiveSignature сообщает, является ли файл архивом (вложенным в загруженный архив).
+func isArchiveSignature(head []byte, contentType string) bool {
+	switch contentType {
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed":
+		return true
+	}
+	if len(head) >= 262 && string(head[257:262]) == "ustar" { // tar
+		return true
+	}
+	for _, sig := range archiveSignatures {
+		if bytes.HasPrefix(head, sig) {
+			return true
+		}
+	}
+	return false
+}
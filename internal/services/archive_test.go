@@ -0,0 +1,272 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"archive/tar"    // Для вложенного tar
+	"archive/zip"    // Для сборки архивов
+	"bytes"          // Для сборки файлов
+	"compress/flate" // Для записи файла с поддельным размером
+	"errors"         // Для проверки ошибок-маркеров
+	"hash/crc32"     // Для контрольной суммы файла с поддельным размером
+	"mime/multipart" // Для загруженного файла
+	"strings"        // Для проверки причин пропуска
+	"testing"        // Для тестов
+)
+
+// testZipEntry - файл тестового архива.
+type testZipEntry struct {
+	name  string
+	data  []byte
+	flags uint16 // Флаги заголовка (0x1 - зашифрован)
+}
+
+// testZip собирает ZIP-архив со сжатием Deflate.
+func testZip(t *testing.T, entries ...testZipEntry) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w := zip.NewWriter(&out)
+	for _, e := range entries {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Flags: e.flags})
+		if err != nil {
+			t.Fatalf("CreateHeader(%s): %v", e.name, err)
+		}
+		f.Write(e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip.Close: %v", err)
+	}
+	return out.Bytes()
+}
+
+// testZipForgedSize собирает архив с одним файлом, в заголовке которого объявлен
+// размер declared вместо настоящего.
+func testZipForgedSize(t *testing.T, name string, data []byte, declared uint64) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	fw.Write(data)
+	fw.Close()
+
+	var out bytes.Buffer
+	w := zip.NewWriter(&out)
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: declared,
+	})
+	if err != nil {
+		t.Fatalf("CreateRaw: %v", err)
+	}
+	f.Write(compressed.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip.Close: %v", err)
+	}
+	return out.Bytes()
+}
+
+// testFileHeader возвращает загруженный файл с заданным содержимым.
+func testFileHeader(t *testing.T, filename string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("files", filename)
+	part.Write(data)
+	mw.Close()
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(int64(body.Len()) + 1024)
+	if err != nil {
+		t.Fatalf("ReadForm: %v", err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files"][0]
+}
+
+// testArchiveLimits - ограничения для тестов: 5 файлов по 1 МБ.
+var testArchiveLimits = ArchiveLimits{MaxEntries: 5, MaxEntrySize: 1 << 20}
+
+func openTestArchive(t *testing.T, data []byte, limits ArchiveLimits) *ImageArchive {
+	t.Helper()
+	archive, err := OpenImageArchive(testFileHeader(t, "photos.zip", data), limits)
+	if err != nil {
+		t.Fatalf("OpenImageArchive: %v", err)
+	}
+	if archive == nil {
+		t.Fatalf("архив не распознан")
+	}
+	return archive
+}
+
+// checkSkipped проверяет, что файл name пропущен по причине reason.
+func checkSkipped(t *testing.T, archive *ImageArchive, name, reason string) {
+	t.Helper()
+	for _, skipped := range archive.Skipped {
+		if strings.Contains(skipped, "photos.zip/"+name+"'") {
+			if !strings.Contains(skipped, reason) {
+				t.Errorf("файл %q пропущен по другой причине: %s", name, skipped)
+			}
+			return
+		}
+	}
+	t.Errorf("файл %q не пропущен: %q", name, archive.Skipped)
+}
+
+func TestOpenImageArchive(t *testing.T) {
+	pngData := testPNG(t)
+	jpegData := testJPEG(t)
+	data := testZip(t,
+		testZipEntry{name: "a.png", data: pngData},
+		testZipEntry{name: "dir/b.jpg", data: jpegData},
+		testZipEntry{name: "__MACOSX/dir/._b.jpg", data: []byte("junk")},
+		testZipEntry{name: "Thumbs.db", data: []byte("junk")},
+		testZipEntry{name: "notes.txt", data: []byte("просто текст")},
+	)
+	archive := openTestArchive(t, data, testArchiveLimits)
+	if len(archive.Entries) != 2 {
+		t.Fatalf("изображений %d, ожидалось 2", len(archive.Entries))
+	}
+	for i, want := range [][]byte{pngData, jpegData} {
+		got, err := archive.Entries[i].Read()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("файл %s: %v", archive.Entries[i].Name, err)
+		}
+	}
+	if archive.Entries[1].Name != "photos.zip/dir/b.jpg" {
+		t.Errorf("имя %q", archive.Entries[1].Name)
+	}
+	// Служебные файлы пропускаются молча, остальные - с причиной.
+	if len(archive.Skipped) != 1 {
+		t.Errorf("пропущено %q, ожидался только notes.txt", archive.Skipped)
+	}
+	checkSkipped(t, archive, "notes.txt", "не является изображением")
+}
+
+func TestOpenImageArchiveUnsafePaths(t *testing.T) {
+	png := testPNG(t)
+	names := []string{"../escape.png", "a/../../escape.png", "/etc/abs.png", "C:/Windows/c.png", `dir\back.png`}
+	var entries []testZipEntry
+	for _, name := range names {
+		entries = append(entries, testZipEntry{name: name, data: png})
+	}
+	archive := openTestArchive(t, testZip(t, entries...), testArchiveLimits)
+	if len(archive.Entries) != 0 {
+		t.Errorf("приняты файлы с небезопасными путями: %d", len(archive.Entries))
+	}
+	for _, name := range names {
+		checkSkipped(t, archive, name, "небезопасный путь")
+	}
+}
+
+func TestOpenImageArchiveNestedAndEncrypted(t *testing.T) {
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	tw.WriteHeader(&tar.Header{Name: "inner.png", Mode: 0o644, Size: int64(len(testPNG(t)))})
+	tw.Write(testPNG(t))
+	tw.Close()
+
+	archive := openTestArchive(t, testZip(t,
+		testZipEntry{name: "inner.zip", data: testZip(t, testZipEntry{name: "x.png", data: testPNG(t)})},
+		testZipEntry{name: "inner.7z", data: append([]byte("7z\xBC\xAF\x27\x1C\x00\x04"), make([]byte, 100)...)},
+		testZipEntry{name: "inner.tar", data: tarData.Bytes()},
+		testZipEntry{name: "secret.png", data: testPNG(t), flags: 0x1},
+	), testArchiveLimits)
+	if len(archive.Entries) != 0 {
+		t.Errorf("приняты вложенные архивы или зашифрованные файлы: %d", len(archive.Entries))
+	}
+	for _, name := range []string{"inner.zip", "inner.7z", "inner.tar"} {
+		checkSkipped(t, archive, name, "вложенные архивы")
+	}
+	checkSkipped(t, archive, "secret.png", "зашифрован")
+}
+
+func TestOpenImageArchiveLimits(t *testing.T) {
+	png := testPNG(t)
+	var entries []testZipEntry
+	for _, name := range []string{"1.png", "2.png", "3.png"} {
+		entries = append(entries, testZipEntry{name: name, data: png})
+	}
+	tooMany := testZip(t, entries...)
+
+	t.Run("количество файлов", func(t *testing.T) {
+		_, err := OpenImageArchive(testFileHeader(t, "photos.zip", tooMany), ArchiveLimits{MaxEntries: 2, MaxEntrySize: 1 << 20})
+		if !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("ожидалась ErrArchiveLimit, получено %v", err)
+		}
+	})
+	t.Run("архивы отключены", func(t *testing.T) {
+		_, err := OpenImageArchive(testFileHeader(t, "photos.zip", tooMany), ArchiveLimits{})
+		if !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("ожидалась ErrArchiveLimit, получено %v", err)
+		}
+	})
+	t.Run("объявленный размер больше допустимого", func(t *testing.T) {
+		big := append(append([]byte{}, png...), make([]byte, 2<<20)...)
+		archive := openTestArchive(t, testZip(t, testZipEntry{name: "big.png", data: big}), testArchiveLimits)
+		if len(archive.Entries) != 0 {
+			t.Fatalf("принят файл больше ограничения")
+		}
+		checkSkipped(t, archive, "big.png", "после распаковки")
+	})
+	t.Run("распаковка больше объявленного размера", func(t *testing.T) {
+		// В заголовке объявлено 600 байт, на деле после распаковки 8 МБ нулей.
+		bomb := append(append([]byte{}, png...), make([]byte, 8<<20)...)
+		archive := openTestArchive(t, testZipForgedSize(t, "bomb.png", bomb, 600), testArchiveLimits)
+		if len(archive.Entries) != 1 {
+			t.Fatalf("файл не дошел до распаковки: %q", archive.Skipped)
+		}
+		for _, entry := range archive.Entries {
+			data, err := entry.Read()
+			if err == nil || data != nil {
+				t.Errorf("распаковано %d байт без ошибки", len(data))
+			}
+			if !errors.Is(err, ErrInvalidArchive) && !errors.Is(err, ErrArchiveLimit) {
+				t.Errorf("неожиданная ошибка: %v", err)
+			}
+			if entry.archive.unpacked > testArchiveLimits.MaxEntrySize+1 {
+				t.Errorf("распаковано %d байт, больше ограничения", entry.archive.unpacked)
+			}
+		}
+	})
+	t.Run("суммарный объем распакованных данных", func(t *testing.T) {
+		archive := openTestArchive(t, tooMany, testArchiveLimits)
+		if _, err := archive.Entries[0].Read(); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		// Остаток суммарного лимита меньше следующего файла.
+		archive.unpacked = archiveMaxUnpacked - int64(len(png))/2
+		if _, err := archive.Entries[1].Read(); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("ожидалась ErrArchiveLimit, получено %v", err)
+		}
+		if _, err := archive.Entries[2].Read(); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("после исчерпания лимита: ожидалась ErrArchiveLimit, получено %v", err)
+		}
+	})
+}
+
+func TestOpenImageArchivePassThrough(t *testing.T) {
+	docx := testZip(t,
+		testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+		testZipEntry{name: "word/document.xml", data: []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"/>`)},
+		testZipEntry{name: "word/media/image1.png", data: testPNG(t)},
+	)
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"документ DOCX", docx},
+		{"изображение PNG", testPNG(t)},
+		{"пустой файл", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, err := OpenImageArchive(testFileHeader(t, "file", tt.data), testArchiveLimits)
+			if archive != nil || err != nil {
+				t.Errorf("ожидалось nil, nil; получено %v, %v", archive, err)
+			}
+		})
+	}
+
+	_, err := OpenImageArchive(testFileHeader(t, "broken.zip", []byte("PK\x03\x04 not really a zip")), testArchiveLimits)
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("поврежденный архив: ожидалась ErrInvalidArchive, получено %v", err)
+	}
+}
@@ -0,0 +1,897 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки очищенного файла и проверки сигнатур
+	"encoding/binary" // Для чтения размеров блоков и полей заголовков
+	"errors"          // Для определения ошибок
+	"fmt"             // Для форматирования ошибок и отчета
+	"sort"            // Для детерминированного порядка блоков в отчете
+	"strconv"         // Для размера тега Lyrics3
+	"strings"         // Для разбора полей тегов
+	"unicode/utf16"   // Для текстовых кадров ID3v2 в UTF-16
+)
+
+// Очистка аудиофайлов (MP3, FLAC, Ogg Vorbis и Ogg Opus).
+//
+// Теги удаляются целиком вместе со встроенными обложками, а аудиоданные копируются
+// без изменений:
+//   - MP3: файл проходится по кадрам MPEG; в результат попадают только кадры, а теги
+//     ID3v2 (в начале и внутри файла), ID3v1, APE и Lyrics3 и посторонние данные между
+//     кадрами удаляются;
+//   - FLAC: из блоков метаданных остаются только STREAMINFO и SEEKTABLE, необходимые
+//     для воспроизведения и перемотки;
+//   - Ogg: пакет комментариев (Vorbis comment, OpusTags) заменяется пустым, страницы
+//     заголовков собираются заново, у страниц со звуком меняются только порядковые
+//     номера и контрольные суммы.
+// Поддерживаются только аудиопотоки Vorbis и Opus: остальные потоки Ogg (FLAC, видео
+// Theora) отклоняются.
+
+// ErrInvalidAudio - файл не удалось разобрать как MP3, FLAC или Ogg.
+var ErrInvalidAudio = errors.New("некорректный аудиофайл")
+
+// audioFormats - форматы сохранения (расширения) аудиофайлов по MIME-типу.
+var audioFormats = map[string]string{
+	"audio/mpeg": "mp3",
+	"audio/flac": "flac",
+	"audio/ogg":  "ogg",
+}
+
+// audioCleaner накапливает отчет об удаленных тегах.
+type audioCleaner struct {
+	report  *MetadataReport
+	removed map[string]int // Удаленные блоки для отчета
+}
+
+// cleanAudio очищает аудиофайл типа contentType и возвращает очищенную копию и отчет
+// о найденных метаданных.
+func cleanAudio(data []byte, contentType string) ([]byte, *MetadataReport, error) {
+	c := &audioCleaner{
+		report:  &MetadataReport{Format: audioFormats[contentType]},
+		removed: make(map[string]int),
+	}
+	var clean []byte
+	var err error
+	switch contentType {
+	case "audio/mpeg":
+		clean, err = c.mp3(data)
+	case "audio/flac":
+		clean, err = c.flac(data)
+	case "audio/ogg":
+		clean, err = c.ogg(data)
+	default:
+		return nil, nil, fmt.Errorf("%w: неподдерживаемый тип %s", ErrInvalidAudio, contentType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(c.removed))
+	for name := range c.removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.report.addBlock(fmt.Sprintf("%s (%d)", name, c.removed[name]))
+	}
+	return clean, c.report, nil
+}
+
+// detectAudioContentType уточняет MIME-тип аудиофайла, определенный по первым байтам:
+// MP3 без тега ID3v2 и FLAC http.DetectContentType не распознает, Ogg определяет
+// как контейнер (application/ogg), а FLAC с тегом ID3v2 в начале - как MP3.
+func detectAudioContentType(data []byte, contentType string) string {
+	switch contentType {
+	case "application/ogg":
+		return "audio/ogg"
+	case "audio/mpeg":
+		if bytes.HasPrefix(data[skipID3v2(data):], []byte("fLaC")) {
+			return "audio/flac"
+		}
+	case "application/octet-stream":
+		if bytes.HasPrefix(data, []byte("fLaC")) {
+			return "audio/flac"
+		}
+		if size := mpegFrameSize(data); size > 0 && mpegFrameFollows(data, size) {
+			return "audio/mpeg"
+		}
+	}
+	return contentType
+}
+
+// --- MP3 ---
+
+// mpegBitrates - битрейты (кбит/с) по индексу из заголовка кадра: MPEG-1 Layer I, II, III
+// и MPEG-2/2.5 Layer I, Layer II и III.
+var mpegBitrates = [5][16]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mpegFrameSize возвращает длину кадра MPEG Audio по его заголовку (0 - данные не
+// начинаются с корректного заголовка). Кадры со свободным битрейтом не поддерживаются.
+func mpegFrameSize(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return 0
+	}
+	version := b[1] >> 3 & 3 // 0 - MPEG-2.5, 2 - MPEG-2, 3 - MPEG-1
+	layer := b[1] >> 1 & 3   // 1 - Layer III, 2 - Layer II, 3 - Layer I
+	bitrateIndex := b[2] >> 4
+	rateIndex := b[2] >> 2 & 3
+	padding := int(b[2] >> 1 & 1)
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 || b[3]&3 == 2 {
+		return 0
+	}
+	sampleRate := [3]int{44100, 48000, 32000}[rateIndex]
+	table := 3 - int(layer) // MPEG-1: Layer I - 0, Layer II - 1, Layer III - 2
+	switch version {
+	case 2:
+		sampleRate /= 2
+	case 0:
+		sampleRate /= 4
+	}
+	if version != 3 {
+		table = 4
+		if layer == 3 {
+			table = 3
+		}
+	}
+	bitrate := mpegBitrates[table][bitrateIndex] * 1000
+	switch {
+	case layer == 3:
+		return (12*bitrate/sampleRate + padding) * 4
+	case layer == 1 && version != 3:
+		return 72*bitrate/sampleRate + padding
+	}
+	return 144*bitrate/sampleRate + padding
+}
+
+// mpegFrameFollows проверяет, что за кадром длины size начинается следующий кадр
+// (или тег, или файл заканчивается). Одиночный байт 0xFF в данных часто похож на
+// заголовок кадра, поэтому первый кадр и кадр после потери синхронизации подтверждаются
+// следующим.
+func mpegFrameFollows(data []byte, size int) bool {
+	if size == len(data) {
+		return true
+	}
+	if size > len(data) {
+		return false
+	}
+	next := data[size:]
+	return mpegFrameSize(next) > 0 || bytes.HasPrefix(next, []byte("ID3"))
+}
+
+// mp3 проходит файл по кадрам и оставляет только кадры MPEG.
+func (c *audioCleaner) mp3(data []byte) ([]byte, error) {
+	audio := data[:c.trailingTags(data)]
+	out := make([]byte, 0, len(audio))
+	frames, skipped := 0, 0
+	for pos := 0; pos < len(audio); {
+		rest := audio[pos:]
+		if size := c.id3v2(rest); size > 0 {
+			pos += size
+			continue
+		}
+		if size := mpegFrameSize(rest); size > 0 && (frames > 0 || mpegFrameFollows(rest, size)) {
+			size = min(size, len(rest)) // Последний кадр может быть обрезан
+			out = append(out, rest[:size]...)
+			pos += size
+			frames++
+			continue
+		}
+		// Потеря синхронизации: данные до следующего подтвержденного кадра удаляются.
+		next := pos + 1
+		for next < len(audio) {
+			if audio[next] == 0xFF {
+				if size := mpegFrameSize(audio[next:]); size > 0 && mpegFrameFollows(audio[next:], size) {
+					break
+				}
+			}
+			if id3, ok := id3v2Size(audio[next:]); ok && id3 <= len(audio)-next {
+				break
+			}
+			next++
+		}
+		skipped += next - pos
+		pos = next
+	}
+	if frames == 0 {
+		return nil, fmt.Errorf("%w: не найдены аудиокадры MPEG", ErrInvalidAudio)
+	}
+	if skipped > 0 {
+		c.removed["посторонние данные, байт"] += skipped
+	}
+	return out, nil
+}
+
+// --- FLAC ---
+
+// flacBlock - блок метаданных FLAC.
+type flacBlock struct {
+	typ  byte
+	data []byte
+}
+
+// flac оставляет из блоков метаданных только STREAMINFO и SEEKTABLE.
+func (c *audioCleaner) flac(data []byte) ([]byte, error) {
+	pos := 0
+	for {
+		size := c.id3v2(data[pos:])
+		if size == 0 {
+			break
+		}
+		pos += size
+	}
+	if !bytes.HasPrefix(data[min(pos, len(data)):], []byte("fLaC")) {
+		return nil, fmt.Errorf("%w: отсутствует сигнатура fLaC", ErrInvalidAudio)
+	}
+	pos += 4
+	end := c.trailingTags(data)
+
+	var kept []flacBlock
+	for last := false; !last; {
+		if pos+4 > end {
+			return nil, fmt.Errorf("%w: обрезанный блок метаданных FLAC", ErrInvalidAudio)
+		}
+		last = data[pos]&0x80 != 0
+		typ := data[pos] & 0x7F
+		length := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		if pos+4+length > end {
+			return nil, fmt.Errorf("%w: обрезанный блок метаданных FLAC", ErrInvalidAudio)
+		}
+		block := data[pos+4 : pos+4+length]
+		pos += 4 + length
+		switch typ {
+		case 0: // STREAMINFO: параметры потока, всегда первый блок
+			if len(kept) > 0 || length != 34 {
+				return nil, fmt.Errorf("%w: некорректный блок STREAMINFO", ErrInvalidAudio)
+			}
+			kept = append(kept, flacBlock{typ, block})
+		case 3: // SEEKTABLE: точки перемотки
+			kept = append(kept, flacBlock{typ, block})
+		case 1: // PADDING: пустое место для тегов, метаданных не содержит
+		case 2:
+			c.removed["данные приложений FLAC (APPLICATION)"]++
+		case 4:
+			c.vorbisComment(block)
+			c.removed["комментарии Vorbis"]++
+		case 5:
+			c.removed["разметка компакт-диска (CUESHEET)"]++
+		case 6:
+			c.removed["обложки"]++
+		case 127:
+			return nil, fmt.Errorf("%w: некорректный тип блока метаданных FLAC", ErrInvalidAudio)
+		default:
+			c.removed[fmt.Sprintf("блок метаданных FLAC %d", typ)]++
+		}
+	}
+	if len(kept) == 0 || kept[0].typ != 0 {
+		return nil, fmt.Errorf("%w: отсутствует блок STREAMINFO", ErrInvalidAudio)
+	}
+	audio := data[pos:end]
+	if len(audio) < 2 || audio[0] != 0xFF || audio[1]&0xFE != 0xF8 {
+		return nil, fmt.Errorf("%w: не найдены аудиокадры FLAC", ErrInvalidAudio)
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(audio)+1024))
+	out.WriteString("fLaC")
+	for i, block := range kept {
+		header := block.typ
+		if i == len(kept)-1 {
+			header |= 0x80 // Признак последнего блока метаданных
+		}
+		length := len(block.data)
+		out.Write([]byte{header, byte(length >> 16), byte(length >> 8), byte(length)})
+		out.Write(block.data)
+	}
+	out.Write(audio)
+	return out.Bytes(), nil
+}
+
+// --- Ogg ---
+
+// Флаги заголовка страницы Ogg.
+const (
+	oggContinued = 0x01 // Страница начинается с продолжения пакета
+	oggBOS       = 0x02 // Первая страница логического потока
+)
+
+// oggPage - страница Ogg.
+type oggPage struct {
+	flags   byte
+	granule uint64
+	serial  uint32
+	lacing  []byte // Таблица сегментов
+	body    []byte
+	size    int // Полный размер страницы в файле
+}
+
+// oggStream - состояние логического потока при очистке.
+type oggStream struct {
+	serial  uint32
+	codec   string   // "vorbis" или "opus"
+	headers int      // Количество пакетов заголовков (Vorbis - 3, Opus - 2)
+	packets [][]byte // Собранные пакеты заголовков
+	partial []byte   // Незавершенный пакет (продолжается на следующей странице)
+	seq     uint32   // Порядковый номер следующей записываемой страницы
+	done    bool     // Заголовки записаны, дальше идут страницы со звуком
+}
+
+// oggCRCTable - таблица CRC-32 Ogg (полином 0x04C11DB7 без отражения битов).
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC считает контрольную сумму страницы (поле контрольной суммы должно быть нулевым).
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// readOggPage разбирает страницу в начале b и проверяет ее контрольную сумму.
+func readOggPage(b []byte) (oggPage, error) {
+	if len(b) < 27 || string(b[:4]) != "OggS" || b[4] != 0 {
+		return oggPage{}, fmt.Errorf("%w: данные вне страниц Ogg", ErrInvalidAudio)
+	}
+	segments := int(b[26])
+	if len(b) < 27+segments {
+		return oggPage{}, fmt.Errorf("%w: обрезанная страница Ogg", ErrInvalidAudio)
+	}
+	size := 27 + segments
+	for _, n := range b[27 : 27+segments] {
+		size += int(n)
+	}
+	if len(b) < size {
+		return oggPage{}, fmt.Errorf("%w: обрезанная страница Ogg", ErrInvalidAudio)
+	}
+	page := append([]byte(nil), b[:size]...)
+	binary.LittleEndian.PutUint32(page[22:26], 0)
+	if oggCRC(page) != binary.LittleEndian.Uint32(b[22:26]) {
+		return oggPage{}, fmt.Errorf("%w: неверная контрольная сумма страницы Ogg", ErrInvalidAudio)
+	}
+	return oggPage{
+		flags:   b[5],
+		granule: binary.LittleEndian.Uint64(b[6:14]),
+		serial:  binary.LittleEndian.Uint32(b[14:18]),
+		lacing:  b[27 : 27+segments],
+		body:    b[27+segments : size],
+		size:    size,
+	}, nil
+}
+
+// writeOggPage записывает страницу с заново посчитанной контрольной суммой.
+func writeOggPage(out *bytes.Buffer, flags byte, granule uint64, serial, seq uint32, lacing, body []byte) {
+	page := make([]byte, 27, 27+len(lacing)+len(body))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:14], granule)
+	binary.LittleEndian.PutUint32(page[14:18], serial)
+	binary.LittleEndian.PutUint32(page[18:22], seq)
+	page[26] = byte(len(lacing))
+	page = append(append(page, lacing...), body...)
+	binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+	out.Write(page)
+}
+
+// ogg заменяет пакеты комментариев всех логических потоков пустыми.
+func (c *audioCleaner) ogg(data []byte) ([]byte, error) {
+	end := c.trailingTags(data)
+	streams := make(map[uint32]*oggStream)
+	out := bytes.NewBuffer(make([]byte, 0, end))
+	for pos := 0; pos < end; {
+		page, err := readOggPage(data[pos:end])
+		if err != nil {
+			return nil, err
+		}
+		pos += page.size
+		s := streams[page.serial]
+
+		if page.flags&oggBOS != 0 {
+			// Первая страница потока содержит только пакет идентификации кодека.
+			if s != nil {
+				return nil, fmt.Errorf("%w: повторное начало потока Ogg", ErrInvalidAudio)
+			}
+			if len(page.lacing) == 0 || page.lacing[len(page.lacing)-1] == 255 || bytes.Count(page.lacing[:len(page.lacing)-1], []byte{255}) != len(page.lacing)-1 {
+				return nil, fmt.Errorf("%w: некорректная первая страница потока Ogg", ErrInvalidAudio)
+			}
+			s = &oggStream{serial: page.serial, packets: [][]byte{page.body}, seq: 1}
+			switch {
+			case bytes.HasPrefix(page.body, []byte("\x01vorbis")):
+				s.codec, s.headers = "vorbis", 3
+			case bytes.HasPrefix(page.body, []byte("OpusHead")):
+				s.codec, s.headers = "opus", 2
+			default:
+				return nil, fmt.Errorf("%w: поддерживаются только потоки Ogg Vorbis и Ogg Opus", ErrInvalidAudio)
+			}
+			streams[page.serial] = s
+			writeOggPage(out, page.flags, page.granule, page.serial, 0, page.lacing, page.body)
+			continue
+		}
+		if s == nil {
+			return nil, fmt.Errorf("%w: страница Ogg без начала потока", ErrInvalidAudio)
+		}
+
+		if s.done {
+			writeOggPage(out, page.flags, page.granule, page.serial, s.seq, page.lacing, page.body)
+			s.seq++
+			continue
+		}
+		if err := s.collect(page); err != nil {
+			return nil, err
+		}
+		if len(s.packets) < s.headers {
+			continue
+		}
+		// Звук начинается с новой страницы: заголовки заканчиваются вместе со страницей.
+		if len(s.partial) > 0 || len(s.packets) > s.headers {
+			return nil, fmt.Errorf("%w: заголовки потока Ogg не завершают страницу", ErrInvalidAudio)
+		}
+		comment, err := c.oggComment(s)
+		if err != nil {
+			return nil, err
+		}
+		s.writePackets(out, append([][]byte{comment}, s.packets[2:]...))
+		s.done = true
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("%w: не найдены страницы Ogg", ErrInvalidAudio)
+	}
+	for _, s := range streams {
+		if !s.done {
+			return nil, fmt.Errorf("%w: обрезанные заголовки потока Ogg", ErrInvalidAudio)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// collect добавляет пакеты страницы к заголовкам потока.
+func (s *oggStream) collect(page oggPage) error {
+	if (page.flags&oggContinued != 0) != (len(s.partial) > 0) {
+		return fmt.Errorf("%w: нарушена последовательность пакетов Ogg", ErrInvalidAudio)
+	}
+	body := page.body
+	for _, n := range page.lacing {
+		s.partial = append(s.partial, body[:n]...)
+		body = body[n:]
+		if n < 255 {
+			s.packets = append(s.packets, s.partial)
+			s.partial = nil
+		}
+	}
+	return nil
+}
+
+// oggComment анализирует пакет комментариев потока и возвращает пустой пакет
+// того же кодека.
+func (c *audioCleaner) oggComment(s *oggStream) ([]byte, error) {
+	packet := s.packets[1]
+	var prefix, empty []byte
+	var block string
+	switch s.codec {
+	case "vorbis":
+		prefix, block = []byte("\x03vorbis"), "комментарии Vorbis"
+		empty = append(append([]byte(nil), prefix...), 0, 0, 0, 0, 0, 0, 0, 0, 1) // Производитель, количество полей, бит кадрирования
+	default:
+		prefix, block = []byte("OpusTags"), "теги Opus"
+		empty = append(append([]byte(nil), prefix...), 0, 0, 0, 0, 0, 0, 0, 0)
+	}
+	if !bytes.HasPrefix(packet, prefix) {
+		return nil, fmt.Errorf("%w: отсутствует пакет комментариев потока Ogg", ErrInvalidAudio)
+	}
+	if !bytes.Equal(packet, empty) {
+		c.vorbisComment(packet[len(prefix):])
+		c.removed[block]++
+	}
+	return empty, nil
+}
+
+// writePackets записывает пакеты заголовков на новые страницы, начиная с порядкового
+// номера s.seq. Позиция (granule) у страниц заголовков нулевая, у страниц, на которых
+// не заканчивается ни один пакет, - "не задана" (-1).
+func (s *oggStream) writePackets(out *bytes.Buffer, packets [][]byte) {
+	var lacing, body []byte
+	continued, complete := false, false
+	flush := func() {
+		granule := ^uint64(0)
+		if complete {
+			granule = 0
+		}
+		var flags byte
+		if continued {
+			flags = oggContinued
+		}
+		writeOggPage(out, flags, granule, s.serial, s.seq, lacing, body)
+		s.seq++
+		lacing, body, complete = nil, nil, false
+	}
+	for _, packet := range packets {
+		for rest := packet; ; {
+			n := min(len(rest), 255)
+			lacing = append(lacing, byte(n))
+			body = append(body, rest[:n]...)
+			rest = rest[n:]
+			if n < 255 {
+				complete = true
+			}
+			if len(lacing) == 255 {
+				flush()
+				continued = n == 255
+			}
+			if n < 255 {
+				break
+			}
+		}
+	}
+	if len(lacing) > 0 {
+		flush()
+	}
+}
+
+// --- Теги ---
+
+// id3TextFrames - текстовые кадры ID3v2 (версии 2.2 и 2.3/2.4) и соответствующие им
+// имена полей Vorbis, по которым tag распределяет значения в отчете.
+var id3TextFrames = map[string]string{
+	"TPE1": "artist", "TP1": "artist", "TOPE": "artist", "TOA": "artist",
+	"TPE2": "albumartist", "TP2": "albumartist",
+	"TPE3": "conductor", "TP3": "conductor",
+	"TPE4": "remixer", "TP4": "remixer",
+	"TCOM": "composer", "TCM": "composer",
+	"TEXT": "lyricist", "TXT": "lyricist", "TOLY": "lyricist", "TOL": "lyricist",
+	"TOWN": "owner",
+	"TENC": "encodedby", "TEN": "encodedby",
+	"TSSE": "encoder", "TSS": "encoder",
+	"TYER": "date", "TYE": "date", "TDAT": "date", "TDA": "date", "TIME": "date", "TIM": "date",
+	"TRDA": "date", "TRD": "date", "TDRC": "date", "TDRL": "date", "TORY": "date", "TOR": "date", "TDOR": "date",
+	"TDEN": "encodingtime", "TDTG": "taggingtime",
+	"TIT2": "title", "TT2": "title",
+	"TALB": "album", "TAL": "album",
+}
+
+// tag переносит в отчет поле тега. Кадры ID3v2 предварительно приводятся к именам
+// полей Vorbis (id3TextFrames), поэтому разбор общий для всех форматов тегов.
+func (c *audioCleaner) tag(key, value string) {
+	name := strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(key))
+	switch name {
+	case "metadatablockpicture", "coverart", "coverart(front)", "coverart(back)":
+		c.removed["обложки"]++
+		return
+	}
+	value = strings.TrimSpace(strings.ReplaceAll(value, "\x00", ", "))
+	if value == "" {
+		return
+	}
+	switch name {
+	case "artist", "albumartist", "performer", "composer", "conductor", "lyricist", "author", "remixer", "owner", "encodedby", "arranger", "writer":
+		c.report.addUnique(&c.report.Authors, value)
+	case "encoder", "encodingsettings", "software", "tool":
+		c.report.addUnique(&c.report.Software, value)
+	case "date", "year", "originaldate", "originalyear", "creationtime", "creationdate", "recordingdate", "releasedate":
+		c.report.addTimestamp("Запись", value)
+	case "encodingtime":
+		c.report.addTimestamp("Кодирование", value)
+	case "taggingtime":
+		c.report.addTimestamp("Изменение тегов", value)
+	case "location", "recordinglocation", "place":
+		c.report.addUnique(&c.report.Comments, "Место: "+value)
+	case "title":
+		c.report.addUnique(&c.report.Comments, "Название: "+value)
+	case "album":
+		c.report.addUnique(&c.report.Comments, "Альбом: "+value)
+	case "comment", "description":
+		c.report.addUnique(&c.report.Comments, value)
+	default:
+		c.report.addUnique(&c.report.Comments, key+": "+value)
+	}
+}
+
+// vorbisComment переносит в отчет комментарий Vorbis (FLAC, Ogg Vorbis, Opus):
+// строку производителя кодировщика и поля "КЛЮЧ=значение".
+func (c *audioCleaner) vorbisComment(b []byte) {
+	read := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return "", false
+		}
+		value := string(b[4 : 4+n])
+		b = b[4+n:]
+		return value, true
+	}
+	vendor, ok := read()
+	if !ok {
+		return
+	}
+	c.report.addUnique(&c.report.Software, vendor)
+	if len(b) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		field, ok := read()
+		if !ok {
+			return
+		}
+		key, value, _ := strings.Cut(field, "=")
+		c.tag(key, value)
+	}
+}
+
+// syncsafe читает 28-битное число ID3v2 (старший бит каждого байта равен нулю).
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// id3v2Size возвращает полный размер тега ID3v2 в начале b (с заголовком и окончанием).
+func id3v2Size(b []byte) (int, bool) {
+	if len(b) < 10 || string(b[:3]) != "ID3" || b[3] < 2 || b[3] > 4 {
+		return 0, false
+	}
+	for _, x := range b[6:10] {
+		if x >= 0x80 {
+			return 0, false
+		}
+	}
+	size := 10 + syncsafe(b[6:10])
+	if b[3] == 4 && b[5]&0x10 != 0 {
+		size += 10 // Окончание тега (footer)
+	}
+	return size, true
+}
+
+// skipID3v2 возвращает смещение первого байта после тегов ID3v2 в начале файла.
+func skipID3v2(data []byte) int {
+	pos := 0
+	for {
+		size, ok := id3v2Size(data[pos:])
+		if !ok || size > len(data)-pos {
+			return pos
+		}
+		pos += size
+	}
+}
+
+// id3Unsync отменяет десинхронизацию ID3v2 (после 0xFF вставляется 0x00).
+func id3Unsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// id3v2 переносит в отчет кадры тега ID3v2 в начале b и возвращает размер тега
+// (0 - b не начинается с тега).
+func (c *audioCleaner) id3v2(b []byte) int {
+	size, ok := id3v2Size(b)
+	if !ok {
+		return 0
+	}
+	c.removed["ID3v2"]++
+	major, flags := b[3], b[5]
+	body := b[10:min(10+syncsafe(b[6:10]), len(b))]
+	if flags&0x80 != 0 && major < 4 {
+		body = id3Unsync(body)
+	}
+	if flags&0x40 != 0 && major >= 3 && len(body) >= 4 {
+		// Расширенный заголовок: в версии 2.3 размер не включает поле размера, в 2.4 - включает.
+		skip := int(binary.BigEndian.Uint32(body)) + 4
+		if major == 4 {
+			skip = syncsafe(body)
+		}
+		body = body[min(skip, len(body)):]
+	}
+
+	idLength, headerLength := 4, 10
+	if major == 2 {
+		idLength, headerLength = 3, 6
+	}
+	for len(body) >= headerLength && body[0] != 0 {
+		id := string(body[:idLength])
+		var length int
+		var frameFlags byte
+		switch major {
+		case 2:
+			length = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			length = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = body[9]
+		default:
+			length = syncsafe(body[4:8])
+			frameFlags = body[9]
+		}
+		if length < 0 || length > len(body)-headerLength {
+			break
+		}
+		frame := body[headerLength : headerLength+length]
+		body = body[headerLength+length:]
+
+		// Сжатые и зашифрованные кадры не разбираются, но удаляются вместе с тегом.
+		switch major {
+		case 3:
+			if frameFlags&0xC0 != 0 {
+				frame = nil
+			} else if frameFlags&0x20 != 0 && len(frame) > 0 {
+				frame = frame[1:] // Идентификатор группы
+			}
+		case 4:
+			if frameFlags&0x0C != 0 {
+				frame = nil
+				break
+			}
+			if frameFlags&0x40 != 0 && len(frame) > 0 {
+				frame = frame[1:]
+			}
+			if frameFlags&0x01 != 0 && len(frame) >= 4 {
+				frame = frame[4:] // Исходная длина данных
+			}
+			if frameFlags&0x02 != 0 {
+				frame = id3Unsync(frame)
+			}
+		}
+		c.id3Frame(id, frame)
+	}
+	return size
+}
+
+// id3Frame переносит в отчет кадр ID3v2.
+func (c *audioCleaner) id3Frame(id string, data []byte) {
+	switch {
+	case id == "APIC" || id == "PIC":
+		c.removed["обложки"]++
+	case len(data) == 0:
+		c.removed["кадры ID3v2 "+id]++
+	case id == "TXXX" || id == "TXX":
+		if values := decodeID3Text(data[0], data[1:]); len(values) >= 2 {
+			c.tag(values[0], strings.Join(values[1:], ", "))
+		}
+	case id[0] == 'T':
+		key := id3TextFrames[id]
+		if key == "" {
+			key = id
+		}
+		c.tag(key, strings.Join(decodeID3Text(data[0], data[1:]), ", "))
+	case id == "COMM" || id == "COM" || id == "USLT" || id == "ULT":
+		// Кодировка, язык (3 байта), описание и текст.
+		if len(data) > 4 {
+			if values := decodeID3Text(data[0], data[4:]); len(values) >= 2 {
+				c.tag("comment", strings.Join(values[1:], " "))
+			}
+		}
+	case id == "WXXX" || id == "WXX":
+		if values := decodeID3Text(data[0], data[1:]); len(values) >= 2 {
+			c.tag("URL", values[len(values)-1])
+		}
+	case id[0] == 'W':
+		c.tag("URL", decodeID3Text(0, data)[0])
+	default:
+		c.removed["кадры ID3v2 "+id]++
+	}
+}
+
+// decodeID3Text декодирует текст кадра ID3v2 в кодировке encoding (0 - ISO-8859-1,
+// 1 - UTF-16 с BOM, 2 - UTF-16BE, 3 - UTF-8) и разбивает его на значения по нулевому символу.
+func decodeID3Text(encoding byte, b []byte) []string {
+	var s string
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			// Каждое значение в UTF-16 начинается со своего BOM.
+			if encoding == 1 && (b[i] == 0xFF && b[i+1] == 0xFE || b[i] == 0xFE && b[i+1] == 0xFF) {
+				bigEndian = b[i] == 0xFE
+				continue
+			}
+			if bigEndian {
+				units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+			} else {
+				units = append(units, uint16(b[i+1])<<8|uint16(b[i]))
+			}
+		}
+		s = string(utf16.Decode(units))
+	case 3:
+		s = string(b)
+	default:
+		runes := make([]rune, len(b))
+		for i, x := range b {
+			runes[i] = rune(x)
+		}
+		s = string(runes)
+	}
+	return strings.Split(strings.TrimRight(s, "\x00"), "\x00")
+}
+
+// trailingTags переносит в отчет теги в конце файла (ID3v1, APE, Lyrics3 и ID3v2
+// с окончанием) и возвращает смещение, с которого они начинаются.
+func (c *audioCleaner) trailingTags(data []byte) int {
+	end := len(data)
+	for {
+		switch {
+		case end >= 128 && bytes.HasPrefix(data[end-128:end], []byte("TAG")):
+			c.id3v1(data[end-128 : end])
+			end -= 128
+			if end >= 227 && bytes.HasPrefix(data[end-227:end], []byte("TAG+")) {
+				end -= 227 // Расширенный тег ID3v1
+			}
+		case end >= 32 && bytes.HasPrefix(data[end-32:end], []byte("APETAGEX")):
+			footer := data[end-32 : end]
+			size := int(binary.LittleEndian.Uint32(footer[12:16]))
+			if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+				size += 32 // Тег начинается с заголовка
+			}
+			if size < 32 || size > end {
+				return end
+			}
+			c.ape(data[end-size : end-32])
+			end -= size
+		case end >= 15 && string(data[end-9:end]) == "LYRICS200":
+			size, err := strconv.Atoi(string(data[end-15 : end-9]))
+			if err != nil || size+15 > end {
+				return end
+			}
+			c.removed["Lyrics3"]++
+			end -= size + 15
+		case end >= 20 && string(data[end-10:end-7]) == "3DI":
+			size, ok := id3v2Size(append([]byte("ID3"), data[end-7:end]...))
+			if !ok || size > end || !bytes.HasPrefix(data[end-size:], []byte("ID3")) {
+				return end
+			}
+			c.id3v2(data[end-size : end])
+			end -= size
+		default:
+			return end
+		}
+	}
+}
+
+// id3v1 переносит в отчет поля тега ID3v1 (128 байт в конце файла).
+func (c *audioCleaner) id3v1(b []byte) {
+	c.removed["ID3v1"]++
+	field := func(from, to int) string {
+		return strings.TrimRight(decodeID3Text(0, b[from:to])[0], " ")
+	}
+	c.tag("title", field(3, 33))
+	c.tag("artist", field(33, 63))
+	c.tag("album", field(63, 93))
+	c.tag("year", field(93, 97))
+	c.tag("comment", field(97, 127))
+}
+
+// ape переносит в отчет элементы тега APE (b - элементы без заголовка и окончания).
+func (c *audioCleaner) ape(b []byte) {
+	c.removed["APE"]++
+	if bytes.HasPrefix(b, []byte("APETAGEX")) {
+		b = b[32:]
+	}
+	for len(b) >= 8 {
+		size := binary.LittleEndian.Uint32(b)
+		flags := binary.LittleEndian.Uint32(b[4:])
+		key, rest, found := bytes.Cut(b[8:], []byte{0})
+		if !found || uint64(size) > uint64(len(rest)) {
+			return
+		}
+		value := ""
+		if flags&6 == 0 { // Текст UTF-8; остальные значения двоичные
+			value = string(rest[:size])
+		}
+		c.tag(string(key), value)
+		b = rest[size:]
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки файлов
+	"encoding/binary" // Для полей заголовков
+	"errors"          // Для проверки ошибки-маркера
+	"strings"         // Для длинных значений тегов
+	"testing"         // Для тестов
+)
+
+// --- Построение файлов ---
+
+// testMP3Frames возвращает n кадров MPEG-1 Layer III (128 кбит/с, 44,1 кГц, 417 байт)
+// с различающимся содержимым.
+func testMP3Frames(n int) [][]byte {
+	frames := make([][]byte, n)
+	for i := range frames {
+		frame := bytes.Repeat([]byte{byte(i + 1)}, 417)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+		frames[i] = frame
+	}
+	return frames
+}
+
+// testID3v23 собирает тег ID3v2.3 из кадров (идентификатор -> содержимое).
+func testID3v23(frames ...[2]string) []byte {
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame[0])
+		binary.Write(&body, binary.BigEndian, uint32(len(frame[1])))
+		body.Write([]byte{0, 0})
+		body.WriteString(frame[1])
+	}
+	size := body.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(header, body.Bytes()...)
+}
+
+// testID3v1 собирает тег ID3v1.
+func testID3v1(title, artist string) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[93:97], "2024")
+	return tag
+}
+
+// testAPE собирает тег APEv2 с заголовком и окончанием.
+func testAPE(items ...[2]string) []byte {
+	var body bytes.Buffer
+	for _, item := range items {
+		binary.Write(&body, binary.LittleEndian, uint32(len(item[1])))
+		binary.Write(&body, binary.LittleEndian, uint32(0))
+		body.WriteString(item[0] + "\x00" + item[1])
+	}
+	header := func(flags uint32) []byte {
+		b := make([]byte, 32)
+		copy(b, "APETAGEX")
+		binary.LittleEndian.PutUint32(b[8:], 2000)
+		binary.LittleEndian.PutUint32(b[12:], uint32(body.Len()+32))
+		binary.LittleEndian.PutUint32(b[16:], uint32(len(items)))
+		binary.LittleEndian.PutUint32(b[20:], flags)
+		return b
+	}
+	tag := header(1<<31 | 1<<29) // Есть заголовок; это заголовок
+	tag = append(tag, body.Bytes()...)
+	return append(tag, header(1<<31)...)
+}
+
+// testVorbisComment собирает комментарий Vorbis из строки производителя и полей.
+func testVorbisComment(vendor string, fields ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(fields)))
+	for _, field := range fields {
+		binary.Write(&b, binary.LittleEndian, uint32(len(field)))
+		b.WriteString(field)
+	}
+	return b.Bytes()
+}
+
+// testFLACBlock записывает блок метаданных FLAC.
+func testFLACBlock(typ byte, last bool, data []byte) []byte {
+	if last {
+		typ |= 0x80
+	}
+	return append([]byte{typ, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+// testOggPage записывает страницу Ogg с сегментами segments (длины частей пакетов).
+func testOggPage(out *bytes.Buffer, flags byte, granule uint64, seq uint32, segments []int, body []byte) {
+	lacing := make([]byte, len(segments))
+	for i, n := range segments {
+		lacing[i] = byte(n)
+	}
+	writeOggPage(out, flags, granule, 0x1234, seq, lacing, body)
+}
+
+// oggPages разбивает файл на страницы.
+func oggPages(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var pages [][]byte
+	for pos := 0; pos < len(data); {
+		page, err := readOggPage(data[pos:])
+		if err != nil {
+			t.Fatalf("страница %d: %v", len(pages), err)
+		}
+		pages = append(pages, data[pos:pos+page.size])
+		pos += page.size
+	}
+	return pages
+}
+
+// --- Тесты ---
+
+// checkAudioReport проверяет отчет и повторную очистку результата.
+func checkAudioReport(t *testing.T, clean []byte, contentType string, report *MetadataReport, authors, software, blocks []string) {
+	t.Helper()
+	for _, author := range authors {
+		if !containsString(report.Authors, author) {
+			t.Errorf("в отчете нет автора %q: %q", author, report.Authors)
+		}
+	}
+	for _, name := range software {
+		if !containsString(report.Software, name) {
+			t.Errorf("в отчете нет программы %q: %q", name, report.Software)
+		}
+	}
+	for _, block := range blocks {
+		if !containsString(report.RemovedBlocks, block) {
+			t.Errorf("в отчете нет %q: %q", block, report.RemovedBlocks)
+		}
+	}
+	findings, err := verifyAudio(clean, contentType)
+	if err != nil || len(findings) > 0 {
+		t.Errorf("verifyAudio: %v %q", err, findings)
+	}
+}
+
+func TestCleanAudioMP3(t *testing.T) {
+	frames := testMP3Frames(5)
+	var input bytes.Buffer
+	input.Write(testID3v23(
+		[2]string{"TPE1", "\x00Ivanov"},
+		[2]string{"TIT2", "\x00Demo"},
+		[2]string{"TSSE", "\x00LAME 3.100"},
+		[2]string{"APIC", "\x00image/jpeg\x00\x03\x00cover-bytes"},
+	))
+	input.Write(frames[0])
+	input.Write(frames[1])
+	input.Write(testID3v23([2]string{"TXXX", "\x00Recorder\x00Petrov"})) // Тег внутри потока
+	input.Write(frames[2])
+	input.Write(frames[3])
+	input.WriteString("junk between frames")
+	input.Write(frames[4])
+	input.Write(testAPE([2]string{"Artist", "ApeArtist"}, [2]string{"Cover Art (Front)", "cover"}))
+	input.Write(testID3v1("Demo", "Id3v1Artist"))
+
+	if got := detectAudioContentType(input.Bytes(), "audio/mpeg"); got != "audio/mpeg" {
+		t.Fatalf("тип %q", got)
+	}
+	clean, report, err := cleanAudio(input.Bytes(), "audio/mpeg")
+	if err != nil {
+		t.Fatalf("cleanAudio: %v", err)
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(clean, want) {
+		t.Errorf("кадры изменены: %d байт, ожидалось %d", len(clean), len(want))
+	}
+	checkAudioReport(t, clean, "audio/mpeg", report,
+		[]string{"Ivanov", "ApeArtist", "Id3v1Artist"}, []string{"LAME 3.100"},
+		[]string{"ID3v2 (2)", "APE (1)", "ID3v1 (1)", "обложки (2)", "посторонние данные, байт (19)"})
+	if !containsString(report.Comments, "Recorder: Petrov") || !containsString(report.Comments, "Название: Demo") {
+		t.Errorf("комментарии отчета: %q", report.Comments)
+	}
+}
+
+func TestCleanAudioFLAC(t *testing.T) {
+	streamInfo := bytes.Repeat([]byte{0x11}, 34)
+	seekTable := bytes.Repeat([]byte{0x22}, 18)
+	audio := append([]byte{0xFF, 0xF8}, bytes.Repeat([]byte{0x33}, 500)...)
+
+	var input bytes.Buffer
+	input.WriteString("fLaC")
+	input.Write(testFLACBlock(0, false, streamInfo))
+	input.Write(testFLACBlock(4, false, testVorbisComment("reference libFLAC 1.4.3",
+		"ARTIST=Ivanov", "DATE=2024-05-01", "LOCATION=Moscow", "METADATA_BLOCK_PICTURE=AAAA")))
+	input.Write(testFLACBlock(6, false, bytes.Repeat([]byte{0x44}, 100))) // PICTURE
+	input.Write(testFLACBlock(1, false, make([]byte, 64)))                // PADDING
+	input.Write(testFLACBlock(3, true, seekTable))
+	input.Write(audio)
+
+	clean, report, err := cleanAudio(input.Bytes(), "audio/flac")
+	if err != nil {
+		t.Fatalf("cleanAudio: %v", err)
+	}
+	want := []byte("fLaC")
+	want = append(want, testFLACBlock(0, false, streamInfo)...)
+	want = append(want, testFLACBlock(3, true, seekTable)...)
+	want = append(want, audio...)
+	if !bytes.Equal(clean, want) {
+		t.Errorf("результат отличается от ожидаемого: %d байт, ожидалось %d", len(clean), len(want))
+	}
+	checkAudioReport(t, clean, "audio/flac", report,
+		[]string{"Ivanov"}, []string{"reference libFLAC 1.4.3"},
+		[]string{"комментарии Vorbis (1)", "обложки (2)"})
+	if !containsString(report.Comments, "Место: Moscow") || !containsString(report.Timestamps, "2024-05-01") {
+		t.Errorf("отчет: %q %q", report.Comments, report.Timestamps)
+	}
+}
+
+func TestCleanAudioOggOpus(t *testing.T) {
+	head := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	tags := append([]byte("OpusTags"), testVorbisComment("libopus 1.4",
+		"ARTIST=Ivanov", "COMMENT="+strings.Repeat("c", 300))...)
+	var input bytes.Buffer
+	testOggPage(&input, oggBOS, 0, 0, []int{len(head)}, head)
+	// Пакет тегов разбит на две страницы.
+	testOggPage(&input, 0, ^uint64(0), 1, []int{255}, tags[:255])
+	testOggPage(&input, oggContinued, 0, 2, []int{len(tags) - 255}, tags[255:])
+	var audioPages [][]byte
+	for i := 0; i < 3; i++ {
+		var page bytes.Buffer
+		flags := byte(0)
+		if i == 2 {
+			flags = 0x04 // Последняя страница потока
+		}
+		packets := bytes.Repeat([]byte{byte(0x50 + i)}, 120)
+		testOggPage(&page, flags, uint64(960*(i+1)), uint32(3+i), []int{60, 60}, packets)
+		audioPages = append(audioPages, page.Bytes())
+		input.Write(page.Bytes())
+	}
+	input.Write(testID3v1("Demo", "Id3v1Artist")) // Тег, дописанный в конец
+
+	clean, report, err := cleanAudio(input.Bytes(), "audio/ogg")
+	if err != nil {
+		t.Fatalf("cleanAudio: %v", err)
+	}
+	pages := oggPages(t, clean)
+	if len(pages) != 5 {
+		t.Fatalf("страниц %d, ожидалось 5", len(pages))
+	}
+	if first := oggPages(t, input.Bytes()[:input.Len()-128])[0]; !bytes.Equal(pages[0], first) {
+		t.Errorf("первая страница изменена")
+	}
+	comment, _ := readOggPage(pages[1])
+	if want := append([]byte("OpusTags"), make([]byte, 8)...); !bytes.Equal(comment.body, want) {
+		t.Errorf("пакет тегов не пустой: %q", comment.body)
+	}
+	for i, page := range pages {
+		if seq := binary.LittleEndian.Uint32(page[18:22]); seq != uint32(i) {
+			t.Errorf("страница %d: порядковый номер %d", i, seq)
+		}
+	}
+	// Страницы со звуком отличаются только порядковым номером и контрольной суммой.
+	for i, original := range audioPages {
+		got := pages[2+i]
+		if len(got) != len(original) || !bytes.Equal(got[:18], original[:18]) || !bytes.Equal(got[26:], original[26:]) {
+			t.Errorf("страница со звуком %d изменена", i)
+		}
+	}
+	checkAudioReport(t, clean, "audio/ogg", report,
+		[]string{"Ivanov", "Id3v1Artist"}, []string{"libopus 1.4"},
+		[]string{"теги Opus (1)", "ID3v1 (1)"})
+}
+
+func TestCleanAudioRejects(t *testing.T) {
+	var corrupt bytes.Buffer
+	head := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	testOggPage(&corrupt, oggBOS, 0, 0, []int{len(head)}, head)
+	broken := corrupt.Bytes()
+	broken[len(broken)-1] ^= 0xFF // Контрольная сумма не совпадает
+
+	var theora bytes.Buffer
+	testOggPage(&theora, oggBOS, 0, 0, []int{7}, []byte("\x80theora"))
+
+	tests := []struct {
+		name        string
+		contentType string
+		input       []byte
+	}{
+		{"MP3 без кадров", "audio/mpeg", append(testID3v23([2]string{"TPE1", "\x00Ivanov"}), "no audio here"...)},
+		{"FLAC без STREAMINFO", "audio/flac", append([]byte("fLaC"), testFLACBlock(4, true, testVorbisComment("x"))...)},
+		{"FLAC без аудиокадров", "audio/flac", append([]byte("fLaC"), testFLACBlock(0, true, make([]byte, 34))...)},
+		{"обрезанный блок FLAC", "audio/flac", []byte("fLaC\x00\x00\x00\x22")},
+		{"неверная контрольная сумма Ogg", "audio/ogg", broken},
+		{"поток Theora", "audio/ogg", theora.Bytes()},
+		{"Ogg без страниц", "audio/ogg", []byte("not ogg")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := cleanAudio(tt.input, tt.contentType)
+			if !errors.Is(err, ErrInvalidAudio) {
+				t.Fatalf("ожидалась ErrInvalidAudio, получено %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bufio"       // Для построчного чтения файла списка
+	"bytes"       // Для декодирования файла из памяти
+	"errors"      // Для ошибки-маркера
+	"fmt"         // Для форматирования ошибок
+	"image"       // Для работы с изображениями
+	"image/draw"  // Для сборки кадров анимации
+	"image/gif"   // Для проверки кадров анимации
+	"log"         // Для логирования загрузки списка
+	"math"        // Для косинусов DCT
+	"math/bits"   // Для расстояния Хэмминга
+	"os"          // Для чтения файла списка
+	"sort"        // Для медианы коэффициентов
+	"strconv"     // Для разбора хешей
+	"strings"     // Для разбора строк списка
+	"sync"        // Для защиты списка при перезагрузке
+	"sync/atomic" // Для счетчиков метрик
+	"time"        // Для периодической проверки файла
+)
+
+// Список блокировки по перцептивным хешам: известные запрещенные изображения
+// отклоняются до сохранения на диск, так что сервис их не хранит.
+// Перцептивный хеш (pHash) почти не меняется при пересжатии, масштабировании
+// и небольшой правке цветов, поэтому сравнение выполняется по расстоянию Хэмминга,
+// а не на точное совпадение.
+//
+// Формат файла (HASH_BLOCKLIST_PATH): по одному хешу на строку - 16 шестнадцатеричных
+// символов (64 бита), после хеша через пробел может идти метка (номер дела, источник).
+// Пустые строки и строки, начинающиеся с '#', пропускаются.
+
+// ErrBlockedContent - ошибка-маркер: изображение совпало с записью списка блокировки.
+// Подробности совпадения - в BlockedContentError.
+var ErrBlockedContent = errors.New("изображение совпадает с записью списка блокировки")
+
+// BlockedContentError описывает совпадение с записью списка блокировки.
+type BlockedContentError struct {
+	Hash     uint64 // Перцептивный хеш загруженного изображения
+	Matched  uint64 // Хеш из списка
+	Label    string // Метка записи списка (может быть пустой)
+	Distance int    // Расстояние Хэмминга между хешами
+}
+
+func (e *BlockedContentError) Error() string {
+	return fmt.Sprintf("%v (хеш %016x, запись %016x, расстояние %d)", ErrBlockedContent, e.Hash, e.Matched, e.Distance)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrBlockedContent).
+func (e *BlockedContentError) Unwrap() error {
+	return ErrBlockedContent
+}
+
+// Параметры хеша и списка.
+const (
+	phashSize                = 32 // Размер уменьшенного изображения для DCT
+	phashLowFreq             = 8  // Используемые низкие частоты (8x8 = 64 бита)
+	phashSamples             = 8  // Выборок на пиксель уменьшенного изображения по каждой оси
+	DefaultBlocklistDistance = 8  // Максимальное расстояние Хэмминга по умолчанию
+	maxBlocklistDistance     = 24 // Больше - слишком много ложных срабатываний
+)
+
+// blocklistEntry - запись списка блокировки.
+type blocklistEntry struct {
+	hash  uint64
+	label string
+}
+
+// hashBlocklist - загруженный список и параметры сравнения.
+type hashBlocklist struct {
+	path        string
+	maxDistance int
+	entries     []blocklistEntry
+	modTime     time.Time // Время изменения файла при последней загрузке
+	size        int64     // Размер файла при последней загрузке
+}
+
+var (
+	blocklistMu      sync.RWMutex
+	blocklistCurrent *hashBlocklist // nil - список не настроен
+)
+
+// Счетчики для метрик (см. BlocklistMetrics).
+var (
+	blocklistChecks       atomic.Int64 // Проверено изображений
+	blocklistMatches      atomic.Int64 // Отклонено по совпадению
+	blocklistReloads      atomic.Int64 // Успешных загрузок списка
+	blocklistReloadErrors atomic.Int64 // Неудачных загрузок списка
+)
+
+// BlocklistStats - значения счетчиков списка блокировки для метрик.
+type BlocklistStats struct {
+	Enabled      bool
+	Entries      int
+	Checks       int64
+	Matches      int64
+	Reloads      int64
+	ReloadErrors int64
+}
+
+// BlocklistMetrics возвращает текущие значения счетчиков списка блокировки.
+func BlocklistMetrics() BlocklistStats {
+	stats := BlocklistStats{
+		Checks:       blocklistChecks.Load(),
+		Matches:      blocklistMatches.Load(),
+		Reloads:      blocklistReloads.Load(),
+		ReloadErrors: blocklistReloadErrors.Load(),
+	}
+	blocklistMu.RLock()
+	if blocklistCurrent != nil {
+		stats.Enabled = true
+		stats.Entries = len(blocklistCurrent.entries)
+	}
+	blocklistMu.RUnlock()
+	return stats
+}
+
+// ParseBlocklistDistance разбирает максимальное расстояние Хэмминга
+// (переменная окружения HASH_BLOCKLIST_MAX_DISTANCE).
+func ParseBlocklistDistance(value string) (int, error) {
+	distance, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || distance < 0 || distance > maxBlocklistDistance {
+		return 0, fmt.Errorf("некорректное расстояние Хэмминга: %q (допустимо от 0 до %d)", value, maxBlocklistDistance)
+	}
+	return distance, nil
+}
+
+// LoadHashBlocklist загружает список блокировки из файла и, если reloadInterval > 0,
+// запускает фоновую проверку файла: при изменении список перечитывается без перезапуска
+// сервера. Если новый файл не удалось прочитать, продолжает действовать прежний список.
+// Вызывается один раз при старте приложения.
+func LoadHashBlocklist(path string, maxDistance int, reloadInterval time.Duration) error {
+	list, err := readHashBlocklist(path, maxDistance)
+	if err != nil {
+		blocklistReloadErrors.Add(1)
+		return err
+	}
+	blocklistMu.Lock()
+	blocklistCurrent = list
+	blocklistMu.Unlock()
+	blocklistReloads.Add(1)
+	log.Printf("Список блокировки загружен: %s (записей: %d, расстояние: %d)", path, len(list.entries), maxDistance)
+
+	if reloadInterval > 0 {
+		go watchHashBlocklist(path, maxDistance, reloadInterval)
+	}
+	return nil
+}
+
+// watchHashBlocklist периодически проверяет файл списка (см. reloadHashBlocklist).
+func watchHashBlocklist(path string, maxDistance int, interval time.Duration) {
+	for range time.Tick(interval) {
+		reloadHashBlocklist(path, maxDistance)
+	}
+}
+
+// reloadHashBlocklist сравнивает время изменения и размер файла списка с последней
+// загрузкой и перечитывает файл при изменении. Возвращает true, если список заменен.
+func reloadHashBlocklist(path string, maxDistance int) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Файл могут заменять (запись во временный файл и переименование) - не сбрасываем список.
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ: список блокировки %s недоступен: %v. Действует прежний список.", path, err)
+		return false
+	}
+	blocklistMu.RLock()
+	unchanged := info.ModTime().Equal(blocklistCurrent.modTime) && info.Size() == blocklistCurrent.size
+	blocklistMu.RUnlock()
+	if unchanged {
+		return false
+	}
+
+	list, err := readHashBlocklist(path, maxDistance)
+	if err != nil {
+		blocklistReloadErrors.Add(1)
+		log.Printf("ПРЕДУПРЕЖДЕНИЕ: не удалось перезагрузить список блокировки: %v. Действует прежний список.", err)
+		// Запоминаем состояние файла, чтобы не повторять ошибку при каждой проверке.
+		blocklistMu.Lock()
+		blocklistCurrent.modTime, blocklistCurrent.size = info.ModTime(), info.Size()
+		blocklistMu.Unlock()
+		return false
+	}
+	blocklistMu.Lock()
+	blocklistCurrent = list
+	blocklistMu.Unlock()
+	blocklistReloads.Add(1)
+	log.Printf("Список блокировки перезагружен: %s (записей: %d)", path, len(list.entries))
+	return true
+}
+
+// readHashBlocklist читает и разбирает файл списка. Любая некорректная строка делает
+// файл недействительным целиком: частично загруженный список опаснее прежнего.
+func readHashBlocklist(path string, maxDistance int) (*hashBlocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть список блокировки: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать список блокировки: %w", err)
+	}
+
+	list := &hashBlocklist{path: path, maxDistance: maxDistance, modTime: info.ModTime(), size: info.Size()}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hashText, label, _ := strings.Cut(text, " ")
+		if len(hashText) != 16 {
+			return nil, fmt.Errorf("список блокировки %s, строка %d: хеш должен состоять из 16 шестнадцатеричных символов", path, line)
+		}
+		hash, err := strconv.ParseUint(hashText, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("список блокировки %s, строка %d: некорректный хеш %q", path, line, hashText)
+		}
+		list.entries = append(list.entries, blocklistEntry{hash: hash, label: strings.TrimSpace(label)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка блокировки %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// blocklistEnabled сообщает, настроен ли список блокировки. Позволяет не декодировать
+// изображения, которые нужны только для сверки (например, встроенные в документы).
+func blocklistEnabled() bool {
+	blocklistMu.RLock()
+	defer blocklistMu.RUnlock()
+	return blocklistCurrent != nil
+}
+
+// checkBlocklist сравнивает изображение со списком блокировки. Для анимации проверяется
+// каждый кадр (запрещенное изображение может быть спрятано среди обычных кадров).
+// orientation - EXIF-ориентация: хеш считается для изображения в том виде, в котором
+// его видит пользователь. Возвращает nil, если список не настроен или совпадений нет.
+func checkBlocklist(img image.Image, anim *gif.GIF, orientation int) error {
+	blocklistMu.RLock()
+	list := blocklistCurrent
+	blocklistMu.RUnlock()
+	if list == nil {
+		return nil
+	}
+	blocklistChecks.Add(1)
+
+	var hashes []uint64
+	if anim != nil {
+		hashes = gifPerceptualHashes(anim)
+	} else {
+		hashes = []uint64{perceptualHash(img, orientation)}
+	}
+	for _, hash := range hashes {
+		// Полный перебор: сравнение 64-битных хешей дешевое, списки в десятки тысяч
+		// записей проверяются за доли миллисекунды.
+		for _, entry := range list.entries {
+			if distance := bits.OnesCount64(hash ^ entry.hash); distance <= list.maxDistance {
+				blocklistMatches.Add(1)
+				return &BlockedContentError{Hash: hash, Matched: entry.hash, Label: entry.label, Distance: distance}
+			}
+		}
+	}
+	return nil
+}
+
+// gifPerceptualHashes возвращает хеши всех кадров анимации, собранных на логическом экране
+// (кадры GIF часто содержат только изменившуюся часть изображения).
+func gifPerceptualHashes(anim *gif.GIF) []uint64 {
+	screen := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if screen.Empty() {
+		screen = anim.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(screen)
+	hashes := make([]uint64, 0, len(anim.Image))
+	for _, frame := range anim.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		hashes = append(hashes, perceptualHash(canvas, 1))
+	}
+	return hashes
+}
+
+// perceptualHash вычисляет 64-битный перцептивный хеш (pHash): изображение уменьшается
+// до 32x32 в оттенках серого, к нему применяется двумерное DCT, и для 8x8 низших частот
+// (кроме постоянной составляющей) записывается, больше ли коэффициент медианы.
+func perceptualHash(img image.Image, orientation int) uint64 {
+	// Уменьшение усреднением сетки выборок: для больших изображений читается
+	// не каждый пиксель, а phashSamples x phashSamples точек на пиксель результата.
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	small := image.NewGray(image.Rect(0, 0, phashSize, phashSize))
+	const grid = phashSize * phashSamples
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			var sum float64
+			for sy := 0; sy < phashSamples; sy++ {
+				py := bounds.Min.Y + ((y*phashSamples+sy)*2+1)*h/(2*grid)
+				for sx := 0; sx < phashSamples; sx++ {
+					px := bounds.Min.X + ((x*phashSamples+sx)*2+1)*w/(2*grid)
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			small.Pix[y*small.Stride+x] = uint8(sum / (phashSamples * phashSamples) / 257)
+		}
+	}
+	// Поворот применяется к уменьшенной копии - результат тот же, а работы меньше.
+	var oriented image.Image = small
+	if orientation != 1 {
+		oriented = applyOrientation(small, orientation)
+	}
+
+	var pixels [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			r, _, _, _ := oriented.At(oriented.Bounds().Min.X+x, oriented.Bounds().Min.Y+y).RGBA()
+			pixels[y][x] = float64(r >> 8)
+		}
+	}
+
+	// DCT-II по строкам, затем по столбцам (нужны только низшие частоты).
+	var cosines [phashLowFreq][phashSize]float64
+	for u := 0; u < phashLowFreq; u++ {
+		for x := 0; x < phashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	var rows [phashSize][phashLowFreq]float64
+	for y := 0; y < phashSize; y++ {
+		for u := 0; u < phashLowFreq; u++ {
+			for x := 0; x < phashSize; x++ {
+				rows[y][u] += pixels[y][x] * cosines[u][x]
+			}
+		}
+	}
+	var coefficients [phashLowFreq * phashLowFreq]float64
+	for v := 0; v < phashLowFreq; v++ {
+		for u := 0; u < phashLowFreq; u++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients[v*phashLowFreq+u] = sum
+		}
+	}
+
+	// Медиана без постоянной составляющей (она отражает только среднюю яркость).
+	sorted := make([]float64, 0, len(coefficients)-1)
+	sorted = append(sorted, coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coefficients {
+		if i > 0 && c > median {
+			hash |= 1 << (63 - i)
+		}
+	}
+	return hash
+}
+
+// PerceptualHashFile вычисляет перцептивный хеш файла изображения так же, как при загрузке
+// (с учетом EXIF-ориентации). Используется для пополнения списка (команда phash).
+func PerceptualHashFile(data []byte) (uint64, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("не удалось декодировать изображение: %w", err)
+	}
+	return perceptualHash(img, imageOrientation(data, format)), nil
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для повторного сжатия JPEG
+	"errors"        // Для проверки ошибок-маркеров
+	"fmt"           // Для строк списка
+	"image"         // Для тестовых изображений
+	"image/color"   // Для кадров анимации
+	"image/gif"     // Для проверки анимации
+	"image/jpeg"    // Для повторного сжатия
+	"math/bits"     // Для расстояния Хэмминга
+	"os"            // Для файла списка
+	"path/filepath" // Для пути к файлу списка
+	"strings"       // Для проверки текста ошибок
+	"testing"       // Для тестов
+	"time"          // Для времени изменения файла
+
+	// Сторонние библиотеки
+	"golang.org/x/image/draw" // Для масштабирования
+)
+
+// setTestBlocklist записывает список во временный файл, загружает его без фоновой
+// проверки и восстанавливает прежний список после теста. Возвращает путь к файлу.
+func setTestBlocklist(t *testing.T, content string) string {
+	t.Helper()
+	blocklistMu.RLock()
+	previous := blocklistCurrent
+	blocklistMu.RUnlock()
+	t.Cleanup(func() {
+		blocklistMu.Lock()
+		blocklistCurrent = previous
+		blocklistMu.Unlock()
+	})
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := LoadHashBlocklist(path, DefaultBlocklistDistance, 0); err != nil {
+		t.Fatalf("LoadHashBlocklist: %v", err)
+	}
+	return path
+}
+
+// reencode уменьшает изображение в scale раз и пересжимает в JPEG с качеством quality.
+func reencode(t *testing.T, img image.Image, scale float64, quality int) image.Image {
+	t.Helper()
+	b := img.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)))
+	draw.CatmullRom.Scale(small, small.Bounds(), img, b, draw.Src, nil)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, small, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	decoded, err := jpeg.Decode(&encoded)
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	return decoded
+}
+
+func TestCheckBlocklist(t *testing.T) {
+	photo := testWatermarkPhoto(400, 300)
+	hash := perceptualHash(photo, 1)
+	setTestBlocklist(t, fmt.Sprintf("# Тестовый список\n\n%016x дело 42\n", hash))
+
+	t.Run("копии совпадают", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			img  image.Image
+		}{
+			{"исходное изображение", photo},
+			{"JPEG с качеством 70", reencode(t, photo, 1, 70)},
+			{"уменьшено до 0,5 и пересжато", reencode(t, photo, 0.5, 80)},
+			{"уменьшено до 0,25", reencode(t, photo, 0.25, 90)},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				err := checkBlocklist(tt.img, nil, 1)
+				var blocked *BlockedContentError
+				if !errors.Is(err, ErrBlockedContent) || !errors.As(err, &blocked) {
+					t.Fatalf("ожидалась BlockedContentError, получено %v (расстояние %d)", err, bits.OnesCount64(perceptualHash(tt.img, 1)^hash))
+				}
+				if blocked.Matched != hash || blocked.Label != "дело 42" || blocked.Distance > DefaultBlocklistDistance {
+					t.Errorf("совпадение %+v", blocked)
+				}
+			})
+		}
+	})
+
+	t.Run("ориентация EXIF", func(t *testing.T) {
+		// Файл хранит повернутые пиксели и тег Orientation=6: пользователь видит исходное изображение.
+		stored := applyOrientation(photo, 8)
+		if err := checkBlocklist(stored, nil, 6); !errors.Is(err, ErrBlockedContent) {
+			t.Errorf("ожидалась ErrBlockedContent, получено %v", err)
+		}
+	})
+
+	t.Run("другие изображения не совпадают", func(t *testing.T) {
+		checker := image.NewGray(image.Rect(0, 0, 400, 300))
+		for y := 0; y < 300; y++ {
+			for x := 0; x < 400; x++ {
+				if (x/50+y/50)%2 == 0 {
+					checker.Pix[y*checker.Stride+x] = 255
+				}
+			}
+		}
+		for _, tt := range []struct {
+			name string
+			img  image.Image
+		}{
+			{"градиент", testGradient(400, 300)},
+			{"шахматная доска", checker},
+			{"зеркальное отражение", applyOrientation(photo, 2)},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := checkBlocklist(tt.img, nil, 1); err != nil {
+					t.Errorf("ложное совпадение: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("кадр анимации", func(t *testing.T) {
+		frame := func(img image.Image) *image.Paletted {
+			p := image.NewPaletted(img.Bounds(), gifGrayPalette())
+			draw.FloydSteinberg.Draw(p, p.Bounds(), img, image.Point{})
+			return p
+		}
+		anim := &gif.GIF{
+			Image:  []*image.Paletted{frame(testGradient(400, 300)), frame(photo)},
+			Delay:  []int{10, 10},
+			Config: image.Config{Width: 400, Height: 300},
+		}
+		if err := checkBlocklist(anim.Image[0], anim, 1); !errors.Is(err, ErrBlockedContent) {
+			t.Errorf("запрещенный второй кадр не найден: %v", err)
+		}
+	})
+}
+
+// gifGrayPalette - палитра из 256 оттенков серого для кадров GIF.
+func gifGrayPalette() color.Palette {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i)}
+	}
+	return palette
+}
+
+func TestCheckBlocklistDisabled(t *testing.T) {
+	blocklistMu.Lock()
+	previous := blocklistCurrent
+	blocklistCurrent = nil
+	blocklistMu.Unlock()
+	t.Cleanup(func() {
+		blocklistMu.Lock()
+		blocklistCurrent = previous
+		blocklistMu.Unlock()
+	})
+	if blocklistEnabled() {
+		t.Errorf("blocklistEnabled() = true без списка")
+	}
+	if err := checkBlocklist(testWatermarkPhoto(64, 64), nil, 1); err != nil {
+		t.Errorf("checkBlocklist без списка: %v", err)
+	}
+}
+
+func TestReadHashBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, fmt.Sprintf("list-%d.txt", len(content)))
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	list, err := readHashBlocklist(write("# комментарий\n\n  00ff00ff00ff00ff  источник: проверка  \nFFFFFFFFFFFFFFFF\n"), 5)
+	if err != nil {
+		t.Fatalf("readHashBlocklist: %v", err)
+	}
+	want := []blocklistEntry{{0x00ff00ff00ff00ff, "источник: проверка"}, {0xFFFFFFFFFFFFFFFF, ""}}
+	if len(list.entries) != len(want) || list.entries[0] != want[0] || list.entries[1] != want[1] || list.maxDistance != 5 {
+		t.Errorf("записи %+v", list.entries)
+	}
+
+	for _, tt := range []struct {
+		name, content, want string
+	}{
+		{"короткий хеш", "00ff00ff00ff00ff\n00ff\n", "строка 2: хеш должен состоять из 16"},
+		{"не шестнадцатеричные символы", "# список\nzzzzzzzzzzzzzzzz метка\n", `строка 2: некорректный хеш "zzzzzzzzzzzzzzzz"`},
+		{"хеш с префиксом 0x", "0x00ff00ff00ff00\n", "строка 1: некорректный хеш"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readHashBlocklist(write(tt.content), DefaultBlocklistDistance)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ожидалась ошибка %q, получено %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := LoadHashBlocklist(filepath.Join(dir, "missing.txt"), DefaultBlocklistDistance, 0); err == nil {
+		t.Errorf("LoadHashBlocklist: отсутствующий файл принят")
+	}
+}
+
+func TestParseBlocklistDistance(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"8", 8, true}, {" 0 ", 0, true}, {"24", 24, true}, {"25", 0, false}, {"-1", 0, false}, {"восемь", 0, false},
+	} {
+		got, err := ParseBlocklistDistance(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseBlocklistDistance(%q) = %d, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestReloadHashBlocklist(t *testing.T) {
+	first, second := uint64(0x1111111111111111), uint64(0x2222222222222222)
+	path := setTestBlocklist(t, fmt.Sprintf("%016x\n", first))
+	entries := func() []blocklistEntry {
+		blocklistMu.RLock()
+		defer blocklistMu.RUnlock()
+		return blocklistCurrent.entries
+	}
+	// Время изменения сдвигается явно: запись в течение одной секунды может его не изменить.
+	touch := func(content string, offset time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		modTime := time.Now().Add(offset)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	if reloadHashBlocklist(path, DefaultBlocklistDistance) {
+		t.Errorf("список перезагружен без изменения файла")
+	}
+
+	touch(fmt.Sprintf("%016x\n%016x новая запись\n", first, second), time.Minute)
+	if !reloadHashBlocklist(path, DefaultBlocklistDistance) || len(entries()) != 2 || entries()[1].label != "новая запись" {
+		t.Fatalf("список не перезагружен: %+v", entries())
+	}
+
+	// Некорректный файл: действует прежний список, ошибка учитывается один раз.
+	errorsBefore := BlocklistMetrics().ReloadErrors
+	touch(fmt.Sprintf("%016x\nне хеш\n", first), 2*time.Minute)
+	if reloadHashBlocklist(path, DefaultBlocklistDistance) || reloadHashBlocklist(path, DefaultBlocklistDistance) {
+		t.Errorf("принят некорректный список")
+	}
+	if got := BlocklistMetrics().ReloadErrors - errorsBefore; got != 1 {
+		t.Errorf("ошибок перезагрузки %d, ожидалась 1", got)
+	}
+	if len(entries()) != 2 {
+		t.Errorf("прежний список потерян: %+v", entries())
+	}
+
+	// Файл временно удален (замена через переименование): список сохраняется.
+	os.Remove(path)
+	if reloadHashBlocklist(path, DefaultBlocklistDistance) || len(entries()) != 2 {
+		t.Errorf("список сброшен при отсутствии файла: %+v", entries())
+	}
+
+	touch(fmt.Sprintf("%016x\n", second), 3*time.Minute)
+	if !reloadHashBlocklist(path, DefaultBlocklistDistance) || len(entries()) != 1 || entries()[0].hash != second {
+		t.Errorf("исправленный список не загружен: %+v", entries())
+	}
+	if stats := BlocklistMetrics(); !stats.Enabled || stats.Entries != 1 {
+		t.Errorf("метрики %+v", stats)
+	}
+}
+
+func TestPerceptualHashFile(t *testing.T) {
+	photo := testWatermarkPhoto(200, 150)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, photo, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	hash, err := PerceptualHashFile(encoded.Bytes())
+	if err != nil {
+		t.Fatalf("PerceptualHashFile: %v", err)
+	}
+	if d := bits.OnesCount64(hash ^ perceptualHash(photo, 1)); d > DefaultBlocklistDistance {
+		t.Errorf("расстояние до хеша исходного изображения %d", d)
+	}
+	if _, err := PerceptualHashFile([]byte("not an image")); err == nil {
+		t.Errorf("ожидалась ошибка для не-изображения")
+	}
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для поиска сигнатур и распаковки
+	"compress/zlib"   // Для распаковки профиля из чанка iCCP
+	"encoding/binary" // Для чтения полей профиля (big-endian)
+	"fmt"             // Для форматирования ошибок
+	"image"           // Для работы с изображениями
+	"image/color"     // Для преобразования палитр
+	"image/draw"      // Для приведения изображений к NRGBA
+	"io"              // Для ограниченного чтения распакованных данных
+	"math"            // Для кривых тонопередачи
+	"sort"            // Для упорядочивания частей профиля JPEG
+	"strings"         // Для очистки описания профиля
+	"unicode/utf16"   // Для описаний профилей ICC v4 (mluc)
+)
+
+// Встроенные ICC-профили удаляются вместе с остальными метаданными: по их описанию
+// и содержимому можно определить устройство или программу. Но если просто удалить
+// профиль широкого охвата (Display P3, Adobe RGB), просмотрщик будет считать
+// пиксели значениями sRGB, и цвета станут блеклыми. Поэтому пиксели сначала
+// переводятся из пространства профиля в sRGB, а результат сохраняется без профиля.
+//
+// Поддерживаются матричные RGB-профили (теги rXYZ/gXYZ/bXYZ и rTRC/gTRC/bTRC) -
+// так устроены профили камер телефонов и распространенные рабочие пространства.
+// Профили на таблицах (LUT), CMYK и Gray удаляются без преобразования.
+
+// maxICCProfileSize - максимальный размер профиля, который будет разобран.
+const maxICCProfileSize = 4 << 20
+
+// iccProfileSignature - префикс APP2-сегментов JPEG с частями ICC-профиля.
+var iccProfileSignature = []byte("ICC_PROFILE\x00")
+
+// iccCurve - кривая тонопередачи (TRC) одного канала: перевод значения канала в линейную яркость.
+type iccCurve struct {
+	gamma  float64    // Показатель степени (для "curv" с одним значением и "para")
+	table  []float64  // Табличная кривая (значения 0..1), если задана
+	kind   int        // Тип параметрической кривой 0-4 (для таблицы и гаммы - 0)
+	params [7]float64 // Параметры g, a, b, c, d, e, f параметрической кривой
+}
+
+// eval возвращает линейное значение для нормализованного значения канала x (0..1).
+func (c iccCurve) eval(x float64) float64 {
+	if c.table != nil {
+		pos := x * float64(len(c.table)-1)
+		i := int(pos)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		frac := pos - float64(i)
+		return c.table[i]*(1-frac) + c.table[i+1]*frac
+	}
+	g, a, b, cc, d, e, f := c.params[0], c.params[1], c.params[2], c.params[3], c.params[4], c.params[5], c.params[6]
+	switch c.kind {
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + cc
+		}
+		return cc
+	case 3:
+		if x >= d {
+			return math.Pow(a*x+b, g)
+		}
+		return cc * x
+	case 4:
+		if x >= d {
+			return math.Pow(a*x+b, g) + e
+		}
+		return cc*x + f
+	}
+	return math.Pow(x, c.gamma)
+}
+
+// iccProfile - разобранный матричный RGB-профиль.
+type iccProfile struct {
+	Description string        // Описание профиля (тег desc), показывается в отчете
+	matrix      [3][3]float64 // Перевод линейного RGB в XYZ (D50); столбцы - rXYZ, gXYZ, bXYZ
+	trc         [3]iccCurve   // Кривые тонопередачи каналов R, G, B
+}
+
+// srgbD50Matrix - матрица профиля sRGB IEC61966-2.1 (адаптированная к D50, как требует ICC).
+var srgbD50Matrix = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// srgbDecode переводит значение sRGB (0..1) в линейную яркость.
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbEncode переводит линейную яркость (0..1) в значение sRGB.
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// extractICCProfile возвращает встроенный ICC-профиль файла или nil, если профиля нет.
+func extractICCProfile(data []byte, format string) []byte {
+	var profile []byte
+	switch format {
+	case "jpeg":
+		profile = jpegICCProfile(data)
+	case "png":
+		profile = pngICCProfile(data)
+	case "webp":
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return nil
+		}
+		for _, chunk := range chunks {
+			if chunk.FourCC == "ICCP" {
+				profile = chunk.Data
+				break
+			}
+		}
+	case "tiff":
+		ex, err := parseEXIF(data)
+		if err != nil {
+			return nil
+		}
+		if e := findEntry(ex.IFD0, tiffTagICC); e != nil {
+			profile = e.Value
+		}
+	}
+	if len(profile) > maxICCProfileSize {
+		return nil
+	}
+	return profile
+}
+
+// jpegICCProfile собирает профиль из APP2-сегментов. Большие профили разбиты на части:
+// после сигнатуры идут номер части и общее количество частей (по одному байту).
+func jpegICCProfile(data []byte) []byte {
+	segments, _, err := readJPEGHeaderSegments(data)
+	if err != nil {
+		return nil
+	}
+	type part struct {
+		seq  byte
+		data []byte
+	}
+	var parts []part
+	for _, seg := range segments {
+		if seg.Marker != jpegMarkerAPP2 || !bytes.HasPrefix(seg.Payload, iccProfileSignature) || len(seg.Payload) < len(iccProfileSignature)+2 {
+			continue
+		}
+		p := seg.Payload[len(iccProfileSignature):]
+		parts = append(parts, part{seq: p[0], data: p[2:]})
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].seq < parts[j].seq })
+	var profile []byte
+	for _, p := range parts {
+		profile = append(profile, p.data...)
+	}
+	return profile
+}
+
+// pngICCProfile распаковывает профиль из чанка iCCP: имя профиля, нулевой байт,
+// метод сжатия (0 - zlib) и сжатые данные.
+func pngICCProfile(data []byte) []byte {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil
+	}
+	for _, chunk := range chunks {
+		if chunk.Type != "iCCP" {
+			continue
+		}
+		nul := bytes.IndexByte(chunk.Data, 0)
+		if nul < 0 || nul+2 > len(chunk.Data) || chunk.Data[nul+1] != 0 {
+			return nil
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(chunk.Data[nul+2:]))
+		if err != nil {
+			return nil
+		}
+		defer zr.Close()
+		// Ограничиваем распаковку: сжатый профиль может оказаться zip-бомбой.
+		profile, err := io.ReadAll(io.LimitReader(zr, maxICCProfileSize+1))
+		if err != nil {
+			return nil
+		}
+		return profile
+	}
+	return nil
+}
+
+// parseICCProfile разбирает матричный RGB-профиль.
+func parseICCProfile(profile []byte) (*iccProfile, error) {
+	if len(profile) < 132 || string(profile[36:40]) != "acsp" {
+		return nil, fmt.Errorf("некорректный ICC-профиль")
+	}
+	if cs := string(profile[16:20]); cs != "RGB " {
+		return nil, fmt.Errorf("цветовое пространство профиля %q не поддерживается", strings.TrimSpace(cs))
+	}
+	if pcs := string(profile[20:24]); pcs != "XYZ " {
+		return nil, fmt.Errorf("пространство связи профиля %q не поддерживается", strings.TrimSpace(pcs))
+	}
+
+	// Таблица тегов: количество, затем записи (сигнатура, смещение, размер).
+	count := int(binary.BigEndian.Uint32(profile[128:132]))
+	if count > (len(profile)-132)/12 {
+		return nil, fmt.Errorf("некорректная таблица тегов ICC-профиля")
+	}
+	tags := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entry := profile[132+i*12:]
+		offset := int(binary.BigEndian.Uint32(entry[4:8]))
+		size := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || size < 0 || offset > len(profile) || size > len(profile)-offset {
+			return nil, fmt.Errorf("тег %q выходит за пределы ICC-профиля", entry[:4])
+		}
+		tags[string(entry[:4])] = profile[offset : offset+size]
+	}
+
+	p := &iccProfile{Description: iccDescription(tags["desc"])}
+	for col, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, err := iccXYZ(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("тег %s: %w (профили на таблицах не поддерживаются)", sig, err)
+		}
+		for row := 0; row < 3; row++ {
+			p.matrix[row][col] = xyz[row]
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := iccParseCurve(tags[sig])
+		if err != nil {
+			return nil, fmt.Errorf("тег %s: %w", sig, err)
+		}
+		p.trc[i] = curve
+	}
+	return p, nil
+}
+
+// s15Fixed16 читает знаковое число с фиксированной точкой 15.16.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// iccXYZ читает тег типа XYZType с одним значением.
+func iccXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("отсутствует или имеет неверный тип")
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+// iccParseCurve читает кривую тонопередачи типа "curv" или "para".
+func iccParseCurve(tag []byte) (iccCurve, error) {
+	if len(tag) < 12 {
+		return iccCurve{}, fmt.Errorf("отсутствует или обрезан")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if n > (len(tag)-12)/2 {
+			return iccCurve{}, fmt.Errorf("обрезанная таблица кривой")
+		}
+		switch n {
+		case 0:
+			return iccCurve{gamma: 1}, nil // Тождественная кривая
+		case 1:
+			return iccCurve{gamma: float64(binary.BigEndian.Uint16(tag[12:14])) / 256}, nil // u8Fixed8
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return iccCurve{table: table}, nil
+	case "para":
+		kind := int(binary.BigEndian.Uint16(tag[8:10]))
+		paramCounts := []int{1, 3, 4, 5, 7}
+		if kind >= len(paramCounts) || len(tag) < 12+4*paramCounts[kind] {
+			return iccCurve{}, fmt.Errorf("неподдерживаемая параметрическая кривая типа %d", kind)
+		}
+		c := iccCurve{kind: kind}
+		for i := 0; i < paramCounts[kind]; i++ {
+			c.params[i] = s15Fixed16(tag[12+i*4:])
+		}
+		c.gamma = c.params[0]
+		if kind > 0 && c.params[1] == 0 {
+			return iccCurve{}, fmt.Errorf("некорректные параметры кривой")
+		}
+		return c, nil
+	}
+	return iccCurve{}, fmt.Errorf("неизвестный тип кривой %q", tag[:4])
+}
+
+// iccDescription извлекает описание профиля из тега desc (ICC v2, "desc")
+// или многоязычной строки (ICC v4, "mluc").
+func iccDescription(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if n > len(tag)-12 {
+			n = len(tag) - 12
+		}
+		return strings.TrimSpace(strings.TrimRight(string(tag[12:12+n]), "\x00"))
+	case "mluc":
+		records := int(binary.BigEndian.Uint32(tag[8:12]))
+		if records < 1 || len(tag) < 28 {
+			return ""
+		}
+		// Берем первую запись: длина и смещение строки UTF-16BE.
+		length := int(binary.BigEndian.Uint32(tag[20:24]))
+		offset := int(binary.BigEndian.Uint32(tag[24:28]))
+		if offset < 0 || length < 0 || offset > len(tag) || length > len(tag)-offset {
+			return ""
+		}
+		raw := tag[offset : offset+length]
+		units := make([]uint16, len(raw)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(raw[i*2:])
+		}
+		return strings.TrimSpace(strings.TrimRight(string(utf16.Decode(units)), "\x00"))
+	}
+	return ""
+}
+
+// isSRGB сообщает, совпадает ли профиль с sRGB (с точностью до округления).
+// Для таких профилей преобразование не нужно: достаточно удалить профиль.
+func (p *iccProfile) isSRGB() bool {
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			if math.Abs(p.matrix[row][col]-srgbD50Matrix[row][col]) > 0.005 {
+				return false
+			}
+		}
+	}
+	for _, curve := range p.trc {
+		for i := 0; i <= 16; i++ {
+			x := float64(i) / 16
+			if math.Abs(curve.eval(x)-srgbDecode(x)) > 0.01 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toSRGBMatrix возвращает матрицу перевода линейного RGB профиля в линейный sRGB.
+func (p *iccProfile) toSRGBMatrix() [3][3]float64 {
+	return mul3(invert3(srgbD50Matrix), p.matrix)
+}
+
+// mul3 перемножает матрицы 3x3.
+func mul3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// invert3 обращает матрицу 3x3 (матрица sRGB заведомо невырожденная).
+func invert3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return [3][3]float64{
+		{(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det, (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det, (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det},
+		{(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det, (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det, (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det},
+	}
+}
+
+// srgbConverter переводит значения каналов из пространства профиля в sRGB
+// через таблицы: линеаризация входа (по размеру входной разрядности) и
+// кодирование выхода (16 бит).
+type srgbConverter struct {
+	linear [3][]float64  // Линейные значения для каждого входного значения канала
+	matrix [3][3]float64 // Перевод линейного RGB профиля в линейный sRGB
+	encode []uint16      // sRGB-значение (16 бит) для линейного значения, квантованного до 16 бит
+}
+
+func newSRGBConverter(p *iccProfile, levels int) *srgbConverter {
+	c := &srgbConverter{matrix: p.toSRGBMatrix(), encode: make([]uint16, 65536)}
+	for ch := 0; ch < 3; ch++ {
+		c.linear[ch] = make([]float64, levels)
+		for i := range c.linear[ch] {
+			c.linear[ch][i] = p.trc[ch].eval(float64(i) / float64(levels-1))
+		}
+	}
+	for i := range c.encode {
+		c.encode[i] = uint16(math.Round(srgbEncode(float64(i)/65535) * 65535))
+	}
+	return c
+}
+
+// convert переводит значения каналов (в диапазоне входной разрядности) в sRGB (16 бит).
+// Цвета вне охвата sRGB обрезаются по границе.
+func (c *srgbConverter) convert(r, g, b int) (uint16, uint16, uint16) {
+	lin := [3]float64{c.linear[0][r], c.linear[1][g], c.linear[2][b]}
+	var out [3]uint16
+	for i := 0; i < 3; i++ {
+		v := c.matrix[i][0]*lin[0] + c.matrix[i][1]*lin[1] + c.matrix[i][2]*lin[2]
+		v = math.Max(0, math.Min(1, v))
+		out[i] = c.encode[int(math.Round(v*65535))]
+	}
+	return out[0], out[1], out[2]
+}
+
+// convertToSRGB переводит пиксели изображения из пространства профиля в sRGB.
+// 16-битные изображения остаются 16-битными, палитровые - палитровыми (преобразуется
+// только палитра), остальные приводятся к NRGBA. Полутоновые изображения возвращаются
+// без изменений: RGB-профиль к ним не применим.
+func convertToSRGB(img image.Image, p *iccProfile) image.Image {
+	switch src := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return img
+	case *image.Paletted:
+		conv := newSRGBConverter(p, 256)
+		palette := make(color.Palette, len(src.Palette))
+		for i, entry := range src.Palette {
+			nc := color.NRGBAModel.Convert(entry).(color.NRGBA)
+			r, g, b := conv.convert(int(nc.R), int(nc.G), int(nc.B))
+			palette[i] = color.NRGBA{to8Bit(r), to8Bit(g), to8Bit(b), nc.A}
+		}
+		out := *src
+		out.Palette = palette
+		return &out
+	case *image.NRGBA64, *image.RGBA64:
+		out := image.NewNRGBA64(src.Bounds())
+		draw.Draw(out, out.Bounds(), src, src.Bounds().Min, draw.Src)
+		conv := newSRGBConverter(p, 65536)
+		for i := 0; i+7 < len(out.Pix); i += 8 {
+			r, g, b := conv.convert(
+				int(binary.BigEndian.Uint16(out.Pix[i:])),
+				int(binary.BigEndian.Uint16(out.Pix[i+2:])),
+				int(binary.BigEndian.Uint16(out.Pix[i+4:])))
+			binary.BigEndian.PutUint16(out.Pix[i:], r)
+			binary.BigEndian.PutUint16(out.Pix[i+2:], g)
+			binary.BigEndian.PutUint16(out.Pix[i+4:], b)
+		}
+		return out
+	}
+
+	out := image.NewNRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	conv := newSRGBConverter(p, 256)
+	for i := 0; i+3 < len(out.Pix); i += 4 {
+		r, g, b := conv.convert(int(out.Pix[i]), int(out.Pix[i+1]), int(out.Pix[i+2]))
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2] = to8Bit(r), to8Bit(g), to8Bit(b)
+	}
+	return out
+}
+
+// to8Bit переводит 16-битное значение канала в 8-битное с округлением.
+func to8Bit(v uint16) uint8 {
+	return uint8((uint32(v)*255 + 32767) / 65535)
+}
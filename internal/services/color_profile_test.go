@@ -0,0 +1,324 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки профилей и файлов
+	"compress/zlib"   // Для чанка iCCP
+	"encoding/binary" // Для полей профиля
+	"image"           // Для тестовых изображений
+	"image/color"     // Для сравнения цветов
+	"image/png"       // Для кодирования и декодирования
+	"os"              // Для чтения сохраненного файла
+	"path/filepath"   // Для пути к сохраненному файлу
+	"testing"         // Для тестов
+)
+
+// testICCCurve - кривая тонопередачи тестового профиля: гамма (curv с одним значением)
+// или кривая sRGB (para типа 3).
+func testICCCurve(gamma float64) []byte {
+	if gamma == 0 {
+		tag := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+		for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+			tag = binary.BigEndian.AppendUint32(tag, uint32(int32(v*65536)))
+		}
+		return tag
+	}
+	tag := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01")
+	return binary.BigEndian.AppendUint16(tag, uint16(gamma*256))
+}
+
+// testICCProfile собирает матричный RGB-профиль ICC v2: описание, первичные цвета
+// (столбцы матрицы в XYZ D50) и одинаковая для всех каналов кривая (см. testICCCurve).
+func testICCProfile(description string, primaries [3][3]float64, gamma float64) []byte {
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(description)+1))
+	desc = append(append(desc, description...), 0)
+	tags := []struct {
+		sig  string
+		data []byte
+	}{{"desc", desc}}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range primaries[i] {
+			xyz = binary.BigEndian.AppendUint32(xyz, uint32(int32(v*65536)))
+		}
+		tags = append(tags, struct {
+			sig  string
+			data []byte
+		}{sig, xyz})
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, struct {
+			sig  string
+			data []byte
+		}{sig, testICCCurve(gamma)})
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	var table, body []byte
+	table = binary.BigEndian.AppendUint32(table, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	for _, tag := range tags {
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(body)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+		body = append(body, tag.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	profile := append(append(header, table...), body...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+// Первичные цвета (столбцы rXYZ, gXYZ, bXYZ) распространенных пространств, адаптированные к D50.
+var (
+	testDisplayP3 = [3][3]float64{{0.5151, 0.2412, -0.0011}, {0.2920, 0.6922, 0.0419}, {0.1571, 0.0666, 0.7841}}
+	testAdobeRGB  = [3][3]float64{{0.6097, 0.3111, 0.0195}, {0.2053, 0.6257, 0.0609}, {0.1492, 0.0632, 0.7446}}
+	testSRGB      = [3][3]float64{{0.4361, 0.2225, 0.0139}, {0.3851, 0.7169, 0.0971}, {0.1431, 0.0606, 0.7142}}
+)
+
+// testICCPNG кодирует изображение в PNG с чанком iCCP.
+func testICCPNG(t *testing.T, img image.Image, profile []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(profile)
+	zw.Close()
+	return testPNGImage(t, img, pngChunk{Type: "iCCP", Data: append([]byte("profile\x00\x00"), compressed.Bytes()...)})
+}
+
+// testPNGImage кодирует img в PNG и вставляет чанки extra после IHDR.
+func testPNGImage(t *testing.T, img image.Image, extra ...pngChunk) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	chunks := mustPNGChunks(t, encoded.Bytes())
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i, c := range chunks {
+		writePNGChunk(&out, c.Type, c.Data)
+		if i == 0 {
+			for _, e := range extra {
+				writePNGChunk(&out, e.Type, e.Data)
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// checkColor сравнивает цвет с ожидаемым с допуском tolerance по каждому каналу.
+func checkColor(t *testing.T, name string, got color.Color, want color.NRGBA, tolerance int) {
+	t.Helper()
+	g := color.NRGBAModel.Convert(got).(color.NRGBA)
+	for i, pair := range [][2]uint8{{g.R, want.R}, {g.G, want.G}, {g.B, want.B}, {g.A, want.A}} {
+		if d := int(pair[0]) - int(pair[1]); d > tolerance || d < -tolerance {
+			t.Errorf("%s: канал %d = %d, ожидалось %d±%d (цвет %v)", name, i, pair[0], pair[1], tolerance, g)
+			return
+		}
+	}
+}
+
+func TestConvertToSRGB(t *testing.T) {
+	// Чистый красный sRGB в Display P3 - примерно (234, 51, 35), в Adobe RGB - (219, 0, 0).
+	// Нейтральные цвета при одинаковой белой точке не меняются.
+	tests := []struct {
+		name    string
+		profile []byte
+		in      color.NRGBA
+		want    color.NRGBA
+	}{
+		{"Display P3, красный", testICCProfile("Display P3", testDisplayP3, 0), color.NRGBA{234, 51, 35, 255}, color.NRGBA{255, 0, 0, 255}},
+		{"Display P3, серый", testICCProfile("Display P3", testDisplayP3, 0), color.NRGBA{128, 128, 128, 200}, color.NRGBA{128, 128, 128, 200}},
+		{"Adobe RGB, красный", testICCProfile("Adobe RGB (1998)", testAdobeRGB, 2.2), color.NRGBA{219, 0, 0, 255}, color.NRGBA{255, 0, 0, 255}},
+		{"Adobe RGB, зеленый вне охвата sRGB", testICCProfile("Adobe RGB (1998)", testAdobeRGB, 2.2), color.NRGBA{0, 255, 0, 255}, color.NRGBA{0, 255, 0, 255}},
+		{"Adobe RGB, серый", testICCProfile("Adobe RGB (1998)", testAdobeRGB, 2.2), color.NRGBA{60, 60, 60, 255}, color.NRGBA{60, 60, 60, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseICCProfile(tt.profile)
+			if err != nil {
+				t.Fatalf("parseICCProfile: %v", err)
+			}
+			if p.isSRGB() {
+				t.Fatalf("профиль %q принят за sRGB", p.Description)
+			}
+			img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+			for i := 0; i < len(img.Pix); i += 4 {
+				img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = tt.in.R, tt.in.G, tt.in.B, tt.in.A
+			}
+			checkColor(t, "NRGBA", convertToSRGB(img, p).At(1, 1), tt.want, 3)
+
+			// Палитровое изображение: преобразуется только палитра.
+			paletted := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{tt.in})
+			out, ok := convertToSRGB(paletted, p).(*image.Paletted)
+			if !ok {
+				t.Fatalf("палитровое изображение стало %T", out)
+			}
+			checkColor(t, "палитра", out.Palette[0], tt.want, 3)
+			if paletted.Palette[0] != tt.in {
+				t.Errorf("палитра исходного изображения изменена")
+			}
+		})
+	}
+
+	t.Run("sRGB", func(t *testing.T) {
+		for _, gamma := range []float64{0, 1.8} {
+			p, err := parseICCProfile(testICCProfile("sRGB IEC61966-2.1", testSRGB, gamma))
+			if err != nil {
+				t.Fatalf("parseICCProfile: %v", err)
+			}
+			// Первичные цвета sRGB с кривой гамма 1.8 (как у старых профилей Mac) - не sRGB.
+			if want := gamma == 0; p.isSRGB() != want {
+				t.Errorf("гамма %v: isSRGB() = %v, ожидалось %v", gamma, p.isSRGB(), want)
+			}
+		}
+	})
+}
+
+func TestProcessImageConvertsICCProfile(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = 234, 51, 35, 255
+	}
+	dir := t.TempDir()
+	opts := DefaultProcessOptions()
+	stored, report, err := ProcessAndSaveData("p3.png", testICCPNG(t, img, testICCProfile("Display P3", testDisplayP3, 0)), dir, opts)
+	if err != nil {
+		t.Fatalf("ProcessAndSaveData: %v", err)
+	}
+	if report.ColorConvertedFrom != "Display P3" {
+		t.Errorf("ColorConvertedFrom = %q", report.ColorConvertedFrom)
+	}
+	path := filepath.Join(dir, stored)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if types := pngChunkTypes(t, data); containsString(types, "iCCP") {
+		t.Errorf("профиль не удален: %q", types)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	checkColor(t, "результат", decoded.At(4, 4), color.NRGBA{255, 0, 0, 255}, 3)
+	if err := VerifyCleanFile(path, opts); err != nil {
+		t.Errorf("VerifyCleanFile: %v", err)
+	}
+}
+
+func TestParseICCProfileMalformed(t *testing.T) {
+	valid := testICCProfile("Display P3", testDisplayP3, 0)
+	modified := func(edit func(p []byte) []byte) []byte {
+		return edit(append([]byte{}, valid...))
+	}
+	tagOffset := func(p []byte, sig string) int {
+		for i := 0; i < int(binary.BigEndian.Uint32(p[128:])); i++ {
+			entry := p[132+i*12:]
+			if string(entry[:4]) == sig {
+				return int(binary.BigEndian.Uint32(entry[4:]))
+			}
+		}
+		t.Fatalf("нет тега %s", sig)
+		return 0
+	}
+
+	tests := []struct {
+		name    string
+		profile []byte
+	}{
+		{"пустой", nil},
+		{"только заголовок", valid[:128]},
+		{"нет сигнатуры acsp", modified(func(p []byte) []byte { copy(p[36:], "xxxx"); return p })},
+		{"CMYK", modified(func(p []byte) []byte { copy(p[16:], "CMYK"); return p })},
+		{"пространство связи Lab", modified(func(p []byte) []byte { copy(p[20:], "Lab "); return p })},
+		{"огромное количество тегов", modified(func(p []byte) []byte { binary.BigEndian.PutUint32(p[128:], 0xFFFFFFFF); return p })},
+		{"тег за концом профиля", modified(func(p []byte) []byte { binary.BigEndian.PutUint32(p[132+4:], 0x7FFFFFF0); return p })},
+		{"размер тега переполняет смещение", modified(func(p []byte) []byte { binary.BigEndian.PutUint32(p[132+8:], 0xFFFFFFFF); return p })},
+		{"нет bXYZ", modified(func(p []byte) []byte { copy(p[132+3*12:], "zzzz"); return p })},
+		{"обрезанная таблица кривой", modified(func(p []byte) []byte {
+			binary.BigEndian.PutUint32(p[tagOffset(p, "rTRC"):], 0)
+			copy(p[tagOffset(p, "rTRC"):], "curv\x00\x00\x00\x00\x00\x01\x00\x00")
+			return p
+		})},
+		{"параметрическая кривая неизвестного типа", modified(func(p []byte) []byte {
+			binary.BigEndian.PutUint16(p[tagOffset(p, "gTRC")+8:], 9)
+			return p
+		})},
+		{"неизвестный тип кривой", modified(func(p []byte) []byte { copy(p[tagOffset(p, "bTRC"):], "mft2"); return p })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, err := parseICCProfile(tt.profile); err == nil {
+				t.Errorf("ожидалась ошибка, получен профиль %+v", p)
+			}
+		})
+	}
+
+	// Профиль, обрезанный на любом байте, не приводит к панике.
+	for n := range valid {
+		parseICCProfile(valid[:n])
+	}
+}
+
+func TestProcessImageMalformedICCProfile(t *testing.T) {
+	img := testBlocks(8, 8)
+	valid := testICCProfile("Display P3", testDisplayP3, 0)
+	var truncatedZlib bytes.Buffer
+	zw := zlib.NewWriter(&truncatedZlib)
+	zw.Write(valid)
+	zw.Close()
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"обрезанный профиль", testICCPNG(t, img, valid[:200])},
+		{"мусор вместо профиля", testICCPNG(t, img, []byte("not an ICC profile at all"))},
+		{"обрезанный поток zlib", testPNGImage(t, img, pngChunk{Type: "iCCP", Data: append([]byte("profile\x00\x00"), truncatedZlib.Bytes()[:30]...)})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stored, report, err := ProcessAndSaveData("bad-icc.png", tt.data, dir, DefaultProcessOptions())
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData: %v", err)
+			}
+			if report.ColorConvertedFrom != "" {
+				t.Errorf("цвета преобразованы по некорректному профилю %q", report.ColorConvertedFrom)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, stored))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if containsString(pngChunkTypes(t, data), "iCCP") {
+				t.Errorf("некорректный профиль не удален")
+			}
+			checkSamePNGPixels(t, tt.data, data)
+		})
+	}
+}
+
+func TestJPEGICCProfileParts(t *testing.T) {
+	profile := testICCProfile("Display P3", testDisplayP3, 0)
+	half := len(profile) / 2
+	part := func(seq byte, data []byte) jpegSegment {
+		payload := append(append(append([]byte{}, iccProfileSignature...), seq, 2), data...)
+		return jpegSegment{Marker: jpegMarkerAPP2, Payload: payload}
+	}
+	// Части записаны в обратном порядке: собираются по номеру.
+	data := testJPEG(t, part(2, profile[half:]), part(1, profile[:half]))
+	if got := extractICCProfile(data, "jpeg"); !bytes.Equal(got, profile) {
+		t.Errorf("профиль собран неверно: %d байт из %d", len(got), len(profile))
+	}
+	// Часть без номера и количества частей пропускается.
+	short := testJPEG(t, jpegSegment{Marker: jpegMarkerAPP2, Payload: iccProfileSignature})
+	if got := extractICCProfile(short, "jpeg"); got != nil {
+		t.Errorf("получен профиль из пустой части: %d байт", len(got))
+	}
+}
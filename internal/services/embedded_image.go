@@ -0,0 +1,121 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"     // Для чтения и записи изображений в памяти
+	"fmt"       // Для форматирования ошибок
+	"image"     // Для декодирования изображений
+	"image/gif" // Для покадровой обработки GIF
+	"strings"   // Для имени формата по MIME-типу
+
+	// Сторонние библиотеки
+	"golang.org/x/image/tiff" // Для перекодирования TIFF без метаданных
+)
+
+// Изображения, встроенные в документы (PDF, Office).
+//
+// Встроенное изображение нельзя сохранить в другом формате: на него ссылаются по
+// имени части документа, а тип содержимого объявлен отдельно. Поэтому оно очищается
+// с сохранением формата теми же функциями, что и загруженные изображения в режиме
+// CleanModeLossless, и сверяется со списком блокировки.
+
+// cleanEmbeddedImage очищает встроенное изображение и возвращает его очищенную копию
+// и отчет о найденных метаданных. Данные, которые не являются растровым изображением
+// или SVG (например, EMF/WMF), возвращаются без изменений и без отчета.
+func cleanEmbeddedImage(data []byte, opts ProcessOptions) ([]byte, *MetadataReport, error) {
+	contentType := detectImageContentType(data[:min(len(data), 512)])
+	switch contentType {
+	case "image/svg+xml":
+		return sanitizeSVG(data)
+	case "image/jpeg", "image/png", "image/gif", "image/tiff", "image/bmp":
+	case "image/webp":
+		return nil, nil, fmt.Errorf("встроенные изображения WebP не поддерживаются")
+	default:
+		return data, nil, nil
+	}
+	format := strings.TrimPrefix(contentType, "image/")
+	report := analyzeMetadata(data, format)
+
+	var clean []byte
+	var err error
+	switch format {
+	case "jpeg":
+		clean, err = stripJPEGMetadata(data, keptMetadata{})
+	case "png":
+		clean, err = stripPNGMetadata(data)
+	case "bmp":
+		clean = data // BMP не содержит блоков метаданных
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось очистить встроенное изображение %s: %w", format, err)
+	}
+
+	// GIF и TIFF перекодируются, для этого (и для сверки со списком блокировки)
+	// изображение декодируется.
+	if format == "gif" || format == "tiff" || blocklistEnabled() {
+		err = decodeWithLimits(data, opts, func(img image.Image, anim *gif.GIF) error {
+			// Документы не применяют EXIF-ориентацию, поэтому хеш считается без поворота.
+			if err := checkBlocklist(img, anim, 1); err != nil {
+				return err
+			}
+			var encoded bytes.Buffer
+			switch format {
+			case "gif":
+				if err := encodeCleanGIF(&encoded, anim); err != nil {
+					return err
+				}
+				clean = encoded.Bytes()
+			case "tiff":
+				if err := tiff.Encode(&encoded, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true}); err != nil {
+					return err
+				}
+				clean = encoded.Bytes()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return clean, report, nil
+}
+
+// decodeWithLimits декодирует встроенное изображение с теми же ограничениями, что и
+// загрузку: размеры из заголовка проверяются до декодирования (checkImageLimits), а память
+// резервируется в общем бюджете. fn вызывается, пока память зарезервирована; для GIF
+// в нее передаются все кадры (img - первый кадр на логическом экране).
+func decodeWithLimits(data []byte, opts ProcessOptions, fn func(img image.Image, anim *gif.GIF) error) error {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("не удалось декодировать встроенное изображение: %w", err)
+	}
+	if err := checkImageLimits(cfg, opts); err != nil {
+		return err
+	}
+	frames := 1
+	if format == "gif" {
+		structure, errScan := scanGIF(data)
+		if errScan != nil {
+			return fmt.Errorf("не удалось декодировать встроенное изображение: %w", errScan)
+		}
+		frames = structure.Frames
+	}
+	memoryNeeded := estimateDecodeMemory(cfg, format, frames)
+	if err := decodeBudget.acquire(memoryNeeded, decodeBudgetWaitTimeout); err != nil {
+		return err
+	}
+	defer decodeBudget.release(memoryNeeded)
+
+	if format == "gif" {
+		anim, err := decodeAnimatedGIF(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("не удалось декодировать встроенное изображение: %w", err)
+		}
+		return fn(gifFirstFrame(anim), anim)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("не удалось декодировать встроенное изображение: %w", err)
+	}
+	return fn(img, nil)
+}
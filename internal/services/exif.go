@@ -0,0 +1,358 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"encoding/binary" // Для чтения чисел в порядке байт TIFF-заголовка
+	"fmt"             // Для форматирования ошибок
+	"sort"            // Для упорядочивания записей IFD по тегам
+	"strings"         // Для обработки строковых значений тегов
+)
+
+// Теги EXIF, которые используются сервисом.
+const (
+	// IFD0 / IFD1
+	exifTagMake           = 0x010F // Производитель камеры
+	exifTagModel          = 0x0110 // Модель камеры
+	exifTagOrientation    = 0x0112 // Ориентация изображения (1-8)
+	exifTagSoftware       = 0x0131 // Программа, создавшая/изменившая файл
+	exifTagDateTime       = 0x0132 // Дата и время изменения файла
+	exifTagArtist         = 0x013B // Автор
+	exifTagThumbnailStart = 0x0201 // Смещение JPEG-миниатюры (IFD1)
+	exifTagThumbnailSize  = 0x0202 // Размер JPEG-миниатюры (IFD1)
+	exifTagCopyright      = 0x8298 // Авторские права
+	exifTagExifIFD        = 0x8769 // Указатель на Exif SubIFD
+	exifTagGPSIFD         = 0x8825 // Указатель на GPS IFD
+
+	// Exif SubIFD
+	exifTagDateTimeOriginal  = 0x9003 // Дата и время съемки
+	exifTagDateTimeDigitized = 0x9004 // Дата и время оцифровки
+	exifTagOwnerName         = 0xA430 // Имя владельца камеры
+	exifTagBodySerialNumber  = 0xA431 // Серийный номер камеры
+	exifTagLensModel         = 0xA434 // Модель объектива
+	exifTagLensSerialNumber  = 0xA435 // Серийный номер объектива
+
+	// GPS IFD
+	exifTagGPSVersionID    = 0x0000 // Версия GPS IFD (4 x BYTE)
+	exifTagGPSLatitudeRef  = 0x0001 // 'N' или 'S'
+	exifTagGPSLatitude     = 0x0002 // Широта: градусы, минуты, секунды (3 x RATIONAL)
+	exifTagGPSLongitudeRef = 0x0003 // 'E' или 'W'
+	exifTagGPSLongitude    = 0x0004 // Долгота: градусы, минуты, секунды (3 x RATIONAL)
+	exifTagGPSAltitudeRef  = 0x0005 // 0 - над уровнем моря, 1 - ниже
+	exifTagGPSAltitude     = 0x0006 // Высота (RATIONAL)
+	exifTagGPSDateStamp    = 0x001D // Дата по GPS
+)
+
+// Типы значений TIFF/EXIF и размеры одного элемента каждого типа в байтах.
+const (
+	exifTypeByte      = 1
+	exifTypeASCII     = 2
+	exifTypeShort     = 3
+	exifTypeLong      = 4
+	exifTypeRational  = 5
+	exifTypeSByte     = 6
+	exifTypeUndefined = 7
+	exifTypeSShort    = 8
+	exifTypeSLong     = 9
+	exifTypeSRational = 10
+	exifTypeFloat     = 11
+	exifTypeDouble    = 12
+)
+
+var exifTypeSizes = map[uint16]int{
+	exifTypeByte: 1, exifTypeASCII: 1, exifTypeShort: 2, exifTypeLong: 4,
+	exifTypeRational: 8, exifTypeSByte: 1, exifTypeUndefined: 1, exifTypeSShort: 2,
+	exifTypeSLong: 4, exifTypeSRational: 8, exifTypeFloat: 4, exifTypeDouble: 8,
+}
+
+// exifEntry - одна запись IFD (тег, тип, количество элементов и сырые байты значения).
+type exifEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value []byte // Байты значения в порядке байт исходного файла
+}
+
+// exifData - разобранная TIFF-структура EXIF.
+type exifData struct {
+	order     binary.ByteOrder // Порядок байт ("II" - little-endian, "MM" - big-endian)
+	IFD0      []exifEntry      // Основной каталог тегов изображения
+	Exif      []exifEntry      // Exif SubIFD (параметры съемки, даты, серийные номера)
+	GPS       []exifEntry      // GPS IFD (координаты)
+	IFD1      []exifEntry      // Каталог миниатюры
+	Thumbnail []byte           // Встроенная JPEG-миниатюра (если есть)
+}
+
+// parseEXIF разбирает TIFF-структуру EXIF (данные после префикса "Exif\0\0").
+// Разбор выполняется с проверкой всех смещений, так как данные приходят от пользователя.
+func parseEXIF(tiff []byte) (*exifData, error) {
+	if len(tiff) < 8 {
+		return nil, fmt.Errorf("EXIF слишком короткий")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("неизвестный порядок байт EXIF: %q", tiff[:2])
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, fmt.Errorf("некорректная сигнатура TIFF в EXIF")
+	}
+
+	ex := &exifData{order: order}
+	ifd0, nextIFD, err := readEXIFDirectory(tiff, order, order.Uint32(tiff[4:]))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения IFD0: %w", err)
+	}
+	ex.IFD0 = ifd0
+
+	// Вложенные каталоги читаются "по возможности": повреждение одного из них
+	// не должно мешать работе с остальными тегами.
+	if offset, ok := ex.uintValue(findEntry(ifd0, exifTagExifIFD)); ok {
+		ex.Exif, _, _ = readEXIFDirectory(tiff, order, offset)
+	}
+	if offset, ok := ex.uintValue(findEntry(ifd0, exifTagGPSIFD)); ok {
+		ex.GPS, _, _ = readEXIFDirectory(tiff, order, offset)
+	}
+	if nextIFD != 0 {
+		ex.IFD1, _, _ = readEXIFDirectory(tiff, order, nextIFD)
+		start, okStart := ex.uintValue(findEntry(ex.IFD1, exifTagThumbnailStart))
+		size, okSize := ex.uintValue(findEntry(ex.IFD1, exifTagThumbnailSize))
+		if okStart && okSize && int64(start)+int64(size) <= int64(len(tiff)) {
+			ex.Thumbnail = tiff[start : start+size]
+		}
+	}
+	return ex, nil
+}
+
+// readEXIFDirectory читает каталог IFD по смещению offset.
+// Возвращает записи каталога и смещение следующего IFD (0, если его нет).
+func readEXIFDirectory(tiff []byte, order binary.ByteOrder, offset uint32) ([]exifEntry, uint32, error) {
+	if int64(offset)+2 > int64(len(tiff)) {
+		return nil, 0, fmt.Errorf("смещение IFD %d вне границ данных", offset)
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12+4 > len(tiff) {
+		return nil, 0, fmt.Errorf("IFD из %d записей выходит за границы данных", count)
+	}
+
+	entries := make([]exifEntry, 0, count)
+	for i := 0; i < count; i++ {
+		raw := tiff[start+i*12 : start+i*12+12]
+		entry := exifEntry{
+			Tag:   order.Uint16(raw[0:]),
+			Type:  order.Uint16(raw[2:]),
+			Count: order.Uint32(raw[4:]),
+		}
+		size, known := exifTypeSizes[entry.Type]
+		if !known {
+			// Записи неизвестного типа пропускаем: их размер определить нельзя.
+			continue
+		}
+		total := int64(size) * int64(entry.Count)
+		if total <= 4 {
+			// Значения до 4 байт хранятся прямо в записи.
+			entry.Value = raw[8 : 8+total]
+		} else {
+			valueOffset := int64(order.Uint32(raw[8:]))
+			if valueOffset+total > int64(len(tiff)) {
+				continue // Битая запись - пропускаем, не прерывая разбор остальных
+			}
+			entry.Value = tiff[valueOffset : valueOffset+total]
+		}
+		entries = append(entries, entry)
+	}
+	next := order.Uint32(tiff[start+count*12:])
+	return entries, next, nil
+}
+
+// findEntry возвращает запись с указанным тегом или nil.
+func findEntry(entries []exifEntry, tag uint16) *exifEntry {
+	for i := range entries {
+		if entries[i].Tag == tag {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// uintValue возвращает первое числовое значение записи типа BYTE, SHORT или LONG.
+func (ex *exifData) uintValue(e *exifEntry) (uint32, bool) {
+	if e == nil || e.Count == 0 {
+		return 0, false
+	}
+	switch e.Type {
+	case exifTypeByte:
+		return uint32(e.Value[0]), true
+	case exifTypeShort:
+		return uint32(ex.order.Uint16(e.Value)), true
+	case exifTypeLong:
+		return ex.order.Uint32(e.Value), true
+	}
+	return 0, false
+}
+
+// stringValue возвращает значение записи типа ASCII без завершающих нулей и пробелов.
+func (ex *exifData) stringValue(e *exifEntry) string {
+	if e == nil || (e.Type != exifTypeASCII && e.Type != exifTypeUndefined) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.Value), "\x00"))
+}
+
+// rationalValues возвращает значения записи типа RATIONAL в виде чисел с плавающей точкой.
+func (ex *exifData) rationalValues(e *exifEntry) []float64 {
+	if e == nil || e.Type != exifTypeRational {
+		return nil
+	}
+	values := make([]float64, 0, e.Count)
+	for i := 0; i+8 <= len(e.Value); i += 8 {
+		num := ex.order.Uint32(e.Value[i:])
+		den := ex.order.Uint32(e.Value[i+4:])
+		if den == 0 {
+			return nil
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
+
+// GPSCoordinates возвращает широту и долготу в десятичных градусах.
+// ok == false, если координаты отсутствуют или повреждены.
+func (ex *exifData) GPSCoordinates() (lat, lon float64, ok bool) {
+	latParts := ex.rationalValues(findEntry(ex.GPS, exifTagGPSLatitude))
+	lonParts := ex.rationalValues(findEntry(ex.GPS, exifTagGPSLongitude))
+	if len(latParts) != 3 || len(lonParts) != 3 {
+		return 0, 0, false
+	}
+	lat = latParts[0] + latParts[1]/60 + latParts[2]/3600
+	lon = lonParts[0] + lonParts[1]/60 + lonParts[2]/3600
+	if strings.EqualFold(ex.stringValue(findEntry(ex.GPS, exifTagGPSLatitudeRef)), "S") {
+		lat = -lat
+	}
+	if strings.EqualFold(ex.stringValue(findEntry(ex.GPS, exifTagGPSLongitudeRef)), "W") {
+		lon = -lon
+	}
+	return lat, lon, true
+}
+
+// GPSAltitude возвращает высоту в метрах (отрицательную - ниже уровня моря).
+func (ex *exifData) GPSAltitude() (float64, bool) {
+	values := ex.rationalValues(findEntry(ex.GPS, exifTagGPSAltitude))
+	if len(values) != 1 {
+		return 0, false
+	}
+	if ref, ok := ex.uintValue(findEntry(ex.GPS, exifTagGPSAltitudeRef)); ok && ref == 1 {
+		return -values[0], true
+	}
+	return values[0], true
+}
+
+// Orientation возвращает значение тега Orientation (1-8) или 1, если тег отсутствует
+// либо содержит недопустимое значение.
+func (ex *exifData) Orientation() int {
+	v, ok := ex.uintValue(findEntry(ex.IFD0, exifTagOrientation))
+	if !ok || v < 1 || v > 8 {
+		return 1
+	}
+	return int(v)
+}
+
+// newShortEntry создает запись типа SHORT со значением в порядке байт big-endian
+// (именно его использует encodeEXIF).
+func newShortEntry(tag uint16, value uint16) exifEntry {
+	v := make([]byte, 2)
+	binary.BigEndian.PutUint16(v, value)
+	return exifEntry{Tag: tag, Type: exifTypeShort, Count: 1, Value: v}
+}
+
+// encodeEXIF собирает минимальную TIFF-структуру EXIF (порядок байт big-endian, "MM")
+// из записей IFD0 и непустых каталогов Exif SubIFD и GPS IFD (указатели на них
+// добавляются в IFD0 автоматически). Значения записей должны быть уже в порядке big-endian.
+// Результат не содержит префикса "Exif\0\0".
+func encodeEXIF(ifd0, exifIFD, gps []exifEntry) []byte {
+	const headerSize = 8
+	entries := append([]exifEntry(nil), ifd0...)
+	// Смещения подкаталогов известны только после размещения IFD0, поэтому значения
+	// указателей заполняются ниже; сами записи нужны, чтобы учесть их в размере каталога.
+	subIFDs := []struct {
+		pointerTag uint16
+		entries    []exifEntry
+	}{{exifTagExifIFD, exifIFD}, {exifTagGPSIFD, gps}}
+	for _, sub := range subIFDs {
+		if len(sub.entries) > 0 {
+			entries = append(entries, exifEntry{Tag: sub.pointerTag, Type: exifTypeLong, Count: 1, Value: make([]byte, 4)})
+		}
+	}
+
+	out := make([]byte, headerSize)
+	copy(out, "MM\x00\x2a")
+	binary.BigEndian.PutUint32(out[4:], headerSize)
+	offset := headerSize + encodedIFDSize(entries)
+	for _, sub := range subIFDs {
+		if len(sub.entries) == 0 {
+			continue
+		}
+		for i := range entries {
+			if entries[i].Tag == sub.pointerTag {
+				binary.BigEndian.PutUint32(entries[i].Value, uint32(offset))
+			}
+		}
+		offset += encodedIFDSize(sub.entries)
+	}
+	out = appendIFD(out, entries)
+	for _, sub := range subIFDs {
+		if len(sub.entries) > 0 {
+			out = appendIFD(out, sub.entries)
+		}
+	}
+	return out
+}
+
+// encodedIFDSize возвращает размер каталога вместе со значениями, не помещающимися в запись.
+func encodedIFDSize(entries []exifEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		if len(e.Value) > 4 {
+			size += len(e.Value) + len(e.Value)%2
+		}
+	}
+	return size
+}
+
+// appendIFD дописывает в конец out каталог с записями entries и их значениями.
+// Смещение следующего IFD остается нулевым - миниатюры (IFD1) не записываются.
+func appendIFD(out []byte, entries []exifEntry) []byte {
+	entries = append([]exifEntry(nil), entries...)
+	// Спецификация TIFF требует, чтобы записи каталога шли по возрастанию тегов.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+
+	dirStart := len(out)
+	dirSize := 2 + 12*len(entries) + 4
+	dataOffset := dirStart + dirSize // Значения длиннее 4 байт размещаются после каталога
+
+	out = append(out, make([]byte, dirSize)...)
+	binary.BigEndian.PutUint16(out[dirStart:], uint16(len(entries)))
+
+	for i, e := range entries {
+		raw := out[dirStart+2+i*12:]
+		binary.BigEndian.PutUint16(raw[0:], e.Tag)
+		binary.BigEndian.PutUint16(raw[2:], e.Type)
+		binary.BigEndian.PutUint32(raw[4:], e.Count)
+		if len(e.Value) <= 4 {
+			copy(raw[8:12], e.Value)
+			continue
+		}
+		binary.BigEndian.PutUint32(raw[8:], uint32(dataOffset))
+		out = append(out, e.Value...)
+		// Смещения значений в TIFF должны быть четными.
+		if len(e.Value)%2 == 1 {
+			out = append(out, 0)
+		}
+		dataOffset = len(out)
+	}
+	return out
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"encoding/binary" // Для чтения чисел из файла каскада (little-endian)
+	"errors"          // Для ошибки-маркера
+	"fmt"             // Для форматирования ошибок
+	"image"           // Для работы с изображениями
+	"image/draw"      // Для приведения кадров к RGBA
+	"image/gif"       // Для обработки кадров анимации
+	"log"             // Для логирования
+	"math"            // Для чтения float32 и вычисления перекрытий
+	"os"              // Для чтения файла каскада
+	"sync"            // Для защиты загруженного каскада
+)
+
+// Детектор лиц в стиле PICO (Pixel Intensity Comparison-based Object detection):
+// каскад деревьев решений, каждый узел которых сравнивает яркость двух пикселей.
+// Алгоритм работает только на CPU, не требует cgo и читает каскады в бинарном
+// формате PICO/pigo (например, файл "facefinder" из репозитория pigo).
+// Путь к каскаду задается переменной окружения FACE_CASCADE_PATH.
+
+// ErrFaceDetectionUnavailable - ошибка-маркер: размытие лиц запрошено,
+// но каскад детектора не загружен (не задан FACE_CASCADE_PATH).
+var ErrFaceDetectionUnavailable = errors.New("автоматическое размытие лиц недоступно: не настроен детектор лиц")
+
+// Параметры поиска лиц.
+const (
+	faceMinSize            = 20   // Минимальный размер окна, пикселей (в уменьшенном изображении)
+	faceMaxSize            = 1000 // Максимальный размер окна
+	faceShiftFactor        = 0.1  // Шаг окна относительно его размера
+	faceScaleFactor        = 1.1  // Множитель размера окна между проходами
+	faceIoUThreshold       = 0.2  // Порог перекрытия при объединении срабатываний
+	faceDetectionThreshold = 5.0  // Минимальная суммарная оценка кластера
+	faceDetectMaxSide      = 1024 // Изображение уменьшается до этой стороны перед поиском
+	faceBlurMargin         = 0.25 // Расширение области размытия (волосы, подбородок)
+)
+
+// faceCascade - дерево решений каскада PICO в распакованном виде.
+type faceCascade struct {
+	treeDepth     int
+	treeNum       int
+	treeCodes     []int8    // По 4 смещения (строка1, столбец1, строка2, столбец2) на узел
+	treePred      []float32 // Предсказания листьев
+	treeThreshold []float32 // Порог отсечения после каждого дерева
+}
+
+// faceDetector - загруженный каскад процесса (nil, если детектор не настроен).
+var (
+	faceDetectorMu sync.RWMutex
+	faceDetector   *faceCascade
+)
+
+// LoadFaceCascade загружает каскад детектора лиц из файла в формате PICO/pigo.
+// Вызывается один раз при старте приложения.
+func LoadFaceCascade(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать каскад детектора лиц: %w", err)
+	}
+	cascade, err := unpackFaceCascade(data)
+	if err != nil {
+		return fmt.Errorf("некорректный каскад детектора лиц '%s': %w", path, err)
+	}
+	faceDetectorMu.Lock()
+	faceDetector = cascade
+	faceDetectorMu.Unlock()
+	log.Printf("Каскад детектора лиц загружен: %s (деревьев: %d, глубина: %d)", path, cascade.treeNum, cascade.treeDepth)
+	return nil
+}
+
+// FaceDetectionAvailable сообщает, загружен ли каскад детектора лиц.
+func FaceDetectionAvailable() bool {
+	faceDetectorMu.RLock()
+	defer faceDetectorMu.RUnlock()
+	return faceDetector != nil
+}
+
+// unpackFaceCascade разбирает бинарный каскад:
+// 8 байт заголовка, глубина деревьев (int32), количество деревьев (int32),
+// затем для каждого дерева: коды узлов (4 * (2^глубина - 1) байт),
+// предсказания листьев (2^глубина float32) и порог (float32).
+func unpackFaceCascade(data []byte) (*faceCascade, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("файл слишком короткий")
+	}
+	depth := int(int32(binary.LittleEndian.Uint32(data[8:])))
+	num := int(int32(binary.LittleEndian.Uint32(data[12:])))
+	if depth < 1 || depth > 16 || num < 1 || num > 10000 {
+		return nil, fmt.Errorf("недопустимые параметры каскада: глубина %d, деревьев %d", depth, num)
+	}
+	leaves := 1 << depth
+	codesSize := 4*leaves - 4
+	treeSize := codesSize + 4*leaves + 4
+	if len(data) < 16+num*treeSize {
+		return nil, fmt.Errorf("файл обрезан: ожидалось %d байт, получено %d", 16+num*treeSize, len(data))
+	}
+
+	c := &faceCascade{treeDepth: depth, treeNum: num}
+	pos := 16
+	for t := 0; t < num; t++ {
+		// Первые 4 кода дерева не используются (нумерация узлов начинается с 1).
+		c.treeCodes = append(c.treeCodes, 0, 0, 0, 0)
+		for _, b := range data[pos : pos+codesSize] {
+			c.treeCodes = append(c.treeCodes, int8(b))
+		}
+		pos += codesSize
+		for i := 0; i < leaves; i++ {
+			c.treePred = append(c.treePred, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		}
+		c.treeThreshold = append(c.treeThreshold, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+		pos += 4
+	}
+	return c, nil
+}
+
+// classifyRegion вычисляет оценку окна с центром (row, col) и размером scale.
+// Возвращает отрицательное значение, если окно отсечено одним из деревьев.
+func (c *faceCascade) classifyRegion(row, col, scale int, pixels []uint8, width int) float32 {
+	leaves := 1 << c.treeDepth
+	row, col = row*256, col*256
+	var out float32
+	root := 0
+	for i := 0; i < c.treeNum; i++ {
+		idx := 1
+		for j := 0; j < c.treeDepth; j++ {
+			codes := c.treeCodes[root+4*idx : root+4*idx+4]
+			p1 := ((row+int(codes[0])*scale)>>8)*width + ((col + int(codes[1])*scale) >> 8)
+			p2 := ((row+int(codes[2])*scale)>>8)*width + ((col + int(codes[3])*scale) >> 8)
+			idx *= 2
+			if pixels[p1] <= pixels[p2] {
+				idx++
+			}
+		}
+		out += c.treePred[leaves*i+idx-leaves]
+		if out <= c.treeThreshold[i] {
+			return -1
+		}
+		root += 4 * leaves
+	}
+	return out - c.treeThreshold[c.treeNum-1]
+}
+
+// faceDetection - срабатывание детектора: центр окна, размер и оценка.
+type faceDetection struct {
+	row, col, scale int
+	q               float32
+}
+
+// detectFaces находит лица на изображении и возвращает их прямоугольники
+// (в координатах img, с запасом faceBlurMargin). Если каскад не загружен,
+// возвращает ErrFaceDetectionUnavailable.
+func detectFaces(img image.Image) ([]image.Rectangle, error) {
+	faceDetectorMu.RLock()
+	cascade := faceDetector
+	faceDetectorMu.RUnlock()
+	if cascade == nil {
+		return nil, ErrFaceDetectionUnavailable
+	}
+
+	// Полутоновое изображение, уменьшенное до faceDetectMaxSide по большей стороне:
+	// на больших фото поиск иначе занимает слишком много времени.
+	bounds := img.Bounds()
+	ratio := 1.0
+	if side := max(bounds.Dx(), bounds.Dy()); side > faceDetectMaxSide {
+		ratio = float64(side) / faceDetectMaxSide
+	}
+	width := max(1, int(float64(bounds.Dx())/ratio))
+	height := max(1, int(float64(bounds.Dy())/ratio))
+	pixels := grayscaleSample(img, width, height)
+
+	// Скользящее окно на нескольких масштабах.
+	var detections []faceDetection
+	for scale := faceMinSize; scale <= faceMaxSize; scale = int(float64(scale) * faceScaleFactor) {
+		step := max(int(faceShiftFactor*float64(scale)), 1)
+		offset := scale/2 + 1
+		for row := offset; row <= height-offset; row += step {
+			for col := offset; col <= width-offset; col += step {
+				if q := cascade.classifyRegion(row, col, scale, pixels, width); q > 0 {
+					detections = append(detections, faceDetection{row, col, scale, q})
+				}
+			}
+		}
+	}
+
+	var faces []image.Rectangle
+	for _, d := range clusterFaceDetections(detections) {
+		if d.q < faceDetectionThreshold {
+			continue
+		}
+		half := float64(d.scale) * (0.5 + faceBlurMargin) * ratio
+		cx, cy := float64(d.col)*ratio, float64(d.row)*ratio
+		faces = append(faces, image.Rect(int(cx-half), int(cy-half), int(cx+half+1), int(cy+half+1)).Add(bounds.Min))
+	}
+	return faces, nil
+}
+
+// grayscaleSample строит полутоновое изображение размером width x height
+// (выборка ближайшего пикселя, яркость по ITU-R BT.601).
+func grayscaleSample(img image.Image, width, height int) []uint8 {
+	bounds := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	}
+	pixels := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/width
+			o := rgba.PixOffset(sx, sy)
+			r, g, b := uint32(rgba.Pix[o]), uint32(rgba.Pix[o+1]), uint32(rgba.Pix[o+2])
+			pixels[y*width+x] = uint8((299*r + 587*g + 114*b) / 1000)
+		}
+	}
+	return pixels
+}
+
+// clusterFaceDetections объединяет пересекающиеся срабатывания (IoU > faceIoUThreshold)
+// в одно: координаты и размер усредняются, оценки суммируются.
+func clusterFaceDetections(detections []faceDetection) []faceDetection {
+	assigned := make([]bool, len(detections))
+	var clusters []faceDetection
+	for i := range detections {
+		if assigned[i] {
+			continue
+		}
+		var row, col, scale, n int
+		var q float32
+		for j := i; j < len(detections); j++ {
+			if faceIoU(detections[i], detections[j]) > faceIoUThreshold {
+				assigned[j] = true
+				row += detections[j].row
+				col += detections[j].col
+				scale += detections[j].scale
+				q += detections[j].q
+				n++
+			}
+		}
+		if n > 0 {
+			clusters = append(clusters, faceDetection{row / n, col / n, scale / n, q})
+		}
+	}
+	return clusters
+}
+
+// faceIoU - отношение площади пересечения двух окон к площади их объединения.
+func faceIoU(a, b faceDetection) float64 {
+	r1, c1, s1 := float64(a.row), float64(a.col), float64(a.scale)
+	r2, c2, s2 := float64(b.row), float64(b.col), float64(b.scale)
+	overRow := math.Max(0, math.Min(r1+s1/2, r2+s2/2)-math.Max(r1-s1/2, r2-s2/2))
+	overCol := math.Max(0, math.Min(c1+s1/2, c2+s2/2)-math.Max(c1-s1/2, c2-s2/2))
+	return overRow * overCol / (s1*s1 + s2*s2 - overRow*overCol)
+}
+
+// faceRegions преобразует прямоугольники лиц в области размытия (координаты
+// относительно левого верхнего угла изображения с границами bounds).
+func faceRegions(faces []image.Rectangle, bounds image.Rectangle) []RedactionRegion {
+	regions := make([]RedactionRegion, 0, len(faces))
+	for _, f := range faces {
+		f = f.Sub(bounds.Min)
+		regions = append(regions, RedactionRegion{X: f.Min.X, Y: f.Min.Y, Width: f.Dx(), Height: f.Dy(), Mode: RedactionBlur})
+	}
+	return regions
+}
+
+// blurFaces находит и размывает лица на изображении. Возвращает новое изображение
+// и количество размытых лиц.
+func blurFaces(img image.Image) (image.Image, int, error) {
+	faces, err := detectFaces(img)
+	if err != nil || len(faces) == 0 {
+		return img, 0, err
+	}
+	return applyRedactions(img, faceRegions(faces, img.Bounds())), len(faces), nil
+}
+
+// blurGIFFaces ищет и размывает лица в каждом кадре анимации отдельно
+// (в анимации лица перемещаются). Возвращает общее количество размытых лиц.
+func blurGIFFaces(anim *gif.GIF) (int, error) {
+	total := 0
+	for _, frame := range anim.Image {
+		faces, err := detectFaces(frame)
+		if err != nil {
+			return total, err
+		}
+		if len(faces) == 0 {
+			continue
+		}
+		// Кадры GIF хранят координаты логического экрана, поэтому области
+		// задаются относительно начала экрана, а не кадра.
+		redactPalettedFrame(frame, faceRegions(faces, image.Rectangle{}))
+		total += len(faces)
+	}
+	return total, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"encoding/binary" // Для сборки файла каскада
+	"errors"          // Для проверки ошибок-маркеров
+	"image"           // Для тестовых изображений
+	"image/color"     // Для заполнения изображений
+	"image/draw"      // Для рисования "лица"
+	"math"            // Для записи float32
+	"os"              // Для файла каскада
+	"path/filepath"   // Для пути к файлу каскада
+	"testing"         // Для тестов
+)
+
+// testFaceCascadeData собирает каскад PICO из четырех деревьев глубины 1. Каждое дерево
+// сравнивает центр окна с точкой на его границе (слева, справа, сверху, снизу) и
+// пропускает окно, только если центр ярче. Такой каскад находит светлое пятно на темном
+// фоне: настоящий каскад лиц в репозитории не хранится, а логика поиска, объединения
+// срабатываний и размытия от содержимого каскада не зависит.
+func testFaceCascadeData() []byte {
+	data := make([]byte, 8)
+	data = binary.LittleEndian.AppendUint32(data, 1) // Глубина
+	data = binary.LittleEndian.AppendUint32(data, 4) // Количество деревьев
+	float := func(b []byte, v float32) []byte {
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	border := [][2]int8{{0, -127}, {0, 127}, {-127, 0}, {127, 0}} // Смещения строки и столбца (доли размера окна / 256)
+	for i, p := range border {
+		// Узел: центр окна (0, 0) против точки на границе. Если центр не ярче - лист 1.
+		data = append(data, 0, 0, byte(p[0]), byte(p[1]))
+		data = float(float(data, 1), -1) // Предсказания листьев: 0 - центр ярче, 1 - нет
+		data = float(data, float32(i))   // Порог: сумма должна расти с каждым деревом
+	}
+	return data
+}
+
+// setTestFaceCascade загружает каскад на время теста (nil - детектор не настроен).
+func setTestFaceCascade(t *testing.T, data []byte) {
+	t.Helper()
+	faceDetectorMu.Lock()
+	previous := faceDetector
+	faceDetector = nil
+	faceDetectorMu.Unlock()
+	t.Cleanup(func() {
+		faceDetectorMu.Lock()
+		faceDetector = previous
+		faceDetectorMu.Unlock()
+	})
+	if data == nil {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "facefinder")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := LoadFaceCascade(path); err != nil {
+		t.Fatalf("LoadFaceCascade: %v", err)
+	}
+}
+
+// testFacePhoto возвращает однотонное темное изображение со светлым квадратом-"лицом" face.
+func testFacePhoto(w, h int, face image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{40, 40, 40, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, face, image.NewUniform(color.RGBA{230, 200, 180, 255}), image.Point{}, draw.Src)
+	// Глаза: детали внутри лица, которые размытие должно сгладить.
+	for _, eye := range []image.Point{{face.Min.X + face.Dx()/3, face.Min.Y + face.Dy()/3}, {face.Max.X - face.Dx()/3, face.Min.Y + face.Dy()/3}} {
+		draw.Draw(img, image.Rect(eye.X-2, eye.Y-2, eye.X+2, eye.Y+2), image.NewUniform(color.RGBA{30, 30, 30, 255}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestDetectFaces(t *testing.T) {
+	setTestFaceCascade(t, testFaceCascadeData())
+	if !FaceDetectionAvailable() {
+		t.Fatalf("FaceDetectionAvailable() = false после загрузки каскада")
+	}
+
+	face := image.Rect(130, 60, 170, 100)
+	photo := testFacePhoto(300, 200, face)
+	faces, err := detectFaces(photo)
+	if err != nil {
+		t.Fatalf("detectFaces: %v", err)
+	}
+	if len(faces) == 0 {
+		t.Fatalf("лицо не найдено")
+	}
+	center := image.Pt((face.Min.X+face.Max.X)/2, (face.Min.Y+face.Max.Y)/2)
+	for _, f := range faces {
+		if !center.In(f) {
+			t.Errorf("область %v не закрывает лицо %v", f, face)
+		}
+	}
+
+	t.Run("размытие", func(t *testing.T) {
+		blurred, n, err := blurFaces(photo)
+		if err != nil || n != len(faces) {
+			t.Fatalf("blurFaces: %d лиц, %v", n, err)
+		}
+		eye := image.Pt(face.Min.X+face.Dx()/3, face.Min.Y+face.Dy()/3)
+		if blurred.At(eye.X, eye.Y) == photo.At(eye.X, eye.Y) {
+			t.Errorf("пиксель лица %v не изменился", eye)
+		}
+		if blurred.At(5, 5) != photo.At(5, 5) {
+			t.Errorf("изменен пиксель вдали от лица")
+		}
+	})
+
+	t.Run("координаты при смещенных границах", func(t *testing.T) {
+		shifted := photo.SubImage(image.Rect(100, 40, 300, 200))
+		faces, err := detectFaces(shifted)
+		if err != nil || len(faces) == 0 {
+			t.Fatalf("detectFaces: %v %v", faces, err)
+		}
+		for _, f := range faces {
+			if !f.Overlaps(face) {
+				t.Errorf("область %v не совпадает с лицом %v", f, face)
+			}
+		}
+	})
+
+	t.Run("большое изображение уменьшается перед поиском", func(t *testing.T) {
+		bigFace := image.Rect(1400, 500, 1700, 800)
+		faces, err := detectFaces(testFacePhoto(2400, 1400, bigFace))
+		if err != nil || len(faces) == 0 {
+			t.Fatalf("detectFaces: %v %v", faces, err)
+		}
+		for _, f := range faces {
+			if !f.Overlaps(bigFace) {
+				t.Errorf("область %v не совпадает с лицом %v", f, bigFace)
+			}
+		}
+	})
+
+	t.Run("изображение без лиц", func(t *testing.T) {
+		faces, err := detectFaces(testFacePhoto(300, 200, image.Rectangle{}))
+		if err != nil || len(faces) != 0 {
+			t.Errorf("найдены лица %v, %v", faces, err)
+		}
+	})
+}
+
+func TestFaceDetectionUnavailable(t *testing.T) {
+	setTestFaceCascade(t, nil)
+	if FaceDetectionAvailable() {
+		t.Errorf("FaceDetectionAvailable() = true без каскада")
+	}
+	if _, err := detectFaces(testImage()); !errors.Is(err, ErrFaceDetectionUnavailable) {
+		t.Errorf("detectFaces: ожидалась ErrFaceDetectionUnavailable, получено %v", err)
+	}
+	// Файл с запрошенным размытием лиц не сохраняется.
+	opts := DefaultProcessOptions()
+	opts.BlurFaces = true
+	dir := t.TempDir()
+	if _, _, err := ProcessAndSaveData("photo.png", testPNG(t), dir, opts); !errors.Is(err, ErrFaceDetectionUnavailable) {
+		t.Errorf("ProcessAndSaveData: ожидалась ErrFaceDetectionUnavailable, получено %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("в каталоге загрузки остались файлы: %v", entries)
+	}
+}
+
+func TestUnpackFaceCascade(t *testing.T) {
+	valid := testFaceCascadeData()
+	withHeader := func(depth, num int32) []byte {
+		data := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint32(data[8:], uint32(depth))
+		binary.LittleEndian.PutUint32(data[12:], uint32(num))
+		return data
+	}
+	cascade, err := unpackFaceCascade(valid)
+	if err != nil || cascade.treeDepth != 1 || cascade.treeNum != 4 || len(cascade.treePred) != 8 {
+		t.Fatalf("unpackFaceCascade: %+v %v", cascade, err)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"пустой файл", nil},
+		{"нулевая глубина", withHeader(0, 4)},
+		{"слишком глубокие деревья", withHeader(17, 4)},
+		{"отрицательное количество деревьев", withHeader(1, -1)},
+		{"деревьев больше, чем данных", withHeader(1, 5)},
+		{"обрезан", valid[:len(valid)-1]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := unpackFaceCascade(tt.data); err == nil {
+				t.Errorf("ожидалась ошибка")
+			}
+		})
+	}
+	if err := LoadFaceCascade(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("LoadFaceCascade: отсутствующий файл принят")
+	}
+}
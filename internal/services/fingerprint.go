@@ -0,0 +1,183 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"fmt"          // Для форматирования ошибок
+	"image"        // Для работы с изображениями
+	"image/draw"   // Для приведения изображений к RGBA и обратно к палитре
+	"image/gif"    // Для обработки кадров анимации
+	"math"         // Для округления
+	"math/rand/v2" // Для случайного сдвига и шума
+	"strings"      // Для нормализации значений настроек
+)
+
+// Подавление "отпечатка" сенсора камеры (PRNU - photo-response non-uniformity).
+//
+// Каждый пиксель сенсора чуть по-разному реагирует на свет. Этот шум стабилен для
+// конкретной камеры, поэтому по нему можно связать разные фотографии с одним телефоном,
+// даже если метаданные удалены. Для сопоставления нужно, чтобы шумовая составляющая
+// сохранилась и осталась выровненной по сетке пикселей сенсора. Поэтому обработка:
+//  1. уменьшает изображение со случайным субпиксельным сдвигом (нарушает выравнивание
+//     и отбрасывает часть высокочастотного шума);
+//  2. подавляет остаточный шум медианным фильтром;
+//  3. возвращает исходный размер и добавляет новый случайный шум, маскирующий остатки.
+
+// FingerprintStrength - сила подавления отпечатка сенсора.
+type FingerprintStrength string
+
+const (
+	FingerprintLow    FingerprintStrength = "low"    // Почти незаметно, базовая защита
+	FingerprintMedium FingerprintStrength = "medium" // Рекомендуемый уровень
+	FingerprintHigh   FingerprintStrength = "high"   // Заметная потеря резкости, максимальная защита
+)
+
+// fingerprintParams - параметры обработки для каждого уровня силы.
+type fingerprintParams struct {
+	scale        float64 // Коэффициент промежуточного уменьшения
+	medianRadius int     // Радиус медианного фильтра
+	noiseSigma   float64 // Стандартное отклонение добавляемого шума (в единицах 0-255)
+}
+
+var fingerprintLevels = map[FingerprintStrength]fingerprintParams{
+	FingerprintLow:    {scale: 0.95, medianRadius: 1, noiseSigma: 1.0},
+	FingerprintMedium: {scale: 0.90, medianRadius: 1, noiseSigma: 2.0},
+	FingerprintHigh:   {scale: 0.80, medianRadius: 2, noiseSigma: 3.0},
+}
+
+// ParseFingerprintStrength разбирает силу подавления отпечатка сенсора
+// (переменная окружения ANTI_FINGERPRINT_STRENGTH или поле формы загрузки).
+func ParseFingerprintStrength(value string) (FingerprintStrength, error) {
+	strength := FingerprintStrength(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := fingerprintLevels[strength]; ok {
+		return strength, nil
+	}
+	return "", fmt.Errorf("неизвестная сила подавления отпечатка: %q (допустимо: %s, %s, %s)", value, FingerprintLow, FingerprintMedium, FingerprintHigh)
+}
+
+// fingerprintJitter - случайный субпиксельный сдвиг, общий для всех кадров одного файла
+// (иначе кадры анимации "дрожали" бы относительно друг друга).
+type fingerprintJitter struct {
+	dx, dy float64
+}
+
+func newFingerprintJitter(rng *rand.Rand) fingerprintJitter {
+	return fingerprintJitter{dx: rng.Float64() - 0.5, dy: rng.Float64() - 0.5}
+}
+
+// suppressFingerprint возвращает изображение того же размера с подавленным шумом сенсора.
+func suppressFingerprint(img image.Image, strength FingerprintStrength) *image.RGBA {
+	rng := newSecureRand()
+	return suppressFingerprintWith(img, fingerprintLevels[strength], newFingerprintJitter(rng), rng)
+}
+
+// suppressGIFFingerprint обрабатывает каждый кадр анимации и снова приводит его к палитре кадра.
+func suppressGIFFingerprint(anim *gif.GIF, strength FingerprintStrength) {
+	rng := newSecureRand()
+	params := fingerprintLevels[strength]
+	jitter := newFingerprintJitter(rng)
+	for _, frame := range anim.Image {
+		processed := suppressFingerprintWith(frame, params, jitter, rng)
+		draw.Draw(frame, frame.Bounds(), processed, processed.Bounds().Min, draw.Src)
+	}
+}
+
+func suppressFingerprintWith(img image.Image, params fingerprintParams, jitter fingerprintJitter, rng *rand.Rand) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	sw, sh := max(1, int(math.Round(float64(w)*params.scale))), max(1, int(math.Round(float64(h)*params.scale)))
+
+	small := resampleBilinear(src, sw, sh, jitter.dx, jitter.dy)
+	small = medianFilter(small, params.medianRadius)
+	out := resampleBilinear(small, w, h, 0, 0)
+	addNoise(out, params.noiseSigma, rng)
+
+	// Возвращаем исходные координаты (важно для кадров GIF со смещением).
+	out.Rect = bounds
+	return out
+}
+
+// resampleBilinear масштабирует изображение до dstW x dstH билинейной интерполяцией.
+// offX и offY - дополнительный сдвиг точки выборки в пикселях исходного изображения.
+// Изображение в формате RGBA (с предумноженной альфой), поэтому интерполяция
+// не дает темных ореолов на границах прозрачных областей.
+func resampleBilinear(src *image.RGBA, dstW, dstH int, offX, offY float64) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	fx, fy := float64(sw)/float64(dstW), float64(sh)/float64(dstH)
+	clampF := func(v float64, hi int) float64 { return math.Max(0, math.Min(v, float64(hi-1))) }
+
+	for y := 0; y < dstH; y++ {
+		syf := clampF((float64(y)+0.5)*fy-0.5+offY, sh)
+		y0 := int(syf)
+		y1 := min(y0+1, sh-1)
+		wy := syf - float64(y0)
+		for x := 0; x < dstW; x++ {
+			sxf := clampF((float64(x)+0.5)*fx-0.5+offX, sw)
+			x0 := int(sxf)
+			x1 := min(x0+1, sw-1)
+			wx := sxf - float64(x0)
+
+			p00, p10 := src.PixOffset(x0, y0), src.PixOffset(x1, y0)
+			p01, p11 := src.PixOffset(x0, y1), src.PixOffset(x1, y1)
+			o := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				top := float64(src.Pix[p00+c])*(1-wx) + float64(src.Pix[p10+c])*wx
+				bottom := float64(src.Pix[p01+c])*(1-wx) + float64(src.Pix[p11+c])*wx
+				dst.Pix[o+c] = uint8(math.Round(top*(1-wy) + bottom*wy))
+			}
+		}
+	}
+	return dst
+}
+
+// medianFilter применяет медианный фильтр с окном (2*radius+1)^2 к каждому каналу.
+// Медиана хорошо убирает мелкий шум, сохраняя контуры. Для предумноженной альфы
+// результат остается корректным: медиана цвета не превышает медиану альфы.
+func medianFilter(src *image.RGBA, radius int) *image.RGBA {
+	if radius <= 0 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(src.Rect)
+	window := make([]uint8, 0, (2*radius+1)*(2*radius+1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				window = window[:0]
+				for ky := max(0, y-radius); ky <= min(h-1, y+radius); ky++ {
+					for kx := max(0, x-radius); kx <= min(w-1, x+radius); kx++ {
+						window = append(window, src.Pix[src.PixOffset(kx, ky)+c])
+					}
+				}
+				// Сортировка вставками: окно не больше 25 элементов.
+				for i := 1; i < len(window); i++ {
+					for j := i; j > 0 && window[j] < window[j-1]; j-- {
+						window[j], window[j-1] = window[j-1], window[j]
+					}
+				}
+				dst.Pix[o+c] = window[len(window)/2]
+			}
+		}
+	}
+	return dst
+}
+
+// addNoise добавляет к цветовым каналам независимый гауссов шум со стандартным отклонением sigma.
+// Шум масштабируется альфой (предумноженные значения не могут ее превышать),
+// полностью прозрачные пиксели не меняются.
+func addNoise(img *image.RGBA, sigma float64, rng *rand.Rand) {
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		a := img.Pix[i+3]
+		if a == 0 {
+			continue
+		}
+		for c := 0; c < 3; c++ {
+			v := float64(img.Pix[i+c]) + rng.NormFloat64()*sigma*float64(a)/255
+			img.Pix[i+c] = uint8(math.Max(0, math.Min(math.Round(v), float64(a))))
+		}
+	}
+}
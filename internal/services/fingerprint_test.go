@@ -0,0 +1,186 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"image"        // Для тестовых изображений
+	"image/color"  // Для палитры кадров GIF
+	"image/gif"    // Для обработки анимации
+	"math"         // Для корреляции
+	"math/rand/v2" // Для шума тестового сенсора
+	"testing"      // Для тестов
+)
+
+// testSensorPattern - мультипликативный шум сенсора (PRNU) камеры camera размером w x h:
+// относительная чувствительность каждого пикселя, в среднем 0, отклонение 3%.
+func testSensorPattern(w, h int, camera uint64) []float64 {
+	rng := rand.New(rand.NewPCG(camera, 7))
+	k := make([]float64, w*h)
+	for i := range k {
+		k[i] = rng.NormFloat64() * 0.03
+	}
+	return k
+}
+
+// testSensorPhoto возвращает полутоновый "снимок" плавной сцены номер scene,
+// сделанный сенсором с шумом k.
+func testSensorPhoto(w, h, scene int, k []float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 150 + 50*math.Sin(float64(x+scene*17)/(9+float64(scene)))*math.Cos(float64(y-scene*5)/13)
+			v *= 1 + k[y*w+x]
+			g := uint8(math.Max(0, math.Min(255, math.Round(v))))
+			img.SetRGBA(x, y, color.RGBA{R: g, G: g, B: g, A: 255})
+		}
+	}
+	return img
+}
+
+// sensorCorrelation - упрощенная проверка принадлежности снимка сенсору, как в
+// криминалистических инструментах: шумовой остаток (изображение минус сглаженное
+// изображение) коррелируется с ожидаемым вкладом отпечатка k * I.
+func sensorCorrelation(img *image.RGBA, k []float64) float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	value := func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }
+	var residual, expected []float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			var smooth float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					smooth += value(x+dx, y+dy)
+				}
+			}
+			smooth /= 9
+			residual = append(residual, value(x, y)-smooth)
+			expected = append(expected, k[y*w+x]*smooth)
+		}
+	}
+	return pearson(residual, expected)
+}
+
+func pearson(a, b []float64) float64 {
+	var ma, mb float64
+	for i := range a {
+		ma += a[i]
+		mb += b[i]
+	}
+	ma /= float64(len(a))
+	mb /= float64(len(b))
+	var cov, va, vb float64
+	for i := range a {
+		cov += (a[i] - ma) * (b[i] - mb)
+		va += (a[i] - ma) * (a[i] - ma)
+		vb += (b[i] - mb) * (b[i] - mb)
+	}
+	return cov / math.Sqrt(va*vb)
+}
+
+func TestSuppressFingerprint(t *testing.T) {
+	const w, h = 160, 120
+	k := testSensorPattern(w, h, 1)
+	other := testSensorPattern(w, h, 2) // Отпечаток другой камеры
+
+	// Наибольшая допустимая корреляция после обработки. Слабые уровни только ослабляют
+	// отпечаток (они оставляют больше резкости), сильный - сводит его почти к нулю.
+	limits := map[FingerprintStrength]float64{
+		FingerprintLow:    0.25,
+		FingerprintMedium: 0.15,
+		FingerprintHigh:   0.06,
+	}
+	for scene := 0; scene < 3; scene++ {
+		photo := testSensorPhoto(w, h, scene, k)
+		before := sensorCorrelation(photo, k)
+		if before < 0.8 || math.Abs(sensorCorrelation(photo, other)) > 0.05 {
+			t.Fatalf("сцена %d: проверка не различает камеры (своя %.3f, чужая %.3f)", scene, before, sensorCorrelation(photo, other))
+		}
+		for _, strength := range []FingerprintStrength{FingerprintLow, FingerprintMedium, FingerprintHigh} {
+			out := suppressFingerprint(photo, strength)
+			if out.Bounds() != photo.Bounds() {
+				t.Fatalf("%s: размер %v, ожидался %v", strength, out.Bounds(), photo.Bounds())
+			}
+			if after := sensorCorrelation(out, k); math.Abs(after) > limits[strength] {
+				t.Errorf("сцена %d, %s: корреляция с отпечатком %.3f (до обработки %.3f, допустимо %.2f)", scene, strength, after, before, limits[strength])
+			}
+			// Само изображение остается узнаваемым.
+			if psnr := jpegPSNR(photo, out); psnr < 30 {
+				t.Errorf("сцена %d, %s: PSNR %.1f дБ", scene, strength, psnr)
+			}
+		}
+	}
+
+	t.Run("шум не воспроизводится", func(t *testing.T) {
+		// Иначе добавленный шум можно было бы вычесть, получив исходный снимок.
+		photo := testSensorPhoto(w, h, 0, k)
+		a, b := suppressFingerprint(photo, FingerprintMedium), suppressFingerprint(photo, FingerprintMedium)
+		if string(a.Pix) == string(b.Pix) {
+			t.Errorf("два запуска дали одинаковый результат")
+		}
+	})
+}
+
+func TestSuppressFingerprintTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 20; x < 40; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+	out := suppressFingerprint(img, FingerprintHigh)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			c := out.RGBAAt(x, y)
+			if c.R > c.A || c.G > c.A || c.B > c.A {
+				t.Fatalf("пиксель (%d,%d) %v: цвет больше альфы", x, y, c)
+			}
+			// Вдали от границы прозрачность не меняется.
+			if x < 14 && c != (color.RGBA{}) {
+				t.Fatalf("прозрачный пиксель (%d,%d) стал %v", x, y, c)
+			}
+			if x > 26 && c.A != 255 {
+				t.Fatalf("непрозрачный пиксель (%d,%d) стал полупрозрачным: %v", x, y, c)
+			}
+		}
+	}
+}
+
+func TestSuppressGIFFingerprint(t *testing.T) {
+	pal := color.Palette{color.Black, color.White, color.Gray{Y: 128}}
+	frames := []*image.Paletted{
+		image.NewPaletted(image.Rect(0, 0, 32, 32), pal),
+		image.NewPaletted(image.Rect(8, 4, 24, 20), pal), // Кадр со смещением
+	}
+	for _, f := range frames {
+		for i := range f.Pix {
+			f.Pix[i] = uint8(i % 2)
+		}
+	}
+	anim := &gif.GIF{Image: frames, Delay: []int{5, 5}}
+	suppressGIFFingerprint(anim, FingerprintMedium)
+	if frames[1].Bounds() != image.Rect(8, 4, 24, 20) {
+		t.Errorf("границы кадра изменены: %v", frames[1].Bounds())
+	}
+	for _, f := range frames {
+		if len(f.Palette) != len(pal) {
+			t.Errorf("палитра кадра изменена: %v", f.Palette)
+		}
+		for _, v := range f.Pix {
+			if int(v) >= len(pal) {
+				t.Fatalf("индекс %d за пределами палитры", v)
+			}
+		}
+	}
+}
+
+func TestParseFingerprintStrength(t *testing.T) {
+	for value, want := range map[string]FingerprintStrength{"low": FingerprintLow, " Medium ": FingerprintMedium, "HIGH": FingerprintHigh} {
+		if got, err := ParseFingerprintStrength(value); err != nil || got != want {
+			t.Errorf("ParseFingerprintStrength(%q) = %q, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"", "max", "1"} {
+		if _, err := ParseFingerprintStrength(value); err == nil {
+			t.Errorf("ParseFingerprintStrength(%q): ожидалась ошибка", value)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для проверки сигнатур
+	"encoding/binary" // Для чтения размеров чанков RIFF (little-endian)
+	"fmt"             // Для форматирования ошибок
+	"image"           // Для работы с изображениями
+	"image/color"     // Для цвета фона при удалении прозрачности
+	"image/draw"      // Для наложения изображения на фон
+	"net/http"        // Для функции DetectContentType
+	"path/filepath"   // Для получения расширения файла
+	"strings"         // Для нормализации значений настроек
+)
+
+// OutputFormat - формат, в котором сохраняется очищенное изображение.
+type OutputFormat string
+
+const (
+	OutputFormatPNG  OutputFormat = "png"  // Без потерь, сохраняет прозрачность
+	OutputFormatJPEG OutputFormat = "jpeg" // С потерями, прозрачность заменяется белым фоном
+)
+
+// ParseOutputFormat разбирает строковое значение формата сохранения
+// (например, из переменной окружения CONVERT_OUTPUT_FORMAT).
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case OutputFormatPNG, OutputFormatJPEG:
+		return format, nil
+	case "jpg":
+		return OutputFormatJPEG, nil
+	}
+	return "", fmt.Errorf("неизвестный формат сохранения: %q (допустимо: %s, %s)", value, OutputFormatPNG, OutputFormatJPEG)
+}
+
+// writableFormats - форматы, которые сервис умеет сохранять в исходном виде.
+// WebP стандартная библиотека кодировать не умеет, а BMP и TIFF браузеры
+// отображают плохо (или не отображают вовсе), поэтому эти форматы конвертируются
+// в формат ProcessOptions.ConvertFormat.
+var writableFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"gif":  true,
+}
+
+// resolveOutputFormat определяет формат сохранения ("jpeg", "png" или "gif")
+// по исходному формату и политике сохранения.
+func resolveOutputFormat(sourceFormat string, opts ProcessOptions) string {
+	switch opts.OutputPolicy {
+	case OutputPolicyPNG:
+		return "png"
+	case OutputPolicyJPEG:
+		return "jpeg"
+	}
+	if writableFormats[sourceFormat] {
+		return sourceFormat
+	}
+	return string(opts.ConvertFormat)
+}
+
+// tiffSignatures - сигнатуры TIFF с порядком байт little-endian ("II") и big-endian ("MM").
+// http.DetectContentType формат TIFF не распознает.
+var tiffSignatures = [][]byte{
+	[]byte("II*\x00"),
+	[]byte("MM\x00*"),
+}
+
+// detectImageContentType определяет MIME-тип по первым байтам файла.
+// Дополняет http.DetectContentType распознаванием TIFF и SVG
+// (для SVG http.DetectContentType возвращает text/xml или text/plain).
+func detectImageContentType(head []byte) string {
+	for _, sig := range tiffSignatures {
+		if bytes.HasPrefix(head, sig) {
+			return "image/tiff"
+		}
+	}
+	if isSVG(head) {
+		return "image/svg+xml"
+	}
+	return http.DetectContentType(head)
+}
+
+// contentTypesByExtension - MIME-типы сохраняемых файлов по расширению.
+var contentTypesByExtension = map[string]string{
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".pdf":  "application/pdf",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+}
+
+// ContentTypeForFilename возвращает MIME-тип сохраненного файла по его расширению.
+// Используется при отдаче файла, чтобы Content-Type не зависел от настроек
+// mime-таблиц операционной системы. Для неизвестных расширений возвращает
+// "application/octet-stream".
+func ContentTypeForFilename(filename string) string {
+	if contentType, ok := contentTypesByExtension[strings.ToLower(filepath.Ext(filename))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// flattenAlpha накладывает изображение на сплошной фон bg и возвращает непрозрачный результат.
+// Нужна перед сохранением в JPEG: кодер просто отбрасывает альфа-канал, и полностью
+// прозрачные пиксели (их цвет обычно черный или случайный) становятся видимыми.
+func flattenAlpha(img image.Image, bg color.Color) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return flat
+}
+
+// riffChunk описывает один чанк контейнера RIFF (используется в WebP).
+type riffChunk struct {
+	FourCC string // Тип чанка, например "VP8 ", "EXIF", "XMP "
+	Data   []byte // Содержимое чанка без заголовка и байта выравнивания
+}
+
+// readWebPChunks разбирает чанки верхнего уровня WebP-файла (RIFF/WEBP).
+func readWebPChunks(data []byte) ([]riffChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("отсутствует сигнатура RIFF/WEBP")
+	}
+	// Размер из заголовка RIFF ограничивает область чанков; данные за ней - "хвост".
+	end := 8 + int(binary.LittleEndian.Uint32(data[4:8]))
+	if end > len(data) || end < 12 {
+		end = len(data)
+	}
+	var chunks []riffChunk
+	pos := 12
+	for pos+8 <= end {
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if pos+8+size > end {
+			return nil, fmt.Errorf("обрезанный чанк WebP %q", data[pos:pos+4])
+		}
+		chunks = append(chunks, riffChunk{FourCC: string(data[pos : pos+4]), Data: data[pos+8 : pos+8+size]})
+		pos += 8 + size + size&1 // Чанки выравниваются на четную границу
+	}
+	return chunks, nil
+}
+
+// webpDataEnd возвращает смещение конца RIFF-контейнера (данные после него - посторонние).
+func webpDataEnd(data []byte) int {
+	if len(data) < 8 {
+		return len(data)
+	}
+	end := 8 + int(binary.LittleEndian.Uint32(data[4:8]))
+	if end > len(data) {
+		return len(data)
+	}
+	return end
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки файлов
+	"encoding/binary" // Для заголовков RIFF
+	"image"           // Для тестовых изображений
+	"image/color"     // Для цветов тестового изображения
+	"image/jpeg"      // Для декодирования результата в JPEG
+	"image/png"       // Для декодирования результата в PNG
+	"os"              // Для чтения сохраненного файла
+	"path/filepath"   // Для пути к сохраненному файлу
+	"testing"         // Для тестов
+
+	// Сторонние библиотеки
+	"golang.org/x/image/bmp"  // Для кодирования BMP
+	"golang.org/x/image/tiff" // Для кодирования TIFF
+	"golang.org/x/image/webp" // Для проверки тестового WebP
+)
+
+// testWebPBits - запись битов в порядке VP8L (младшие биты первыми).
+type testWebPBits struct {
+	out  []byte
+	used uint // Занято битов в последнем байте
+}
+
+func (w *testWebPBits) write(value uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if w.used%8 == 0 {
+			w.out = append(w.out, 0)
+		}
+		w.out[len(w.out)-1] |= byte(value>>i&1) << (w.used % 8)
+		w.used++
+	}
+}
+
+// testWebP собирает WebP без потерь (VP8L) размером 4x2, в котором каждый пиксель
+// задан битами своего номера: бит 0 - зеленый, бит 1 - красный, бит 2 - синий (0 или 255).
+// Каждый канал кодируется простым кодом Хаффмана из двух символов (0 и 255), поэтому
+// на пиксель приходится ровно три бита. Чанки extra добавляются после данных изображения
+// вместе с заголовком VP8X.
+func testWebP(extra ...riffChunk) []byte {
+	var bits testWebPBits
+	bits.write(0x2F, 8)      // Сигнатура VP8L
+	bits.write(4-1, 14)      // Ширина
+	bits.write(2-1, 14)      // Высота
+	bits.write(0, 1)         // Альфа-канал не используется
+	bits.write(0, 3)         // Версия
+	bits.write(0, 1)         // Нет преобразований
+	bits.write(0, 1)         // Нет цветового кэша
+	bits.write(0, 1)         // Нет мета-кодов Хаффмана
+	for i := 0; i < 3; i++ { // Зеленый, красный, синий: символы 0 и 255
+		bits.write(1, 1) // Простой код
+		bits.write(1, 1) // Два символа
+		bits.write(0, 1) // Первый символ записан одним битом
+		bits.write(0, 1)
+		bits.write(255, 8)
+	}
+	for i := 0; i < 2; i++ { // Альфа (255) и расстояния (0): один символ
+		bits.write(1, 1)
+		bits.write(0, 1)
+		bits.write(1, 1)
+		bits.write(uint32(255*(1-i)), 8)
+	}
+	for p := uint32(0); p < 8; p++ {
+		bits.write(p&1, 1)
+		bits.write(p>>1&1, 1)
+		bits.write(p>>2&1, 1)
+	}
+
+	chunk := func(fourCC string, data []byte) []byte {
+		out := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(data)))
+		out = append(out, data...)
+		if len(data)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	var body []byte
+	if len(extra) > 0 {
+		// VP8X: флаг EXIF/XMP и размер холста 4x2.
+		body = chunk("VP8X", []byte{0x08 | 0x04, 0, 0, 0, 3, 0, 0, 1, 0, 0})
+	}
+	body = append(body, chunk("VP8L", bits.out)...)
+	for _, c := range extra {
+		body = append(body, chunk(c.FourCC, c.Data)...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(4+len(body))), append([]byte("WEBP"), body...)...)
+}
+
+// testWebPColor возвращает цвет пикселя (x, y) изображения testWebP.
+func testWebPColor(x, y int) color.NRGBA {
+	p := y*4 + x
+	channel := func(bit int) uint8 { return uint8(255 * (p >> bit & 1)) }
+	return color.NRGBA{R: channel(1), G: channel(0), B: channel(2), A: 255}
+}
+
+// Проверка самого тестового файла: иначе ошибка в нем выглядела бы как ошибка сервиса.
+func TestWebPFixture(t *testing.T) {
+	img, err := webp.Decode(bytes.NewReader(testWebP()))
+	if err != nil {
+		t.Fatalf("webp.Decode: %v", err)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			checkColor(t, "пиксель", img.At(x, y), testWebPColor(x, y), 0)
+		}
+	}
+}
+
+func TestProcessImageConvertsInputFormats(t *testing.T) {
+	// Эталон для BMP и TIFF - то же изображение 4x2, что и в testWebP.
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetNRGBA(x, y, testWebPColor(x, y))
+		}
+	}
+	var bmpData, tiffData bytes.Buffer
+	if err := bmp.Encode(&bmpData, src); err != nil {
+		t.Fatalf("bmp.Encode: %v", err)
+	}
+	if err := tiff.Encode(&tiffData, src, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatalf("tiff.Encode: %v", err)
+	}
+	exif := encodeEXIF([]exifEntry{testASCIIEntry(exifTagArtist, "Иван Петров")}, nil, nil)
+	inputs := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"image.webp", testWebP(), "image/webp"},
+		{"image-exif.webp", testWebP(riffChunk{FourCC: "EXIF", Data: exif}, riffChunk{FourCC: "XMP ", Data: []byte(testXMPPacket)}), "image/webp"},
+		{"image.bmp", bmpData.Bytes(), "image/bmp"},
+		{"image.tiff", tiffData.Bytes(), "image/tiff"},
+	}
+	outputs := []struct {
+		format      OutputFormat
+		extension   string
+		contentType string
+		lossless    bool // Пиксели сравниваются точно
+	}{
+		{OutputFormatPNG, ".png", "image/png", true},
+		{OutputFormatJPEG, ".jpeg", "image/jpeg", false},
+	}
+
+	for _, in := range inputs {
+		if got := detectImageContentType(in.data); got != in.contentType {
+			t.Errorf("%s: тип %q, ожидался %q", in.name, got, in.contentType)
+		}
+		for _, out := range outputs {
+			t.Run(in.name+" -> "+string(out.format), func(t *testing.T) {
+				opts := DefaultProcessOptions()
+				opts.ConvertFormat = out.format
+				dir := t.TempDir()
+				stored, report, err := ProcessAndSaveData(in.name, in.data, dir, opts)
+				if err != nil {
+					t.Fatalf("ProcessAndSaveData: %v", err)
+				}
+				if filepath.Ext(stored) != out.extension || ContentTypeForFilename(stored) != out.contentType {
+					t.Errorf("сохранено как %s (%s)", stored, ContentTypeForFilename(stored))
+				}
+				clean, err := os.ReadFile(filepath.Join(dir, stored))
+				if err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+				var img image.Image
+				if out.format == OutputFormatPNG {
+					img, err = png.Decode(bytes.NewReader(clean))
+				} else {
+					img, err = jpeg.Decode(bytes.NewReader(clean))
+				}
+				if err != nil {
+					t.Fatalf("результат не декодируется: %v", err)
+				}
+				if img.Bounds() != src.Bounds() || report.Width != 4 || report.Height != 2 {
+					t.Fatalf("размер %v, в отчете %dx%d", img.Bounds(), report.Width, report.Height)
+				}
+				if out.lossless {
+					for y := 0; y < 2; y++ {
+						for x := 0; x < 4; x++ {
+							checkColor(t, "пиксель", img.At(x, y), testWebPColor(x, y), 0)
+						}
+					}
+				}
+				if err := VerifyCleanFile(filepath.Join(dir, stored), opts); err != nil {
+					t.Errorf("VerifyCleanFile: %v", err)
+				}
+				if in.name == "image-exif.webp" && (!containsString(report.Authors, "Иван Петров") || !containsString(report.RemovedBlocks, "XMP")) {
+					t.Errorf("метаданные WebP не попали в отчет: %+v", report)
+				}
+			})
+		}
+	}
+}
+
+func TestResolveOutputFormat(t *testing.T) {
+	tests := []struct {
+		source  string
+		policy  OutputPolicy
+		convert OutputFormat
+		want    string
+	}{
+		{"jpeg", OutputPolicyKeep, OutputFormatPNG, "jpeg"},
+		{"gif", OutputPolicyKeep, OutputFormatJPEG, "gif"},
+		{"webp", OutputPolicyKeep, OutputFormatPNG, "png"},
+		{"bmp", OutputPolicyKeep, OutputFormatJPEG, "jpeg"},
+		{"tiff", OutputPolicyKeep, OutputFormatPNG, "png"},
+		{"webp", OutputPolicyJPEG, OutputFormatPNG, "jpeg"},
+		{"jpeg", OutputPolicyPNG, OutputFormatJPEG, "png"},
+	}
+	for _, tt := range tests {
+		opts := ProcessOptions{OutputPolicy: tt.policy, ConvertFormat: tt.convert}
+		if got := resolveOutputFormat(tt.source, opts); got != tt.want {
+			t.Errorf("resolveOutputFormat(%q, %s, %s) = %q, ожидался %q", tt.source, tt.policy, tt.convert, got, tt.want)
+		}
+	}
+	if got := ContentTypeForFilename("file.unknown"); got != "application/octet-stream" {
+		t.Errorf("неизвестное расширение: %q", got)
+	}
+}
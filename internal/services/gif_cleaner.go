@@ -0,0 +1,174 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"     // Для сборки данных подблоков
+	"fmt"        // Для форматирования ошибок
+	"image"      // Для холста первого кадра
+	"image/draw" // Для наложения кадра на холст
+	"image/gif"  // Для покадрового декодирования и кодирования GIF
+	"io"        // Для интерфейсов Reader/Writer
+)
+
+// decodeAnimatedGIF декодирует ВСЕ кадры GIF-файла вместе с задержками,
+// режимами утилизации кадров (disposal) и счетчиком повторов.
+//
+// В отличие от image.Decode, который возвращает только первый кадр,
+// gif.DecodeAll сохраняет анимацию. При этом декодер стандартной библиотеки
+// пропускает расширения комментариев (Comment Extension) и все расширения
+// приложений (Application Extension), кроме NETSCAPE2.0/ANIMEXTS1.0,
+// из которого берется только счетчик повторов. Поэтому в результат не попадают
+// ни комментарии, ни XMP-пакеты, ни другие данные сторонних программ.
+func decodeAnimatedGIF(r io.Reader) (*gif.GIF, error) {
+	anim, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// GIF без кадров формально может пройти декодирование, но сохранить его нельзя.
+	if len(anim.Image) == 0 {
+		return nil, fmt.Errorf("GIF не содержит ни одного кадра")
+	}
+	return anim, nil
+}
+
+// encodeCleanGIF записывает анимацию в w, перенося только данные, необходимые
+// для воспроизведения: кадры с их палитрами и позициями, задержки, режимы утилизации,
+// счетчик повторов, размеры логического экрана, глобальную палитру и индекс цвета фона.
+//
+// Новая структура gif.GIF собирается явно, чтобы в выходной файл гарантированно
+// не попало ничего, кроме перечисленного. gif.EncodeAll записывает расширение
+// NETSCAPE2.0 только для анимаций с LoopCount >= 0 - оно нужно для зацикливания
+// и не содержит пользовательских данных. Комментарии и прочие расширения
+// приложений не записываются.
+func encodeCleanGIF(w io.Writer, anim *gif.GIF) error {
+	clean := &gif.GIF{
+		Image:           anim.Image,
+		Delay:           anim.Delay,
+		LoopCount:       anim.LoopCount,
+		Disposal:        anim.Disposal,
+		Config:          anim.Config,
+		BackgroundIndex: anim.BackgroundIndex,
+	}
+
+	// gif.EncodeAll требует, чтобы срезы задержек и режимов утилизации
+	// совпадали по длине со срезом кадров. Поврежденные файлы могут нарушать это
+	// правило, поэтому выравниваем длины (недостающие значения - нули).
+	if len(clean.Delay) != len(clean.Image) {
+		delays := make([]int, len(clean.Image))
+		copy(delays, clean.Delay)
+		clean.Delay = delays
+	}
+	if clean.Disposal != nil && len(clean.Disposal) != len(clean.Image) {
+		disposals := make([]byte, len(clean.Image))
+		copy(disposals, clean.Disposal)
+		clean.Disposal = disposals
+	}
+
+	return gif.EncodeAll(w, clean)
+}
+
+// gifFirstFrame возвращает первый кадр анимации на холсте размером с логический экран.
+// Кадр GIF может занимать только часть экрана, поэтому при конвертации в другой
+// формат он накладывается на прозрачный холст в своей позиции.
+func gifFirstFrame(anim *gif.GIF) image.Image {
+	frame := anim.Image[0]
+	width, height := anim.Config.Width, anim.Config.Height
+	if width <= 0 || height <= 0 {
+		return frame
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas
+}
+
+// gifExtension описывает расширение GIF, найденное при сканировании файла.
+type gifExtension struct {
+	Label byte   // Метка расширения (0xFE - комментарий, 0xFF - приложение, 0xF9 - управление графикой)
+	Data  []byte // Содержимое всех подблоков, склеенное в один срез
+}
+
+// GIF-метки блоков и расширений.
+const (
+	gifExtensionIntroducer = 0x21
+	gifImageSeparator      = 0x2C
+	gifTrailer             = 0x3B
+	gifLabelComment        = 0xFE
+	gifLabelApplication    = 0xFF
+)
+
+// gifStructure - результат сканирования блоков GIF-файла.
+type gifStructure struct {
+	Extensions []gifExtension // Все найденные расширения
+	Frames     int            // Количество кадров
+	Trailing   int            // Количество байт после завершающего блока (trailer)
+}
+
+// scanGIF проходит по блокам GIF-файла без декодирования данных изображений
+// и возвращает найденные расширения, количество кадров и размер данных после trailer.
+func scanGIF(data []byte) (*gifStructure, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, fmt.Errorf("отсутствует сигнатура GIF")
+	}
+	result := &gifStructure{}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 * (1 << (int(flags&0x07) + 1)) // Глобальная таблица цветов
+	}
+
+	// readSubBlocks читает цепочку подблоков (размер + данные), завершающуюся нулевым байтом.
+	readSubBlocks := func() ([]byte, error) {
+		var buf bytes.Buffer
+		for {
+			if pos >= len(data) {
+				return nil, fmt.Errorf("GIF обрезан внутри подблоков")
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return buf.Bytes(), nil
+			}
+			if pos+size > len(data) {
+				return nil, fmt.Errorf("GIF обрезан внутри подблока")
+			}
+			buf.Write(data[pos : pos+size])
+			pos += size
+		}
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case gifExtensionIntroducer:
+			if pos+1 >= len(data) {
+				return nil, fmt.Errorf("GIF обрезан внутри расширения")
+			}
+			label := data[pos+1]
+			pos += 2
+			body, err := readSubBlocks()
+			if err != nil {
+				return nil, err
+			}
+			result.Extensions = append(result.Extensions, gifExtension{Label: label, Data: body})
+		case gifImageSeparator:
+			if pos+10 > len(data) {
+				return nil, fmt.Errorf("GIF обрезан внутри дескриптора кадра")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 * (1 << (int(flags&0x07) + 1)) // Локальная таблица цветов
+			}
+			pos++ // Минимальный размер кода LZW
+			if _, err := readSubBlocks(); err != nil {
+				return nil, err
+			}
+			result.Frames++
+		case gifTrailer:
+			result.Trailing = len(data) - pos - 1
+			return result, nil
+		default:
+			return nil, fmt.Errorf("неизвестный блок GIF 0x%02X по смещению %d", data[pos], pos)
+		}
+	}
+	// Файл без завершающего блока: декодеры такое допускают.
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"               // Для сборки файлов
+	"image"               // Для кадров
+	"image/color"         // Для модели цвета логического экрана
+	"image/color/palette" // Для палитры кадров
+	"image/gif"           // Для кодирования и проверки анимации
+	"os"                  // Для чтения сохраненного файла
+	"path/filepath"       // Для пути к сохраненному файлу
+	"testing"             // Для тестов
+)
+
+// testAnimation возвращает анимацию из трех кадров с разными задержками и режимами
+// утилизации; второй кадр занимает только часть логического экрана.
+func testAnimation() *gif.GIF {
+	anim := &gif.GIF{
+		Delay:     []int{10, 25, 200},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious},
+		LoopCount: 3,
+		Config:    image.Config{Width: 16, Height: 12, ColorModel: color.Palette(palette.Plan9)},
+	}
+	for i, rect := range []image.Rectangle{image.Rect(0, 0, 16, 12), image.Rect(4, 2, 12, 10), image.Rect(0, 0, 16, 12)} {
+		frame := image.NewPaletted(rect, palette.Plan9)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				frame.SetColorIndex(x, y, uint8((x+y+i*40)%len(palette.Plan9)))
+			}
+		}
+		anim.Image = append(anim.Image, frame)
+	}
+	return anim
+}
+
+// gifExtensionBytes кодирует расширение GIF с данными в одном подблоке.
+func gifExtensionBytes(label byte, data string) []byte {
+	return append(append([]byte{gifExtensionIntroducer, label, byte(len(data))}, data...), 0)
+}
+
+func TestProcessImageKeepsGIFAnimation(t *testing.T) {
+	for _, loop := range []int{0, -1, 3} {
+		anim := testAnimation()
+		anim.LoopCount = loop
+		var encoded bytes.Buffer
+		if err := gif.EncodeAll(&encoded, anim); err != nil {
+			t.Fatalf("gif.EncodeAll: %v", err)
+		}
+		data := encoded.Bytes()
+		extra := append(gifExtensionBytes(gifLabelComment, "Иван Петров"), gifExtensionBytes(gifLabelApplication, "XMP DataXMP<x:xmpmeta/>")...)
+		data = append(append(append([]byte{}, data[:len(data)-1]...), extra...), gifTrailer)
+
+		dir := t.TempDir()
+		stored, report, err := ProcessAndSaveData("anim.gif", data, dir, DefaultProcessOptions())
+		if err != nil {
+			t.Fatalf("ProcessAndSaveData: %v", err)
+		}
+		if filepath.Ext(stored) != ".gif" {
+			t.Fatalf("анимация сохранена как %s", stored)
+		}
+		if !containsString(report.Comments, "Иван Петров") || !containsString(report.RemovedBlocks, "XMP") {
+			t.Errorf("отчет: комментарии %q, блоки %q", report.Comments, report.RemovedBlocks)
+		}
+		clean, err := os.ReadFile(filepath.Join(dir, stored))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if findings, err := verifyGIF(clean); err != nil || len(findings) > 0 {
+			t.Errorf("verifyGIF: %v %q", err, findings)
+		}
+
+		got, err := gif.DecodeAll(bytes.NewReader(clean))
+		if err != nil {
+			t.Fatalf("gif.DecodeAll: %v", err)
+		}
+		if len(got.Image) != len(anim.Image) {
+			t.Fatalf("кадров %d, ожидалось %d", len(got.Image), len(anim.Image))
+		}
+		if got.LoopCount != loop {
+			t.Errorf("счетчик повторов %d, ожидался %d", got.LoopCount, loop)
+		}
+		if got.Config.Width != 16 || got.Config.Height != 12 {
+			t.Errorf("логический экран %dx%d", got.Config.Width, got.Config.Height)
+		}
+		for i := range anim.Image {
+			if got.Delay[i] != anim.Delay[i] || got.Disposal[i] != anim.Disposal[i] {
+				t.Errorf("кадр %d: задержка %d, утилизация %d; ожидались %d, %d", i, got.Delay[i], got.Disposal[i], anim.Delay[i], anim.Disposal[i])
+			}
+			if got.Image[i].Bounds() != anim.Image[i].Bounds() {
+				t.Errorf("кадр %d: границы %v, ожидались %v", i, got.Image[i].Bounds(), anim.Image[i].Bounds())
+			}
+			b := anim.Image[i].Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got.Image[i].At(x, y) != anim.Image[i].At(x, y) {
+						t.Fatalf("кадр %d, пиксель (%d,%d) изменен", i, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeCleanGIFAlignsFrameSlices(t *testing.T) {
+	anim := testAnimation()
+	anim.Delay = anim.Delay[:1]       // Поврежденный файл: задержка только у первого кадра
+	anim.Disposal = anim.Disposal[:2] // и режимы утилизации у двух
+	var out bytes.Buffer
+	if err := encodeCleanGIF(&out, anim); err != nil {
+		t.Fatalf("encodeCleanGIF: %v", err)
+	}
+	got, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatalf("gif.DecodeAll: %v", err)
+	}
+	// Значения третьего кадра не проверяются: кадр без расширения управления графикой
+	// декодер image/gif наследует от предыдущего.
+	if len(got.Image) != 3 || got.Delay[0] != 10 || got.Delay[1] != 0 || got.Disposal[1] != gif.DisposalBackground {
+		t.Errorf("кадров %d, задержки %v, утилизация %v", len(got.Image), got.Delay, got.Disposal)
+	}
+}
+
+func TestGIFFirstFrame(t *testing.T) {
+	anim := testAnimation()
+	anim.Image = anim.Image[1:] // Первый кадр занимает часть экрана
+	frame := gifFirstFrame(anim)
+	if frame.Bounds() != image.Rect(0, 0, 16, 12) {
+		t.Fatalf("границы %v", frame.Bounds())
+	}
+	if _, _, _, a := frame.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("вне кадра не прозрачно")
+	}
+	if r1, g1, b1, _ := frame.At(5, 5).RGBA(); [3]uint32{r1, g1, b1} != func() [3]uint32 {
+		r, g, b, _ := anim.Image[0].At(5, 5).RGBA()
+		return [3]uint32{r, g, b}
+	}() {
+		t.Errorf("пиксель кадра изменен")
+	}
+}
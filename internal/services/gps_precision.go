@@ -0,0 +1,113 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"encoding/binary" // Для записи значений тегов GPS (big-endian)
+	"fmt"             // Для форматирования ошибок
+	"math"            // Для округления координат
+	"strings"         // Для нормализации значений настроек
+)
+
+// GPSPrecision - с какой точностью сохранять координаты съемки в очищенном JPEG.
+// По умолчанию координаты удаляются полностью; огрубленные координаты позволяют
+// показать, где примерно сделан снимок, не раскрывая точного места.
+type GPSPrecision string
+
+const (
+	GPSPrecisionRemove GPSPrecision = "remove" // Удалить координаты (по умолчанию)
+	GPSPrecisionRegion GPSPrecision = "region" // Сетка 100 км (область/регион)
+	GPSPrecisionCity   GPSPrecision = "city"   // Сетка 10 км (уровень города)
+	GPSPrecision1km    GPSPrecision = "1km"    // Сетка 1 км (район)
+)
+
+// gpsGridSizesKm - размер ячейки сетки в километрах для каждой точности.
+var gpsGridSizesKm = map[GPSPrecision]float64{
+	GPSPrecisionRegion: 100,
+	GPSPrecisionCity:   10,
+	GPSPrecision1km:    1,
+}
+
+// kmPerDegreeLatitude - длина одного градуса широты в километрах.
+const kmPerDegreeLatitude = 111.32
+
+// ParseGPSPrecision разбирает точность сохранения координат
+// (переменная окружения GPS_PRECISION или поле формы загрузки).
+func ParseGPSPrecision(value string) (GPSPrecision, error) {
+	precision := GPSPrecision(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := gpsGridSizesKm[precision]; ok || precision == GPSPrecisionRemove {
+		return precision, nil
+	}
+	return "", fmt.Errorf("неизвестная точность координат: %q (допустимо: %s, %s, %s, %s)", value, GPSPrecisionRemove, GPSPrecisionRegion, GPSPrecisionCity, GPSPrecision1km)
+}
+
+// Keeps сообщает, сохраняются ли (огрубленные) координаты.
+func (p GPSPrecision) Keeps() bool {
+	_, ok := gpsGridSizesKm[p]
+	return ok
+}
+
+// Description возвращает описание точности для показа пользователю.
+func (p GPSPrecision) Description() string {
+	switch p {
+	case GPSPrecisionRegion:
+		return "около 100 км (регион)"
+	case GPSPrecisionCity:
+		return "около 10 км (город)"
+	case GPSPrecision1km:
+		return "около 1 км (район)"
+	}
+	return "координаты удалены"
+}
+
+// coarsenGPS привязывает координаты к центру ячейки сетки заданной точности.
+// Ячейки имеют примерно одинаковый размер в километрах: шаг по долготе
+// увеличивается с широтой, так как меридианы сходятся к полюсам.
+// Все точки одной ячейки получают одинаковые координаты, поэтому исходное
+// место нельзя восстановить точнее размера ячейки.
+func coarsenGPS(lat, lon float64, precision GPSPrecision) (float64, float64) {
+	cellKm := gpsGridSizesKm[precision]
+	latStep := cellKm / kmPerDegreeLatitude
+	lat = (math.Floor(lat/latStep) + 0.5) * latStep
+	lat = math.Max(-90, math.Min(90, lat))
+
+	lonStep := 360.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 1e-6 {
+		lonStep = math.Min(360, cellKm/(kmPerDegreeLatitude*cos))
+	}
+	lon = (math.Floor((lon+180)/lonStep)+0.5)*lonStep - 180
+	if lon >= 180 {
+		lon -= 360
+	}
+	return lat, lon
+}
+
+// gpsEXIFEntries формирует минимальный каталог GPS IFD: версия, широта и долгота
+// (без высоты, времени, направления и прочих тегов).
+func gpsEXIFEntries(lat, lon float64) []exifEntry {
+	latRef, lonRef := "N", "E"
+	if lat < 0 {
+		latRef, lat = "S", -lat
+	}
+	if lon < 0 {
+		lonRef, lon = "W", -lon
+	}
+	return []exifEntry{
+		{Tag: exifTagGPSVersionID, Type: exifTypeByte, Count: 4, Value: []byte{2, 3, 0, 0}},
+		{Tag: exifTagGPSLatitudeRef, Type: exifTypeASCII, Count: 2, Value: []byte(latRef + "\x00")},
+		{Tag: exifTagGPSLatitude, Type: exifTypeRational, Count: 3, Value: gpsDegreesValue(lat)},
+		{Tag: exifTagGPSLongitudeRef, Type: exifTypeASCII, Count: 2, Value: []byte(lonRef + "\x00")},
+		{Tag: exifTagGPSLongitude, Type: exifTypeRational, Count: 3, Value: gpsDegreesValue(lon)},
+	}
+}
+
+// gpsDegreesValue кодирует координату как три RATIONAL (градусы, минуты, секунды).
+// Градусы записываются дробью с шестью знаками, минуты и секунды - нулями:
+// такая запись допустима стандартом и не добавляет ложной точности.
+func gpsDegreesValue(degrees float64) []byte {
+	v := make([]byte, 24)
+	binary.BigEndian.PutUint32(v[0:], uint32(math.Round(degrees*1e6)))
+	binary.BigEndian.PutUint32(v[4:], 1e6)
+	binary.BigEndian.PutUint32(v[12:], 1) // 0/1 минут
+	binary.BigEndian.PutUint32(v[20:], 1) // 0/1 секунд
+	return v
+}
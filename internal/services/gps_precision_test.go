@@ -0,0 +1,165 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"math"          // Для расстояний между точками
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"testing"       // Для тестов
+)
+
+// distanceKm возвращает приближенное расстояние по широте и долготе в километрах.
+func distanceKm(lat1, lon1, lat2, lon2 float64) (dLat, dLon float64) {
+	dLat = math.Abs(lat1-lat2) * kmPerDegreeLatitude
+	dLon = math.Abs(lon1-lon2) * kmPerDegreeLatitude * math.Cos(lat2*math.Pi/180)
+	return dLat, dLon
+}
+
+func TestCoarsenGPS(t *testing.T) {
+	points := [][2]float64{
+		{55.7558, 37.6173},   // Москва
+		{-33.8688, 151.2093}, // Сидней
+		{40.7128, -74.0060},  // Нью-Йорк
+		{0.0001, -0.0001},    // Около нуля
+		{64.1466, -21.9426},  // Рейкьявик: шаг по долготе заметно больше шага по широте
+		{12.34, 179.9999},    // Около линии смены дат
+	}
+	for _, precision := range []GPSPrecision{GPSPrecisionRegion, GPSPrecisionCity, GPSPrecision1km} {
+		cellKm := gpsGridSizesKm[precision]
+		for _, p := range points {
+			lat, lon := coarsenGPS(p[0], p[1], precision)
+			// Точка лежит в своей ячейке: до центра не больше половины ячейки по каждой оси.
+			dLat, dLon := distanceKm(p[0], p[1], lat, lon)
+			if dLat > cellKm/2+1e-6 || dLon > cellKm/2+1e-6 {
+				t.Errorf("%s, %v: центр (%.6f, %.6f) в %.2f/%.2f км, ячейка %.0f км", precision, p, lat, lon, dLat, dLon, cellKm)
+			}
+			if lon < -180 || lon >= 180 || lat < -90 || lat > 90 {
+				t.Errorf("%s, %v: координаты вне диапазона: %.6f, %.6f", precision, p, lat, lon)
+			}
+			// Центр ячейки - неподвижная точка: повторное огрубление его не меняет.
+			if lat2, lon2 := coarsenGPS(lat, lon, precision); math.Abs(lat2-lat) > 1e-9 || math.Abs(lon2-lon) > 1e-9 {
+				t.Errorf("%s, %v: центр (%.6f, %.6f) огрубляется в (%.6f, %.6f)", precision, p, lat, lon, lat2, lon2)
+			}
+		}
+	}
+
+	t.Run("точки одной ячейки неразличимы", func(t *testing.T) {
+		latStep := 10 / kmPerDegreeLatitude
+		base := (math.Floor(55.7558/latStep) + 0.5) * latStep // Центр ячейки по широте
+		lat1, lon1 := coarsenGPS(base-latStep*0.45, 37.60, GPSPrecisionCity)
+		lat2, lon2 := coarsenGPS(base+latStep*0.45, 37.62, GPSPrecisionCity)
+		if lat1 != lat2 || lon1 != lon2 {
+			t.Errorf("точки одной ячейки дали разные центры: (%.6f, %.6f) и (%.6f, %.6f)", lat1, lon1, lat2, lon2)
+		}
+		if math.Abs(lat1-base) > 1e-9 {
+			t.Errorf("широта %.6f, ожидался центр ячейки %.6f", lat1, base)
+		}
+	})
+
+	t.Run("полюс", func(t *testing.T) {
+		lat, lon := coarsenGPS(89.9999, 123.4, GPSPrecisionRegion)
+		if lat > 90 || lon < -180 || lon >= 180 {
+			t.Errorf("координаты вне диапазона: %.6f, %.6f", lat, lon)
+		}
+	})
+}
+
+func TestGPSEXIFEntries(t *testing.T) {
+	ex, err := parseEXIF(encodeEXIF(nil, nil, gpsEXIFEntries(-33.874, -151.21)))
+	if err != nil {
+		t.Fatalf("parseEXIF: %v", err)
+	}
+	lat, lon, ok := ex.GPSCoordinates()
+	if !ok || math.Abs(lat+33.874) > 1e-6 || math.Abs(lon+151.21) > 1e-6 {
+		t.Errorf("координаты %.6f, %.6f (%v)", lat, lon, ok)
+	}
+	if len(ex.GPS) != 5 {
+		t.Errorf("тегов GPS %d, ожидалось 5 (версия, широта, долгота и их полушария)", len(ex.GPS))
+	}
+}
+
+func TestProcessImageKeepsCoarseGPS(t *testing.T) {
+	input := testJPEG(t, testEXIFSegment(
+		[]exifEntry{testASCIIEntry(exifTagModel, "X100")},
+		nil,
+		append(gpsEXIFEntries(55.7558, 37.6173), exifEntry{Tag: exifTagGPSDateStamp, Type: exifTypeASCII, Count: 11, Value: []byte("2024:05:01\x00")}),
+	))
+	for _, mode := range []CleanMode{CleanModeLossless, CleanModeReencode} {
+		for _, precision := range []GPSPrecision{GPSPrecisionRegion, GPSPrecisionCity, GPSPrecision1km} {
+			t.Run(string(mode)+"/"+string(precision), func(t *testing.T) {
+				opts := DefaultProcessOptions()
+				opts.JPEGMode = mode
+				opts.GPSPrecision = precision
+				dir := t.TempDir()
+				stored, report, err := ProcessAndSaveData("photo.jpg", input, dir, opts)
+				if err != nil {
+					t.Fatalf("ProcessAndSaveData: %v", err)
+				}
+				wantLat, wantLon := coarsenGPS(55.7558, 37.6173, precision)
+				if report.GPSKept == nil || report.GPSKept.Latitude != wantLat || report.GPSKept.Longitude != wantLon || report.GPSKeptPrecision != precision {
+					t.Fatalf("в отчете сохранены координаты %+v (%s), ожидались %.6f, %.6f", report.GPSKept, report.GPSKeptPrecision, wantLat, wantLon)
+				}
+
+				path := filepath.Join(dir, stored)
+				clean, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+				segments, _, err := readJPEGHeaderSegments(clean)
+				if err != nil {
+					t.Fatalf("readJPEGHeaderSegments: %v", err)
+				}
+				ex, err := parseEXIF(findJPEGExif(segments))
+				if err != nil {
+					t.Fatalf("parseEXIF: %v", err)
+				}
+				lat, lon, ok := ex.GPSCoordinates()
+				if !ok || math.Abs(lat-wantLat) > 1e-6 || math.Abs(lon-wantLon) > 1e-6 {
+					t.Errorf("в файле координаты %.6f, %.6f (%v), ожидались %.6f, %.6f", lat, lon, ok, wantLat, wantLon)
+				}
+				// Дата GPS и модель камеры не переносятся.
+				if findEntry(ex.GPS, exifTagGPSDateStamp) != nil || findEntry(ex.IFD0, exifTagModel) != nil {
+					t.Errorf("перенесены лишние теги: %+v", ex)
+				}
+
+				if err := VerifyCleanFile(path, opts); err != nil {
+					t.Errorf("VerifyCleanFile: %v", err)
+				}
+				// При настройке "удалять координаты" тот же файл не проходит проверку.
+				if err := VerifyCleanFile(path, DefaultProcessOptions()); err == nil {
+					t.Errorf("файл с координатами прошел проверку без разрешения")
+				}
+			})
+		}
+	}
+
+	t.Run("PNG", func(t *testing.T) {
+		// Огрубленные координаты сохраняются только в JPEG.
+		opts := DefaultProcessOptions()
+		opts.GPSPrecision = GPSPrecisionCity
+		opts.OutputPolicy = OutputPolicyPNG
+		_, report, err := ProcessAndSaveData("photo.jpg", input, t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("ProcessAndSaveData: %v", err)
+		}
+		if report.GPSKept != nil || report.GPS == nil {
+			t.Errorf("координаты: найдены %+v, сохранены %+v", report.GPS, report.GPSKept)
+		}
+	})
+}
+
+func TestParseGPSPrecision(t *testing.T) {
+	for value, want := range map[string]GPSPrecision{"remove": GPSPrecisionRemove, " City ": GPSPrecisionCity, "REGION": GPSPrecisionRegion, "1km": GPSPrecision1km} {
+		if got, err := ParseGPSPrecision(value); err != nil || got != want {
+			t.Errorf("ParseGPSPrecision(%q) = %q, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"", "exact", "100m"} {
+		if _, err := ParseGPSPrecision(value); err == nil {
+			t.Errorf("ParseGPSPrecision(%q): ожидалась ошибка", value)
+		}
+	}
+	if GPSPrecisionRemove.Keeps() || !GPSPrecision1km.Keeps() {
+		t.Errorf("Keeps() перепутан")
+	}
+}
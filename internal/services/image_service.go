@@ -2,25 +2,33 @@ package services
 
 import (
 	// Стандартные библиотеки
+	"bytes"    // Для чтения файла, загруженного в память
+	"errors"   // Для проверки ошибок водяного знака (errors.Is)
 	"fmt"      // Для форматирования строк и ошибок
 	"image"    // Основной пакет для работы с изображениями
+	"image/color" // Для белого фона при сохранении в JPEG
 	"io"       // Для интерфейсов Reader/Seeker и константы EOF
 	"log"      // Для логирования
 	"mime/multipart" // Для работы с multipart-формами (загрузка файлов)
-	"net/http" // Для функции DetectContentType
 	"os"       // Для работы с файлами (Create, Remove)
 	"path/filepath" // Для работы с путями к файлам (Join)
+	"strings"  // Для списка сохраненных полей в логе
 
 	// Пакеты для поддержки форматов изображений.
 	// Используется пустой импорт (_) для регистрации соответствующих декодеров/кодеров
 	// в пакете "image". Без этих импортов image.Decode и функции Encode не будут работать
 	// для данных форматов.
-	"image/gif"  // Для кодирования GIF
-	_ "image/gif" // Для декодирования GIF
+	"image/gif"  // Для покадрового декодирования и кодирования GIF
 	"image/jpeg" // Для кодирования JPEG
 	_ "image/jpeg"// Для декодирования JPEG
 	"image/png"  // Для кодирования PNG
 	_ "image/png" // Для декодирования PNG
+
+	// Декодеры форматов, которые стандартная библиотека не поддерживает (чистый Go).
+	// Кодировать эти форматы не требуется: они конвертируются в ProcessOptions.ConvertFormat.
+	_ "golang.org/x/image/bmp"  // Для декодирования BMP
+	_ "golang.org/x/image/tiff" // Для декодирования TIFF
+	_ "golang.org/x/image/webp" // Для декодирования WebP (VP8 и VP8L)
 )
 
 // AllowedImageTypes - карта (map) разрешенных MIME-типов изображений.
@@ -31,88 +39,519 @@ var AllowedImageTypes = map[string]bool{
 	"image/jpeg": true,
 	"image/png":  true,
 	"image/gif":  true,
-	// Можно добавить другие типы, если нужно, например:
-	// "image/webp": true, // Потребует импорта пакета для WebP
+	"image/webp": true, // Сохраняется в формате ProcessOptions.ConvertFormat
+	"image/bmp":  true, // Сохраняется в формате ProcessOptions.ConvertFormat
+	"image/tiff": true, // Сохраняется в формате ProcessOptions.ConvertFormat
+	"image/svg+xml": true, // Очищается (sanitizeSVG) или растеризуется в PNG
+}
+
+// AllowedDocumentTypes - разрешенные MIME-типы документов. Документы не декодируются
+// как изображения: они очищаются собственными обработчиками и сохраняются в исходном формате.
+var AllowedDocumentTypes = map[string]bool{
+	"application/pdf": true, // Очищается cleanPDF
+	// Документы Office: очищаются cleanOOXML.
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true, // DOCX
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true, // XLSX
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true, // PPTX
+}
+
+// AllowedAudioTypes - разрешенные MIME-типы аудиофайлов. Из них удаляются теги и обложки
+// (cleanAudio), аудиоданные сохраняются без изменений.
+var AllowedAudioTypes = map[string]bool{
+	"audio/mpeg": true, // MP3
+	"audio/flac": true, // FLAC
+	"audio/ogg":  true, // Ogg Vorbis и Ogg Opus
 }
 
 // ProcessAndSaveImage обрабатывает загруженный файл изображения.
 // Выполняет следующие шаги:
 // 1. Открывает файл из multipart.FileHeader.
-// 2. Читает первые 512 байт для определения MIME-типа с помощью http.DetectContentType.
-// 3. Проверяет, соответствует ли определенный MIME-тип разрешенным в AllowedImageTypes.
-// 4. Декодирует изображение с помощью image.Decode. Этот шаг важен, так как он:
+// 2. Читает файл в память и определяет MIME-тип по первым 512 байтам с помощью http.DetectContentType
+//    (через detectImageContentType, которая дополнительно распознает TIFF).
+// 3. Проверяет, соответствует ли определенный MIME-тип разрешенным в AllowedImageTypes
+//    или AllowedDocumentTypes (документы Office определяются по содержимому ZIP-архива).
+//    PDF собирается заново без метаданных, скриптов, вложенных файлов и истории изменений
+//    (cleanPDF), документы Office - без свойств документа и с обезличенными авторами
+//    комментариев и исправлений (cleanOOXML); документы сохраняются сразу, без шагов 4-7.
+//    Из аудиофайлов (AllowedAudioTypes) удаляются теги и обложки (cleanAudio), они тоже
+//    сохраняются сразу.
+//    SVG очищается от скриптов, внешних ссылок и метаданных (sanitizeSVG) и сохраняется
+//    как есть, а если выбрана растеризация или нужны пиксельные операции - растеризуется
+//    в PNG и дальше обрабатывается как PNG.
+// 4. Проверяет размеры из заголовка (image.DecodeConfig) и резервирует память в общем бюджете
+//    декодирования - защита от "декомпрессионных бомб".
+//    Затем декодирует изображение с помощью image.Decode. Этот шаг важен, так как он:
 //    а) Проверяет, является ли файл действительно изображением поддерживаемого формата.
 //    б) Отбрасывает большинство метаданных (EXIF, GPS и т.д.), так как декодируется только пиксельная информация.
-//    в) Возвращает фактический формат изображения ("jpeg", "png", "gif").
-// 5. Генерирует уникальное имя файла на основе случайного токена и фактического формата.
+//    в) Возвращает фактический формат изображения ("jpeg", "png", "gif", "webp", "bmp", "tiff").
+//    GIF декодируется покадрово, чтобы сохранить анимацию.
+//    Декодированное изображение (каждый кадр GIF) сверяется по перцептивному хешу
+//    со списком блокировки; совпавшие файлы отклоняются с ErrBlockedContent.
+//    Для JPEG, TIFF и WebP перед перекодированием применяется EXIF-ориентация (поворот/отражение пикселей).
+//    Если включено размытие лиц (opts.BlurFaces), найденные детектором лица размываются.
+//    Если заданы области скрытия (opts.Redactions), они закрашиваются, размываются или
+//    пикселизируются в декодированном изображении до кодирования.
+//    Если задана максимальная длинная сторона (opts.MaxLongEdge), большие изображения уменьшаются.
+//    Если включено подавление отпечатка сенсора (opts.AntiFingerprint), изображение слегка
+//    пересэмплируется, очищается от шума и получает новый случайный шум.
+//    Если задана надпись (opts.Overlay), она наносится поверх изображения, а при включенном
+//    водяном знаке (opts.Watermark) в пиксели встраивается opts.WatermarkID.
+//    В режиме глубокой очистки (opts.Scrub) обнуляется RGB прозрачных пикселей, сжимаются палитры,
+//    а при необходимости понижается разрядность и заменяются случайными младшие биты.
+// 5. Генерирует уникальное имя файла на основе случайного токена и формата сохранения
+//    (исходного для JPEG, PNG и GIF, ProcessOptions.ConvertFormat для WebP, BMP и TIFF).
 // 6. Создает новый файл на сервере по указанному пути (`uploadDir`).
-// 7. Перекодирует декодированное изображение в его исходном формате (или можно принудительно в один формат, например, JPEG)
-//    и сохраняет в созданный файл.
-// Возвращает имя сохраненного файла (без пути) и ошибку (nil в случае успеха).
-func ProcessAndSaveImage(fileHeader *multipart.FileHeader, uploadDir string) (storedFilename string, err error) {
+// 7. Перекодирует декодированное изображение в формат, выбранный политикой сохранения (opts.OutputPolicy:
+//    исходный формат, PNG или JPEG с заданным качеством, в том числе прогрессивный) и сохраняет в созданный файл. JPEG и PNG в режиме CleanModeLossless не перекодируются:
+//    из них удаляются сегменты/чанки метаданных, а данные изображения копируются без изменений.
+// Возвращает имя сохраненного файла (без пути), отчет о найденных и удаленных метаданных
+// и ошибку (nil в случае успеха).
+func ProcessAndSaveImage(fileHeader *multipart.FileHeader, uploadDir string, opts ProcessOptions) (storedFilename string, report *MetadataReport, err error) {
 	// 1. Открываем файл, предоставленный в заголовке multipart-формы.
 	file, err := fileHeader.Open() // Возвращает multipart.File, который реализует io.Reader, io.Seeker, io.Closer
 	if err != nil {
-		return "", fmt.Errorf("не удалось открыть загруженный файл '%s': %w", fileHeader.Filename, err)
+		return "", nil, fmt.Errorf("не удалось открыть загруженный файл '%s': %w", fileHeader.Filename, err)
 	}
 	// Гарантируем закрытие файла при выходе из функции.
 	defer file.Close()
 
-	// 2. Читаем начало файла для определения MIME-типа.
-	//    http.DetectContentType требует до 512 байт.
-	buffer := make([]byte, 512)
-	bytesRead, err := file.Read(buffer) // Читаем байты в буфер
-	// Обрабатываем ошибки чтения. io.EOF не является ошибкой, если файл меньше 512 байт.
-	if err != nil && err != io.EOF {
-		return "", fmt.Errorf("не удалось прочитать начало файла '%s': %w", fileHeader.Filename, err)
-	}
-	// Проверяем случай пустого файла (0 байт прочитано и достигнут конец файла)
-	if bytesRead == 0 && err == io.EOF {
-		return "", fmt.Errorf("файл '%s' пустой", fileHeader.Filename)
+	// 2. Читаем файл целиком в память. Размер файла уже ограничен в хендлере (MaxUploadSize),
+	//    а сырые байты нужны не только декодеру, но и для чтения EXIF (ориентация).
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("не удалось прочитать файл '%s': %w", fileHeader.Filename, err)
 	}
+	return ProcessAndSaveData(fileHeader.Filename, data, uploadDir, opts)
+}
 
-	// 2.1 Важно: Сбрасываем указатель чтения обратно в начало файла!
-	//     Потому что следующий шаг (image.Decode) должен читать файл с самого начала.
-	_, err = file.Seek(0, io.SeekStart) // io.SeekStart означает смещение от начала файла
-	if err != nil {
-		return "", fmt.Errorf("не удалось сбросить указатель чтения файла '%s' в начало: %w", fileHeader.Filename, err)
+// ProcessAndSaveData обрабатывает файл, уже прочитанный в память (например, изображение
+// из ZIP-архива), так же, как ProcessAndSaveImage, начиная с шага 3.
+// filename - исходное имя файла (для журнала).
+func ProcessAndSaveData(filename string, data []byte, uploadDir string, opts ProcessOptions) (storedFilename string, report *MetadataReport, err error) {
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("файл '%s' пустой", filename)
 	}
 
-	// 3. Определяем MIME-тип по прочитанным байтам.
-	//    Используем срез buffer[:bytesRead], чтобы передать только фактически прочитанные байты.
-	contentType := http.DetectContentType(buffer[:bytesRead])
+	// 3. Определяем MIME-тип по первым байтам файла (http.DetectContentType учитывает до 512 байт).
+	contentType := detectImageContentType(data[:min(len(data), 512)])
+	// Документ Office - это ZIP-архив: его тип определяется по частям архива.
+	if contentType == "application/zip" {
+		if officeType := detectOOXMLContentType(data); officeType != "" {
+			contentType = officeType
+		}
+	}
+	// MP3 без тегов и FLAC по первым байтам не распознаются, Ogg распознается как контейнер.
+	contentType = detectAudioContentType(data, contentType)
 
 	// 3.1 Проверяем, разрешен ли определенный тип.
-	if !AllowedImageTypes[contentType] {
-		log.Printf("Файл '%s' отклонен: недопустимый MIME-тип '%s', определенный по содержимому.", fileHeader.Filename, contentType)
-		return "", fmt.Errorf("недопустимый тип файла: %s", contentType) // Возвращаем ошибку с указанием типа
+	if !AllowedImageTypes[contentType] && !AllowedDocumentTypes[contentType] && !AllowedAudioTypes[contentType] {
+		log.Printf("Файл '%s' отклонен: недопустимый MIME-тип '%s', определенный по содержимому.", filename, contentType)
+		return "", nil, fmt.Errorf("недопустимый тип файла: %s", contentType) // Возвращаем ошибку с указанием типа
+	}
+	log.Printf("Файл '%s' прошел проверку MIME-типа: '%s'", filename, contentType)
+
+	// 3.0 Документы (PDF, Office) очищаются целиком и сохраняются в исходном формате.
+	//     Пиксельные операции (размытие, надписи, водяной знак) к документам не применяются.
+	if AllowedDocumentTypes[contentType] {
+		var clean []byte
+		var docReport *MetadataReport
+		if contentType == "application/pdf" {
+			clean, docReport, err = cleanPDF(data, opts)
+		} else {
+			clean, docReport, err = cleanOOXML(data, contentType, opts)
+		}
+		if err != nil {
+			log.Printf("Файл '%s' отклонен: %v", filename, err)
+			return "", nil, err
+		}
+		if opts.modifiesPixels() {
+			log.Printf("Файл '%s': обработка пикселей к документам не применяется", filename)
+		}
+		storedFilename, err := saveCleanFile(filename, uploadDir, "."+docReport.Format, clean)
+		if err != nil {
+			return "", nil, err
+		}
+		return storedFilename, docReport, nil
+	}
+
+	// 3.0.1 Аудиофайлы: удаляются теги, звук копируется без изменений.
+	if AllowedAudioTypes[contentType] {
+		clean, audioReport, err := cleanAudio(data, contentType)
+		if err != nil {
+			log.Printf("Файл '%s' отклонен: %v", filename, err)
+			return "", nil, err
+		}
+		if opts.modifiesPixels() {
+			log.Printf("Файл '%s': обработка пикселей к аудиофайлам не применяется", filename)
+		}
+		storedFilename, err := saveCleanFile(filename, uploadDir, "."+audioReport.Format, clean)
+		if err != nil {
+			return "", nil, err
+		}
+		return storedFilename, audioReport, nil
 	}
-	log.Printf("Файл '%s' прошел проверку MIME-типа: '%s'", fileHeader.Filename, contentType)
+
+	// 3.0.2 SVG - это документ, а не растровое изображение: сначала он очищается.
+	//       Очищенный SVG либо сохраняется сразу, либо растеризуется в PNG, который
+	//       проходит обычную обработку (отчет при этом остается отчетом об исходном SVG).
+	var svgReport *MetadataReport
+	if contentType == "image/svg+xml" {
+		var clean []byte
+		clean, svgReport, err = sanitizeSVG(data)
+		if err != nil {
+			log.Printf("Файл '%s' отклонен: %v", filename, err)
+			return "", nil, err
+		}
+		if !opts.rasterizesSVG() {
+			// Размеры в отчете - собственный размер рисунка (width/height/viewBox).
+			svgReport.Width, svgReport.Height, _ = svgSize(clean)
+			storedFilename, err := saveCleanFile(filename, uploadDir, ".svg", clean)
+			if err != nil {
+				return "", nil, err
+			}
+			return storedFilename, svgReport, nil
+		}
+		raster, err := rasterizeSVG(clean, opts.MaxLongEdge)
+		if err != nil {
+			log.Printf("Ошибка растеризации SVG '%s': %v", filename, err)
+			return "", nil, fmt.Errorf("не удалось растеризовать SVG: %w", err)
+		}
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, raster); err != nil {
+			return "", nil, fmt.Errorf("не удалось растеризовать SVG: %w", err)
+		}
+		log.Printf("Файл '%s': SVG растеризован в PNG %dx%d", filename, raster.Rect.Dx(), raster.Rect.Dy())
+		data, contentType = encoded.Bytes(), "image/png"
+	}
+
+	// 3.2 Защита от "декомпрессионных бомб": читаем только заголовок (image.DecodeConfig)
+	//     и проверяем объявленные размеры ДО выделения памяти под пиксели.
+	imgConfig, configFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Ошибка чтения заголовка изображения '%s': %v", filename, err)
+		return "", nil, fmt.Errorf("не удалось декодировать изображение: %w", err)
+	}
+	if err := checkImageLimits(imgConfig, opts); err != nil {
+		log.Printf("Файл '%s' отклонен до декодирования: %v", filename, err)
+		return "", nil, err
+	}
+	// Для GIF память зависит от количества кадров. Файл, структуру которого не удалось
+	// разобрать, отклоняется: иначе анимация из тысяч кадров была бы оценена как один кадр.
+	frames := 1
+	if configFormat == "gif" {
+		structure, errScan := scanGIF(data)
+		if errScan != nil {
+			log.Printf("Файл '%s' отклонен до декодирования: %v", filename, errScan)
+			return "", nil, fmt.Errorf("не удалось декодировать изображение: %w", errScan)
+		}
+		frames = structure.Frames
+	}
+
+	// 3.3 Резервируем память в общем бюджете декодирования. Если памяти не хватает,
+	//     ждем завершения других загрузок, а слишком "тяжелые" файлы отклоняем сразу.
+	memoryNeeded := estimateDecodeMemory(imgConfig, configFormat, frames)
+	if err := decodeBudget.acquire(memoryNeeded, decodeBudgetWaitTimeout); err != nil {
+		log.Printf("Файл '%s' (%dx%d, кадров: %d) не может быть декодирован: %v", filename, imgConfig.Width, imgConfig.Height, frames, err)
+		return "", nil, err
+	}
+	defer decodeBudget.release(memoryNeeded)
 
 	// 4. Декодируем изображение.
 	//    image.Decode читает данные из file (io.Reader) и пытается определить формат
 	//    и декодировать его в объект image.Image.
 	//    Он возвращает декодированное изображение, строку с именем формата ("jpeg", "png", "gif") и ошибку.
-	img, detectedFormat, err := image.Decode(file)
+	//    Для GIF используется покадровое декодирование (decodeAnimatedGIF), иначе
+	//    анимированные GIF схлопнулись бы до первого кадра.
+	var img image.Image
+	var detectedFormat string
+	var anim *gif.GIF // Заполняется только для GIF
+	if contentType == "image/gif" {
+		detectedFormat = "gif"
+		anim, err = decodeAnimatedGIF(bytes.NewReader(data))
+		if err == nil {
+			img = anim.Image[0] // Первый кадр используется только для логирования размеров
+		}
+	} else {
+		img, detectedFormat, err = image.Decode(bytes.NewReader(data))
+	}
 	if err != nil {
 		// Если декодирование не удалось, файл либо поврежден, либо не является изображением
 		// поддерживаемого формата (несмотря на MIME-тип).
-		log.Printf("Ошибка декодирования файла '%s' как изображения: %v. Обнаруженный формат (если есть): %s", fileHeader.Filename, err, detectedFormat)
+		log.Printf("Ошибка декодирования файла '%s' как изображения: %v. Обнаруженный формат (если есть): %s", filename, err, detectedFormat)
 		// Возвращаем пользователю более общую ошибку.
-		return "", fmt.Errorf("не удалось декодировать изображение: %w", err)
+		return "", nil, fmt.Errorf("не удалось декодировать изображение: %w", err)
 	}
 	// Логируем успешное декодирование и определенный формат.
-	log.Printf("Файл '%s' успешно декодирован как формат '%s'. Размеры: %dx%d", fileHeader.Filename, detectedFormat, img.Bounds().Dx(), img.Bounds().Dy())
+	log.Printf("Файл '%s' успешно декодирован как формат '%s'. Размеры: %dx%d", filename, detectedFormat, img.Bounds().Dx(), img.Bounds().Dy())
+
+	// Сверяем изображение со списком блокировки (если он настроен) до любой обработки
+	// и до записи на диск: запрещенные изображения не должны сохраняться даже временно.
+	if err := checkBlocklist(img, anim, imageOrientation(data, detectedFormat)); err != nil {
+		log.Printf("Файл '%s' отклонен: %v", filename, err)
+		return "", nil, err
+	}
+
+	// Уменьшение нужно, только если изображение больше заданного размера; иначе
+	// оно не мешает lossless-очистке (opts - копия, изменение не выходит за пределы функции).
+	if opts.MaxLongEdge > 0 && max(imgConfig.Width, imgConfig.Height) <= opts.MaxLongEdge {
+		opts.MaxLongEdge = 0
+	}
+
+	// 4.0 Составляем отчет о метаданных исходного файла до их удаления,
+	//     чтобы показать пользователю, что именно могло утечь.
+	report = analyzeMetadata(data, detectedFormat)
+	if svgReport != nil {
+		report = svgReport // Метаданные были в исходном SVG, а не в PNG после растеризации
+	}
+
+	// 4.0.1 Определяем формат сохранения по политике (opts.OutputPolicy). Форматы, которые
+	//       сервис не может сохранить в исходном виде (WebP, BMP, TIFF), конвертируются всегда.
+	outputFormat := resolveOutputFormat(detectedFormat, opts)
+	if outputFormat != detectedFormat {
+		log.Printf("Файл '%s': формат '%s' будет сохранен как '%s'", filename, detectedFormat, outputFormat)
+	}
+	if anim != nil && outputFormat != "gif" {
+		// В PNG и JPEG сохраняется только первый кадр.
+		if len(anim.Image) > 1 {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ: Файл '%s' - анимированный GIF (%d кадров); при сохранении в %s останется только первый кадр.", filename, len(anim.Image), outputFormat)
+		}
+		img = gifFirstFrame(anim)
+	}
+
+	// 4.0.2 Встроенный ICC-профиль удаляется в любом случае. Если он описывает пространство,
+	//       отличное от sRGB (Display P3, Adobe RGB...), пиксели нужно перевести в sRGB,
+	//       иначе без профиля цвета станут блеклыми. Поэтому lossless-очистка для таких
+	//       файлов не применяется.
+	var colorProfile *iccProfile
+	if rawProfile := extractICCProfile(data, detectedFormat); rawProfile != nil {
+		parsed, errICC := parseICCProfile(rawProfile)
+		switch {
+		case errICC != nil:
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ: Файл '%s': ICC-профиль не поддерживается (%v); он будет удален без преобразования цветов.", filename, errICC)
+		case parsed.isSRGB():
+			log.Printf("Файл '%s': ICC-профиль совпадает с sRGB и удаляется без преобразования", filename)
+		default:
+			colorProfile = parsed
+			report.ColorConvertedFrom = parsed.Description
+			if report.ColorConvertedFrom == "" {
+				report.ColorConvertedFrom = "без названия"
+			}
+			log.Printf("Файл '%s': цвета будут переведены в sRGB из профиля '%s'", filename, report.ColorConvertedFrom)
+		}
+	}
+
+	// 4.0.3 Огрубление координат: вместо полного удаления GPS в очищенный JPEG
+	//       записываются координаты центра ячейки сетки выбранной точности.
+	//       Поддерживается только для JPEG, сохраняемого в JPEG.
+	var kept keptMetadata // Метаданные, записываемые в очищенный JPEG заново
+	if opts.GPSPrecision.Keeps() && report.GPS != nil {
+		if detectedFormat == "jpeg" && outputFormat == "jpeg" {
+			lat, lon := coarsenGPS(report.GPS.Latitude, report.GPS.Longitude, opts.GPSPrecision)
+			kept.GPS = gpsEXIFEntries(lat, lon)
+			report.GPSKept = &GPSLocation{Latitude: lat, Longitude: lon}
+			report.GPSKeptPrecision = opts.GPSPrecision
+			log.Printf("Файл '%s': координаты сохраняются с точностью '%s'", filename, opts.GPSPrecision)
+		} else {
+			log.Printf("Файл '%s': огрубленные координаты сохраняются только в JPEG; координаты удалены полностью", filename)
+		}
+	}
+
+	// 4.0.4 Список разрешенных полей (авторство, копирайт и т.п.): значения переносятся
+	//       в новые минимальные блоки EXIF/XMP/IPTC. Как и координаты, только для JPEG -> JPEG.
+	if len(opts.MetadataAllowlist) > 0 {
+		if detectedFormat == "jpeg" && outputFormat == "jpeg" {
+			allowed, keptNames := collectAllowedMetadata(data, opts.MetadataAllowlist)
+			kept.IFD0, kept.ExifIFD, kept.XMP, kept.IPTC = allowed.IFD0, allowed.ExifIFD, allowed.XMP, allowed.IPTC
+			report.KeptFields = keptNames
+			if len(keptNames) > 0 {
+				log.Printf("Файл '%s': сохраняются разрешенные поля метаданных: %s", filename, strings.Join(keptNames, ", "))
+			}
+		} else {
+			log.Printf("Файл '%s': разрешенные поля метаданных сохраняются только в JPEG; метаданные удалены полностью", filename)
+		}
+	}
+
+	// 4.1 Подготовка JPEG.
+	//     Камеры телефонов часто сохраняют пиксели "как с сенсора" и указывают поворот
+	//     только в теге Orientation. В режиме lossless пиксели не трогаются, а ориентация
+	//     переносится в новый минимальный EXIF. При перекодировании поворот применяется
+	//     к пикселям ДО удаления метаданных, иначе очищенное фото оказалось бы повернутым.
+	var losslessJPEG []byte // Очищенный без перекодирования JPEG (если режим lossless сработал)
+	if detectedFormat == "jpeg" {
+		orientation := jpegOrientation(data)
+		// Lossless-очистка возможна, только если результат сохраняется в JPEG без смены режима кодирования.
+		if opts.JPEGMode == CleanModeLossless && outputFormat == "jpeg" && !opts.JPEGProgressive && !opts.modifiesPixels() && colorProfile == nil {
+			keptLossless := kept
+			keptLossless.Orientation = orientation
+			losslessJPEG, err = stripJPEGMetadata(data, keptLossless)
+			if err != nil {
+				// Файл декодируется, но его структуру не удалось разобрать посегментно.
+				// Не отказываем пользователю, а переходим к полному перекодированию.
+				log.Printf("Файл '%s': lossless-очистка JPEG невозможна (%v), используется перекодирование", filename, err)
+				losslessJPEG = nil
+				err = nil
+			}
+		}
+		if losslessJPEG == nil && orientation != 1 {
+			log.Printf("Файл '%s': применяется EXIF-ориентация %d", filename, orientation)
+			img = applyOrientation(img, orientation)
+		}
+	}
+
+	// 4.1.1 TIFF и WebP тоже могут содержать EXIF-ориентацию, а при конвертации
+	//       метаданные не переносятся, поэтому поворот применяется к пикселям.
+	if detectedFormat == "tiff" || detectedFormat == "webp" {
+		if orientation := imageOrientation(data, detectedFormat); orientation != 1 {
+			log.Printf("Файл '%s': применяется EXIF-ориентация %d", filename, orientation)
+			img = applyOrientation(img, orientation)
+		}
+	}
+
+	// 4.2 Подготовка PNG. В режиме lossless поток чанков переписывается без перекомпрессии
+	//     (сохраняются и кадры APNG). png.Encode записал бы только основное изображение.
+	var losslessPNG []byte // Очищенный без перекомпрессии PNG (если режим lossless сработал)
+	if detectedFormat == "png" {
+		if opts.PNGMode == CleanModeLossless && outputFormat == "png" && !opts.modifiesPixels() && colorProfile == nil {
+			losslessPNG, err = stripPNGMetadata(data)
+			if err != nil {
+				log.Printf("Файл '%s': lossless-очистка PNG невозможна (%v), используется перекодирование", filename, err)
+				losslessPNG = nil
+				err = nil
+			}
+		}
+		if losslessPNG == nil && outputFormat == "png" {
+			if chunks, errChunks := readPNGChunks(data); errChunks == nil && isAPNG(chunks) {
+				log.Printf("ПРЕДУПРЕЖДЕНИЕ: Файл '%s' - анимированный PNG; при перекодировании сохранится только основное изображение.", filename)
+			}
+		}
+	}
+
+	// 4.2.1 Переводим цвета в sRGB (профиль в результат не записывается: кодеры
+	//       image/png и image/jpeg ICC-профили не сохраняют). В GIF профилей не бывает.
+	if colorProfile != nil && anim == nil {
+		img = convertToSRGB(img, colorProfile)
+	}
+
+	// 4.3 Автоматически размываем лица (детектор PICO). Для анимации лица ищутся
+	//     в каждом кадре отдельно. Если детектор не настроен, файл не сохраняется:
+	//     пользователь рассчитывает, что лица будут скрыты.
+	if opts.BlurFaces {
+		var faces int
+		if anim != nil && outputFormat == "gif" {
+			faces, err = blurGIFFaces(anim)
+		} else {
+			img, faces, err = blurFaces(img)
+		}
+		if err != nil {
+			log.Printf("Файл '%s': размытие лиц невозможно: %v", filename, err)
+			return "", nil, err
+		}
+		log.Printf("Файл '%s': размыто лиц: %d", filename, faces)
+		report.FacesBlurred = faces
+	}
+
+	// 4.4 Скрываем указанные пользователем области (номера, лица, документы).
+	//     Это делается до кодирования, поэтому на сервере хранится только
+	//     копия с уже скрытыми областями.
+	if len(opts.Redactions) > 0 {
+		log.Printf("Файл '%s': скрытие областей (%d шт.)", filename, len(opts.Redactions))
+		if anim != nil && outputFormat == "gif" {
+			redactGIFFrames(anim, opts.Redactions)
+		} else {
+			img = applyRedactions(img, opts.Redactions)
+		}
+	}
+
+	// 4.4.1 Уменьшаем изображение до заданной длинной стороны. После скрытия областей
+	//       (их координаты заданы в пикселях исходного изображения), но до надписи
+	//       и водяного знака, размеры которых зависят от итогового изображения.
+	if opts.MaxLongEdge > 0 {
+		if anim != nil && outputFormat == "gif" {
+			from := fmt.Sprintf("%dx%d", anim.Config.Width, anim.Config.Height)
+			resizeGIF(anim, opts.MaxLongEdge)
+			report.ResizedFrom = from
+		} else {
+			report.ResizedFrom = fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+			img = resizeImage(img, opts.MaxLongEdge)
+		}
+		log.Printf("Файл '%s': изображение уменьшено с %s (длинная сторона не больше %d)", filename, report.ResizedFrom, opts.MaxLongEdge)
+	}
+
+	// 4.5 Подавляем отпечаток сенсора камеры (PRNU), чтобы фотографию нельзя было
+	//     связать с конкретным устройством по шуму матрицы.
+	if opts.AntiFingerprint {
+		log.Printf("Файл '%s': подавление отпечатка сенсора (сила: %s)", filename, opts.AntiFingerprintStrength)
+		if anim != nil && outputFormat == "gif" {
+			suppressGIFFingerprint(anim, opts.AntiFingerprintStrength)
+		} else {
+			img = suppressFingerprint(img, opts.AntiFingerprintStrength)
+		}
+	}
+
+	// 4.5.1 Наносим видимую надпись. После подавления отпечатка, чтобы текст
+	//       не размывался, но до глубокой очистки, которая должна затронуть и его.
+	if opts.Overlay.Enabled() {
+		log.Printf("Файл '%s': нанесение надписи (расположение: %s, непрозрачность: %.0f%%)", filename, opts.Overlay.Position, opts.Overlay.Opacity*100)
+		if anim != nil && outputFormat == "gif" {
+			err = applyGIFTextOverlay(anim, opts.Overlay)
+		} else {
+			img, err = applyTextOverlay(img, opts.Overlay)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("не удалось нанести надпись: %w", err)
+		}
+	}
+
+	// 4.5.2 Встраиваем невидимый водяной знак. После надписи, чтобы она его не перекрыла.
+	//       GIF пропускается: приведение к палитре разрушает слабый шаблон, а слишком
+	//       маленькие изображения сохраняются без знака (с предупреждением в журнале).
+	if opts.Watermark && anim != nil && outputFormat == "gif" {
+		log.Printf("Файл '%s': водяной знак не встраивается в GIF", filename)
+	} else if opts.Watermark {
+		watermarked, err := embedWatermark(img, opts.WatermarkID)
+		if errors.Is(err, ErrImageTooSmallForWatermark) {
+			log.Printf("ПРЕДУПРЕЖДЕНИЕ: Файл '%s' сохранен без водяного знака: %v", filename, err)
+		} else if err != nil {
+			return "", nil, fmt.Errorf("не удалось встроить водяной знак: %w", err)
+		} else {
+			log.Printf("Файл '%s': встроен водяной знак %08x", filename, opts.WatermarkID)
+			img = watermarked
+			report.Watermarked = true
+		}
+	}
+
+	// 4.6 Глубокая очистка пикселей: выполняется последней, чтобы затронуть
+	//     и результат размытия/скрытия областей.
+	if opts.Scrub.Enabled {
+		log.Printf("Файл '%s': глубокая очистка пикселей (8 бит: %t, случайные младшие биты: %t)",
+			filename, opts.Scrub.ReduceDepth, opts.Scrub.RandomizeLSB)
+		if anim != nil && outputFormat == "gif" {
+			scrubGIF(anim, opts.Scrub)
+		} else {
+			img = deepScrub(img, opts.Scrub)
+		}
+	}
+
+	// Итоговые размеры сохраняемого изображения (для отчета и записи в БД). При lossless-очистке
+	// JPEG пиксели не поворачиваются, и при ориентации 5-8 стороны на экране меняются местами.
+	switch {
+	case anim != nil && outputFormat == "gif":
+		report.Width, report.Height = anim.Config.Width, anim.Config.Height
+	case losslessJPEG != nil && jpegOrientation(data) >= 5:
+		report.Width, report.Height = img.Bounds().Dy(), img.Bounds().Dx()
+	default:
+		report.Width, report.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
 
 	// 5. Генерируем уникальное имя файла.
 	//    Используем криптографически стойкий токен и добавляем расширение,
-	//    соответствующее *фактически* определенному формату изображения.
+	//    соответствующее формату сохранения (для конвертируемых форматов - ConvertFormat).
 	randomName, err := GenerateSecureToken(16) // 16 байт = ~22 символа base64
 	if err != nil {
 		// Ошибка генерации токена - это внутренняя проблема сервера.
-		return "", fmt.Errorf("не удалось сгенерировать имя файла: %w", err)
+		return "", nil, fmt.Errorf("не удалось сгенерировать имя файла: %w", err)
 	}
-	fileExtension := "." + detectedFormat // Например, ".jpeg", ".png"
+	fileExtension := "." + outputFormat // Например, ".jpeg", ".png"
 	storedFilename = randomName + fileExtension // Конечное имя файла, например, "aBcDeFgHiJkLmNoPqRsTuV.png"
 
 	// Формируем полный путь для сохранения файла.
@@ -123,7 +562,7 @@ func ProcessAndSaveImage(fileHeader *multipart.FileHeader, uploadDir string) (st
 	if err != nil {
 		// Ошибка создания файла (например, нет прав на запись в uploadDir).
 		log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Не удалось создать файл на сервере: %s - %v", filePath, err)
-		return "", fmt.Errorf("не удалось создать файл на сервере: %w", err)
+		return "", nil, fmt.Errorf("не удалось создать файл на сервере: %w", err)
 	}
 	// Используем defer для гарантированного закрытия файла.
 	// Добавляем проверку ошибки при закрытии, т.к. она может указывать на проблемы с записью.
@@ -143,41 +582,91 @@ func ProcessAndSaveImage(fileHeader *multipart.FileHeader, uploadDir string) (st
 	}()
 
 	// 7. Перекодируем декодированное изображение (img) и сохраняем его в outFile.
-	//    Выбираем кодер в зависимости от формата, определенного на шаге 4.
-	log.Printf("Начало кодирования файла '%s' (формат %s) в %s", fileHeader.Filename, detectedFormat, filePath)
-	switch detectedFormat {
+	//    Выбираем кодер в зависимости от формата сохранения, определенного на шаге 4.
+	log.Printf("Начало кодирования файла '%s' (формат %s) в %s", filename, outputFormat, filePath)
+	switch outputFormat {
 	case "jpeg":
-		// jpeg.Encode записывает изображение в формате JPEG.
-		// Третий параметр (options) позволяет настроить качество (nil использует стандартное).
-		err = jpeg.Encode(outFile, img, nil)
+		if losslessJPEG != nil {
+			// Lossless-режим: записываем исходный поток без сегментов метаданных.
+			_, err = outFile.Write(losslessJPEG)
+		} else {
+			// JPEG не поддерживает прозрачность: при конвертации (например, из WebP)
+			// прозрачные области заливаются белым.
+			if detectedFormat != "jpeg" {
+				img = flattenAlpha(img, color.White)
+			}
+			// Если нужно сохранить огрубленные координаты или разрешенные поля, файл сначала
+			// кодируется в память: кодеры не пишут метаданные, и сегменты вставляются после кодирования.
+			// Ориентация уже применена к пикселям, поэтому тег Orientation не записывается.
+			keptSegments := kept.segments()
+			var jpegOut io.Writer = outFile
+			var encoded bytes.Buffer
+			if len(keptSegments) > 0 {
+				jpegOut = &encoded
+			}
+			if opts.JPEGProgressive {
+				// Стандартная библиотека пишет только baseline JPEG, поэтому
+				// прогрессивный файл записывается собственным кодером.
+				err = encodeProgressiveJPEG(jpegOut, img, opts.JPEGQuality)
+			} else {
+				// jpeg.Encode записывает изображение в формате JPEG с качеством из политики сохранения.
+				err = jpeg.Encode(jpegOut, img, &jpeg.Options{Quality: opts.JPEGQuality})
+			}
+			if err == nil && len(keptSegments) > 0 {
+				_, err = outFile.Write(insertJPEGSegments(encoded.Bytes(), keptSegments))
+			}
+		}
 	case "png":
-		// png.Encode записывает изображение в формате PNG.
-		err = png.Encode(outFile, img)
+		if losslessPNG != nil {
+			// Lossless-режим: записываем поток чанков без метаданных.
+			_, err = outFile.Write(losslessPNG)
+		} else {
+			// png.Encoder записывает изображение в формате PNG с уровнем сжатия из политики сохранения.
+			encoder := &png.Encoder{CompressionLevel: opts.PNGCompression}
+			err = encoder.Encode(outFile, img)
+		}
 	case "gif":
-		// gif.Encode записывает изображение в формате GIF.
-		// Третий параметр (options) позволяет настроить палитру и другие параметры (nil использует стандартные).
-		err = gif.Encode(outFile, img, nil)
+		// encodeCleanGIF записывает все кадры анимации с задержками, режимами утилизации
+		// и счетчиком повторов, но без комментариев и расширений приложений.
+		err = encodeCleanGIF(outFile, anim)
 	default:
 		// Эта ветка не должна быть достигнута, если image.Decode сработал корректно.
-		log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Неподдерживаемый формат '%s' обнаружен ПОСЛЕ успешного декодирования файла '%s'. Это не должно происходить.", detectedFormat, fileHeader.Filename)
-		err = fmt.Errorf("неподдерживаемый формат изображения после декодирования: %s", detectedFormat)
+		log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Неподдерживаемый формат сохранения '%s' для файла '%s' (исходный формат '%s'). Это не должно происходить.", outputFormat, filename, detectedFormat)
+		err = fmt.Errorf("неподдерживаемый формат сохранения изображения: %s", outputFormat)
 	}
 
 	// Проверяем, произошла ли ошибка во время кодирования.
 	if err != nil {
 		// Если кодирование не удалось, функция defer outFile.Close() все равно выполнится.
 		// Нам нужно явно удалить созданный, но, возможно, пустой или частично записанный файл.
-		log.Printf("Ошибка кодирования файла '%s' в формат %s, удаляем %s: %v", fileHeader.Filename, detectedFormat, filePath, err)
+		log.Printf("Ошибка кодирования файла '%s' в формат %s, удаляем %s: %v", filename, outputFormat, filePath, err)
 		// Пытаемся удалить файл. Игнорируем ошибку удаления здесь, т.к. основная ошибка - это ошибка кодирования.
 		_ = os.Remove(filePath)
 		// Возвращаем ошибку кодирования.
-		return "", fmt.Errorf("не удалось закодировать и сохранить изображение: %w", err)
+		return "", nil, fmt.Errorf("не удалось закодировать и сохранить изображение: %w", err)
 	}
 
 	// Если кодирование прошло успешно.
-	log.Printf("Изображение '%s' успешно сохранено как %s", fileHeader.Filename, filePath)
+	log.Printf("Изображение '%s' успешно сохранено как %s", filename, filePath)
 
-	// Возвращаем имя сохраненного файла (без пути) и nil в качестве ошибки.
+	// Возвращаем имя сохраненного файла (без пути), отчет и nil в качестве ошибки.
 	// Ошибка при закрытии файла будет обработана в defer и присвоена переменной err, если возникнет.
-	return storedFilename, err
-}
\ No newline at end of file
+	return storedFilename, report, err
+}
+// saveCleanFile сохраняет уже очищенный документ (SVG, PDF, аудиофайл) под случайным именем
+// с расширением extension и возвращает имя сохраненного файла.
+func saveCleanFile(originalName, uploadDir, extension string, clean []byte) (string, error) {
+	randomName, err := GenerateSecureToken(16)
+	if err != nil {
+		return "", fmt.Errorf("не удалось сгенерировать имя файла: %w", err)
+	}
+	storedFilename := randomName + extension
+	filePath := filepath.Join(uploadDir, storedFilename)
+	if err := os.WriteFile(filePath, clean, 0666); err != nil {
+		log.Printf("КРИТИЧЕСКАЯ ОШИБКА: Не удалось записать файл на сервере: %s - %v", filePath, err)
+		_ = os.Remove(filePath)
+		return "", fmt.Errorf("не удалось сохранить файл: %w", err)
+	}
+	log.Printf("Файл '%s' очищен и сохранен как %s", originalName, filePath)
+	return storedFilename, nil
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки результата и проверки сигнатур
+	"encoding/binary" // Для чтения/записи длин сегментов
+	"fmt"             // Для форматирования ошибок
+)
+
+// Дополнительные маркеры JPEG, используемые при очистке.
+const (
+	jpegMarkerAPP14 = 0xEE // Adobe: флаги цветового преобразования (нужны декодерам)
+	jpegMarkerAPP15 = 0xEF // Последний из маркеров приложений
+	jpegMarkerCOM   = 0xFE // Комментарий
+)
+
+// jfifMinimalLength - длина полезной нагрузки APP0 JFIF без встроенной миниатюры:
+// "JFIF\0"(5) + версия(2) + единицы(1) + плотность X/Y(4) + размеры миниатюры(2).
+const jfifMinimalLength = 14
+
+// stripJPEGMetadata выполняет ЛОСЛЕСС-очистку JPEG: проходит по сегментам файла
+// и копирует энтропийно-кодированные данные изображения без изменений,
+// поэтому качество не теряется, а размер почти не меняется.
+//
+// Удаляются:
+//   - APP1 (EXIF, XMP), APP2 (ICC, FlashPix), APP13 (IPTC/Photoshop) и прочие
+//     APPn-блоки производителей камер и программ;
+//   - миниатюры из APP0 (JFIF-заголовок сохраняется в минимальном виде, JFXX удаляется);
+//   - комментарии (COM) и зарезервированные маркеры JPGn;
+//   - любые данные после маркера EOI (там часто прячут дополнительные файлы).
+//
+// Сохраняются таблицы квантования и Хаффмана, заголовки кадров и сканов, DRI
+// и APP14 Adobe (без него декодеры неверно интерпретируют цвета CMYK/RGB-файлов).
+//
+// Если kept.Orientation > 1, пиксели не поворачиваются (это невозможно без перекодирования),
+// поэтому в файл записывается новый минимальный EXIF, содержащий тег Orientation.
+// В новые блоки попадают и остальные разрешенные метаданные kept (огрубленные
+// координаты, поля из списка разрешенных); все прочее из исходного файла удаляется.
+func stripJPEGMetadata(data []byte, kept keptMetadata) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, fmt.Errorf("отсутствует маркер SOI, файл не является JPEG")
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write([]byte{0xFF, jpegMarkerSOI})
+
+	// EXIF с ориентацией должен идти в начале файла, сразу после JFIF (если он есть).
+	keptSegments := kept.segments()
+	exifWritten := len(keptSegments) == 0
+	writeOrientation := func() {
+		if exifWritten {
+			return
+		}
+		for _, seg := range keptSegments {
+			writeJPEGSegment(&out, seg.Marker, seg.Payload)
+		}
+		exifWritten = true
+	}
+
+	pos := 2
+	for {
+		// Пропускаем байты заполнения 0xFF перед маркером.
+		if pos >= len(data) {
+			// Файл закончился без EOI (обрезан). Декодер его принял, поэтому
+			// просто закрываем поток корректным маркером.
+			out.Write([]byte{0xFF, jpegMarkerEOI})
+			return out.Bytes(), nil
+		}
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("ожидался маркер JPEG по смещению %d", pos)
+		}
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			continue
+		}
+		marker := data[pos]
+		pos++
+
+		switch {
+		case marker == jpegMarkerEOI:
+			// Все, что после EOI, отбрасывается.
+			out.Write([]byte{0xFF, jpegMarkerEOI})
+			return out.Bytes(), nil
+		case (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01:
+			// Маркеры без длины (RSTn, TEM) копируем как есть.
+			out.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("обрезанный сегмент 0xFF%02X", marker)
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, fmt.Errorf("некорректная длина сегмента 0xFF%02X: %d", marker, length)
+		}
+		payload := data[pos+2 : pos+length]
+		pos += length
+
+		if marker != jpegMarkerAPP0 {
+			writeOrientation()
+		}
+
+		switch {
+		case marker == jpegMarkerAPP0:
+			// Сохраняем только JFIF-заголовок, обнуляя размеры миниатюры.
+			if bytes.HasPrefix(payload, []byte("JFIF\x00")) && len(payload) >= jfifMinimalLength {
+				jfif := append([]byte(nil), payload[:jfifMinimalLength]...)
+				jfif[12], jfif[13] = 0, 0
+				writeJPEGSegment(&out, marker, jfif)
+			}
+		case marker == jpegMarkerAPP14:
+			// Сохраняем только фиксированную часть Adobe-сегмента (12 байт).
+			if bytes.HasPrefix(payload, []byte("Adobe")) && len(payload) >= 12 {
+				writeJPEGSegment(&out, marker, payload[:12])
+			}
+		case marker >= jpegMarkerAPP0 && marker <= jpegMarkerAPP15:
+			// Все остальные APPn удаляются.
+		case marker == jpegMarkerCOM:
+			// Комментарии удаляются.
+		case marker >= 0xF0 && marker <= 0xFD:
+			// Зарезервированные маркеры JPGn удаляются.
+		default:
+			writeJPEGSegment(&out, marker, payload)
+		}
+
+		if marker == jpegMarkerSOS {
+			// После заголовка скана идут энтропийно-кодированные данные.
+			// Копируем их без изменений до следующего маркера (не RSTn и не байт-стаффинга 0xFF00).
+			end := findJPEGScanEnd(data, pos)
+			out.Write(data[pos:end])
+			pos = end
+		}
+	}
+}
+
+// keptMetadata - метаданные, которые записываются в очищенный JPEG заново,
+// в минимальных блоках, собранных сервисом (исходные блоки не копируются).
+type keptMetadata struct {
+	Orientation int         // Тег Orientation (если пиксели не поворачивались)
+	IFD0        []exifEntry // Разрешенные теги IFD0 (значения в порядке big-endian)
+	ExifIFD     []exifEntry // Разрешенные теги Exif SubIFD
+	GPS         []exifEntry // Огрубленные координаты (см. GPSPrecision)
+	XMP         []byte      // XMP-пакет только с разрешенными свойствами
+	IPTC        []byte      // Наборы данных IPTC только с разрешенными полями
+}
+
+// segments возвращает сегменты JPEG для записи: APP1 (EXIF), APP1 (XMP), APP13 (IPTC).
+// Пустые блоки не записываются.
+func (k keptMetadata) segments() []jpegSegment {
+	var segments []jpegSegment
+	ifd0 := append([]exifEntry(nil), k.IFD0...)
+	if k.Orientation > 1 {
+		ifd0 = append(ifd0, newShortEntry(exifTagOrientation, uint16(k.Orientation)))
+	}
+	if len(ifd0) > 0 || len(k.ExifIFD) > 0 || len(k.GPS) > 0 {
+		payload := append(append([]byte(nil), exifSignature...), encodeEXIF(ifd0, k.ExifIFD, k.GPS)...)
+		segments = append(segments, jpegSegment{Marker: jpegMarkerAPP1, Payload: payload})
+	}
+	if len(k.XMP) > 0 {
+		payload := append(append([]byte(nil), xmpSignature...), k.XMP...)
+		segments = append(segments, jpegSegment{Marker: jpegMarkerAPP1, Payload: payload})
+	}
+	if len(k.IPTC) > 0 {
+		segments = append(segments, jpegSegment{Marker: jpegMarkerAPP13, Payload: photoshopIPTCPayload(k.IPTC)})
+	}
+	return segments
+}
+
+// insertJPEGSegments вставляет сегменты сразу после маркера SOI закодированного JPEG.
+// Используется для добавления метаданных в файлы, записанные кодерами без их поддержки.
+func insertJPEGSegments(data []byte, segments []jpegSegment) []byte {
+	var out bytes.Buffer
+	out.Grow(len(data) + 1024)
+	out.Write(data[:2])
+	for _, seg := range segments {
+		writeJPEGSegment(&out, seg.Marker, seg.Payload)
+	}
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+// findJPEGScanEnd возвращает смещение первого маркера после энтропийно-кодированных
+// данных, начинающихся с start (или len(data), если маркер не найден).
+func findJPEGScanEnd(data []byte, start int) int {
+	i := start
+	for i+1 < len(data) {
+		if data[i] != 0xFF {
+			i++
+			continue
+		}
+		next := data[i+1]
+		switch {
+		case next == 0x00 || (next >= 0xD0 && next <= 0xD7):
+			// Байт-стаффинг или маркер рестарта - часть данных скана.
+			i += 2
+		case next == 0xFF:
+			// Байт заполнения перед маркером.
+			i++
+		default:
+			return i
+		}
+	}
+	return len(data)
+}
+
+// writeJPEGSegment записывает сегмент с маркером и двухбайтовой длиной.
+func writeJPEGSegment(out *bytes.Buffer, marker byte, payload []byte) {
+	var header [4]byte
+	header[0], header[1] = 0xFF, marker
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	out.Write(header[:])
+	out.Write(payload)
+}
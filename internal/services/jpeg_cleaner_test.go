@@ -0,0 +1,208 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки файлов
+	"encoding/binary" // Для длины заголовка скана
+	"image"           // Для тестовых изображений
+	"image/color"     // Для заполнения тестовых изображений
+	"image/jpeg"      // Для кодирования и декодирования
+	"testing"         // Для тестов
+)
+
+// testGradient возвращает цветное изображение с плавными переходами.
+func testGradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: uint8((x + y) * 4), A: 255})
+		}
+	}
+	return img
+}
+
+// insertBeforeScan вставляет сегменты перед n-м (с нуля) маркером SOS.
+func insertBeforeScan(t *testing.T, data []byte, n int, segments ...jpegSegment) []byte {
+	t.Helper()
+	pos := 0
+	for i := 0; i <= n; i++ {
+		next := bytes.Index(data[pos:], []byte{0xFF, jpegMarkerSOS})
+		if next < 0 {
+			t.Fatalf("в файле меньше %d сканов", n+1)
+		}
+		pos += next
+		if i < n {
+			pos += 2
+		}
+	}
+	var out bytes.Buffer
+	out.Write(data[:pos])
+	for _, seg := range segments {
+		writeJPEGSegment(&out, seg.Marker, seg.Payload)
+	}
+	out.Write(data[pos:])
+	return out.Bytes()
+}
+
+// testRestartJPEG собирает полутоновый JPEG 32x8 из четырех MCU с маркерами рестарта
+// после каждого. Однотонный блок 8x8 кодируется одинаково, если предсказание DC
+// сбрасывается, поэтому данные скана - одна и та же MCU, повторенная через RST0..RST2.
+func testRestartJPEG(t *testing.T) []byte {
+	t.Helper()
+	block := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range block.Pix {
+		block.Pix[i] = 100
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, block, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	data := encoded.Bytes()
+	sos := bytes.Index(data, []byte{0xFF, jpegMarkerSOS})
+	scan := sos + 2 + int(binary.BigEndian.Uint16(data[sos+2:]))
+	mcu := data[scan : len(data)-2]
+
+	header := append([]byte{}, data[:sos]...)
+	sof := bytes.Index(header, []byte{0xFF, 0xC0})
+	header[sof+7], header[sof+8] = 0, 32 // Ширина 32 пикселя
+
+	var out bytes.Buffer
+	out.Write(header)
+	out.Write([]byte{0xFF, 0xDD, 0, 4, 0, 1}) // DRI: рестарт после каждой MCU
+	out.Write(data[sos:scan])
+	for i := 0; i < 4; i++ {
+		if i > 0 {
+			out.Write([]byte{0xFF, 0xD0 + byte(i-1)})
+		}
+		out.Write(mcu)
+	}
+	out.Write([]byte{0xFF, jpegMarkerEOI})
+	return out.Bytes()
+}
+
+// checkSamePixels проверяет, что оба JPEG декодируются в одинаковые пиксели.
+func checkSamePixels(t *testing.T, original, clean []byte) {
+	t.Helper()
+	want, err := jpeg.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("исходный файл не декодируется: %v", err)
+	}
+	got, err := jpeg.Decode(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("очищенный файл не декодируется: %v", err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("размер %v, ожидался %v", got.Bounds(), want.Bounds())
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("пиксель (%d,%d): %v, ожидался %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	var baseline bytes.Buffer
+	if err := jpeg.Encode(&baseline, testGradient(40, 24), &jpeg.Options{Quality: 85}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	var progressive bytes.Buffer
+	if err := encodeProgressiveJPEG(&progressive, testGradient(40, 24), 85); err != nil {
+		t.Fatalf("encodeProgressiveJPEG: %v", err)
+	}
+
+	metadata := []jpegSegment{
+		{Marker: jpegMarkerAPP0, Payload: append([]byte("JFIF\x00\x01\x01\x00\x00\x48\x00\x48\x01\x01"), 0x10, 0x20, 0x30)},
+		testEXIFSegment([]exifEntry{testASCIIEntry(exifTagMake, "Canon")}, nil, nil),
+		{Marker: jpegMarkerAPP1, Payload: append(append([]byte{}, xmpSignature...), "<x:xmpmeta/>"...)},
+		{Marker: jpegMarkerAPP2, Payload: append(append([]byte{}, iccProfileSignature...), 1, 1, 0, 0)},
+		testIPTCSegment([2]string{string(rune(iptcByline)), "Ivanov"}),
+		{Marker: jpegMarkerAPP14, Payload: []byte("Adobe\x00\x64\x00\x00\x00\x00\x01extra")},
+		{Marker: jpegMarkerCOM, Payload: []byte("Ivanov")},
+	}
+	between := []jpegSegment{
+		{Marker: jpegMarkerCOM, Payload: []byte("между сканами")},
+		{Marker: jpegMarkerAPP0 + 11, Payload: []byte("JP\x00\x01")},
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		scans int // Ожидаемое количество сканов
+	}{
+		{"baseline", insertJPEGSegments(baseline.Bytes(), metadata), 1},
+		{"baseline с данными после EOI", append(insertJPEGSegments(baseline.Bytes(), metadata), "PK\x03\x04hidden"...), 1},
+		{"прогрессивный с сегментами между сканами", insertBeforeScan(t, insertJPEGSegments(progressive.Bytes(), metadata), 2, between...), 5},
+		{"маркеры рестарта", insertJPEGSegments(testRestartJPEG(t), metadata), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, err := stripJPEGMetadata(tt.input, keptMetadata{})
+			if err != nil {
+				t.Fatalf("stripJPEGMetadata: %v", err)
+			}
+			checkSamePixels(t, tt.input, clean)
+			findings, err := verifyJPEG(clean, newVerifyPolicy(DefaultProcessOptions()))
+			if err != nil || len(findings) > 0 {
+				t.Errorf("verifyJPEG: %v %q", err, findings)
+			}
+			if n := bytes.Count(clean, []byte{0xFF, jpegMarkerSOS}); n != tt.scans {
+				t.Errorf("сканов %d, ожидалось %d", n, tt.scans)
+			}
+			// Из APP14 Adobe остается фиксированная часть: без нее декодеры путают цвета.
+			adobe := []byte{0xFF, jpegMarkerAPP14, 0, 14, 'A', 'd', 'o', 'b', 'e'}
+			if !bytes.Contains(clean, adobe) || bytes.Contains(clean, []byte("extra")) {
+				t.Errorf("APP14 Adobe не сохранен в минимальном виде")
+			}
+			if !bytes.HasSuffix(clean, []byte{0xFF, jpegMarkerEOI}) {
+				t.Errorf("файл не заканчивается EOI")
+			}
+		})
+	}
+
+	t.Run("данные скана не меняются", func(t *testing.T) {
+		data := baseline.Bytes()
+		clean, err := stripJPEGMetadata(insertJPEGSegments(data, metadata), keptMetadata{})
+		if err != nil {
+			t.Fatalf("stripJPEGMetadata: %v", err)
+		}
+		sos := bytes.Index(data, []byte{0xFF, jpegMarkerSOS})
+		if !bytes.HasSuffix(clean, data[sos:]) {
+			t.Errorf("энтропийно-кодированные данные изменены")
+		}
+	})
+
+	t.Run("маркеры рестарта сохраняются", func(t *testing.T) {
+		clean, err := stripJPEGMetadata(testRestartJPEG(t), keptMetadata{})
+		if err != nil {
+			t.Fatalf("stripJPEGMetadata: %v", err)
+		}
+		for _, marker := range [][]byte{{0xFF, 0xDD, 0, 4}, {0xFF, 0xD0}, {0xFF, 0xD1}, {0xFF, 0xD2}} {
+			if !bytes.Contains(clean, marker) {
+				t.Errorf("нет маркера % X", marker)
+			}
+		}
+	})
+
+	t.Run("ориентация", func(t *testing.T) {
+		clean, err := stripJPEGMetadata(insertJPEGSegments(baseline.Bytes(), metadata), keptMetadata{Orientation: 6})
+		if err != nil {
+			t.Fatalf("stripJPEGMetadata: %v", err)
+		}
+		segments, _, err := readJPEGHeaderSegments(clean)
+		if err != nil {
+			t.Fatalf("readJPEGHeaderSegments: %v", err)
+		}
+		ex, err := parseEXIF(findJPEGExif(segments))
+		if err != nil || ex.Orientation() != 6 || len(ex.IFD0) != 1 {
+			t.Errorf("EXIF с ориентацией: %v %+v", err, ex)
+		}
+		findings, err := verifyJPEG(clean, newVerifyPolicy(DefaultProcessOptions()))
+		if err != nil || len(findings) > 0 {
+			t.Errorf("verifyJPEG: %v %q", err, findings)
+		}
+	})
+}
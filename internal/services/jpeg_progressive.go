@@ -0,0 +1,531 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"       // Для сборки файла в памяти
+	"fmt"         // Для форматирования ошибок
+	"image"       // Для работы с изображениями
+	"image/color" // Для определения полутоновых изображений
+	"image/draw"  // Для приведения изображения к RGBA
+	"io"          // Для интерфейса Writer
+	"math"        // Для косинусов DCT и округления
+)
+
+// Прогрессивный JPEG.
+//
+// Кодер стандартной библиотеки пишет только baseline JPEG (SOF0). Прогрессивный файл
+// (SOF2) при медленной загрузке сначала показывается целиком в низком качестве,
+// а затем уточняется. Здесь реализован минимальный прогрессивный кодер со спектральной
+// селекцией (без последовательного приближения): сначала передаются DC-коэффициенты
+// всех компонент, затем полосы AC-коэффициентов. Используются стандартные таблицы
+// квантования и Хаффмана из приложения K спецификации - те же, что и в image/jpeg,
+// поэтому качество при одинаковом quality совпадает с baseline-кодером.
+
+// jpegZigzag[k] - индекс в естественном порядке (строка*8+столбец) для k-го
+// коэффициента в порядке зигзага.
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegBaseQuant - таблицы квантования из раздела K.1 спецификации (порядок зигзага):
+// [0] - яркость, [1] - цветность.
+var jpegBaseQuant = [2][64]byte{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// jpegHuffmanSpec - таблица Хаффмана в виде, в котором она записывается в DHT:
+// количество кодов каждой длины (1..16 бит) и значения в порядке возрастания кодов.
+type jpegHuffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// jpegStandardHuffman - стандартные таблицы из раздела K.3 спецификации:
+// [0] - DC яркости, [1] - AC яркости, [2] - DC цветности, [3] - AC цветности.
+var jpegStandardHuffman = [4]jpegHuffmanSpec{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// jpegHuffmanCode - код Хаффмана для одного символа.
+type jpegHuffmanCode struct {
+	code uint32
+	size uint
+}
+
+// buildJPEGHuffmanCodes строит таблицу кодов по спецификации DHT (раздел C спецификации).
+func buildJPEGHuffmanCodes(spec jpegHuffmanSpec) [256]jpegHuffmanCode {
+	var codes [256]jpegHuffmanCode
+	code, k := uint32(0), 0
+	for length := 0; length < 16; length++ {
+		for i := 0; i < int(spec.counts[length]); i++ {
+			codes[spec.values[k]] = jpegHuffmanCode{code: code, size: uint(length + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// scaledJPEGQuant масштабирует базовую таблицу квантования под качество
+// (та же формула, что у libjpeg и image/jpeg).
+func scaledJPEGQuant(base [64]byte, quality int) [64]int32 {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var q [64]int32
+	for i, b := range base {
+		v := (int32(b)*int32(scale) + 50) / 100
+		if v < 1 {
+			v = 1
+		} else if v > 255 {
+			v = 255
+		}
+		q[i] = v
+	}
+	return q
+}
+
+// jpegDCTCos[x][u] = cos((2x+1)uπ/16) - таблица косинусов для прямого DCT 8x8.
+var jpegDCTCos = func() (t [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			t[x][u] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 16)
+		}
+	}
+	return t
+}()
+
+// forwardDCT выполняет двумерное DCT блока 8x8 (значения уже сдвинуты на -128)
+// и возвращает коэффициенты в естественном порядке.
+func forwardDCT(block *[64]float64) (out [64]float64) {
+	var tmp [64]float64
+	// Преобразование строк.
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < 8; x++ {
+				sum += block[y*8+x] * jpegDCTCos[x][u]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	// Преобразование столбцов с нормировкой C(u)C(v)/4.
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			sum := 0.0
+			for y := 0; y < 8; y++ {
+				sum += tmp[y*8+u] * jpegDCTCos[y][v]
+			}
+			cu, cv := 1.0, 1.0
+			if u == 0 {
+				cu = math.Sqrt2 / 2
+			}
+			if v == 0 {
+				cv = math.Sqrt2 / 2
+			}
+			out[v*8+u] = sum * cu * cv / 4
+		}
+	}
+	return out
+}
+
+// progressiveComponent - одна цветовая компонента кодируемого изображения.
+type progressiveComponent struct {
+	id      byte        // Идентификатор компоненты в SOF/SOS
+	h, v    int         // Коэффициенты дискретизации
+	table   int         // 0 - таблицы яркости, 1 - таблицы цветности
+	width   int         // Размер компоненты в пикселях (с учетом субдискретизации)
+	height  int         //
+	blocksW int         // Размер сетки блоков, дополненной до целого числа MCU
+	blocksH int         //
+	coef    [][64]int32 // Квантованные коэффициенты блоков (порядок зигзага)
+	plane   []float64   // Отсчеты компоненты (временный буфер)
+}
+
+// encodeProgressiveJPEG записывает img в w как прогрессивный JPEG (SOF2)
+// со спектральной селекцией. Цветные изображения кодируются в YCbCr 4:2:0,
+// полутоновые - одной компонентой. Метаданные (APPn, COM) не записываются.
+func encodeProgressiveJPEG(w io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > 65535 || height > 65535 {
+		return fmt.Errorf("недопустимые размеры для JPEG: %dx%d", width, height)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	gray := img.ColorModel() == color.GrayModel || img.ColorModel() == color.Gray16Model
+	var comps []*progressiveComponent
+	if gray {
+		comps = []*progressiveComponent{{id: 1, h: 1, v: 1, table: 0}}
+	} else {
+		comps = []*progressiveComponent{
+			{id: 1, h: 2, v: 2, table: 0},
+			{id: 2, h: 1, v: 1, table: 1},
+			{id: 3, h: 1, v: 1, table: 1},
+		}
+	}
+	hMax, vMax := comps[0].h, comps[0].v
+	mcusX := (width + 8*hMax - 1) / (8 * hMax)
+	mcusY := (height + 8*vMax - 1) / (8 * vMax)
+
+	// 1. Цветовое преобразование в полном разрешении.
+	full := make([][]float64, len(comps))
+	for i := range comps {
+		full[i] = make([]float64, width*height)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			o := rgba.PixOffset(x, y)
+			r, g, b := rgba.Pix[o], rgba.Pix[o+1], rgba.Pix[o+2]
+			if gray {
+				full[0][y*width+x] = float64(r)
+				continue
+			}
+			yy, cb, cr := color.RGBToYCbCr(r, g, b)
+			full[0][y*width+x] = float64(yy)
+			full[1][y*width+x] = float64(cb)
+			full[2][y*width+x] = float64(cr)
+		}
+	}
+
+	// 2. Субдискретизация, DCT и квантование.
+	for i, c := range comps {
+		sx, sy := hMax/c.h, vMax/c.v
+		c.width = (width + sx - 1) / sx
+		c.height = (height + sy - 1) / sy
+		c.plane = make([]float64, c.width*c.height)
+		for y := 0; y < c.height; y++ {
+			for x := 0; x < c.width; x++ {
+				// Усредняем блок sx*sy пикселей исходного разрешения (на краях - только существующие).
+				sum, n := 0.0, 0
+				for dy := 0; dy < sy; dy++ {
+					for dx := 0; dx < sx; dx++ {
+						px, py := x*sx+dx, y*sy+dy
+						if px < width && py < height {
+							sum += full[i][py*width+px]
+							n++
+						}
+					}
+				}
+				c.plane[y*c.width+x] = sum / float64(n)
+			}
+		}
+		full[i] = nil
+
+		c.blocksW, c.blocksH = mcusX*c.h, mcusY*c.v
+		c.coef = make([][64]int32, c.blocksW*c.blocksH)
+		quant := scaledJPEGQuant(jpegBaseQuant[c.table], quality)
+		var block [64]float64
+		for by := 0; by < c.blocksH; by++ {
+			for bx := 0; bx < c.blocksW; bx++ {
+				for y := 0; y < 8; y++ {
+					// За пределами изображения повторяем крайние отсчеты.
+					py := min(by*8+y, c.height-1)
+					for x := 0; x < 8; x++ {
+						px := min(bx*8+x, c.width-1)
+						block[y*8+x] = c.plane[py*c.width+px] - 128
+					}
+				}
+				dct := forwardDCT(&block)
+				coef := &c.coef[by*c.blocksW+bx]
+				for k := 0; k < 64; k++ {
+					v := int32(math.Round(dct[jpegZigzag[k]] / float64(quant[k])))
+					// Стандартные AC-таблицы покрывают значения до 10 бит.
+					if k > 0 {
+						v = max(-1023, min(1023, v))
+					}
+					coef[k] = v
+				}
+			}
+		}
+		c.plane = nil
+	}
+
+	// 3. Запись заголовков.
+	var out bytes.Buffer
+	out.Grow(width * height / 2)
+	out.Write([]byte{0xFF, jpegMarkerSOI})
+
+	tables := 1
+	if !gray {
+		tables = 2
+	}
+	dqt := make([]byte, 0, 65*tables)
+	for t := 0; t < tables; t++ {
+		quant := scaledJPEGQuant(jpegBaseQuant[t], quality)
+		dqt = append(dqt, byte(t))
+		for _, q := range quant {
+			dqt = append(dqt, byte(q))
+		}
+	}
+	writeJPEGSegment(&out, jpegMarkerDQT, dqt)
+
+	sof := []byte{8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(comps))}
+	for _, c := range comps {
+		sof = append(sof, c.id, byte(c.h<<4|c.v), byte(c.table))
+	}
+	writeJPEGSegment(&out, jpegMarkerSOF2, sof)
+
+	var dht []byte
+	for i := 0; i < 2*tables; i++ {
+		// Порядок в jpegStandardHuffman: DC0, AC0, DC1, AC1.
+		class, id := i%2, i/2
+		dht = append(dht, byte(class<<4|id))
+		dht = append(dht, jpegStandardHuffman[i].counts[:]...)
+		dht = append(dht, jpegStandardHuffman[i].values...)
+	}
+	writeJPEGSegment(&out, jpegMarkerDHT, dht)
+
+	var codes [4][256]jpegHuffmanCode
+	for i := range codes {
+		codes[i] = buildJPEGHuffmanCodes(jpegStandardHuffman[i])
+	}
+
+	// 4. Сканы: DC всех компонент, затем полосы AC (сначала самые заметные
+	//    низкие частоты яркости, затем цветность, затем остаток яркости).
+	writeProgressiveDCScan(&out, comps, mcusX, mcusY, &codes)
+	writeProgressiveACScan(&out, comps[0], 1, 5, &codes)
+	for _, c := range comps[1:] {
+		writeProgressiveACScan(&out, c, 1, 63, &codes)
+	}
+	writeProgressiveACScan(&out, comps[0], 6, 63, &codes)
+
+	out.Write([]byte{0xFF, jpegMarkerEOI})
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// Маркеры, используемые только при кодировании.
+const (
+	jpegMarkerSOF2 = 0xC2 // Начало кадра, прогрессивный режим с кодами Хаффмана
+	jpegMarkerDHT  = 0xC4 // Таблицы Хаффмана
+	jpegMarkerDQT  = 0xDB // Таблицы квантования
+)
+
+// writeSOS записывает заголовок скана.
+func writeSOS(out *bytes.Buffer, comps []*progressiveComponent, ss, se byte) {
+	sos := []byte{byte(len(comps))}
+	for _, c := range comps {
+		sos = append(sos, c.id, byte(c.table<<4|c.table))
+	}
+	sos = append(sos, ss, se, 0) // Ah = Al = 0: без последовательного приближения
+	writeJPEGSegment(out, jpegMarkerSOS, sos)
+}
+
+// writeProgressiveDCScan записывает первый скан: DC-коэффициенты всех компонент.
+// При нескольких компонентах скан чередующийся (порядок MCU), при одной - блоки
+// идут построчно в пределах изображения.
+func writeProgressiveDCScan(out *bytes.Buffer, comps []*progressiveComponent, mcusX, mcusY int, codes *[4][256]jpegHuffmanCode) {
+	writeSOS(out, comps, 0, 0)
+	bw := &jpegBitWriter{w: out}
+	preds := make([]int32, len(comps))
+	encodeDC := func(ci, bx, by int) {
+		c := comps[ci]
+		dc := c.coef[by*c.blocksW+bx][0]
+		bw.emitValue(&codes[c.table*2], 0, dc-preds[ci])
+		preds[ci] = dc
+	}
+	if len(comps) == 1 {
+		c := comps[0]
+		for by := 0; by < (c.height+7)/8; by++ {
+			for bx := 0; bx < (c.width+7)/8; bx++ {
+				encodeDC(0, bx, by)
+			}
+		}
+	} else {
+		for my := 0; my < mcusY; my++ {
+			for mx := 0; mx < mcusX; mx++ {
+				for ci, c := range comps {
+					for v := 0; v < c.v; v++ {
+						for h := 0; h < c.h; h++ {
+							encodeDC(ci, mx*c.h+h, my*c.v+v)
+						}
+					}
+				}
+			}
+		}
+	}
+	bw.flush()
+}
+
+// writeProgressiveACScan записывает полосу AC-коэффициентов ss..se одной компоненты.
+// Сканы AC всегда нечередующиеся и охватывают только блоки в пределах компоненты.
+func writeProgressiveACScan(out *bytes.Buffer, c *progressiveComponent, ss, se int, codes *[4][256]jpegHuffmanCode) {
+	writeSOS(out, []*progressiveComponent{c}, byte(ss), byte(se))
+	bw := &jpegBitWriter{w: out}
+	table := &codes[c.table*2+1]
+	for by := 0; by < (c.height+7)/8; by++ {
+		for bx := 0; bx < (c.width+7)/8; bx++ {
+			coef := &c.coef[by*c.blocksW+bx]
+			run := 0
+			for k := ss; k <= se; k++ {
+				if coef[k] == 0 {
+					run++
+					continue
+				}
+				for run > 15 {
+					bw.emitCode(table[0xF0]) // ZRL - 16 нулей подряд
+					run -= 16
+				}
+				bw.emitValue(table, byte(run<<4), coef[k])
+				run = 0
+			}
+			if run > 0 {
+				bw.emitCode(table[0x00]) // EOB: остаток полосы нулевой (EOBRUN = 1)
+			}
+		}
+	}
+	bw.flush()
+}
+
+// jpegBitWriter записывает энтропийно-кодированные данные с байт-стаффингом
+// (после каждого байта 0xFF вставляется 0x00).
+type jpegBitWriter struct {
+	w     *bytes.Buffer
+	bits  uint32
+	nBits uint
+}
+
+// emitBits добавляет в поток size младших бит значения code.
+func (b *jpegBitWriter) emitBits(code uint32, size uint) {
+	code &= 1<<size - 1
+	b.bits |= code << (32 - b.nBits - size)
+	b.nBits += size
+	for b.nBits >= 8 {
+		octet := byte(b.bits >> 24)
+		b.w.WriteByte(octet)
+		if octet == 0xFF {
+			b.w.WriteByte(0x00)
+		}
+		b.bits <<= 8
+		b.nBits -= 8
+	}
+}
+
+// emitCode записывает код Хаффмана.
+func (b *jpegBitWriter) emitCode(c jpegHuffmanCode) {
+	b.emitBits(c.code, c.size)
+}
+
+// emitValue записывает значение v: символ (run<<4 | категория) и дополнительные биты.
+// Для DC run всегда равен 0.
+func (b *jpegBitWriter) emitValue(table *[256]jpegHuffmanCode, run byte, v int32) {
+	magnitude := v
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+	size := uint(0)
+	for magnitude > 0 {
+		size++
+		magnitude >>= 1
+	}
+	b.emitCode(table[run|byte(size)])
+	if size > 0 {
+		if v < 0 {
+			v-- // Отрицательные значения записываются в обратном коде
+		}
+		b.emitBits(uint32(v), size)
+	}
+}
+
+// flush дополняет последний байт единичными битами.
+func (b *jpegBitWriter) flush() {
+	if b.nBits > 0 {
+		b.emitBits(0x7F, 7)
+	}
+	b.bits, b.nBits = 0, 0
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"        // Для декодирования результата
+	"image"        // Для тестовых изображений
+	"image/color"  // Для сравнения пикселей
+	"image/jpeg"   // Для декодирования и эталонного кодирования
+	"math"         // Для PSNR
+	"math/rand/v2" // Для шумового изображения
+	"testing"      // Для тестов
+)
+
+// jpegPSNR возвращает PSNR (дБ) декодированного изображения относительно исходного
+// по каналам RGB.
+func jpegPSNR(original, decoded image.Image) float64 {
+	b := original.Bounds()
+	var sum float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			want := color.RGBAModel.Convert(original.At(x, y)).(color.RGBA)
+			got := color.RGBAModel.Convert(decoded.At(x, y)).(color.RGBA)
+			for _, d := range []float64{
+				float64(want.R) - float64(got.R),
+				float64(want.G) - float64(got.G),
+				float64(want.B) - float64(got.B),
+			} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(3*b.Dx()*b.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// progressiveScans возвращает спектральные полосы (Ss, Se) сканов файла
+// и количество компонент в каждом.
+func progressiveScans(t *testing.T, data []byte) [][3]int {
+	t.Helper()
+	var scans [][3]int
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			pos++ // Энтропийно-кодированные данные
+			continue
+		}
+		marker := data[pos+1]
+		if marker == 0x00 || marker == 0xFF || marker >= 0xD0 && marker <= 0xD7 {
+			pos++
+			continue
+		}
+		if marker == jpegMarkerEOI {
+			break
+		}
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		if marker == jpegMarkerSOS {
+			n := int(data[pos+4])
+			ss, se := int(data[pos+5+2*n]), int(data[pos+6+2*n])
+			scans = append(scans, [3]int{n, ss, se})
+		}
+		pos += 2 + length
+	}
+	return scans
+}
+
+func TestEncodeProgressiveJPEG(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 23, 11))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7)
+	}
+	rng := rand.New(rand.NewPCG(3, 4))
+	noise := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(noise.Pix); i += 4 {
+		// Шум только по яркости: цветность при 4:2:0 усредняется по блокам 2x2.
+		v := uint8(rng.IntN(256))
+		noise.Pix[i], noise.Pix[i+1], noise.Pix[i+2], noise.Pix[i+3] = v, v, v, 255
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		quality int
+		scans   [][3]int // Компонент, Ss, Se каждого скана
+		minPSNR float64
+	}{
+		{"цветное 40x24", testGradient(40, 24), 85, [][3]int{{3, 0, 0}, {1, 1, 5}, {1, 1, 63}, {1, 1, 63}, {1, 6, 63}}, 30},
+		{"нечетный размер 17x9", testGradient(17, 9), 85, [][3]int{{3, 0, 0}, {1, 1, 5}, {1, 1, 63}, {1, 1, 63}, {1, 6, 63}}, 28},
+		{"полутоновое 23x11", gray, 90, [][3]int{{1, 0, 0}, {1, 1, 5}, {1, 6, 63}}, 30},
+		{"1x1", testGradient(1, 1), 85, [][3]int{{3, 0, 0}, {1, 1, 5}, {1, 1, 63}, {1, 1, 63}, {1, 6, 63}}, 30},
+		{"шум с крупными коэффициентами", noise, 100, [][3]int{{3, 0, 0}, {1, 1, 5}, {1, 1, 63}, {1, 1, 63}, {1, 6, 63}}, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := encodeProgressiveJPEG(&out, tt.img, tt.quality); err != nil {
+				t.Fatalf("encodeProgressiveJPEG: %v", err)
+			}
+			data := out.Bytes()
+			if !bytes.Contains(data, []byte{0xFF, jpegMarkerSOF2}) || bytes.Contains(data, []byte{0xFF, 0xC0, 0x00}) {
+				t.Errorf("файл не SOF2")
+			}
+			scans := progressiveScans(t, data)
+			if len(scans) != len(tt.scans) {
+				t.Fatalf("сканы %v, ожидались %v", scans, tt.scans)
+			}
+			for i := range scans {
+				if scans[i] != tt.scans[i] {
+					t.Errorf("скан %d: %v, ожидался %v", i, scans[i], tt.scans[i])
+				}
+			}
+
+			decoded, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("jpeg.Decode: %v", err)
+			}
+			if decoded.Bounds().Size() != tt.img.Bounds().Size() {
+				t.Fatalf("размер %v, ожидался %v", decoded.Bounds().Size(), tt.img.Bounds().Size())
+			}
+			if _, ok := tt.img.(*image.Gray); ok {
+				if _, ok := decoded.(*image.Gray); !ok {
+					t.Errorf("полутоновое изображение декодировано как %T", decoded)
+				}
+			}
+			if psnr := jpegPSNR(tt.img, decoded); psnr < tt.minPSNR {
+				t.Errorf("PSNR %.1f дБ, ожидалось не меньше %.1f", psnr, tt.minPSNR)
+			}
+			findings, err := verifyJPEG(data, newVerifyPolicy(DefaultProcessOptions()))
+			if err != nil || len(findings) > 0 {
+				t.Errorf("verifyJPEG: %v %q", err, findings)
+			}
+		})
+	}
+}
+
+// Качество прогрессивного кодера при том же quality не хуже baseline-кодера
+// стандартной библиотеки: таблицы квантования одинаковые.
+func TestEncodeProgressiveJPEGMatchesBaselineQuality(t *testing.T) {
+	img := testWatermarkPhoto(160, 120)
+	for _, quality := range []int{50, 75, 92} {
+		var progressive, baseline bytes.Buffer
+		if err := encodeProgressiveJPEG(&progressive, img, quality); err != nil {
+			t.Fatalf("encodeProgressiveJPEG: %v", err)
+		}
+		if err := jpeg.Encode(&baseline, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("jpeg.Encode: %v", err)
+		}
+		p, err := jpeg.Decode(&progressive)
+		if err != nil {
+			t.Fatalf("jpeg.Decode: %v", err)
+		}
+		b, _ := jpeg.Decode(&baseline)
+		if pp, bp := jpegPSNR(img, p), jpegPSNR(img, b); pp < bp-1 {
+			t.Errorf("quality %d: PSNR %.1f дБ, у baseline %.1f", quality, pp, bp)
+		}
+	}
+}
+
+func TestEncodeProgressiveJPEGRejectsEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := encodeProgressiveJPEG(&out, image.NewRGBA(image.Rect(0, 0, 0, 5)), 85); err == nil {
+		t.Errorf("ожидалась ошибка для пустого изображения")
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сравнения сигнатур сегментов
+	"encoding/binary" // Для чтения длин сегментов (big-endian)
+	"fmt"             // Для форматирования ошибок
+)
+
+// Маркеры JPEG, которые используются при разборе потока сегментов.
+const (
+	jpegMarkerSOI  = 0xD8 // Start Of Image - начало файла
+	jpegMarkerEOI  = 0xD9 // End Of Image - конец файла
+	jpegMarkerSOS  = 0xDA // Start Of Scan - начало энтропийно-кодированных данных
+	jpegMarkerAPP0 = 0xE0 // Первый из маркеров приложений APP0..APP15
+	jpegMarkerAPP1 = 0xE1 // EXIF и XMP
+)
+
+// exifSignature - сигнатура, с которой начинается полезная нагрузка APP1-сегмента с EXIF.
+var exifSignature = []byte("Exif\x00\x00")
+
+// jpegSegment описывает один сегмент JPEG-файла из заголовочной части (до SOS).
+type jpegSegment struct {
+	Marker  byte   // Второй байт маркера (например, 0xE1 для APP1)
+	Payload []byte // Данные сегмента без маркера и двух байт длины
+}
+
+// readJPEGHeaderSegments разбирает сегменты JPEG-файла от SOI до SOS (не включая его).
+// Возвращает список сегментов и смещение маркера SOS в data.
+// Энтропийно-кодированные данные не анализируются.
+func readJPEGHeaderSegments(data []byte) (segments []jpegSegment, sosOffset int, err error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, 0, fmt.Errorf("отсутствует маркер SOI, файл не является JPEG")
+	}
+
+	pos := 2
+	for pos < len(data) {
+		// Перед маркером допускается произвольное число байт заполнения 0xFF.
+		if data[pos] != 0xFF {
+			return nil, 0, fmt.Errorf("ожидался маркер JPEG по смещению %d", pos)
+		}
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			break
+		}
+		marker := data[pos]
+		pos++
+
+		if marker == jpegMarkerSOS {
+			return segments, pos - 2, nil
+		}
+		if marker == jpegMarkerEOI {
+			return nil, 0, fmt.Errorf("файл JPEG закончился до начала данных изображения")
+		}
+		// Маркеры RSTn и TEM не имеют длины; в заголовочной части они не встречаются,
+		// но корректно их пропускаем.
+		if (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, 0, fmt.Errorf("обрезанный сегмент 0xFF%02X", marker)
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, 0, fmt.Errorf("некорректная длина сегмента 0xFF%02X: %d", marker, length)
+		}
+		segments = append(segments, jpegSegment{Marker: marker, Payload: data[pos+2 : pos+length]})
+		pos += length
+	}
+	return nil, 0, fmt.Errorf("не найден маркер SOS")
+}
+
+// findJPEGExif возвращает TIFF-структуру EXIF (без префикса "Exif\0\0")
+// из первого APP1-сегмента с EXIF-сигнатурой или nil, если EXIF отсутствует.
+func findJPEGExif(segments []jpegSegment) []byte {
+	for _, seg := range segments {
+		if seg.Marker == jpegMarkerAPP1 && bytes.HasPrefix(seg.Payload, exifSignature) {
+			return seg.Payload[len(exifSignature):]
+		}
+	}
+	return nil
+}
+
+// jpegDataEnd возвращает смещение сразу после маркера EOI, найденного при
+// последовательном проходе по сегментам и данным сканов. Простой поиск байт
+// FF D9 здесь не подходит: они могут встречаться во встроенных миниатюрах
+// и в данных, дописанных после конца изображения.
+func jpegDataEnd(data []byte) (int, error) {
+	_, pos, err := readJPEGHeaderSegments(data)
+	if err != nil {
+		return 0, err
+	}
+	for pos+1 < len(data) {
+		if data[pos] != 0xFF {
+			return 0, fmt.Errorf("ожидался маркер JPEG по смещению %d", pos)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			pos++ // Байт заполнения
+			continue
+		case marker == jpegMarkerEOI:
+			return pos + 2, nil
+		case (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01:
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 0, fmt.Errorf("некорректная длина сегмента 0xFF%02X: %d", marker, length)
+		}
+		pos += 2 + length
+		if marker == jpegMarkerSOS {
+			pos = findJPEGScanEnd(data, pos)
+		}
+	}
+	return len(data), nil // EOI отсутствует: файл обрезан
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"errors"      // Для ошибок-маркеров, проверяемых в хендлерах
+	"fmt"         // Для форматирования ошибок
+	"image"       // Для image.Config
+	"image/color" // Для определения 16-битных цветовых моделей
+	"log"         // Для логирования
+	"sync"        // Для синхронизации бюджета памяти
+	"time"        // Для таймаута ожидания бюджета
+)
+
+// ErrImageTooLarge - ошибка-маркер для изображений, превышающих ограничения по размерам
+// или по памяти, необходимой для декодирования. Хендлеры проверяют ее через errors.Is
+// и показывают пользователю текст ошибки как есть.
+var ErrImageTooLarge = errors.New("изображение слишком большое")
+
+// ErrServerBusy - ошибка-маркер: бюджет памяти для декодирования занят другими загрузками
+// дольше допустимого времени ожидания.
+var ErrServerBusy = errors.New("сервер занят обработкой других изображений")
+
+// Ограничения по умолчанию. Их можно переопределить переменными окружения
+// MAX_IMAGE_WIDTH, MAX_IMAGE_HEIGHT, MAX_IMAGE_PIXELS и DECODE_MEMORY_BUDGET_MB.
+const (
+	DefaultMaxImageWidth      = 16384      // Максимальная ширина, пикселей
+	DefaultMaxImageHeight     = 16384      // Максимальная высота, пикселей
+	DefaultMaxImagePixels     = 64_000_000 // Максимальное количество пикселей (64 Мп)
+	DefaultDecodeMemoryBudget = 1024 << 20 // Общий бюджет памяти на декодирование (1 ГБ)
+	decodeBudgetWaitTimeout   = 30 * time.Second
+)
+
+// checkImageLimits проверяет объявленные в заголовке размеры изображения ДО декодирования.
+// Заголовок занимает несколько байт, поэтому крошечный файл может объявить 50000x50000
+// пикселей и при декодировании исчерпать память сервера ("декомпрессионная бомба").
+func checkImageLimits(cfg image.Config, opts ProcessOptions) error {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return fmt.Errorf("%w: некорректные размеры %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if opts.MaxWidth > 0 && cfg.Width > opts.MaxWidth {
+		return fmt.Errorf("%w: ширина %d пикселей превышает допустимые %d", ErrImageTooLarge, cfg.Width, opts.MaxWidth)
+	}
+	if opts.MaxHeight > 0 && cfg.Height > opts.MaxHeight {
+		return fmt.Errorf("%w: высота %d пикселей превышает допустимые %d", ErrImageTooLarge, cfg.Height, opts.MaxHeight)
+	}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if opts.MaxPixels > 0 && pixels > opts.MaxPixels {
+		return fmt.Errorf("%w: %.1f Мп превышает допустимые %.1f Мп", ErrImageTooLarge,
+			float64(pixels)/1e6, float64(opts.MaxPixels)/1e6)
+	}
+	return nil
+}
+
+// estimateDecodeMemory оценивает объем памяти (в байтах), необходимый для декодирования
+// и обработки изображения: сам декодированный буфер плюс рабочая RGBA-копия
+// (она создается при повороте и других преобразованиях).
+// Для GIF учитываются все кадры (по байту на пиксель логического экрана).
+func estimateDecodeMemory(cfg image.Config, format string, frames int) int64 {
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	const workingCopy = 4 // RGBA, байт на пиксель
+	if format == "gif" {
+		if frames < 1 {
+			frames = 1
+		}
+		return pixels*int64(frames) + pixels*workingCopy
+	}
+	bytesPerPixel := int64(4)
+	switch cfg.ColorModel {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		// 16-битные изображения занимают до 8 байт на пиксель.
+		bytesPerPixel = 8
+	}
+	return pixels*bytesPerPixel + pixels*workingCopy
+}
+
+// memoryBudget - общий для всех запросов бюджет памяти на декодирование изображений.
+// Каждая загрузка резервирует оценку нужной ей памяти перед декодированием и освобождает
+// ее после записи файла. Если бюджет исчерпан, загрузка ждет освобождения памяти,
+// поэтому несколько больших изображений одновременно не могут уронить процесс.
+type memoryBudget struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	changed chan struct{} // Закрывается (и пересоздается) при каждом освобождении памяти
+}
+
+// decodeBudget - бюджет памяти процесса. Размер задается через SetDecodeMemoryBudget.
+var decodeBudget = &memoryBudget{limit: DefaultDecodeMemoryBudget, changed: make(chan struct{})}
+
+// SetDecodeMemoryBudget устанавливает общий бюджет памяти на декодирование (в байтах).
+// Вызывается один раз при старте приложения.
+func SetDecodeMemoryBudget(limit int64) {
+	decodeBudget.mu.Lock()
+	defer decodeBudget.mu.Unlock()
+	decodeBudget.limit = limit
+	log.Printf("Бюджет памяти на декодирование изображений: %d МБ", limit>>20)
+}
+
+// acquire резервирует n байт бюджета. Если изображению в принципе нужно больше
+// всего бюджета, сразу возвращает ErrImageTooLarge. Если бюджет занят другими
+// загрузками дольше timeout, возвращает ErrServerBusy.
+func (b *memoryBudget) acquire(n int64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		b.mu.Lock()
+		if n > b.limit {
+			b.mu.Unlock()
+			return fmt.Errorf("%w: для обработки нужно около %d МБ памяти, допустимо не более %d МБ",
+				ErrImageTooLarge, n>>20, b.limit>>20)
+		}
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+			// Кто-то освободил память - пробуем снова.
+		case <-timer.C:
+			return fmt.Errorf("%w: попробуйте загрузить файл позже", ErrServerBusy)
+		}
+	}
+}
+
+// release возвращает n байт в бюджет и будит ожидающие загрузки.
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
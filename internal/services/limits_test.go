@@ -0,0 +1,199 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"               // Для кодирования анимации
+	"errors"              // Для проверки ошибок-маркеров
+	"image"               // Для image.Config
+	"image/color"         // Для цветовых моделей
+	"image/color/palette" // Для палитры кадров
+	"image/gif"           // Для анимации из многих кадров
+	"os"                  // Для проверки каталога загрузки
+	"strings"             // Для проверки текста ошибок
+	"testing"             // Для тестов
+	"time"                // Для таймаутов бюджета
+)
+
+func TestCheckImageLimits(t *testing.T) {
+	opts := ProcessOptions{MaxWidth: 1000, MaxHeight: 800, MaxPixels: 500_000}
+	tests := []struct {
+		name          string
+		width, height int
+		opts          ProcessOptions
+		wantErr       bool
+	}{
+		{"в пределах ограничений", 1000, 500, opts, false},
+		{"нулевая ширина", 0, 100, opts, true},
+		{"отрицательная высота", 100, -1, opts, true},
+		{"ширина больше допустимой", 1001, 10, opts, true},
+		{"высота больше допустимой", 10, 801, opts, true},
+		{"пикселей больше допустимого", 1000, 501, opts, true},
+		{"ограничения отключены", 50000, 50000, ProcessOptions{}, false},
+		{"переполнение int32 при умножении", 65535, 65535, ProcessOptions{MaxPixels: DefaultMaxImagePixels}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImageLimits(image.Config{Width: tt.width, Height: tt.height}, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrImageTooLarge) {
+				t.Errorf("ошибка не ErrImageTooLarge: %v", err)
+			}
+		})
+	}
+}
+
+func TestEstimateDecodeMemory(t *testing.T) {
+	const w, h = 100, 50
+	tests := []struct {
+		name   string
+		model  color.Model
+		format string
+		frames int
+		want   int64
+	}{
+		{"RGBA", color.RGBAModel, "png", 1, w * h * (4 + 4)},
+		{"YCbCr", color.YCbCrModel, "jpeg", 1, w * h * (4 + 4)},
+		{"16 бит", color.NRGBA64Model, "png", 1, w * h * (8 + 4)},
+		{"полутоновое 16 бит", color.Gray16Model, "png", 1, w * h * (8 + 4)},
+		{"GIF из 10 кадров", nil, "gif", 10, w*h*10 + w*h*4},
+		{"GIF без кадров", nil, "gif", 0, w*h + w*h*4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := estimateDecodeMemory(image.Config{Width: w, Height: h, ColorModel: tt.model}, tt.format, tt.frames)
+			if got != tt.want {
+				t.Errorf("%d байт, ожидалось %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	t.Run("больше всего бюджета", func(t *testing.T) {
+		b := &memoryBudget{limit: 100, changed: make(chan struct{})}
+		start := time.Now()
+		if err := b.acquire(101, time.Minute); !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("ожидалась ErrImageTooLarge, получено %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("отказ не сразу, а через %v", time.Since(start))
+		}
+		if b.used != 0 {
+			t.Errorf("занято %d байт после отказа", b.used)
+		}
+	})
+
+	t.Run("таймаут ожидания", func(t *testing.T) {
+		b := &memoryBudget{limit: 100, changed: make(chan struct{})}
+		if err := b.acquire(60, time.Second); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		if err := b.acquire(60, 20*time.Millisecond); !errors.Is(err, ErrServerBusy) {
+			t.Errorf("ожидалась ErrServerBusy, получено %v", err)
+		}
+		if b.used != 60 {
+			t.Errorf("занято %d байт, ожидалось 60", b.used)
+		}
+	})
+
+	t.Run("ожидание освобождения", func(t *testing.T) {
+		b := &memoryBudget{limit: 100, changed: make(chan struct{})}
+		if err := b.acquire(60, time.Second); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		done := make(chan error)
+		go func() { done <- b.acquire(60, 10*time.Second) }()
+		select {
+		case err := <-done:
+			t.Fatalf("память выделена до освобождения: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		b.release(60)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("acquire после освобождения: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ожидающая загрузка не разбужена")
+		}
+		b.release(60)
+		if b.used != 0 {
+			t.Errorf("занято %d байт после освобождения", b.used)
+		}
+	})
+}
+
+// setTestDecodeBudget заменяет бюджет декодирования на время теста.
+func setTestDecodeBudget(t *testing.T, limit int64) {
+	t.Helper()
+	previous := decodeBudget
+	decodeBudget = &memoryBudget{limit: limit, changed: make(chan struct{})}
+	t.Cleanup(func() { decodeBudget = previous })
+}
+
+func TestProcessImageGIFMemory(t *testing.T) {
+	// 300 кадров 64x64: около 1,2 МБ на кадры, хотя один кадр занимает 4 КБ.
+	anim := &gif.GIF{}
+	for i := 0; i < 300; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 64, 64), palette.Plan9)
+		frame.SetColorIndex(i%64, i/64, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 2)
+	}
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, anim); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+	many := encoded.Bytes()
+	valid := testGIF(t, nil, "")
+
+	// Файлы с испорченной структурой отклоняются до декодирования (по ошибке scanGIF),
+	// а не оцениваются как один кадр.
+	manyBroken := append(append([]byte{}, many[:len(many)-1]...), 0x99, 0x3B)
+	tests := []struct {
+		name    string
+		data    []byte
+		want    error  // nil - любая ошибка
+		message string // Фрагмент текста ошибки
+	}{
+		{"кадры не помещаются в бюджет", many, ErrImageTooLarge, ""},
+		{"неизвестный блок после кадров", manyBroken, nil, "неизвестный блок GIF"},
+		{"неизвестный блок", testGIF(t, []byte{0x99}, ""), nil, "неизвестный блок GIF"},
+		{"обрезан внутри кадра", valid[:len(valid)-6], nil, "GIF обрезан"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestDecodeBudget(t, 1<<20)
+			dir := t.TempDir()
+			stored, _, err := ProcessAndSaveData("anim.gif", tt.data, dir, DefaultProcessOptions())
+			if err == nil {
+				t.Fatalf("файл принят и сохранен как %s", stored)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась %v, получено %v", tt.want, err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("ошибка %q не содержит %q", err, tt.message)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+				t.Errorf("в каталоге загрузки остались файлы: %v", entries)
+			}
+			if decodeBudget.used != 0 {
+				t.Errorf("бюджет не освобожден: %d байт", decodeBudget.used)
+			}
+		})
+	}
+
+	t.Run("в пределах бюджета", func(t *testing.T) {
+		setTestDecodeBudget(t, 64<<20)
+		if _, _, err := ProcessAndSaveData("anim.gif", many, t.TempDir(), DefaultProcessOptions()); err != nil {
+			t.Errorf("ProcessAndSaveData: %v", err)
+		}
+		if decodeBudget.used != 0 {
+			t.Errorf("бюджет не освобожден: %d байт", decodeBudget.used)
+		}
+	})
+}
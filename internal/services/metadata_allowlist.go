@@ -0,0 +1,428 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки XMP-пакета и поиска сигнатур
+	"encoding/binary" // Для записи длин блоков IPTC и Photoshop
+	"encoding/xml"    // Для разбора исходного XMP и экранирования значений
+	"fmt"             // Для форматирования ошибок
+	"sort"            // Для стабильного порядка полей
+	"strings"         // Для разбора списка полей
+)
+
+// Список разрешенных полей метаданных.
+//
+// По умолчанию очистка удаляет все метаданные. Некоторым пользователям (например,
+// фотографам) нужно сохранить указание авторства. Для них администратор задает
+// список полей, которые переносятся в очищенный файл: глобально (переменная окружения
+// METADATA_ALLOWLIST) и, при необходимости, отдельно для пользователя.
+// Поля не копируются из исходных блоков, а записываются в новые минимальные блоки
+// EXIF, XMP и IPTC, поэтому ничего, кроме разрешенных значений, в файл не попадает.
+
+// metadataFieldKind - стандарт метаданных, к которому относится поле.
+type metadataFieldKind int
+
+const (
+	fieldEXIF metadataFieldKind = iota
+	fieldXMP
+	fieldIPTC
+)
+
+// xmpValueKind - вид значения свойства XMP.
+type xmpValueKind int
+
+const (
+	xmpSimple xmpValueKind = iota // Простое значение
+	xmpSeq                        // Упорядоченный список (rdf:Seq)
+	xmpAlt                        // Альтернативы по языкам (rdf:Alt, сохраняется x-default)
+)
+
+// metadataField описывает одно поле, которое может быть разрешено.
+type metadataField struct {
+	kind metadataFieldKind
+
+	exifTag    uint16 // Тег EXIF (для fieldEXIF)
+	exifSubIFD bool   // Тег хранится в Exif SubIFD, а не в IFD0
+
+	xmpNamespace string       // URI пространства имен (для fieldXMP)
+	xmpPrefix    string       // Префикс пространства имен в записываемом пакете
+	xmpName      string       // Локальное имя свойства
+	xmpValue     xmpValueKind // Вид значения
+
+	iptcDataset byte // Номер набора данных записи 2 (для fieldIPTC)
+}
+
+// Пространства имен XMP, свойства которых можно сохранить.
+const (
+	xmpNamespaceDC        = "http://purl.org/dc/elements/1.1/"
+	xmpNamespaceRights    = "http://ns.adobe.com/xap/1.0/rights/"
+	xmpNamespacePhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+// Дополнительные теги EXIF и наборы данных IPTC, которые можно сохранить.
+const (
+	exifTagImageDescription = 0x010E // Описание изображения
+
+	iptcObjectName = 5   // Название
+	iptcHeadline   = 105 // Заголовок
+	iptcCredit     = 110 // Кредит (указание источника)
+	iptcSource     = 115 // Источник
+)
+
+// metadataFields - все поля, которые можно указать в списке разрешенных.
+// Имена задаются с префиксом стандарта: exif:, xmp: или iptc:.
+var metadataFields = map[string]metadataField{
+	"exif:Artist":           {kind: fieldEXIF, exifTag: exifTagArtist},
+	"exif:Copyright":        {kind: fieldEXIF, exifTag: exifTagCopyright},
+	"exif:ImageDescription": {kind: fieldEXIF, exifTag: exifTagImageDescription},
+	"exif:Make":             {kind: fieldEXIF, exifTag: exifTagMake},
+	"exif:Model":            {kind: fieldEXIF, exifTag: exifTagModel},
+	"exif:Software":         {kind: fieldEXIF, exifTag: exifTagSoftware},
+	"exif:DateTime":         {kind: fieldEXIF, exifTag: exifTagDateTime},
+	"exif:DateTimeOriginal": {kind: fieldEXIF, exifTag: exifTagDateTimeOriginal, exifSubIFD: true},
+	"exif:LensModel":        {kind: fieldEXIF, exifTag: exifTagLensModel, exifSubIFD: true},
+
+	"xmp:dc:creator":             {kind: fieldXMP, xmpNamespace: xmpNamespaceDC, xmpPrefix: "dc", xmpName: "creator", xmpValue: xmpSeq},
+	"xmp:dc:rights":              {kind: fieldXMP, xmpNamespace: xmpNamespaceDC, xmpPrefix: "dc", xmpName: "rights", xmpValue: xmpAlt},
+	"xmp:dc:title":               {kind: fieldXMP, xmpNamespace: xmpNamespaceDC, xmpPrefix: "dc", xmpName: "title", xmpValue: xmpAlt},
+	"xmp:dc:description":         {kind: fieldXMP, xmpNamespace: xmpNamespaceDC, xmpPrefix: "dc", xmpName: "description", xmpValue: xmpAlt},
+	"xmp:xmpRights:UsageTerms":   {kind: fieldXMP, xmpNamespace: xmpNamespaceRights, xmpPrefix: "xmpRights", xmpName: "UsageTerms", xmpValue: xmpAlt},
+	"xmp:xmpRights:WebStatement": {kind: fieldXMP, xmpNamespace: xmpNamespaceRights, xmpPrefix: "xmpRights", xmpName: "WebStatement", xmpValue: xmpSimple},
+	"xmp:photoshop:Credit":       {kind: fieldXMP, xmpNamespace: xmpNamespacePhotoshop, xmpPrefix: "photoshop", xmpName: "Credit", xmpValue: xmpSimple},
+	"xmp:photoshop:Source":       {kind: fieldXMP, xmpNamespace: xmpNamespacePhotoshop, xmpPrefix: "photoshop", xmpName: "Source", xmpValue: xmpSimple},
+
+	"iptc:By-line":          {kind: fieldIPTC, iptcDataset: iptcByline},
+	"iptc:CopyrightNotice":  {kind: fieldIPTC, iptcDataset: iptcCopyrightNotice},
+	"iptc:Caption-Abstract": {kind: fieldIPTC, iptcDataset: iptcCaption},
+	"iptc:Headline":         {kind: fieldIPTC, iptcDataset: iptcHeadline},
+	"iptc:ObjectName":       {kind: fieldIPTC, iptcDataset: iptcObjectName},
+	"iptc:Credit":           {kind: fieldIPTC, iptcDataset: iptcCredit},
+	"iptc:Source":           {kind: fieldIPTC, iptcDataset: iptcSource},
+}
+
+// metadataFieldAliases - сокращения, разрешающие одно и то же по смыслу поле во всех стандартах.
+var metadataFieldAliases = map[string][]string{
+	"artist":      {"exif:Artist", "xmp:dc:creator", "iptc:By-line"},
+	"copyright":   {"exif:Copyright", "xmp:dc:rights", "iptc:CopyrightNotice"},
+	"description": {"exif:ImageDescription", "xmp:dc:description", "iptc:Caption-Abstract"},
+	"credit":      {"xmp:photoshop:Credit", "iptc:Credit"},
+}
+
+// maxKeptValueLength - максимальная длина сохраняемого значения (в байтах).
+const maxKeptValueLength = 2000
+
+// MetadataAllowlist - множество полей метаданных, которые сохраняются при очистке.
+// Пустой список (или nil) означает, что удаляется все.
+type MetadataAllowlist map[string]bool
+
+// ParseMetadataAllowlist разбирает список полей через запятую или пробел, например
+// "Artist, Copyright" или "exif:Artist,xmp:dc:rights". Регистр не учитывается.
+// Пустая строка и "none" означают пустой список.
+func ParseMetadataAllowlist(value string) (MetadataAllowlist, error) {
+	allow := MetadataAllowlist{}
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' }) {
+		if strings.EqualFold(name, "none") {
+			continue
+		}
+		if fields, ok := metadataFieldAliases[strings.ToLower(name)]; ok {
+			for _, field := range fields {
+				allow[field] = true
+			}
+			continue
+		}
+		canonical := ""
+		for field := range metadataFields {
+			if strings.EqualFold(field, name) {
+				canonical = field
+				break
+			}
+		}
+		if canonical == "" {
+			return nil, fmt.Errorf("неизвестное поле метаданных: %q (допустимо: %s или сокращения artist, copyright, description, credit)", name, strings.Join(MetadataFieldNames(), ", "))
+		}
+		allow[canonical] = true
+	}
+	return allow, nil
+}
+
+// MetadataFieldNames возвращает отсортированный список всех полей, которые можно разрешить.
+func MetadataFieldNames() []string {
+	names := make([]string, 0, len(metadataFields))
+	for name := range metadataFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String возвращает список полей в каноническом виде (через запятую, по алфавиту).
+// Используется для хранения списка пользователя в базе данных.
+func (a MetadataAllowlist) String() string {
+	names := make([]string, 0, len(a))
+	for name, ok := range a {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// collectAllowedMetadata извлекает из исходного JPEG значения разрешенных полей
+// и раскладывает их по новым минимальным блокам. Возвращает также отсортированные
+// имена полей, которые действительно были сохранены (для отчета).
+func collectAllowedMetadata(data []byte, allow MetadataAllowlist) (keptMetadata, []string) {
+	var kept keptMetadata
+	if len(allow) == 0 {
+		return kept, nil
+	}
+	segments, _, err := readJPEGHeaderSegments(data)
+	if err != nil {
+		return kept, nil
+	}
+	keptNames := map[string]bool{}
+
+	// EXIF: сохраняются только текстовые теги - их значения не зависят от порядка байт.
+	if tiff := findJPEGExif(segments); tiff != nil {
+		if ex, errEXIF := parseEXIF(tiff); errEXIF == nil {
+			for _, name := range allowedFields(allow, fieldEXIF) {
+				field := metadataFields[name]
+				source, target := ex.IFD0, &kept.IFD0
+				if field.exifSubIFD {
+					source, target = ex.Exif, &kept.ExifIFD
+				}
+				e := findEntry(source, field.exifTag)
+				if e == nil || e.Type != exifTypeASCII {
+					continue
+				}
+				value := bytes.TrimRight(e.Value, "\x00")
+				if len(value) == 0 || len(value) > maxKeptValueLength {
+					continue
+				}
+				value = append(append([]byte(nil), value...), 0)
+				*target = append(*target, exifEntry{Tag: field.exifTag, Type: exifTypeASCII, Count: uint32(len(value)), Value: value})
+				keptNames[name] = true
+			}
+		}
+	}
+
+	// XMP и IPTC: значения собираются из всех блоков, затем записываются в один новый блок каждого вида.
+	xmpValues := map[string][]string{}
+	var iptc []byte
+	for _, seg := range segments {
+		switch {
+		case seg.Marker == jpegMarkerAPP1 && bytes.HasPrefix(seg.Payload, xmpSignature):
+			extractXMPValues(seg.Payload[len(xmpSignature):], allow, xmpValues)
+		case seg.Marker == jpegMarkerAPP13 && bytes.HasPrefix(seg.Payload, photoshopSignature):
+			forEachPhotoshopResource(seg.Payload[len(photoshopSignature):], func(id uint16, body []byte) {
+				if id == photoshopResourceIPTC {
+					iptc = append(iptc, filterIPTC(body, allow, keptNames)...)
+				}
+			})
+		}
+	}
+	if len(xmpValues) > 0 {
+		kept.XMP = buildXMPPacket(xmpValues)
+		for name := range xmpValues {
+			keptNames[name] = true
+		}
+	}
+	if len(iptc) > 0 {
+		// Первым идет обязательный набор 2:00 (версия записи 2).
+		kept.IPTC = append([]byte{0x1C, 2, 0, 0, 2, 0, 4}, iptc...)
+	}
+
+	names := make([]string, 0, len(keptNames))
+	for name := range keptNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return kept, names
+}
+
+// allowedFields возвращает отсортированные имена разрешенных полей заданного стандарта.
+func allowedFields(allow MetadataAllowlist, kind metadataFieldKind) []string {
+	var names []string
+	for name, ok := range allow {
+		if field, known := metadataFields[name]; ok && known && field.kind == kind {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxKeptXMPValues - сколько значений одного свойства XMP сохраняется (например, авторов в dc:creator).
+const maxKeptXMPValues = 32
+
+// extractXMPValues находит в XMP-пакете разрешенные свойства и добавляет их значения в values.
+// Свойства могут быть записаны атрибутами rdf:Description, простыми элементами
+// или списками rdf:Seq/rdf:Bag/rdf:Alt; для rdf:Alt первым ставится значение x-default.
+// Вложенная разметка внутри свойства не переносится - сохраняется только текст.
+func extractXMPValues(packet []byte, allow MetadataAllowlist, values map[string][]string) {
+	byName := map[xml.Name]string{}
+	for _, name := range allowedFields(allow, fieldXMP) {
+		field := metadataFields[name]
+		byName[xml.Name{Space: field.xmpNamespace, Local: field.xmpName}] = name
+	}
+
+	add := func(name, value string, preferred bool) {
+		value = strings.TrimSpace(value)
+		if value == "" || len(value) > maxKeptValueLength || len(values[name]) >= maxKeptXMPValues {
+			return
+		}
+		if preferred {
+			values[name] = append([]string{value}, values[name]...)
+		} else {
+			values[name] = append(values[name], value)
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+	var (
+		current   string          // Разрешенное свойство, внутри которого находится разбор
+		depth     int             // Глубина вложенности внутри current
+		items     int             // Сколько элементов rdf:li найдено в current
+		text      strings.Builder // Текст текущего значения
+		isDefault bool            // Текущий rdf:li имеет xml:lang="x-default"
+	)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return // Конец пакета или поврежденный XML - используем то, что успели разобрать
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == "" {
+				for _, attr := range t.Attr {
+					if name, ok := byName[attr.Name]; ok {
+						add(name, attr.Value, false)
+					}
+				}
+				if name, ok := byName[t.Name]; ok {
+					current, depth, items = name, 1, 0
+					text.Reset()
+				}
+				continue
+			}
+			depth++
+			if t.Name.Space == rdfNamespace && t.Name.Local == "li" {
+				text.Reset()
+				isDefault = false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "lang" && strings.EqualFold(attr.Value, "x-default") {
+						isDefault = true
+					}
+				}
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if current == "" {
+				continue
+			}
+			depth--
+			if t.Name.Space == rdfNamespace && t.Name.Local == "li" {
+				add(current, text.String(), isDefault)
+				items++
+				text.Reset()
+			}
+			if depth == 0 {
+				if items == 0 {
+					add(current, text.String(), false)
+				}
+				current = ""
+			}
+		}
+	}
+}
+
+// buildXMPPacket собирает новый XMP-пакет только с переданными свойствами.
+func buildXMPPacket(values map[string][]string) []byte {
+	names := make([]string, 0, len(values))
+	prefixes := map[string]string{}
+	for name := range values {
+		names = append(names, name)
+		field := metadataFields[name]
+		prefixes[field.xmpPrefix] = field.xmpNamespace
+	}
+	sort.Strings(names)
+	prefixNames := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		prefixNames = append(prefixNames, prefix)
+	}
+	sort.Strings(prefixNames)
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"" + rdfNamespace + "\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"")
+	for _, prefix := range prefixNames {
+		b.WriteString("\n    xmlns:" + prefix + "=\"" + prefixes[prefix] + "\"")
+	}
+	b.WriteString(">\n")
+	for _, name := range names {
+		field := metadataFields[name]
+		tag := field.xmpPrefix + ":" + field.xmpName
+		b.WriteString("   <" + tag + ">")
+		switch field.xmpValue {
+		case xmpSeq:
+			b.WriteString("<rdf:Seq>")
+			for _, value := range values[name] {
+				b.WriteString("<rdf:li>")
+				xml.EscapeText(&b, []byte(value))
+				b.WriteString("</rdf:li>")
+			}
+			b.WriteString("</rdf:Seq>")
+		case xmpAlt:
+			b.WriteString("<rdf:Alt><rdf:li xml:lang=\"x-default\">")
+			xml.EscapeText(&b, []byte(values[name][0]))
+			b.WriteString("</rdf:li></rdf:Alt>")
+		default:
+			xml.EscapeText(&b, []byte(values[name][0]))
+		}
+		b.WriteString("</" + tag + ">\n")
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+// filterIPTC возвращает наборы данных записи 2, разрешенные списком, в исходном порядке
+// и отмечает их имена в keptNames. Остальные наборы (включая записи 1 и 2:00) отбрасываются.
+func filterIPTC(data []byte, allow MetadataAllowlist, keptNames map[string]bool) []byte {
+	byDataset := map[byte]string{}
+	for _, name := range allowedFields(allow, fieldIPTC) {
+		byDataset[metadataFields[name].iptcDataset] = name
+	}
+	var out []byte
+	forEachIPTCDataset(data, func(record, dataset byte, value []byte) {
+		name, ok := byDataset[dataset]
+		if record != 2 || !ok || len(value) == 0 || len(value) > maxKeptValueLength {
+			return
+		}
+		out = append(out, 0x1C, record, dataset)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(value)))
+		out = append(out, value...)
+		keptNames[name] = true
+	})
+	return out
+}
+
+// photoshopIPTCPayload формирует полезную нагрузку APP13: сигнатура Photoshop
+// и единственный блок ресурсов 8BIM с записями IPTC-NAA.
+func photoshopIPTCPayload(iptc []byte) []byte {
+	out := append([]byte(nil), photoshopSignature...)
+	out = append(out, "8BIM"...)
+	out = binary.BigEndian.AppendUint16(out, photoshopResourceIPTC)
+	out = append(out, 0, 0) // Пустое имя ресурса (Pascal-строка, выровненная до 2 байт)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(iptc)))
+	out = append(out, iptc...)
+	if len(iptc)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для поиска блоков в файле
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"slices"        // Для сравнения списков
+	"testing"       // Для тестов
+)
+
+func TestParseMetadataAllowlist(t *testing.T) {
+	allow, err := ParseMetadataAllowlist("Artist; copyright  EXIF:make,none")
+	if err != nil {
+		t.Fatalf("ParseMetadataAllowlist: %v", err)
+	}
+	want := "exif:Artist,exif:Copyright,exif:Make,iptc:By-line,iptc:CopyrightNotice,xmp:dc:creator,xmp:dc:rights"
+	if got := allow.String(); got != want {
+		t.Errorf("список %q, ожидался %q", got, want)
+	}
+	// Каноническая запись разбирается в тот же список (так список хранится в базе данных).
+	again, err := ParseMetadataAllowlist(allow.String())
+	if err != nil || again.String() != want {
+		t.Errorf("повторный разбор: %q, %v", again.String(), err)
+	}
+	for _, value := range []string{"", "none", " , "} {
+		if allow, err := ParseMetadataAllowlist(value); err != nil || len(allow) != 0 {
+			t.Errorf("ParseMetadataAllowlist(%q) = %v, %v; ожидался пустой список", value, allow, err)
+		}
+	}
+	if _, err := ParseMetadataAllowlist("Artist, exif:GPSLatitude"); err == nil {
+		t.Errorf("неизвестное поле принято")
+	}
+}
+
+func TestProcessImageKeepsAllowedMetadata(t *testing.T) {
+	input := testMetadataJPEG(t)
+	allow, err := ParseMetadataAllowlist("artist, exif:Copyright")
+	if err != nil {
+		t.Fatalf("ParseMetadataAllowlist: %v", err)
+	}
+
+	for _, mode := range []CleanMode{CleanModeLossless, CleanModeReencode} {
+		t.Run(string(mode), func(t *testing.T) {
+			opts := DefaultProcessOptions()
+			opts.JPEGMode = mode
+			opts.MetadataAllowlist = allow
+			dir := t.TempDir()
+			stored, report, err := ProcessAndSaveData("photo.jpg", input, dir, opts)
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData: %v", err)
+			}
+			// Поля, которых нет в исходном файле (iptc:CopyrightNotice), в отчет не попадают.
+			wantKept := []string{"exif:Artist", "exif:Copyright", "iptc:By-line", "xmp:dc:creator"}
+			if !slices.Equal(report.KeptFields, wantKept) {
+				t.Errorf("сохраненные поля %q, ожидались %q", report.KeptFields, wantKept)
+			}
+
+			path := filepath.Join(dir, stored)
+			clean, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			segments, _, err := readJPEGHeaderSegments(clean)
+			if err != nil {
+				t.Fatalf("readJPEGHeaderSegments: %v", err)
+			}
+			ex, err := parseEXIF(findJPEGExif(segments))
+			if err != nil {
+				t.Fatalf("parseEXIF: %v", err)
+			}
+			if got := ex.stringValue(findEntry(ex.IFD0, exifTagArtist)); got != "Иван Петров" {
+				t.Errorf("Artist = %q", got)
+			}
+			if got := ex.stringValue(findEntry(ex.IFD0, exifTagCopyright)); got != "(c) Петров" {
+				t.Errorf("Copyright = %q", got)
+			}
+			if len(ex.IFD0) != 2 || len(ex.Exif) != 0 || len(ex.GPS) != 0 {
+				t.Errorf("лишние теги EXIF: IFD0 %d, Exif %d, GPS %d", len(ex.IFD0), len(ex.Exif), len(ex.GPS))
+			}
+
+			// Отчет по очищенному файлу: остались только авторы.
+			again := analyzeMetadata(clean, "jpeg")
+			slices.Sort(again.Authors)
+			if want := []string{"(c) Петров", "Photo Agency", "Анна Смирнова", "Иван Петров"}; !slices.Equal(again.Authors, want) {
+				t.Errorf("авторы в очищенном файле %q, ожидались %q", again.Authors, want)
+			}
+			if again.GPS != nil || again.CameraMake != "" || again.CameraModel != "" || len(again.SerialNumbers) > 0 ||
+				len(again.Timestamps) > 0 || len(again.Software) > 0 || len(again.Comments) > 0 || again.C2PA || again.Thumbnails > 0 {
+				t.Errorf("в очищенном файле остались другие метаданные: %+v", again)
+			}
+			for _, leaked := range []string{"Lightroom", "Дача у озера", "Москва", "59,56.34N", "c2pa", "снято на даче"} {
+				if bytes.Contains(clean, []byte(leaked)) {
+					t.Errorf("в файле осталось %q", leaked)
+				}
+			}
+
+			if err := VerifyCleanFile(path, opts); err != nil {
+				t.Errorf("VerifyCleanFile: %v", err)
+			}
+			if err := VerifyCleanFile(path, DefaultProcessOptions()); err == nil {
+				t.Errorf("файл с авторством прошел проверку без списка разрешенных полей")
+			}
+		})
+	}
+
+	t.Run("PNG", func(t *testing.T) {
+		// Разрешенные поля сохраняются только в JPEG.
+		opts := DefaultProcessOptions()
+		opts.MetadataAllowlist = allow
+		opts.OutputPolicy = OutputPolicyPNG
+		dir := t.TempDir()
+		stored, report, err := ProcessAndSaveData("photo.jpg", input, dir, opts)
+		if err != nil {
+			t.Fatalf("ProcessAndSaveData: %v", err)
+		}
+		if len(report.KeptFields) > 0 {
+			t.Errorf("сохранены поля %q", report.KeptFields)
+		}
+		if err := VerifyCleanFile(filepath.Join(dir, stored), DefaultProcessOptions()); err != nil {
+			t.Errorf("VerifyCleanFile: %v", err)
+		}
+	})
+}
+
+func TestCollectAllowedMetadata(t *testing.T) {
+	t.Run("только текстовые теги EXIF", func(t *testing.T) {
+		input := testJPEG(t, testEXIFSegment([]exifEntry{newShortEntry(exifTagArtist, 1), testASCIIEntry(exifTagCopyright, "")}, nil, nil))
+		kept, names := collectAllowedMetadata(input, MetadataAllowlist{"exif:Artist": true, "exif:Copyright": true})
+		if len(kept.IFD0) != 0 || len(names) != 0 {
+			t.Errorf("сохранены %q: %+v", names, kept.IFD0)
+		}
+	})
+
+	t.Run("значения XMP", func(t *testing.T) {
+		packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+			`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/" photoshop:Credit="Агентство &amp; партнеры">` +
+			`<dc:rights><rdf:Alt><rdf:li xml:lang="en">(c) Petrov</rdf:li><rdf:li xml:lang="x-default">(c) Петров</rdf:li></rdf:Alt></dc:rights>` +
+			`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Озеро <b>утром</b></rdf:li></rdf:Alt></dc:title>` +
+			`<photoshop:City>Москва</photoshop:City>` +
+			`</rdf:Description></rdf:RDF></x:xmpmeta>`
+		input := testJPEG(t, jpegSegment{Marker: jpegMarkerAPP1, Payload: append(append([]byte{}, xmpSignature...), packet...)})
+		allow := MetadataAllowlist{"xmp:dc:rights": true, "xmp:dc:title": true, "xmp:photoshop:Credit": true}
+		kept, names := collectAllowedMetadata(input, allow)
+		if want := []string{"xmp:dc:rights", "xmp:dc:title", "xmp:photoshop:Credit"}; !slices.Equal(names, want) {
+			t.Errorf("поля %q, ожидались %q", names, want)
+		}
+
+		// Новый пакет разбирается заново: x-default стоит первым, вложенная разметка
+		// заменена текстом, спецсимволы экранированы, неразрешенных свойств нет.
+		values := map[string][]string{}
+		extractXMPValues(kept.XMP, allow, values)
+		if got := values["xmp:dc:rights"]; len(got) != 1 || got[0] != "(c) Петров" {
+			t.Errorf("dc:rights = %q", got)
+		}
+		if got := values["xmp:dc:title"]; len(got) != 1 || got[0] != "Озеро утром" {
+			t.Errorf("dc:title = %q", got)
+		}
+		if got := values["xmp:photoshop:Credit"]; len(got) != 1 || got[0] != "Агентство & партнеры" {
+			t.Errorf("photoshop:Credit = %q", got)
+		}
+		if bytes.Contains(kept.XMP, []byte("Москва")) || bytes.Contains(kept.XMP, []byte("<b>")) {
+			t.Errorf("в пакет попали лишние данные:\n%s", kept.XMP)
+		}
+		findings := verifyXMP(kept.XMP, newVerifyPolicy(ProcessOptions{MetadataAllowlist: allow}))
+		if len(findings) > 0 {
+			t.Errorf("verifyXMP: %q", findings)
+		}
+	})
+
+	t.Run("наборы IPTC", func(t *testing.T) {
+		input := testJPEG(t, testIPTCSegment(
+			[2]string{string(rune(iptcByline)), "Иванов"},
+			[2]string{string(rune(iptcCity)), "Москва"},
+			[2]string{string(rune(iptcByline)), "Петров"},
+		))
+		kept, names := collectAllowedMetadata(input, MetadataAllowlist{"iptc:By-line": true})
+		if !slices.Equal(names, []string{"iptc:By-line"}) {
+			t.Errorf("поля %q", names)
+		}
+		var got []string
+		forEachIPTCDataset(kept.IPTC, func(record, dataset byte, value []byte) {
+			if dataset != 0 {
+				got = append(got, string(value))
+			}
+		})
+		if !slices.Equal(got, []string{"Иванов", "Петров"}) {
+			t.Errorf("наборы IPTC %q", got)
+		}
+	})
+}
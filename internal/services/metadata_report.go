@@ -0,0 +1,677 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для поиска сигнатур в сегментах
+	"compress/zlib"   // Для распаковки сжатых текстовых чанков PNG
+	"encoding/binary" // Для разбора ресурсов Photoshop и записей IPTC
+	"encoding/xml"    // Для разбора XMP-пакетов
+	"fmt"             // Для форматирования значений отчета
+	"io"              // Для ограниченного чтения распакованных данных
+	"sort"            // Для стабильного порядка значений в отчете
+	"strconv"         // Для разбора координат XMP
+	"strings"         // Для работы со строками
+)
+
+// MetadataReport - отчет о метаданных, найденных в исходном файле и удаленных при очистке.
+// Показывается пользователю после загрузки, чтобы было видно, что именно могло утечь.
+type MetadataReport struct {
+	Format        string       `json:"format"`                   // Формат исходного файла ("jpeg", "png", "gif")
+	GPS           *GPSLocation `json:"gps,omitempty"`            // Координаты съемки
+	CameraMake    string       `json:"camera_make,omitempty"`    // Производитель камеры
+	CameraModel   string       `json:"camera_model,omitempty"`   // Модель камеры
+	SerialNumbers []string     `json:"serial_numbers,omitempty"` // Серийные номера камеры/объектива
+	Timestamps    []string     `json:"timestamps,omitempty"`     // Даты съемки, изменения и т.п.
+	Software      []string     `json:"software,omitempty"`       // Программы, создавшие/изменившие файл
+	Authors       []string     `json:"authors,omitempty"`        // Авторы и владельцы (EXIF, XMP, IPTC)
+	Comments      []string     `json:"comments,omitempty"`       // Текстовые комментарии
+	C2PA          bool         `json:"c2pa"`                     // Найден манифест C2PA (Content Credentials)
+	Thumbnails    int          `json:"thumbnails"`               // Количество встроенных миниатюр/превью
+	RemovedBlocks []string     `json:"removed_blocks,omitempty"` // Удаленные блоки метаданных (EXIF, XMP, tEXt...)
+	FacesBlurred  int          `json:"faces_blurred,omitempty"`  // Количество автоматически размытых лиц
+
+	// ColorConvertedFrom - описание ICC-профиля, из пространства которого цвета
+	// были переведены в sRGB (пусто, если преобразование не выполнялось).
+	ColorConvertedFrom string `json:"color_converted_from,omitempty"`
+
+	// Огрубленные координаты, сохраненные в очищенном файле, и их точность
+	// (пусто, если координаты удалены полностью).
+	GPSKept          *GPSLocation `json:"gps_kept,omitempty"`
+	GPSKeptPrecision GPSPrecision `json:"gps_kept_precision,omitempty"`
+
+	// KeptFields - поля метаданных, сохраненные в очищенном файле по списку разрешенных.
+	KeptFields []string `json:"kept_fields,omitempty"`
+
+	// Watermarked - в пиксели встроен невидимый водяной знак (идентификатор ссылки).
+	Watermarked bool `json:"watermarked,omitempty"`
+
+	// Размеры сохраненного изображения и исходные размеры, если оно было уменьшено
+	// (пусто, если размер не менялся).
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ResizedFrom string `json:"resized_from,omitempty"`
+}
+
+// GPSLocation - координаты из метаданных файла.
+type GPSLocation struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"` // Высота в метрах (если указана)
+}
+
+// String форматирует координаты для показа пользователю.
+func (g *GPSLocation) String() string {
+	s := fmt.Sprintf("%.6f, %.6f", g.Latitude, g.Longitude)
+	if g.Altitude != nil {
+		s += fmt.Sprintf(" (высота %.1f м)", *g.Altitude)
+	}
+	return s
+}
+
+// HasFindings сообщает, найдены ли в файле какие-либо метаданные.
+func (r *MetadataReport) HasFindings() bool {
+	return r.GPS != nil || r.CameraMake != "" || r.CameraModel != "" || len(r.SerialNumbers) > 0 ||
+		len(r.Timestamps) > 0 || len(r.Software) > 0 || len(r.Authors) > 0 || len(r.Comments) > 0 ||
+		r.C2PA || r.Thumbnails > 0 || len(r.RemovedBlocks) > 0
+}
+
+// maxReportTextLength - максимальная длина одного текстового значения в отчете.
+// Длинные значения обрезаются, чтобы отчет оставался читаемым.
+const maxReportTextLength = 200
+
+// addUnique добавляет значение в список отчета, пропуская пустые значения и повторы.
+func (r *MetadataReport) addUnique(list *[]string, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if runes := []rune(value); len(runes) > maxReportTextLength {
+		value = string(runes[:maxReportTextLength]) + "…"
+	}
+	for _, existing := range *list {
+		if existing == value {
+			return
+		}
+	}
+	*list = append(*list, value)
+}
+
+// addBlock добавляет название удаленного блока метаданных.
+func (r *MetadataReport) addBlock(name string) {
+	r.addUnique(&r.RemovedBlocks, name)
+}
+
+// addTimestamp добавляет временную метку с подписью источника.
+func (r *MetadataReport) addTimestamp(label, v string) {
+	if strings.TrimSpace(v) != "" {
+		r.addUnique(&r.Timestamps, label+": "+strings.TrimSpace(v))
+	}
+}
+
+// analyzeMetadata строит отчет о метаданных исходного файла формата format.
+// Анализ выполняется только для отчета: ошибки разбора отдельных блоков не
+// прерывают его, а очистка файла выполняется независимо.
+func analyzeMetadata(data []byte, format string) *MetadataReport {
+	report := &MetadataReport{Format: format}
+	switch format {
+	case "jpeg":
+		analyzeJPEGMetadata(data, report)
+	case "png":
+		analyzePNGMetadata(data, report)
+	case "gif":
+		analyzeGIFMetadata(data, report)
+	case "webp":
+		analyzeWebPMetadata(data, report)
+	case "tiff":
+		analyzeTIFFMetadata(data, report)
+	}
+	sort.Strings(report.Timestamps)
+	return report
+}
+
+// analyzeJPEGMetadata разбирает сегменты JPEG: EXIF, XMP, IPTC, C2PA, комментарии,
+// миниатюры и данные после EOI.
+func analyzeJPEGMetadata(data []byte, report *MetadataReport) {
+	segments, _, err := readJPEGHeaderSegments(data)
+	if err != nil {
+		return
+	}
+	for _, seg := range segments {
+		p := seg.Payload
+		switch {
+		case seg.Marker == jpegMarkerAPP0 && bytes.HasPrefix(p, []byte("JFIF\x00")):
+			if len(p) >= jfifMinimalLength && p[12] > 0 && p[13] > 0 {
+				report.Thumbnails++
+				report.addBlock("Миниатюра JFIF")
+			}
+		case seg.Marker == jpegMarkerAPP0 && bytes.HasPrefix(p, []byte("JFXX\x00")):
+			report.Thumbnails++
+			report.addBlock("Миниатюра JFXX")
+		case seg.Marker == jpegMarkerAPP1 && bytes.HasPrefix(p, exifSignature):
+			report.addBlock("EXIF")
+			analyzeEXIF(p[len(exifSignature):], report)
+		case seg.Marker == jpegMarkerAPP1 && bytes.HasPrefix(p, xmpSignature):
+			report.addBlock("XMP")
+			analyzeXMP(p[len(xmpSignature):], report)
+		case seg.Marker == jpegMarkerAPP1 && bytes.HasPrefix(p, xmpExtensionSignature):
+			report.addBlock("XMP (расширенный)")
+		case seg.Marker == jpegMarkerAPP2 && bytes.HasPrefix(p, []byte("ICC_PROFILE\x00")):
+			report.addBlock("ICC-профиль")
+		case seg.Marker == jpegMarkerAPP2 && bytes.HasPrefix(p, []byte("MPF\x00")):
+			// Multi-Picture Format: дополнительные изображения (превью) хранятся после EOI.
+			report.Thumbnails++
+			report.addBlock("MPF (дополнительные изображения)")
+		case seg.Marker == jpegMarkerAPP11 && bytes.HasPrefix(p, []byte("JP")):
+			// JUMBF-контейнер. Манифесты C2PA хранятся в JUMBF-блоках с меткой "c2pa".
+			if bytes.Contains(p, []byte("c2pa")) {
+				report.C2PA = true
+				report.addBlock("C2PA (Content Credentials)")
+			} else {
+				report.addBlock("JUMBF")
+			}
+		case seg.Marker == jpegMarkerAPP13 && bytes.HasPrefix(p, photoshopSignature):
+			report.addBlock("IPTC/Photoshop")
+			analyzePhotoshopResources(p[len(photoshopSignature):], report)
+		case seg.Marker == jpegMarkerCOM:
+			report.addBlock("Комментарий (COM)")
+			report.addUnique(&report.Comments, string(p))
+		case seg.Marker == jpegMarkerAPP14:
+			// Adobe APP14 содержит только флаги цветового преобразования.
+		case seg.Marker > jpegMarkerAPP0 && seg.Marker <= jpegMarkerAPP15:
+			report.addBlock(fmt.Sprintf("APP%d (данные производителя)", seg.Marker-jpegMarkerAPP0))
+		}
+	}
+	if end, err := jpegDataEnd(data); err == nil && end < len(data) {
+		report.addBlock(fmt.Sprintf("Данные после конца изображения (%d байт)", len(data)-end))
+	}
+}
+
+// analyzeEXIF добавляет в отчет сведения из TIFF-структуры EXIF.
+func analyzeEXIF(tiff []byte, report *MetadataReport) {
+	ex, err := parseEXIF(tiff)
+	if err != nil {
+		return
+	}
+	if lat, lon, ok := ex.GPSCoordinates(); ok {
+		report.GPS = &GPSLocation{Latitude: lat, Longitude: lon}
+		if alt, ok := ex.GPSAltitude(); ok {
+			report.GPS.Altitude = &alt
+		}
+	}
+	if v := ex.stringValue(findEntry(ex.IFD0, exifTagMake)); v != "" {
+		report.CameraMake = v
+	}
+	if v := ex.stringValue(findEntry(ex.IFD0, exifTagModel)); v != "" {
+		report.CameraModel = v
+	}
+	report.addUnique(&report.Software, ex.stringValue(findEntry(ex.IFD0, exifTagSoftware)))
+	report.addUnique(&report.Authors, ex.stringValue(findEntry(ex.IFD0, exifTagArtist)))
+	report.addUnique(&report.Authors, ex.stringValue(findEntry(ex.IFD0, exifTagCopyright)))
+	report.addUnique(&report.Authors, ex.stringValue(findEntry(ex.Exif, exifTagOwnerName)))
+	report.addUnique(&report.SerialNumbers, ex.stringValue(findEntry(ex.Exif, exifTagBodySerialNumber)))
+	if v := ex.stringValue(findEntry(ex.Exif, exifTagLensSerialNumber)); v != "" {
+		report.addUnique(&report.SerialNumbers, "объектив: "+v)
+	}
+	report.addTimestamp("Съемка", ex.stringValue(findEntry(ex.Exif, exifTagDateTimeOriginal)))
+	report.addTimestamp("Оцифровка", ex.stringValue(findEntry(ex.Exif, exifTagDateTimeDigitized)))
+	report.addTimestamp("Изменение", ex.stringValue(findEntry(ex.IFD0, exifTagDateTime)))
+	report.addTimestamp("Дата GPS", ex.stringValue(findEntry(ex.GPS, exifTagGPSDateStamp)))
+	if len(ex.IFD1) > 0 || len(ex.Thumbnail) > 0 {
+		report.Thumbnails++
+		report.addBlock("Миниатюра EXIF")
+	}
+}
+
+// Сигнатуры блоков метаданных.
+var (
+	xmpSignature          = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtensionSignature = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	photoshopSignature    = []byte("Photoshop 3.0\x00")
+)
+
+// Маркеры APPn, используемые при анализе.
+const (
+	jpegMarkerAPP2  = 0xE2 // ICC-профиль, MPF, FlashPix
+	jpegMarkerAPP11 = 0xEB // JUMBF (C2PA)
+	jpegMarkerAPP13 = 0xED // Photoshop IRB / IPTC
+)
+
+// xmpProperties сопоставляет локальные имена свойств XMP с разделами отчета.
+var xmpProperties = map[string]string{
+	"creator":          "author",
+	"rights":           "author",
+	"Artist":           "author",
+	"Author":           "author",
+	"OwnerName":        "author",
+	"CameraOwnerName":  "author",
+	"CreatorTool":      "software",
+	"Software":         "software",
+	"Make":             "make",
+	"Model":            "model",
+	"SerialNumber":     "serial",
+	"BodySerialNumber": "serial",
+	"LensSerialNumber": "serial",
+	"CreateDate":       "time",
+	"ModifyDate":       "time",
+	"MetadataDate":     "time",
+	"DateCreated":      "time",
+	"DateTimeOriginal": "time",
+	"GPSLatitude":      "lat",
+	"GPSLongitude":     "lon",
+	"description":      "comment",
+}
+
+// analyzeXMP разбирает XMP-пакет (RDF/XML) и добавляет найденные свойства в отчет.
+// Свойства в XMP записываются как атрибутами rdf:Description, так и вложенными
+// элементами (в том числе списками rdf:Seq/rdf:Bag/rdf:Alt), поэтому учитываются оба варианта.
+func analyzeXMP(packet []byte, report *MetadataReport) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+	var stack []string // Стек свойств (без служебных элементов rdf:*)
+	var lat, lon string
+
+	apply := func(property, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		switch xmpProperties[property] {
+		case "author":
+			report.addUnique(&report.Authors, value)
+		case "software":
+			report.addUnique(&report.Software, value)
+		case "make":
+			report.CameraMake = value
+		case "model":
+			report.CameraModel = value
+		case "serial":
+			report.addUnique(&report.SerialNumbers, value)
+		case "time":
+			report.addTimestamp("XMP "+property, value)
+		case "lat":
+			lat = value
+		case "lon":
+			lon = value
+		case "comment":
+			report.addUnique(&report.Comments, value)
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break // Конец пакета или поврежденный XML - используем то, что успели разобрать
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				apply(attr.Name.Local, attr.Value)
+			}
+			if t.Name.Space != rdfNamespace {
+				stack = append(stack, t.Name.Local)
+			}
+		case xml.EndElement:
+			if t.Name.Space != rdfNamespace && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				apply(stack[len(stack)-1], string(t))
+			}
+		}
+	}
+
+	if report.GPS == nil && lat != "" && lon != "" {
+		latValue, okLat := parseXMPCoordinate(lat)
+		lonValue, okLon := parseXMPCoordinate(lon)
+		if okLat && okLon {
+			report.GPS = &GPSLocation{Latitude: latValue, Longitude: lonValue}
+		}
+	}
+}
+
+// rdfNamespace - пространство имен RDF, элементы которого являются служебными.
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// parseXMPCoordinate разбирает координату XMP в формате "DDD,MM.mmk" или "DDD,MM,SSk",
+// где k - направление (N, S, E, W).
+func parseXMPCoordinate(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return 0, false
+	}
+	direction := strings.ToUpper(value[len(value)-1:])
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var result float64
+	divisor := 1.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, false
+		}
+		result += n / divisor
+		divisor *= 60
+	}
+	switch direction {
+	case "S", "W":
+		return -result, true
+	case "N", "E":
+		return result, true
+	}
+	return 0, false
+}
+
+// Наборы данных IPTC (запись 2), попадающие в отчет.
+const (
+	iptcDateCreated        = 55
+	iptcTimeCreated        = 60
+	iptcOriginatingProgram = 65
+	iptcByline             = 80
+	iptcCity               = 90
+	iptcCountry            = 101
+	iptcCopyrightNotice    = 116
+	iptcCaption            = 120
+)
+
+// analyzePhotoshopResources разбирает блоки ресурсов Photoshop (8BIM) из APP13:
+// IPTC-NAA (0x0404) и миниатюры (0x0409, 0x040C).
+func analyzePhotoshopResources(data []byte, report *MetadataReport) {
+	forEachPhotoshopResource(data, func(id uint16, body []byte) {
+		switch id {
+		case photoshopResourceIPTC:
+			analyzeIPTC(body, report)
+		case 0x0409, 0x040C:
+			report.Thumbnails++
+			report.addBlock("Миниатюра Photoshop")
+		}
+	})
+}
+
+// photoshopResourceIPTC - идентификатор ресурса Photoshop с записями IPTC-NAA.
+const photoshopResourceIPTC = 0x0404
+
+// forEachPhotoshopResource вызывает fn для каждого блока ресурсов Photoshop (8BIM).
+// Разбор останавливается на первом поврежденном блоке.
+func forEachPhotoshopResource(data []byte, fn func(id uint16, body []byte)) {
+	pos := 0
+	for pos+12 <= len(data) && bytes.Equal(data[pos:pos+4], []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[pos+4:])
+		nameLen := int(data[pos+6])
+		// Имя ресурса - Pascal-строка, выровненная до четной длины (включая байт длины).
+		namePadded := nameLen + 1
+		if namePadded%2 == 1 {
+			namePadded++
+		}
+		sizePos := pos + 6 + namePadded
+		if sizePos+4 > len(data) {
+			return
+		}
+		size := int(binary.BigEndian.Uint32(data[sizePos:]))
+		start := sizePos + 4
+		if size < 0 || start+size > len(data) {
+			return
+		}
+		fn(id, data[start:start+size])
+		pos = start + size
+		if size%2 == 1 {
+			pos++
+		}
+	}
+}
+
+// analyzeIPTC разбирает наборы данных IPTC-IIM и добавляет в отчет авторов,
+// даты, программу и место съемки.
+func analyzeIPTC(data []byte, report *MetadataReport) {
+	var date, clock string
+	complete := forEachIPTCDataset(data, func(record, dataset byte, raw []byte) {
+		value := string(raw)
+		if record == 2 {
+			switch dataset {
+			case iptcByline, iptcCopyrightNotice:
+				report.addUnique(&report.Authors, value)
+			case iptcOriginatingProgram:
+				report.addUnique(&report.Software, value)
+			case iptcDateCreated:
+				date = value
+			case iptcTimeCreated:
+				clock = value
+			case iptcCity, iptcCountry:
+				report.addUnique(&report.Comments, "Место (IPTC): "+value)
+			case iptcCaption:
+				report.addUnique(&report.Comments, value)
+			}
+		}
+	})
+	if complete {
+		report.addTimestamp("IPTC", strings.TrimSpace(date+" "+clock))
+	}
+}
+
+// forEachIPTCDataset вызывает fn для каждого набора данных IPTC-IIM.
+// Возвращает false, если разбор прерван на поврежденном наборе или наборе
+// с расширенной длиной (в метаданных фото они не используются).
+func forEachIPTCDataset(data []byte, fn func(record, dataset byte, value []byte)) bool {
+	pos := 0
+	for pos+5 <= len(data) && data[pos] == 0x1C {
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3:]))
+		if size&0x8000 != 0 || pos+5+size > len(data) {
+			return false
+		}
+		fn(record, dataset, data[pos+5:pos+5+size])
+		pos += 5 + size
+	}
+	return true
+}
+
+// pngTextKeywords сопоставляет ключевые слова текстовых чанков PNG с разделами отчета.
+var pngTextKeywords = map[string]string{
+	"Author":        "author",
+	"Copyright":     "author",
+	"Software":      "software",
+	"Creation Time": "time",
+	"Comment":       "comment",
+	"Description":   "comment",
+	"Title":         "comment",
+	"Source":        "software",
+}
+
+// maxPNGTextSize - ограничение на размер распакованного текстового чанка при анализе.
+const maxPNGTextSize = 1 << 20
+
+// analyzePNGMetadata разбирает чанки PNG: текстовые (tEXt, zTXt, iTXt), eXIf, tIME,
+// iCCP, C2PA (caBX) и приватные чанки.
+func analyzePNGMetadata(data []byte, report *MetadataReport) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return
+	}
+	for _, chunk := range chunks {
+		if pngAllowedChunks[chunk.Type] {
+			continue
+		}
+		report.addBlock(chunk.Type)
+		switch chunk.Type {
+		case "tEXt", "zTXt", "iTXt":
+			keyword, text, ok := decodePNGText(chunk)
+			if !ok {
+				continue
+			}
+			if keyword == "XML:com.adobe.xmp" {
+				analyzeXMP([]byte(text), report)
+				continue
+			}
+			switch pngTextKeywords[keyword] {
+			case "author":
+				report.addUnique(&report.Authors, text)
+			case "software":
+				report.addUnique(&report.Software, text)
+			case "time":
+				report.addTimestamp(keyword, text)
+			default:
+				report.addUnique(&report.Comments, keyword+": "+text)
+			}
+		case "eXIf":
+			analyzeEXIF(chunk.Data, report)
+		case "tIME":
+			if len(chunk.Data) == 7 {
+				year := binary.BigEndian.Uint16(chunk.Data)
+				report.addTimestamp("Изменение (tIME)", fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+					year, chunk.Data[2], chunk.Data[3], chunk.Data[4], chunk.Data[5], chunk.Data[6]))
+			}
+		case "caBX":
+			report.C2PA = true
+		}
+	}
+}
+
+// decodePNGText извлекает ключевое слово и текст из чанков tEXt, zTXt и iTXt.
+func decodePNGText(chunk pngChunk) (keyword, text string, ok bool) {
+	sep := bytes.IndexByte(chunk.Data, 0)
+	if sep <= 0 {
+		return "", "", false
+	}
+	keyword = string(chunk.Data[:sep])
+	rest := chunk.Data[sep+1:]
+	switch chunk.Type {
+	case "tEXt":
+		return keyword, string(rest), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		inflated, err := inflateLimited(rest[1:])
+		return keyword, string(inflated), err == nil
+	case "iTXt":
+		// Флаг сжатия, метод сжатия, тег языка\0, переведенное ключевое слово\0, текст.
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for i := 0; i < 2; i++ {
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return "", "", false
+			}
+			rest = rest[end+1:]
+		}
+		if compressed {
+			inflated, err := inflateLimited(rest)
+			return keyword, string(inflated), err == nil
+		}
+		return keyword, string(rest), true
+	}
+	return "", "", false
+}
+
+// inflateLimited распаковывает zlib-данные, ограничивая размер результата maxPNGTextSize
+// (защита от "zip-бомб" в текстовых чанках).
+func inflateLimited(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxPNGTextSize))
+}
+
+// analyzeGIFMetadata ищет в GIF комментарии, расширения приложений (например, XMP)
+// и данные после завершающего блока.
+func analyzeGIFMetadata(data []byte, report *MetadataReport) {
+	structure, err := scanGIF(data)
+	if err != nil {
+		return
+	}
+	for _, ext := range structure.Extensions {
+		switch ext.Label {
+		case gifLabelComment:
+			report.addBlock("Комментарий GIF")
+			report.addUnique(&report.Comments, string(ext.Data))
+		case gifLabelApplication:
+			if len(ext.Data) < 11 {
+				continue
+			}
+			appID := string(ext.Data[:11])
+			switch {
+			case appID == "NETSCAPE2.0" || appID == "ANIMEXTS1.0":
+				// Счетчик повторов анимации - не метаданные, сохраняется при очистке.
+			case appID == "XMP DataXMP":
+				report.addBlock("XMP")
+				analyzeXMP(ext.Data[11:], report)
+			default:
+				report.addBlock("Расширение приложения " + strings.TrimSpace(appID[:8]))
+			}
+		}
+	}
+	if structure.Trailing > 0 {
+		report.addBlock(fmt.Sprintf("Данные после конца изображения (%d байт)", structure.Trailing))
+	}
+}
+
+// analyzeWebPMetadata разбирает чанки WebP: EXIF, XMP, ICC-профиль
+// и данные после конца RIFF-контейнера.
+func analyzeWebPMetadata(data []byte, report *MetadataReport) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return
+	}
+	for _, chunk := range chunks {
+		switch chunk.FourCC {
+		case "EXIF":
+			report.addBlock("EXIF")
+			analyzeEXIF(bytes.TrimPrefix(chunk.Data, exifSignature), report)
+		case "XMP ":
+			report.addBlock("XMP")
+			analyzeXMP(chunk.Data, report)
+		case "ICCP":
+			report.addBlock("ICC-профиль")
+		case "VP8 ", "VP8L", "VP8X", "ALPH", "ANIM", "ANMF":
+			// Данные изображения и служебные чанки.
+		default:
+			report.addBlock("Чанк WebP " + strings.TrimSpace(chunk.FourCC))
+		}
+	}
+	if end := webpDataEnd(data); end < len(data) {
+		report.addBlock(fmt.Sprintf("Данные после конца изображения (%d байт)", len(data)-end))
+	}
+}
+
+// Теги TIFF, в которых хранятся блоки метаданных других стандартов.
+const (
+	tiffTagXMP       = 0x02BC // XMP-пакет
+	tiffTagIPTC      = 0x83BB // Записи IPTC-NAA
+	tiffTagPhotoshop = 0x8649 // Ресурсы Photoshop (8BIM)
+	tiffTagICC       = 0x8773 // ICC-профиль
+)
+
+// analyzeTIFFMetadata разбирает TIFF-файл: его каталог IFD0 содержит те же теги,
+// что и EXIF в JPEG, а также встроенные XMP, IPTC и ресурсы Photoshop.
+func analyzeTIFFMetadata(data []byte, report *MetadataReport) {
+	ex, err := parseEXIF(data)
+	if err != nil {
+		return
+	}
+	analyzeEXIF(data, report)
+	if len(ex.Exif) > 0 || len(ex.GPS) > 0 {
+		report.addBlock("EXIF")
+	}
+	if e := findEntry(ex.IFD0, tiffTagXMP); e != nil {
+		report.addBlock("XMP")
+		analyzeXMP(e.Value, report)
+	}
+	if e := findEntry(ex.IFD0, tiffTagIPTC); e != nil {
+		report.addBlock("IPTC")
+		analyzeIPTC(e.Value, report)
+	}
+	if e := findEntry(ex.IFD0, tiffTagPhotoshop); e != nil {
+		report.addBlock("Ресурсы Photoshop")
+		analyzePhotoshopResources(e.Value, report)
+	}
+	if findEntry(ex.IFD0, tiffTagICC) != nil {
+		report.addBlock("ICC-профиль")
+	}
+}
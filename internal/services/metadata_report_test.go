@@ -0,0 +1,197 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для сжатия текстового чанка
+	"compress/zlib" // Для чанка zTXt
+	"math"          // Для сравнения координат
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"strings"       // Для длинных значений
+	"testing"       // Для тестов
+)
+
+// testXMPPacket - XMP-пакет со свойствами в атрибутах и во вложенных списках.
+const testXMPPacket = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:exif="http://ns.adobe.com/exif/1.0/"` +
+	` xmp:CreatorTool="Adobe Lightroom 7.0" xmp:CreateDate="2024-05-01T10:00:00" exif:GPSLatitude="59,56.34N" exif:GPSLongitude="30,18.6E">` +
+	`<dc:creator><rdf:Seq><rdf:li>Анна Смирнова</rdf:li></rdf:Seq></dc:creator>` +
+	`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">Дача у озера</rdf:li></rdf:Alt></dc:description>` +
+	`</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+// testMetadataJPEG возвращает JPEG со всеми видами метаданных, которые попадают в отчет.
+func testMetadataJPEG(t *testing.T) []byte {
+	t.Helper()
+	altitude := exifEntry{Tag: exifTagGPSAltitude, Type: exifTypeRational, Count: 1, Value: []byte{0, 0, 0x01, 0x2D, 0, 0, 0, 2}} // 301/2 м
+	exif := testEXIFSegment(
+		[]exifEntry{
+			testASCIIEntry(exifTagMake, "Canon"),
+			testASCIIEntry(exifTagModel, "EOS R5"),
+			testASCIIEntry(exifTagSoftware, "Firmware 1.8.1"),
+			testASCIIEntry(exifTagArtist, "Иван Петров"),
+			testASCIIEntry(exifTagCopyright, "(c) Петров"),
+			testASCIIEntry(exifTagDateTime, "2024:05:02 09:00:00"),
+		},
+		[]exifEntry{
+			testASCIIEntry(exifTagDateTimeOriginal, "2024:05:01 12:34:56"),
+			testASCIIEntry(exifTagOwnerName, "I. Petrov"),
+			testASCIIEntry(exifTagBodySerialNumber, "123456789"),
+			testASCIIEntry(exifTagLensSerialNumber, "L-42"),
+		},
+		append(gpsEXIFEntries(55.7558, -37.6173), altitude),
+	)
+	jfxx := jpegSegment{Marker: jpegMarkerAPP0, Payload: append([]byte("JFXX\x00\x10"), make([]byte, 64)...)}
+	return append(testJPEG(t,
+		exif,
+		jfxx,
+		jpegSegment{Marker: jpegMarkerAPP1, Payload: append(append([]byte{}, xmpSignature...), testXMPPacket...)},
+		testIPTCSegment([2]string{string(rune(iptcByline)), "Photo Agency"}, [2]string{string(rune(iptcCity)), "Москва"}),
+		jpegSegment{Marker: jpegMarkerAPP11, Payload: []byte("JP\x00\x01\x00\x00\x00\x01jumbc2pa manifest")},
+		jpegSegment{Marker: jpegMarkerCOM, Payload: []byte("снято на даче")},
+	), "PK\x03\x04hidden"...)
+}
+
+func TestAnalyzeJPEGMetadata(t *testing.T) {
+	report := analyzeMetadata(testMetadataJPEG(t), "jpeg")
+
+	if report.GPS == nil || math.Abs(report.GPS.Latitude-55.7558) > 1e-6 || math.Abs(report.GPS.Longitude+37.6173) > 1e-6 {
+		t.Errorf("координаты: %+v", report.GPS)
+	} else if report.GPS.Altitude == nil || *report.GPS.Altitude != 150.5 {
+		t.Errorf("высота: %v", report.GPS.Altitude)
+	}
+	if report.CameraMake != "Canon" || report.CameraModel != "EOS R5" {
+		t.Errorf("камера: %q %q", report.CameraMake, report.CameraModel)
+	}
+	lists := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"серийные номера", report.SerialNumbers, []string{"123456789", "объектив: L-42"}},
+		{"даты", report.Timestamps, []string{"Съемка: 2024:05:01 12:34:56", "Изменение: 2024:05:02 09:00:00", "XMP CreateDate: 2024-05-01T10:00:00"}},
+		{"программы", report.Software, []string{"Firmware 1.8.1", "Adobe Lightroom 7.0"}},
+		{"авторы", report.Authors, []string{"Иван Петров", "(c) Петров", "I. Petrov", "Анна Смирнова", "Photo Agency"}},
+		{"комментарии", report.Comments, []string{"Дача у озера", "Место (IPTC): Москва", "снято на даче"}},
+		{"удаленные блоки", report.RemovedBlocks, []string{"EXIF", "XMP", "IPTC/Photoshop", "Миниатюра JFXX", "C2PA (Content Credentials)", "Комментарий (COM)", "Данные после конца изображения (10 байт)"}},
+	}
+	for _, l := range lists {
+		for _, want := range l.want {
+			if !containsString(l.got, want) {
+				t.Errorf("%s: нет %q в %q", l.name, want, l.got)
+			}
+		}
+	}
+	if !report.C2PA || report.Thumbnails != 1 {
+		t.Errorf("C2PA %v, миниатюр %d", report.C2PA, report.Thumbnails)
+	}
+	if !report.HasFindings() {
+		t.Errorf("HasFindings() = false")
+	}
+}
+
+func TestAnalyzePNGMetadata(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("GIMP 2.10"))
+	zw.Close()
+
+	data := testPNG(t,
+		pngChunk{Type: "tEXt", Data: []byte("Author\x00Мария")},
+		pngChunk{Type: "zTXt", Data: append([]byte("Software\x00\x00"), compressed.Bytes()...)},
+		pngChunk{Type: "iTXt", Data: []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00" + testXMPPacket)},
+		pngChunk{Type: "tIME", Data: []byte{0x07, 0xE8, 5, 1, 12, 0, 0}},
+		pngChunk{Type: "caBX", Data: []byte("c2pa")},
+	)
+	report := analyzeMetadata(data, "png")
+	if !containsString(report.Authors, "Мария") || !containsString(report.Authors, "Анна Смирнова") {
+		t.Errorf("авторы: %q", report.Authors)
+	}
+	if !containsString(report.Software, "GIMP 2.10") || !containsString(report.Software, "Adobe Lightroom 7.0") {
+		t.Errorf("программы: %q", report.Software)
+	}
+	if !containsString(report.Timestamps, "Изменение (tIME): 2024-05-01 12:00:00") {
+		t.Errorf("даты: %q", report.Timestamps)
+	}
+	// Координаты XMP в формате "градусы,минуты.доли".
+	if report.GPS == nil || math.Abs(report.GPS.Latitude-59.939) > 1e-6 || math.Abs(report.GPS.Longitude-30.31) > 1e-6 {
+		t.Errorf("координаты XMP: %+v", report.GPS)
+	}
+	for _, block := range []string{"tEXt", "zTXt", "iTXt", "tIME", "caBX"} {
+		if !containsString(report.RemovedBlocks, block) {
+			t.Errorf("нет блока %q: %q", block, report.RemovedBlocks)
+		}
+	}
+	if !report.C2PA {
+		t.Errorf("C2PA не найден")
+	}
+}
+
+func TestProcessImageReportsRemovedMetadata(t *testing.T) {
+	dir := t.TempDir()
+	stored, report, err := ProcessAndSaveData("photo.jpg", testMetadataJPEG(t), dir, DefaultProcessOptions())
+	if err != nil {
+		t.Fatalf("ProcessAndSaveData: %v", err)
+	}
+	if report.Format != "jpeg" || report.GPS == nil || report.CameraModel != "EOS R5" || !containsString(report.Authors, "Иван Петров") {
+		t.Errorf("отчет не содержит найденных метаданных: %+v", report)
+	}
+	if report.GPSKept != nil {
+		t.Errorf("координаты сохранены при точности %q", DefaultProcessOptions().GPSPrecision)
+	}
+
+	// В очищенном файле не остается ничего из перечисленного в отчете.
+	clean, err := os.ReadFile(filepath.Join(dir, stored))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if again := analyzeMetadata(clean, "jpeg"); again.HasFindings() {
+		t.Errorf("в очищенном файле найдены метаданные: %+v", again)
+	}
+
+	// Файл без метаданных дает пустой отчет.
+	_, report, err = ProcessAndSaveData("plain.png", testPNG(t), t.TempDir(), DefaultProcessOptions())
+	if err != nil {
+		t.Fatalf("ProcessAndSaveData: %v", err)
+	}
+	if report.HasFindings() {
+		t.Errorf("метаданные в файле без метаданных: %+v", report)
+	}
+}
+
+func TestMetadataReportAddUnique(t *testing.T) {
+	var r MetadataReport
+	for _, v := range []string{"  Canon ", "Canon", "", "   "} {
+		r.addUnique(&r.Software, v)
+	}
+	if len(r.Software) != 1 || r.Software[0] != "Canon" {
+		t.Errorf("значения %q, ожидалось одно \"Canon\"", r.Software)
+	}
+	r.addUnique(&r.Comments, strings.Repeat("я", maxReportTextLength+50))
+	if got := []rune(r.Comments[0]); len(got) != maxReportTextLength+1 || got[maxReportTextLength] != '…' {
+		t.Errorf("длинное значение не обрезано: %d символов", len(got))
+	}
+}
+
+func TestParseXMPCoordinate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"59,56.34N", 59.939, true},
+		{"30,18,36E", 30.31, true},
+		{"33,52.5S", -33.875, true},
+		{"151,12.6W", -151.21, true},
+		{"59.5N", 0, false},
+		{"59,56.34X", 0, false},
+		{"a,b N", 0, false},
+		{"N", 0, false},
+		{"1,2,3,4N", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseXMPCoordinate(tt.value)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseXMPCoordinate(%q) = %v, %v; ожидалось %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"archive/zip"  // Для чтения и записи контейнера документа
+	"bytes"        // Для сборки архива в памяти
+	"encoding/xml" // Для разбора свойств документа
+	"errors"       // Для ошибок-маркеров
+	"fmt"          // Для форматирования ошибок и отчета
+	"html"         // Для раскодирования сущностей в значениях атрибутов
+	"io"           // Для ограниченного чтения частей архива
+	"path"         // Для расширений и каталогов частей
+	"regexp"       // Для правил обработки частей и атрибутов
+	"sort"         // Для порядка строк отчета
+	"strconv"      // Для нумерации псевдонимов
+	"strings"      // Для работы с именами частей
+)
+
+// Очистка документов Office Open XML (DOCX, XLSX, PPTX).
+//
+// Документ - это ZIP-архив с XML-частями. Архив собирается заново:
+//   - docProps/core.xml и docProps/app.xml заменяются пустыми свойствами (авторы,
+//     организация, шаблон, программа, число ревизий, время редактирования, даты);
+//   - пользовательские свойства (docProps/custom.xml) и миниатюра удаляются вместе
+//     со ссылками на них;
+//   - имена авторов комментариев и исправлений заменяются псевдонимами ("Автор 1"),
+//     их даты - фиксированной датой, учетные записи и идентификаторы сеансов правки
+//     Word (rsid) удаляются;
+//   - встроенные изображения очищаются cleanEmbeddedImage, встроенные документы
+//     Office - рекурсивно;
+//   - у записей архива сбрасываются даты, удаляются дополнительные поля и комментарий.
+// Текст документа, сами комментарии и исправления не меняются.
+
+// ErrInvalidOOXML - архив не удалось разобрать как документ Office.
+var ErrInvalidOOXML = errors.New("некорректный документ Office")
+
+// ErrOOXMLMacros - документ с макросами (DOCM, XLSM, PPTM).
+var ErrOOXMLMacros = errors.New("документы Office с макросами не поддерживаются")
+
+// Ограничения разбора архива (защита от "ZIP-бомб").
+const (
+	ooxmlMaxParts       = 10000     // Максимальное количество частей
+	ooxmlMaxUnpacked    = 256 << 20 // Максимальный суммарный размер распакованных частей, байт
+	ooxmlMaxNestedDepth = 2         // Максимальная вложенность документов (диаграмма в презентации в документе)
+)
+
+// ooxmlZipDate - дата записей архива в формате MS-DOS: 1980-01-01 00:00, минимальная дата.
+const ooxmlZipDate = 1<<5 | 1
+
+// ooxmlFixedDate заменяет даты комментариев и исправлений (атрибуты обязательны не во всех схемах,
+// поэтому они не удаляются, а обезличиваются).
+const ooxmlFixedDate = "2000-01-01T00:00:00Z"
+
+// ooxmlTypes - поддерживаемые типы документов: главная часть, MIME-тип и расширение.
+var ooxmlTypes = []struct {
+	mainPart, contentType, format string
+}{
+	{"word/document.xml", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "docx"},
+	{"xl/workbook.xml", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+	{"ppt/presentation.xml", "application/vnd.openxmlformats-officedocument.presentationml.presentation", "pptx"},
+}
+
+// ooxmlPartRule - правило обработки XML-частей, имена которых соответствуют parts.
+// Имена атрибутов указываются без префикса пространства имен; "*" в конце - любое окончание.
+type ooxmlPartRule struct {
+	parts      *regexp.Regexp
+	anonymize  []string // Атрибуты с именами авторов
+	initials   []string // Атрибуты с инициалами авторов
+	remove     []string // Удаляемые атрибуты (учетные записи, идентификаторы сеансов)
+	dates      []string // Атрибуты с датами
+	elements   []string // Удаляемые элементы (с префиксом, как их записывает Office)
+	authorText bool     // Текст элементов author - имена авторов (комментарии Excel)
+}
+
+var ooxmlPartRules = []ooxmlPartRule{
+	{
+		// Исправления, комментарии и список авторов Word (people.xml).
+		parts:     regexp.MustCompile(`^word/[^/]+\.xml$`),
+		anonymize: []string{"author"},
+		initials:  []string{"initials"},
+		remove:    []string{"rsid*"},
+		dates:     []string{"date", "dateUtc"},
+		elements:  []string{"w:rsids", "w15:presenceInfo"},
+	},
+	{
+		parts:      regexp.MustCompile(`^xl/comments[^/]*\.xml$`),
+		authorText: true,
+	},
+	{
+		parts:     regexp.MustCompile(`^xl/persons/[^/]+\.xml$`),
+		anonymize: []string{"displayName"},
+		remove:    []string{"userId", "providerId"},
+	},
+	{
+		parts: regexp.MustCompile(`^xl/threadedComments/[^/]+\.xml$`),
+		dates: []string{"dT"},
+	},
+	{
+		parts:     regexp.MustCompile(`^xl/revisions/[^/]+\.xml$`),
+		anonymize: []string{"userName"},
+		dates:     []string{"dateTime"},
+	},
+	{
+		// Автор блокировки файла и полный путь к файлу на диске автора.
+		parts:     regexp.MustCompile(`^xl/workbook\.xml$`),
+		anonymize: []string{"userName"},
+		elements:  []string{"x15ac:absPath"},
+	},
+	{
+		parts:     regexp.MustCompile(`^ppt/(commentAuthors|authors)\.xml$`),
+		anonymize: []string{"name"},
+		initials:  []string{"initials"},
+		remove:    []string{"userId", "providerId"},
+	},
+	{
+		parts: regexp.MustCompile(`^ppt/comments/[^/]+\.xml$`),
+		dates: []string{"dt", "created"},
+	},
+}
+
+// Регулярные выражения для переписывания XML без полного разбора: разметка частей
+// сохраняется байт в байт, меняются только значения найденных атрибутов.
+var (
+	ooxmlTagPattern        = regexp.MustCompile(`<[A-Za-z][^<>]*>`)
+	ooxmlAttributePattern  = regexp.MustCompile(`\s+(?:[A-Za-z_][\w.-]*:)?([A-Za-z_][\w.-]*)\s*=\s*("[^"]*"|'[^']*')`)
+	ooxmlAuthorTextPattern = regexp.MustCompile(`(<(?:[\w.-]+:)?author>)([^<]*)(</(?:[\w.-]+:)?author>)`)
+	ooxmlPseudonymPattern  = regexp.MustCompile(`^(Автор \d+|А\d+)$`)
+)
+
+// ooxmlMinimalParts - пустые свойства документа, которыми заменяются исходные.
+var ooxmlMinimalParts = map[string]string{
+	"docProps/core.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\r\n" +
+		`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></cp:coreProperties>`,
+	"docProps/app.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\r\n" +
+		`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"></Properties>`,
+}
+
+// ooxmlPropertyLabels - подписи свойств документа в отчете (комментарии).
+var ooxmlPropertyLabels = map[string]string{
+	"title":         "Заголовок",
+	"subject":       "Тема",
+	"description":   "Описание",
+	"keywords":      "Ключевые слова",
+	"category":      "Категория",
+	"contentStatus": "Статус",
+	"identifier":    "Идентификатор",
+	"language":      "Язык",
+	"version":       "Версия",
+	"revision":      "Ревизия",
+	"Company":       "Организация",
+	"Template":      "Шаблон",
+	"HyperlinkBase": "Базовый адрес ссылок",
+	"TotalTime":     "Время редактирования, мин",
+}
+
+// ooxmlPart - часть документа.
+type ooxmlPart struct {
+	name string
+	data []byte
+}
+
+// ooxmlCleaner - состояние очистки одного документа (и вложенных в него документов).
+type ooxmlCleaner struct {
+	opts     ProcessOptions
+	report   *MetadataReport
+	names    map[string]string // Имя автора -> псевдоним
+	initials map[string]string // Инициалы -> псевдоним
+	removed  map[string]int    // Удаленные блоки для отчета
+	images   int               // Встроенные изображения, в которых были метаданные
+}
+
+// detectOOXMLContentType определяет тип документа Office по содержимому ZIP-архива.
+// Возвращает пустую строку, если архив не является документом Office.
+func detectOOXMLContentType(data []byte) string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	names := make(map[string]bool, len(archive.File))
+	for _, file := range archive.File {
+		names[file.Name] = true
+	}
+	if !names["[Content_Types].xml"] {
+		return ""
+	}
+	for _, typ := range ooxmlTypes {
+		if names[typ.mainPart] {
+			return typ.contentType
+		}
+	}
+	return ""
+}
+
+// ooxmlFormat возвращает формат ("docx", "xlsx", "pptx") по MIME-типу.
+func ooxmlFormat(contentType string) string {
+	for _, typ := range ooxmlTypes {
+		if typ.contentType == contentType {
+			return typ.format
+		}
+	}
+	return ""
+}
+
+// cleanOOXML очищает документ Office и возвращает новый архив и отчет.
+func cleanOOXML(data []byte, contentType string, opts ProcessOptions) ([]byte, *MetadataReport, error) {
+	c := &ooxmlCleaner{
+		opts:     opts,
+		report:   &MetadataReport{Format: ooxmlFormat(contentType)},
+		names:    make(map[string]string),
+		initials: make(map[string]string),
+		removed:  make(map[string]int),
+	}
+	clean, err := c.clean(data, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(c.removed))
+	for name := range c.removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.report.addBlock(fmt.Sprintf("OOXML: %s (%d)", name, c.removed[name]))
+	}
+	if len(c.names) > 0 {
+		c.report.addBlock(fmt.Sprintf("OOXML: авторы комментариев и исправлений (%d)", len(c.names)))
+	}
+	if c.images > 0 {
+		c.report.addBlock(fmt.Sprintf("OOXML: метаданные встроенных изображений (%d)", c.images))
+	}
+	sort.Strings(c.report.Timestamps)
+	return clean, c.report, nil
+}
+
+// readOOXMLParts читает все части архива с проверкой ограничений. Архивы с
+// повторяющимися именами частей отклоняются: разные программы выбрали бы разные копии.
+func readOOXMLParts(data []byte) ([]ooxmlPart, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOOXML, err)
+	}
+	if len(archive.File) > ooxmlMaxParts {
+		return nil, fmt.Errorf("%w: слишком много частей (%d)", ErrInvalidOOXML, len(archive.File))
+	}
+	parts := make([]ooxmlPart, 0, len(archive.File))
+	seen := make(map[string]bool, len(archive.File))
+	var total int64
+	for _, file := range archive.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue // Каталог
+		}
+		key := strings.ToLower(file.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: часть %q встречается дважды", ErrInvalidOOXML, file.Name)
+		}
+		seen[key] = true
+		if file.Flags&0x1 != 0 {
+			return nil, fmt.Errorf("%w: часть %q зашифрована", ErrInvalidOOXML, file.Name)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: часть %q: %v", ErrInvalidOOXML, file.Name, err)
+		}
+		// Объявленному размеру распакованных данных верить нельзя: читаем с ограничением.
+		content, err := io.ReadAll(io.LimitReader(reader, ooxmlMaxUnpacked-total+1))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: часть %q: %v", ErrInvalidOOXML, file.Name, err)
+		}
+		if total += int64(len(content)); total > ooxmlMaxUnpacked {
+			return nil, fmt.Errorf("%w: больше %d МБ после распаковки", ErrInvalidOOXML, ooxmlMaxUnpacked>>20)
+		}
+		parts = append(parts, ooxmlPart{name: file.Name, data: content})
+	}
+	return parts, nil
+}
+
+// clean очищает архив документа. depth - уровень вложенности (встроенные документы).
+func (c *ooxmlCleaner) clean(data []byte, depth int) ([]byte, error) {
+	parts, err := readOOXMLParts(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		// Макросы нельзя просто удалить: тип главной части и расширение файла
+		// тоже пришлось бы менять.
+		if part.name == "[Content_Types].xml" && bytes.Contains(bytes.ToLower(part.data), []byte("macroenabled")) {
+			return nil, ErrOOXMLMacros
+		}
+	}
+
+	// Части, которые удаляются целиком, и ссылки на них.
+	dropped := make(map[string]bool)
+	for _, part := range parts {
+		switch {
+		case part.name == "docProps/custom.xml":
+			c.analyzeCustomProperties(part.data)
+			c.removed["пользовательские свойства"]++
+			dropped[part.name] = true
+		case strings.HasPrefix(part.name, "docProps/thumbnail."):
+			c.report.Thumbnails++
+			c.removed["миниатюра"]++
+			dropped[part.name] = true
+		}
+	}
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	// [Content_Types].xml записывается первым: так его ожидают некоторые программы.
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].name == "[Content_Types].xml" && parts[j].name != "[Content_Types].xml"
+	})
+	for _, part := range parts {
+		if dropped[part.name] {
+			continue
+		}
+		content, err := c.part(part, dropped, depth)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, ModifiedDate: ooxmlZipDate})
+		if err != nil {
+			return nil, fmt.Errorf("не удалось записать документ: %w", err)
+		}
+		if _, err := entry.Write(content); err != nil {
+			return nil, fmt.Errorf("не удалось записать документ: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("не удалось записать документ: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// part возвращает очищенное содержимое части.
+func (c *ooxmlCleaner) part(part ooxmlPart, dropped map[string]bool, depth int) ([]byte, error) {
+	name := part.name
+	switch {
+	case name == "docProps/core.xml" || name == "docProps/app.xml":
+		if !bytes.Equal(part.data, []byte(ooxmlMinimalParts[name])) {
+			c.analyzeProperties(part.data)
+			c.removed["свойства документа ("+path.Base(name)+")"]++
+		}
+		return []byte(ooxmlMinimalParts[name]), nil
+	case name == "[Content_Types].xml" || strings.HasSuffix(name, ".rels"):
+		return removeOOXMLReferences(part.data, dropped), nil
+	case strings.Contains(name, "/media/"):
+		clean, report, err := cleanEmbeddedImage(part.data, c.opts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidOOXML, name, err)
+		}
+		if report != nil && report.HasFindings() {
+			c.images++
+			mergeReport(c.report, report)
+		}
+		return clean, nil
+	case strings.Contains(name, "/embeddings/") && ooxmlNestedDocument(name):
+		if depth >= ooxmlMaxNestedDepth {
+			return nil, fmt.Errorf("%w: слишком глубокая вложенность документов", ErrInvalidOOXML)
+		}
+		clean, err := c.clean(part.data, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("встроенный документ %s: %w", name, err)
+		}
+		return clean, nil
+	}
+	for _, rule := range ooxmlPartRules {
+		if rule.parts.MatchString(name) {
+			return c.rewrite(part.data, rule), nil
+		}
+	}
+	return part.data, nil
+}
+
+// ooxmlNestedDocument сообщает, является ли встроенный объект документом Office
+// (диаграммы Word и PowerPoint хранят данные во встроенных книгах Excel).
+func ooxmlNestedDocument(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".docx", ".xlsx", ".pptx":
+		return true
+	}
+	return false
+}
+
+// analyzeProperties переносит в отчет свойства из core.xml и app.xml.
+func (c *ooxmlCleaner) analyzeProperties(data []byte) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var element string
+	values := make(map[string]string)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element = t.Name.Local
+		case xml.EndElement:
+			element = ""
+		case xml.CharData:
+			if element != "" {
+				values[element] += string(t)
+			}
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	application := strings.TrimSpace(values["Application"] + " " + values["AppVersion"])
+	c.report.addUnique(&c.report.Software, application)
+	for _, key := range keys {
+		value := strings.TrimSpace(values[key])
+		switch key {
+		case "creator", "lastModifiedBy", "Manager":
+			c.report.addUnique(&c.report.Authors, value)
+		case "created":
+			c.report.addTimestamp("Создание", value)
+		case "modified":
+			c.report.addTimestamp("Изменение", value)
+		case "lastPrinted":
+			c.report.addTimestamp("Печать", value)
+		case "Application", "AppVersion":
+		case "TotalTime":
+			if value != "" && value != "0" {
+				c.report.addUnique(&c.report.Comments, ooxmlPropertyLabels[key]+": "+value)
+			}
+		default:
+			if isOOXMLStatistic(key) {
+				continue
+			}
+			label := ooxmlPropertyLabels[key]
+			if label == "" {
+				label = key
+			}
+			if value != "" {
+				c.report.addUnique(&c.report.Comments, label+": "+value)
+			}
+		}
+	}
+}
+
+// isOOXMLStatistic сообщает, является ли свойство app.xml статистикой документа
+// (число страниц, слов и т.п.), его структурой или служебным флагом: это не метаданные автора.
+func isOOXMLStatistic(key string) bool {
+	switch key {
+	case "Pages", "Words", "Characters", "CharactersWithSpaces", "Lines", "Paragraphs",
+		"Slides", "Notes", "HiddenSlides", "MMClips", "PresentationFormat",
+		"HeadingPairs", "TitlesOfParts", "vector", "variant", "lpstr", "i4",
+		"DocSecurity", "ScaleCrop", "LinksUpToDate", "SharedDoc", "HyperlinksChanged":
+		return true
+	}
+	return false
+}
+
+// analyzeCustomProperties переносит в отчет пользовательские свойства (имя и значение).
+func (c *ooxmlCleaner) analyzeCustomProperties(data []byte) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var name, value string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "property" {
+				name, value = "", ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "name" {
+						name = attr.Value
+					}
+				}
+			}
+		case xml.CharData:
+			value += string(t)
+		case xml.EndElement:
+			if t.Name.Local == "property" && name != "" {
+				c.report.addUnique(&c.report.Comments, name+": "+strings.TrimSpace(value))
+			}
+		}
+	}
+}
+
+// removeOOXMLReferences удаляет из [Content_Types].xml и файлов связей (.rels)
+// записи об удаленных частях.
+func removeOOXMLReferences(data []byte, dropped map[string]bool) []byte {
+	if len(dropped) == 0 {
+		return data
+	}
+	return ooxmlTagPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		for _, match := range ooxmlAttributePattern.FindAllSubmatch(tag, -1) {
+			local := string(match[1])
+			if local != "PartName" && local != "Target" {
+				continue
+			}
+			target := strings.TrimPrefix(html.UnescapeString(string(match[2][1:len(match[2])-1])), "/")
+			if dropped[target] {
+				return nil
+			}
+		}
+		return tag
+	})
+}
+
+// rewrite применяет правило к XML-части.
+func (c *ooxmlCleaner) rewrite(data []byte, rule ooxmlPartRule) []byte {
+	for _, element := range rule.elements {
+		pattern := regexp.MustCompile(`(?s)<` + regexp.QuoteMeta(element) + `\b[^>]*?/>|<` + regexp.QuoteMeta(element) + `\b[^>]*>.*?</` + regexp.QuoteMeta(element) + `>`)
+		if n := len(pattern.FindAllIndex(data, -1)); n > 0 {
+			c.removed[ooxmlElementBlocks[element]] += n
+			data = pattern.ReplaceAll(data, nil)
+		}
+	}
+	if rule.authorText {
+		aliases := make(map[string]string)
+		data = ooxmlAuthorTextPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+			parts := ooxmlAuthorTextPattern.FindSubmatch(match)
+			value := html.UnescapeString(string(parts[2]))
+			if strings.HasPrefix(value, "tc=") {
+				return match // Ссылка на цепочку комментариев (threadedComments), а не имя
+			}
+			name := c.pseudonym(c.names, "Автор ", value, true)
+			aliases[strings.TrimSpace(value)] = name
+			return append(append(append([]byte(nil), parts[1]...), html.EscapeString(name)...), parts[3]...)
+		})
+		// Excel начинает текст комментария с имени автора ("Имя:").
+		for value, name := range aliases {
+			if value != name {
+				data = bytes.ReplaceAll(data, []byte(">"+html.EscapeString(value)+":"), []byte(">"+html.EscapeString(name)+":"))
+			}
+		}
+	}
+	return ooxmlTagPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		return ooxmlAttributePattern.ReplaceAllFunc(tag, func(attr []byte) []byte {
+			match := ooxmlAttributePattern.FindSubmatch(attr)
+			local, quoted := string(match[1]), match[2]
+			value := html.UnescapeString(string(quoted[1 : len(quoted)-1]))
+			replace := func(v string) []byte {
+				// Значение заменяется, префикс атрибута и пробелы перед ним сохраняются.
+				return append(attr[:len(attr)-len(quoted):len(attr)-len(quoted)], []byte(`"`+html.EscapeString(v)+`"`)...)
+			}
+			switch {
+			case ooxmlNameMatches(rule.remove, local):
+				c.removed[ooxmlAttributeBlocks(local)]++
+				return nil
+			case ooxmlNameMatches(rule.anonymize, local):
+				return replace(c.pseudonym(c.names, "Автор ", value, true))
+			case ooxmlNameMatches(rule.initials, local):
+				return replace(c.pseudonym(c.initials, "А", value, false))
+			case ooxmlNameMatches(rule.dates, local) && value != ooxmlFixedDate:
+				c.removed["даты комментариев и исправлений"]++
+				return replace(ooxmlFixedDate)
+			}
+			return attr
+		})
+	})
+}
+
+// ooxmlElementBlocks - названия удаленных элементов для отчета.
+var ooxmlElementBlocks = map[string]string{
+	"w:rsids":          "идентификаторы сеансов правки (rsid)",
+	"w15:presenceInfo": "учетные записи авторов",
+	"x15ac:absPath":    "путь к файлу на диске автора",
+}
+
+// ooxmlAttributeBlocks возвращает название удаленного атрибута для отчета.
+func ooxmlAttributeBlocks(local string) string {
+	if strings.HasPrefix(local, "rsid") {
+		return "идентификаторы сеансов правки (rsid)"
+	}
+	return "учетные записи авторов"
+}
+
+// ooxmlNameMatches сообщает, есть ли имя атрибута в списке ("*" в конце - любое окончание).
+func ooxmlNameMatches(names []string, local string) bool {
+	for _, name := range names {
+		if prefix, wildcard := strings.CutSuffix(name, "*"); wildcard && strings.HasPrefix(local, prefix) || name == local {
+			return true
+		}
+	}
+	return false
+}
+
+// pseudonym возвращает псевдоним для значения: одинаковые значения во всех частях
+// документа получают один и тот же псевдоним. Уже обезличенные значения (повторная
+// очистка) и пустые значения не меняются. Если report, исходное имя попадает в отчет.
+func (c *ooxmlCleaner) pseudonym(known map[string]string, prefix, value string, report bool) string {
+	value = strings.TrimSpace(value)
+	if value == "" || ooxmlPseudonymPattern.MatchString(value) {
+		return value
+	}
+	if alias, ok := known[value]; ok {
+		return alias
+	}
+	alias := prefix + strconv.Itoa(len(known)+1)
+	known[value] = alias
+	if report {
+		c.report.addUnique(&c.report.Authors, value)
+	}
+	return alias
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"archive/zip" // Для сборки и чтения документов
+	"bytes"       // Для поиска в частях документа
+	"errors"      // Для проверки ошибок-маркеров
+	"strings"     // Для проверки отчета
+	"testing"     // Для тестов
+	"time"        // Для дат записей архива
+)
+
+// testOOXML собирает документ Office так, как его записывает Office: с датами записей,
+// дополнительными полями и комментарием архива.
+func testOOXML(t *testing.T, parts ...testZipEntry) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w := zip.NewWriter(&out)
+	for _, p := range parts {
+		header := &zip.FileHeader{
+			Name:     p.name,
+			Method:   zip.Deflate,
+			Flags:    p.flags,
+			Modified: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			Extra:    []byte{0x0A, 0x00, 0x04, 0x00, 1, 2, 3, 4},
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("CreateHeader(%s): %v", p.name, err)
+		}
+		f.Write(p.data)
+	}
+	w.SetComment("Иван Петров, ООО Ромашка")
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip.Close: %v", err)
+	}
+	return out.Bytes()
+}
+
+// testDOCXParts - части документа Word со всеми видами метаданных, которые удаляет очистка.
+func testDOCXParts(t *testing.T) []testZipEntry {
+	jpegWithEXIF := testJPEG(t, testEXIFSegment([]exifEntry{testASCIIEntry(exifTagMake, "Canon")}, nil, nil))
+	pngWithText := testPNG(t, pngChunk{Type: "tEXt", Data: []byte("Author\x00Иван Петров")})
+	return []testZipEntry{
+		{name: "[Content_Types].xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="jpeg" ContentType="image/jpeg"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+			`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+			`<Override PartName="/docProps/app.xml" ContentType="application/vnd.openxmlformats-officedocument.extended-properties+xml"/>` +
+			`<Override PartName="/docProps/custom.xml" ContentType="application/vnd.openxmlformats-officedocument.custom-properties+xml"/>` +
+			`</Types>`)},
+		{name: "_rels/.rels", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+			`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties" Target="docProps/app.xml"/>` +
+			`<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties" Target="docProps/custom.xml"/>` +
+			`<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/thumbnail" Target="docProps/thumbnail.jpeg"/>` +
+			`</Relationships>`)},
+		{name: "docProps/core.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">` +
+			`<dc:title>Годовой отчет</dc:title><dc:creator>Иван Петров</dc:creator><cp:lastModifiedBy>Мария Сидорова</cp:lastModifiedBy>` +
+			`<cp:revision>12</cp:revision><dcterms:created>2024-05-01T10:00:00Z</dcterms:created><dcterms:modified>2024-05-02T11:00:00Z</dcterms:modified>` +
+			`</cp:coreProperties>`)},
+		{name: "docProps/app.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties">` +
+			`<Template>Normal.dotm</Template><TotalTime>42</TotalTime><Pages>3</Pages><Application>Microsoft Office Word</Application>` +
+			`<Company>ООО Ромашка</Company><AppVersion>16.0000</AppVersion></Properties>`)},
+		{name: "docProps/custom.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">` +
+			`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="Проект"><vt:lpwstr>Секретный проект</vt:lpwstr></property></Properties>`)},
+		{name: "docProps/thumbnail.jpeg", data: testJPEG(t)},
+		{name: "word/document.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p w:rsidR="00A1B2C3" w:rsidRDefault="00D4E5F6"><w:r><w:t>Текст документа</w:t></w:r></w:p>` +
+			`<w:ins w:id="1" w:author="Иван Петров" w:date="2024-05-01T10:05:00Z"><w:r><w:t>вставка</w:t></w:r></w:ins>` +
+			`<w:del w:id="2" w:author="Мария Сидорова" w:date="2024-05-01T10:06:00Z"><w:r><w:delText>удаление</w:delText></w:r></w:del>` +
+			`</w:body></w:document>`)},
+		{name: "word/comments.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:comments xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:comment w:id="0" w:author="Мария Сидорова" w:initials="МС" w:date="2024-05-01T10:07:00Z"><w:p><w:r><w:t>Проверить цифры</w:t></w:r></w:p></w:comment>` +
+			`</w:comments>`)},
+		{name: "word/settings.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w:settings xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:zoom w:percent="100"/>` +
+			`<w:rsids><w:rsidRoot w:val="00A1B2C3"/><w:rsid w:val="00D4E5F6"/></w:rsids></w:settings>`)},
+		{name: "word/people.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<w15:people xmlns:w15="http://schemas.microsoft.com/office/word/2012/wordml"><w15:person w15:author="Иван Петров">` +
+			`<w15:presenceInfo w15:providerId="AD" w15:userId="S::ivan.petrov@romashka.ru::1234"/></w15:person></w15:people>`)},
+		{name: "word/media/image1.jpeg", data: jpegWithEXIF},
+		{name: "word/media/image2.png", data: pngWithText},
+	}
+}
+
+// ooxmlPartsMap возвращает части документа по именам.
+func ooxmlPartsMap(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	parts, err := readOOXMLParts(data)
+	if err != nil {
+		t.Fatalf("readOOXMLParts: %v", err)
+	}
+	m := make(map[string][]byte, len(parts))
+	for _, p := range parts {
+		m[p.name] = p.data
+	}
+	return m
+}
+
+func TestCleanOOXML(t *testing.T) {
+	original := testOOXML(t, testDOCXParts(t)...)
+	policy := newVerifyPolicy(DefaultProcessOptions())
+	findings, err := verifyOOXML(original, policy, 0)
+	if err != nil {
+		t.Fatalf("verifyOOXML исходного документа: %v", err)
+	}
+	// Проверка исходного документа находит каждый вид метаданных.
+	for _, want := range []string{
+		"комментарий архива",
+		"даты или дополнительные поля записей архива",
+		"свойства документа (docProps/core.xml)",
+		"свойства документа (docProps/app.xml)",
+		"пользовательские свойства документа",
+		"миниатюра документа",
+		"авторы, даты или учетные записи в word/document.xml",
+		"авторы, даты или учетные записи в word/comments.xml",
+		"авторы, даты или учетные записи в word/settings.xml",
+		"авторы, даты или учетные записи в word/people.xml",
+		"word/media/image1.jpeg: встроенный JPEG: ",
+		"word/media/image2.png: встроенный PNG: ",
+	} {
+		found := false
+		for _, f := range findings {
+			found = found || strings.HasPrefix(f, want)
+		}
+		if !found {
+			t.Errorf("проверка исходного документа не нашла %q: %q", want, findings)
+		}
+	}
+
+	clean, report, err := cleanOOXML(original, ooxmlTypes[0].contentType, DefaultProcessOptions())
+	if err != nil {
+		t.Fatalf("cleanOOXML: %v", err)
+	}
+	findings, err = verifyOOXML(clean, policy, 0)
+	if err != nil || len(findings) > 0 {
+		t.Errorf("verifyOOXML: %v %q", err, findings)
+	}
+
+	t.Run("отчет", func(t *testing.T) {
+		if report.Format != "docx" {
+			t.Errorf("формат %q", report.Format)
+		}
+		for _, want := range []string{"Иван Петров", "Мария Сидорова"} {
+			if !containsString(report.Authors, want) {
+				t.Errorf("нет автора %q: %q", want, report.Authors)
+			}
+		}
+		for _, want := range []string{"Организация: ООО Ромашка", "Шаблон: Normal.dotm", "Время редактирования, мин: 42", "Заголовок: Годовой отчет", "Ревизия: 12", "Проект: Секретный проект"} {
+			if !containsString(report.Comments, want) {
+				t.Errorf("нет свойства %q: %q", want, report.Comments)
+			}
+		}
+		if !containsString(report.Software, "Microsoft Office Word 16.0000") {
+			t.Errorf("программа: %q", report.Software)
+		}
+		if len(report.Timestamps) != 2 || report.Thumbnails != 1 {
+			t.Errorf("даты %q, миниатюр %d", report.Timestamps, report.Thumbnails)
+		}
+		for _, want := range []string{"пользовательские свойства (1)", "миниатюра (1)", "идентификаторы сеансов правки (rsid) (3)", "учетные записи авторов (1)", "метаданные встроенных изображений (2)"} {
+			if !containsString(report.RemovedBlocks, "OOXML: "+want) {
+				t.Errorf("нет блока %q: %q", want, report.RemovedBlocks)
+			}
+		}
+		for _, unwanted := range []string{"Pages: 3", "Страницы: 3"} {
+			if containsString(report.Comments, unwanted) {
+				t.Errorf("статистика документа в отчете: %q", report.Comments)
+			}
+		}
+	})
+
+	parts := ooxmlPartsMap(t, clean)
+	t.Run("свойства и миниатюра", func(t *testing.T) {
+		for _, name := range []string{"docProps/custom.xml", "docProps/thumbnail.jpeg"} {
+			if _, ok := parts[name]; ok {
+				t.Errorf("часть %s не удалена", name)
+			}
+		}
+		for _, name := range []string{"docProps/core.xml", "docProps/app.xml"} {
+			if string(parts[name]) != ooxmlMinimalParts[name] {
+				t.Errorf("%s: %s", name, parts[name])
+			}
+		}
+		for _, name := range []string{"[Content_Types].xml", "_rels/.rels"} {
+			if bytes.Contains(parts[name], []byte("custom.xml")) || bytes.Contains(parts[name], []byte("thumbnail")) {
+				t.Errorf("%s ссылается на удаленные части: %s", name, parts[name])
+			}
+			if !bytes.Contains(parts[name], []byte("word/document.xml")) {
+				t.Errorf("%s: удалена ссылка на главную часть", name)
+			}
+		}
+	})
+
+	t.Run("авторы комментариев и исправлений", func(t *testing.T) {
+		for name, data := range parts {
+			for _, leak := range []string{"Иван Петров", "Мария Сидорова", "МС", "romashka", "rsid", "2024-05-01"} {
+				if bytes.Contains(data, []byte(leak)) {
+					t.Errorf("%s содержит %q", name, leak)
+				}
+			}
+		}
+		// Один и тот же автор получает один псевдоним во всех частях.
+		document, comments := string(parts["word/document.xml"]), string(parts["word/comments.xml"])
+		for _, want := range []string{`w:author="Автор 1"`, `w:author="Автор 2"`, `w:date="` + ooxmlFixedDate + `"`, "<w:t>Текст документа</w:t>", "<w:delText>удаление</w:delText>"} {
+			if !strings.Contains(document, want) {
+				t.Errorf("word/document.xml не содержит %q: %s", want, document)
+			}
+		}
+		if !strings.Contains(comments, `w:author="Автор 2" w:initials="А1"`) || !strings.Contains(comments, "Проверить цифры") {
+			t.Errorf("word/comments.xml: %s", comments)
+		}
+		if !strings.Contains(string(parts["word/settings.xml"]), `<w:zoom w:percent="100"/>`) {
+			t.Errorf("word/settings.xml: удалено лишнее: %s", parts["word/settings.xml"])
+		}
+	})
+
+	t.Run("встроенные изображения", func(t *testing.T) {
+		originalParts := ooxmlPartsMap(t, original)
+		checkSamePixels(t, originalParts["word/media/image1.jpeg"], parts["word/media/image1.jpeg"])
+		checkSamePNGPixels(t, originalParts["word/media/image2.png"], parts["word/media/image2.png"])
+		for _, name := range []string{"word/media/image1.jpeg", "word/media/image2.png"} {
+			if findings, err := verifyEmbeddedImage(parts[name], policy); err != nil || len(findings) > 0 {
+				t.Errorf("%s: %v %q", name, err, findings)
+			}
+		}
+	})
+
+	t.Run("записи архива", func(t *testing.T) {
+		archive, err := zip.NewReader(bytes.NewReader(clean), int64(len(clean)))
+		if err != nil {
+			t.Fatalf("zip.NewReader: %v", err)
+		}
+		if archive.Comment != "" {
+			t.Errorf("комментарий архива: %q", archive.Comment)
+		}
+		if archive.File[0].Name != "[Content_Types].xml" {
+			t.Errorf("первая часть %q", archive.File[0].Name)
+		}
+		for _, f := range archive.File {
+			if f.ModifiedDate != ooxmlZipDate || f.ModifiedTime != 0 || len(f.Extra) > 0 {
+				t.Errorf("%s: дата %d %d, дополнительные поля % X", f.Name, f.ModifiedDate, f.ModifiedTime, f.Extra)
+			}
+		}
+		if got := detectOOXMLContentType(clean); got != ooxmlTypes[0].contentType {
+			t.Errorf("тип очищенного документа %q", got)
+		}
+	})
+
+	t.Run("повторная очистка", func(t *testing.T) {
+		again, report, err := cleanOOXML(clean, ooxmlTypes[0].contentType, DefaultProcessOptions())
+		if err != nil {
+			t.Fatalf("cleanOOXML: %v", err)
+		}
+		if report.HasFindings() {
+			t.Errorf("в очищенном документе найдены метаданные: %+v", report)
+		}
+		if !bytes.Equal(again, clean) {
+			t.Errorf("повторная очистка изменила документ")
+		}
+	})
+}
+
+func TestCleanOOXMLSpreadsheetAndPresentation(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		parts             []testZipEntry
+		want              map[string][]string // Часть -> ожидаемые фрагменты
+	}{
+		{
+			name:        "XLSX",
+			contentType: ooxmlTypes[1].contentType,
+			parts: []testZipEntry{
+				{name: "[Content_Types].xml", data: []byte(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+				{name: "xl/workbook.xml", data: []byte(`<workbook><fileSharing userName="Иван Петров"/><x15ac:absPath xmlns:x15ac="x" url="C:\Users\ivan\Documents\"/><sheets/></workbook>`)},
+				{name: "xl/comments1.xml", data: []byte(`<comments><authors><author>Иван Петров</author><author>tc={0001}</author></authors>` +
+					`<commentList><comment ref="A1" authorId="0"><text><r><t>Иван Петров:</t></r><r><t> проверить</t></r></text></comment></commentList></comments>`)},
+				{name: "xl/persons/person.xml", data: []byte(`<personList><person displayName="Мария Сидорова" id="{1}" userId="maria@romashka.ru" providerId="AD"/></personList>`)},
+				{name: "xl/threadedComments/threadedComment1.xml", data: []byte(`<ThreadedComments><threadedComment ref="A1" dT="2024-05-01T10:00:00.00" personId="{1}"/></ThreadedComments>`)},
+			},
+			want: map[string][]string{
+				"xl/workbook.xml":                          {`<fileSharing userName="Автор 1"/>`, "<sheets/>"},
+				"xl/comments1.xml":                         {"<author>Автор 1</author>", "<author>tc={0001}</author>", "<t>Автор 1:</t>", "<t> проверить</t>"},
+				"xl/persons/person.xml":                    {`displayName="Автор 2" id="{1}"/>`},
+				"xl/threadedComments/threadedComment1.xml": {`dT="` + ooxmlFixedDate + `"`},
+			},
+		},
+		{
+			name:        "PPTX",
+			contentType: ooxmlTypes[2].contentType,
+			parts: []testZipEntry{
+				{name: "[Content_Types].xml", data: []byte(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+				{name: "ppt/presentation.xml", data: []byte(`<p:presentation xmlns:p="p"/>`)},
+				{name: "ppt/commentAuthors.xml", data: []byte(`<p:cmAuthorLst xmlns:p="p"><p:cmAuthor id="0" name="Иван Петров" initials="ИП" lastIdx="1" clrIdx="0"/></p:cmAuthorLst>`)},
+				{name: "ppt/comments/comment1.xml", data: []byte(`<p:cmLst xmlns:p="p"><p:cm authorId="0" dt="2024-05-01T10:00:00.000"><p:text>Слайд 2</p:text></p:cm></p:cmLst>`)},
+			},
+			want: map[string][]string{
+				"ppt/commentAuthors.xml":    {`name="Автор 1" initials="А1" lastIdx="1"`},
+				"ppt/comments/comment1.xml": {`dt="` + ooxmlFixedDate + `"`, "<p:text>Слайд 2</p:text>"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testOOXML(t, tt.parts...)
+			if got := detectOOXMLContentType(data); got != tt.contentType {
+				t.Fatalf("тип %q", got)
+			}
+			clean, report, err := cleanOOXML(data, tt.contentType, DefaultProcessOptions())
+			if err != nil {
+				t.Fatalf("cleanOOXML: %v", err)
+			}
+			parts := ooxmlPartsMap(t, clean)
+			for name, fragments := range tt.want {
+				for _, fragment := range fragments {
+					if !bytes.Contains(parts[name], []byte(fragment)) {
+						t.Errorf("%s не содержит %q: %s", name, fragment, parts[name])
+					}
+				}
+			}
+			for name, data := range parts {
+				for _, leak := range []string{"Иван Петров", "Мария Сидорова", "romashka", `C:\Users`, "2024-05-01"} {
+					if bytes.Contains(data, []byte(leak)) {
+						t.Errorf("%s содержит %q", name, leak)
+					}
+				}
+			}
+			if !containsString(report.Authors, "Иван Петров") {
+				t.Errorf("авторы %q", report.Authors)
+			}
+			if findings, err := verifyOOXML(clean, newVerifyPolicy(DefaultProcessOptions()), 0); err != nil || len(findings) > 0 {
+				t.Errorf("verifyOOXML: %v %q", err, findings)
+			}
+		})
+	}
+}
+
+func TestCleanOOXMLNestedDocument(t *testing.T) {
+	xlsx := testOOXML(t,
+		testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+		testZipEntry{name: "xl/workbook.xml", data: []byte(`<workbook/>`)},
+		testZipEntry{name: "docProps/core.xml", data: []byte(`<cp:coreProperties xmlns:cp="cp"><dc:creator xmlns:dc="dc">Иван Петров</dc:creator></cp:coreProperties>`)},
+	)
+	docx := testOOXML(t,
+		testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+		testZipEntry{name: "word/document.xml", data: []byte(`<w:document xmlns:w="w"/>`)},
+		testZipEntry{name: "word/embeddings/Microsoft_Excel_Worksheet.xlsx", data: xlsx},
+	)
+	clean, report, err := cleanOOXML(docx, ooxmlTypes[0].contentType, DefaultProcessOptions())
+	if err != nil {
+		t.Fatalf("cleanOOXML: %v", err)
+	}
+	if !containsString(report.Authors, "Иван Петров") {
+		t.Errorf("автор встроенной книги не попал в отчет: %q", report.Authors)
+	}
+	nested := ooxmlPartsMap(t, ooxmlPartsMap(t, clean)["word/embeddings/Microsoft_Excel_Worksheet.xlsx"])
+	if string(nested["docProps/core.xml"]) != ooxmlMinimalParts["docProps/core.xml"] {
+		t.Errorf("свойства встроенной книги не очищены: %s", nested["docProps/core.xml"])
+	}
+	if findings, err := verifyOOXML(clean, newVerifyPolicy(DefaultProcessOptions()), 0); err != nil || len(findings) > 0 {
+		t.Errorf("verifyOOXML: %v %q", err, findings)
+	}
+	// Исходный документ: проверка находит свойства во встроенной книге.
+	findings, err := verifyOOXML(docx, newVerifyPolicy(DefaultProcessOptions()), 0)
+	if err != nil || !containsString(findings, "word/embeddings/Microsoft_Excel_Worksheet.xlsx: свойства документа (docProps/core.xml)") {
+		t.Errorf("verifyOOXML исходного документа: %v %q", err, findings)
+	}
+
+	// Слишком глубокая вложенность отклоняется.
+	deep := docx
+	for i := 0; i < ooxmlMaxNestedDepth; i++ {
+		deep = testOOXML(t,
+			testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+			testZipEntry{name: "word/document.xml", data: []byte(`<w:document xmlns:w="w"/>`)},
+			testZipEntry{name: "word/embeddings/inner.docx", data: deep},
+		)
+	}
+	if _, _, err := cleanOOXML(deep, ooxmlTypes[0].contentType, DefaultProcessOptions()); !errors.Is(err, ErrInvalidOOXML) {
+		t.Errorf("глубокая вложенность: ожидалась ErrInvalidOOXML, получено %v", err)
+	}
+}
+
+func TestCleanOOXMLRejects(t *testing.T) {
+	valid := testOOXML(t, testDOCXParts(t)...)
+	brokenPNG := append(append([]byte{}, pngSignature...), "not really a png"...)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"не ZIP", []byte("PK\x03\x04 not really a zip"), ErrInvalidOOXML},
+		{"обрезанный архив", valid[:len(valid)/2], ErrInvalidOOXML},
+		{"повреждены сжатые данные", corruptZipData(t, valid, "word/document.xml"), ErrInvalidOOXML},
+		{"повторяющиеся части", testZip(t,
+			testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+			testZipEntry{name: "word/document.xml", data: []byte(`<w:document/>`)},
+			testZipEntry{name: "Word/Document.xml", data: []byte(`<w:document>другой текст</w:document>`)},
+		), ErrInvalidOOXML},
+		{"зашифрованная часть", testZip(t,
+			testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+			testZipEntry{name: "word/document.xml", data: []byte(`<w:document/>`), flags: 0x1},
+		), ErrInvalidOOXML},
+		{"поврежденное встроенное изображение", testZip(t,
+			testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types/>`)},
+			testZipEntry{name: "word/document.xml", data: []byte(`<w:document/>`)},
+			testZipEntry{name: "word/media/image1.png", data: brokenPNG},
+		), ErrInvalidOOXML},
+		{"макросы", testZip(t,
+			testZipEntry{name: "[Content_Types].xml", data: []byte(`<Types><Override PartName="/word/document.xml" ContentType="application/vnd.ms-word.document.macroEnabled.main+xml"/></Types>`)},
+			testZipEntry{name: "word/document.xml", data: []byte(`<w:document/>`)},
+			testZipEntry{name: "word/vbaProject.bin", data: []byte("VBA")},
+		), ErrOOXMLMacros},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, report, err := cleanOOXML(tt.data, ooxmlTypes[0].contentType, DefaultProcessOptions())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась %v, получено %v", tt.want, err)
+			}
+			if clean != nil || report != nil {
+				t.Errorf("при ошибке возвращен результат")
+			}
+			if _, err := verifyOOXML(tt.data, newVerifyPolicy(DefaultProcessOptions()), 0); err == nil && tt.want != ErrOOXMLMacros {
+				t.Errorf("verifyOOXML принял поврежденный документ")
+			}
+		})
+	}
+}
+
+// corruptZipData портит сжатые данные части name, не меняя структуру архива.
+func corruptZipData(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			t.Fatalf("DataOffset: %v", err)
+		}
+		out := append([]byte{}, data...)
+		for i := offset; i < offset+int64(f.CompressedSize64); i++ {
+			out[i] ^= 0x5A
+		}
+		return out
+	}
+	t.Fatalf("нет части %s", name)
+	return nil
+}
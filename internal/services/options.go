@@ -0,0 +1,185 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"fmt"        // Для форматирования ошибок
+	"image/jpeg" // Для качества JPEG по умолчанию
+	"image/png"  // Для уровней сжатия PNG
+	"strconv"    // Для разбора качества JPEG
+	"strings"    // Для нормализации значений настроек
+)
+
+// CleanMode - способ очистки файлов форматов, для которых поддерживается
+// удаление метаданных без перекодирования (JPEG, PNG).
+type CleanMode string
+
+const (
+	// CleanModeLossless - удаление сегментов/чанков метаданных без перекодирования.
+	// Данные изображения копируются байт в байт, качество не теряется.
+	CleanModeLossless CleanMode = "lossless"
+	// CleanModeReencode - полное декодирование и повторное кодирование.
+	// Может терять качество, но гарантирует, что из исходного файла не переносится
+	// ничего, кроме пикселей (режим для "параноидальных" инсталляций).
+	CleanModeReencode CleanMode = "reencode"
+)
+
+// ParseCleanMode разбирает строковое значение режима очистки
+// (например, из переменных окружения JPEG_CLEAN_MODE и PNG_CLEAN_MODE).
+func ParseCleanMode(value string) (CleanMode, error) {
+	switch mode := CleanMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case CleanModeLossless, CleanModeReencode:
+		return mode, nil
+	}
+	return "", fmt.Errorf("неизвестный режим очистки: %q (допустимо: %s, %s)", value, CleanModeLossless, CleanModeReencode)
+}
+
+// OutputPolicy - политика выбора формата сохранения очищенного изображения.
+type OutputPolicy string
+
+const (
+	// OutputPolicyKeep - сохранять в исходном формате (WebP, BMP и TIFF
+	// конвертируются в ProcessOptions.ConvertFormat).
+	OutputPolicyKeep OutputPolicy = "keep"
+	// OutputPolicyPNG - сохранять все изображения в PNG (анимация GIF не сохраняется).
+	OutputPolicyPNG OutputPolicy = "png"
+	// OutputPolicyJPEG - сохранять все изображения в JPEG с качеством ProcessOptions.JPEGQuality.
+	OutputPolicyJPEG OutputPolicy = "jpeg"
+)
+
+// ParseOutputPolicy разбирает строковое значение политики формата сохранения
+// (переменная окружения OUTPUT_POLICY или поле формы загрузки).
+func ParseOutputPolicy(value string) (OutputPolicy, error) {
+	switch policy := OutputPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case OutputPolicyKeep, OutputPolicyPNG, OutputPolicyJPEG:
+		return policy, nil
+	case "jpg":
+		return OutputPolicyJPEG, nil
+	}
+	return "", fmt.Errorf("неизвестная политика формата: %q (допустимо: %s, %s, %s)", value, OutputPolicyKeep, OutputPolicyPNG, OutputPolicyJPEG)
+}
+
+// ParseJPEGQuality разбирает качество JPEG (целое число от 1 до 100).
+func ParseJPEGQuality(value string) (int, error) {
+	quality, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || quality < 1 || quality > 100 {
+		return 0, fmt.Errorf("некорректное качество JPEG: %q (допустимо от 1 до 100)", value)
+	}
+	return quality, nil
+}
+
+// pngCompressionLevels сопоставляет названия уровней сжатия PNG со значениями image/png.
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// ParsePNGCompression разбирает уровень сжатия PNG: default, none, fast или best.
+func ParsePNGCompression(value string) (png.CompressionLevel, error) {
+	if level, ok := pngCompressionLevels[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return level, nil
+	}
+	return 0, fmt.Errorf("неизвестный уровень сжатия PNG: %q (допустимо: default, none, fast, best)", value)
+}
+
+// ProcessOptions - параметры обработки загружаемого изображения.
+type ProcessOptions struct {
+	JPEGMode CleanMode // Способ очистки JPEG
+	PNGMode  CleanMode // Способ очистки PNG (lossless сохраняет анимацию APNG)
+
+	// ConvertFormat - формат сохранения для WebP, BMP и TIFF, которые
+	// не сохраняются в исходном виде.
+	ConvertFormat OutputFormat
+
+	// Политика сохранения. Lossless-очистка JPEG и PNG применяется, только если
+	// формат сохранения совпадает с исходным (и для JPEG не выбран прогрессивный режим);
+	// качество и уровень сжатия влияют лишь на перекодируемые изображения.
+	OutputPolicy    OutputPolicy         // Исходный формат, PNG или JPEG
+	JPEGQuality     int                  // Качество JPEG при кодировании (1-100)
+	JPEGProgressive bool                 // Записывать JPEG в прогрессивном режиме
+	PNGCompression  png.CompressionLevel // Уровень сжатия PNG при кодировании
+
+	// Ограничения на размеры изображения, проверяемые до декодирования (0 - без ограничения).
+	MaxWidth  int   // Максимальная ширина, пикселей
+	MaxHeight int   // Максимальная высота, пикселей
+	MaxPixels int64 // Максимальное количество пикселей (ширина * высота)
+
+	// Redactions - области, которые нужно скрыть в пикселях (задаются для каждого файла отдельно).
+	Redactions []RedactionRegion
+
+	// BlurFaces - найти лица детектором (см. LoadFaceCascade) и размыть их.
+	BlurFaces bool
+
+	// Scrub - глубокая очистка скрытых пиксельных данных (прозрачные пиксели,
+	// неиспользуемые записи палитры, младшие биты каналов).
+	Scrub ScrubOptions
+
+	// Подавление отпечатка сенсора камеры (PRNU): уменьшение со случайным сдвигом,
+	// шумоподавление и добавление нового шума. Размер изображения не меняется.
+	AntiFingerprint         bool
+	AntiFingerprintStrength FingerprintStrength
+
+	// GPSPrecision - сохранять ли огрубленные координаты съемки (только для JPEG,
+	// сохраняемого в JPEG). Все остальные теги EXIF удаляются в любом случае.
+	GPSPrecision GPSPrecision
+
+	// MetadataAllowlist - поля метаданных (авторство, копирайт и т.п.), которые переносятся
+	// в очищенный файл (только для JPEG, сохраняемого в JPEG). Пустой список - удалить все.
+	MetadataAllowlist MetadataAllowlist
+
+	// Overlay - видимая надпись поверх изображения (например, имя получателя и дата).
+	Overlay TextOverlay
+
+	// Невидимый водяной знак (см. DetectWatermark): WatermarkID встраивается в пиксели
+	// и сохраняется в записи изображения, чтобы по утекшей копии найти ссылку.
+	// Генерируется для каждого файла отдельно (NewWatermarkID).
+	Watermark   bool
+	WatermarkID uint32
+
+	// MaxLongEdge - максимальная длинная сторона сохраняемого изображения, пикселей
+	// (0 - без уменьшения). Изображения меньшего размера не увеличиваются.
+	MaxLongEdge int
+
+	// SVGRasterize - сохранять SVG как PNG (см. rasterizeSVG) вместо очищенного SVG.
+	// SVG растеризуется и без этого параметра, если к нему нужно применить пиксельные
+	// операции или политика сохранения требует PNG/JPEG.
+	SVGRasterize bool
+}
+
+// rasterizesSVG сообщает, нужно ли растеризовать загруженный SVG. Уменьшение
+// (MaxLongEdge) само по себе растеризации не требует: векторный рисунок масштабируется
+// без потерь, а при растеризации MaxLongEdge ограничивает размер результата.
+func (o ProcessOptions) rasterizesSVG() bool {
+	vectorOpts := o
+	vectorOpts.MaxLongEdge = 0
+	return o.SVGRasterize || vectorOpts.modifiesPixels() || o.OutputPolicy != OutputPolicyKeep
+}
+
+// modifiesPixels сообщает, изменяет ли обработка пиксели изображения.
+// В этом случае lossless-очистка (копирование исходных данных изображения) невозможна.
+func (o ProcessOptions) modifiesPixels() bool {
+	return len(o.Redactions) > 0 || o.BlurFaces || o.Scrub.Enabled || o.AntiFingerprint || o.Overlay.Enabled() || o.Watermark || o.MaxLongEdge > 0
+}
+
+// DefaultProcessOptions возвращает параметры обработки по умолчанию.
+func DefaultProcessOptions() ProcessOptions {
+	return ProcessOptions{
+		JPEGMode:  CleanModeLossless,
+		PNGMode:   CleanModeLossless,
+		MaxWidth:  DefaultMaxImageWidth,
+		MaxHeight: DefaultMaxImageHeight,
+		MaxPixels: DefaultMaxImagePixels,
+
+		ConvertFormat: OutputFormatPNG,
+
+		OutputPolicy:   OutputPolicyKeep,
+		JPEGQuality:    jpeg.DefaultQuality,
+		PNGCompression: png.DefaultCompression,
+
+		AntiFingerprintStrength: FingerprintMedium,
+		GPSPrecision:            GPSPrecisionRemove,
+
+		Overlay: TextOverlay{Position: OverlayCenter, Opacity: 0.5},
+	}
+}
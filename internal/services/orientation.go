@@ -0,0 +1,115 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"      // Для удаления префикса EXIF в WebP
+	"image"      // Для типов изображений
+	"image/draw" // Для быстрого приведения изображения к RGBA
+)
+
+// applyOrientation поворачивает и/или отражает изображение в соответствии
+// со значением EXIF-тега Orientation, чтобы после удаления метаданных
+// картинка выглядела так же, как оригинал в просмотрщике.
+//
+// Значения тега (по спецификации EXIF 2.3):
+//
+//	1 - без изменений            5 - транспонирование (отражение по главной диагонали)
+//	2 - отражение по горизонтали  6 - поворот на 90° по часовой стрелке
+//	3 - поворот на 180°           7 - транспонирование по побочной диагонали
+//	4 - отражение по вертикали    8 - поворот на 90° против часовой стрелки
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	// Приводим исходник к RGBA: draw.Draw имеет быстрые пути для YCbCr и других
+	// типов, а дальше можно копировать пиксели по индексам без вызовов At().
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w // Повороты на 90° и транспонирование меняют стороны местами
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			// Для каждого пикселя результата вычисляем координаты исходного пикселя.
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation извлекает значение EXIF-тега Orientation из JPEG-файла.
+// Возвращает 1 (без изменений), если EXIF отсутствует или поврежден.
+func jpegOrientation(data []byte) int {
+	segments, _, err := readJPEGHeaderSegments(data)
+	if err != nil {
+		return 1
+	}
+	tiff := findJPEGExif(segments)
+	if tiff == nil {
+		return 1
+	}
+	ex, err := parseEXIF(tiff)
+	if err != nil {
+		return 1
+	}
+	return ex.Orientation()
+}
+
+// imageOrientation извлекает значение EXIF-тега Orientation для форматов,
+// где он встречается: JPEG (сегмент APP1), TIFF (сам файл является TIFF-структурой)
+// и WebP (чанк EXIF). Для остальных форматов и при ошибках возвращает 1.
+func imageOrientation(data []byte, format string) int {
+	var tiff []byte
+	switch format {
+	case "jpeg":
+		return jpegOrientation(data)
+	case "tiff":
+		tiff = data
+	case "webp":
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return 1
+		}
+		for _, chunk := range chunks {
+			if chunk.FourCC == "EXIF" {
+				// Некоторые программы записывают EXIF-чанк с префиксом "Exif\0\0".
+				tiff = bytes.TrimPrefix(chunk.Data, exifSignature)
+				break
+			}
+		}
+	}
+	if tiff == nil {
+		return 1
+	}
+	ex, err := parseEXIF(tiff)
+	if err != nil {
+		return 1
+	}
+	return ex.Orientation()
+}
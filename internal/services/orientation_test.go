@@ -0,0 +1,146 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для чтения сохраненного файла
+	"fmt"           // Для имен подтестов
+	"image"         // Для тестовых изображений
+	"image/color"   // Для цветов клеток
+	"image/jpeg"    // Для кодирования и декодирования
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"testing"       // Для тестов
+)
+
+// orientationColors - цвета клеток тестового изображения 3x2:
+//
+//	A B C
+//	D E F
+var orientationColors = map[byte]color.NRGBA{
+	'A': {R: 255, A: 255},
+	'B': {G: 255, A: 255},
+	'C': {B: 255, A: 255},
+	'D': {R: 255, G: 255, A: 255},
+	'E': {G: 255, B: 255, A: 255},
+	'F': {R: 255, B: 255, A: 255},
+}
+
+// orientationExpected - как выглядит изображение A B C / D E F после применения
+// каждого значения EXIF-тега Orientation (по строкам сверху вниз, по спецификации EXIF 2.32).
+var orientationExpected = []struct {
+	orientation int
+	rows        []string
+}{
+	{1, []string{"ABC", "DEF"}},
+	{2, []string{"CBA", "FED"}},     // Зеркально по горизонтали
+	{3, []string{"FED", "CBA"}},     // Поворот на 180°
+	{4, []string{"DEF", "ABC"}},     // Зеркально по вертикали
+	{5, []string{"AD", "BE", "CF"}}, // Транспонирование
+	{6, []string{"DA", "EB", "FC"}}, // Поворот на 90° по часовой стрелке
+	{7, []string{"FC", "EB", "DA"}}, // Транспонирование относительно побочной диагонали
+	{8, []string{"CF", "BE", "AD"}}, // Поворот на 90° против часовой стрелки
+	{0, []string{"ABC", "DEF"}},     // Некорректные значения игнорируются
+	{9, []string{"ABC", "DEF"}},
+}
+
+// testOrientationImage возвращает изображение 3x2 клетки по cell пикселей.
+func testOrientationImage(cell int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3*cell, 2*cell))
+	for y := 0; y < 2*cell; y++ {
+		for x := 0; x < 3*cell; x++ {
+			img.SetNRGBA(x, y, orientationColors["ABCDEF"[y/cell*3+x/cell]])
+		}
+	}
+	return img
+}
+
+// checkOrientationCells проверяет цвета в центрах клеток по ожидаемой раскладке.
+func checkOrientationCells(t *testing.T, img image.Image, rows []string, cell, tolerance int) {
+	t.Helper()
+	b := img.Bounds()
+	if b.Dx() != len(rows[0])*cell || b.Dy() != len(rows)*cell {
+		t.Fatalf("размер %dx%d, ожидался %dx%d", b.Dx(), b.Dy(), len(rows[0])*cell, len(rows)*cell)
+	}
+	for row, letters := range rows {
+		for col := range letters {
+			at := img.At(b.Min.X+col*cell+cell/2, b.Min.Y+row*cell+cell/2)
+			checkColor(t, fmt.Sprintf("клетка (%d,%d)", col, row), at, orientationColors[letters[col]], tolerance)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	for _, tt := range orientationExpected {
+		t.Run(fmt.Sprintf("ориентация %d", tt.orientation), func(t *testing.T) {
+			checkOrientationCells(t, applyOrientation(testOrientationImage(1), tt.orientation), tt.rows, 1, 0)
+		})
+	}
+
+	t.Run("изображение со смещенными границами", func(t *testing.T) {
+		big := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		sub := big.SubImage(image.Rect(5, 4, 8, 6)).(*image.NRGBA)
+		src := testOrientationImage(1)
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				sub.SetNRGBA(5+x, 4+y, src.NRGBAAt(x, y))
+			}
+		}
+		checkOrientationCells(t, applyOrientation(sub, 6), []string{"DA", "EB", "FC"}, 1, 0)
+	})
+}
+
+func TestProcessImageAppliesOrientation(t *testing.T) {
+	const cell = 16
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testOrientationImage(cell), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	for _, tt := range orientationExpected[1:8] {
+		t.Run(fmt.Sprintf("ориентация %d", tt.orientation), func(t *testing.T) {
+			exif := testEXIFSegment([]exifEntry{newShortEntry(exifTagOrientation, uint16(tt.orientation))}, nil, nil)
+			input := insertJPEGSegments(encoded.Bytes(), []jpegSegment{exif})
+
+			// При перекодировании поворот применяется к пикселям, тег не сохраняется.
+			opts := DefaultProcessOptions()
+			opts.JPEGMode = CleanModeReencode
+			dir := t.TempDir()
+			stored, report, err := ProcessAndSaveData("photo.jpg", input, dir, opts)
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData: %v", err)
+			}
+			clean, err := os.ReadFile(filepath.Join(dir, stored))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if got := jpegOrientation(clean); got != 1 {
+				t.Errorf("в перекодированном файле осталась ориентация %d", got)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(clean))
+			if err != nil {
+				t.Fatalf("jpeg.Decode: %v", err)
+			}
+			checkOrientationCells(t, img, tt.rows, cell, 40)
+			if report.Width != img.Bounds().Dx() || report.Height != img.Bounds().Dy() {
+				t.Errorf("размер в отчете %dx%d, у файла %v", report.Width, report.Height, img.Bounds())
+			}
+
+			// В режиме lossless пиксели не меняются, а тег переносится в новый EXIF.
+			dir = t.TempDir()
+			stored, report, err = ProcessAndSaveData("photo.jpg", input, dir, DefaultProcessOptions())
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData (lossless): %v", err)
+			}
+			clean, err = os.ReadFile(filepath.Join(dir, stored))
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if got := jpegOrientation(clean); got != tt.orientation {
+				t.Errorf("lossless: ориентация %d, ожидалась %d", got, tt.orientation)
+			}
+			wantW, wantH := len(tt.rows[0])*cell, len(tt.rows)*cell
+			if report.Width != wantW || report.Height != wantH {
+				t.Errorf("lossless: размер в отчете %dx%d, на экране %dx%d", report.Width, report.Height, wantW, wantH)
+			}
+		})
+	}
+}
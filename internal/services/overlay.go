@@ -0,0 +1,223 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"fmt"         // Для форматирования ошибок
+	"image"       // Для работы с изображениями
+	"image/color" // Для цвета текста и тени
+	"image/draw"  // Для наложения текста
+	"image/gif"   // Для обработки кадров анимации
+	"strconv"     // Для разбора прозрачности
+	"strings"     // Для нормализации значений настроек
+	"sync"        // Для однократной загрузки шрифта
+	"unicode"     // Для удаления управляющих символов из текста
+
+	// Сторонние библиотеки
+	"golang.org/x/image/font"               // Для отрисовки и измерения текста
+	"golang.org/x/image/font/gofont/gobold" // Встроенный шрифт (работает без доступа к сети и системных шрифтов)
+	"golang.org/x/image/font/opentype"      // Для создания начертания нужного размера
+	"golang.org/x/image/math/fixed"         // Для координат в единицах шрифта
+)
+
+// Видимая надпись поверх изображения (например, "Для Иванова И.И., 01.02.2025 - не пересылать").
+// Надпись наносится на пиксели до кодирования, поэтому ее нельзя удалить, просто
+// очистив метаданные, а утечку можно связать с конкретным получателем.
+
+// OverlayPosition - расположение надписи на изображении.
+type OverlayPosition string
+
+const (
+	OverlayCenter      OverlayPosition = "center"       // По центру
+	OverlayTopLeft     OverlayPosition = "top-left"     // В левом верхнем углу
+	OverlayTopRight    OverlayPosition = "top-right"    // В правом верхнем углу
+	OverlayBottomLeft  OverlayPosition = "bottom-left"  // В левом нижнем углу
+	OverlayBottomRight OverlayPosition = "bottom-right" // В правом нижнем углу
+	OverlayTile        OverlayPosition = "tile"         // Повторяется по всему изображению (труднее обрезать)
+)
+
+// overlayPositions - допустимые расположения (для проверки и сообщений об ошибках).
+var overlayPositions = []OverlayPosition{OverlayCenter, OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight, OverlayTile}
+
+// Ограничения надписи.
+const (
+	maxOverlayTextLength = 200  // Максимальная длина текста (в символах)
+	minOverlayOpacity    = 0.05 // Минимальная непрозрачность (более прозрачную надпись не видно)
+	minOverlayFontSize   = 8    // Минимальный размер шрифта в пикселях
+)
+
+// TextOverlay - параметры надписи. Пустой текст означает, что надпись не наносится.
+type TextOverlay struct {
+	Text     string
+	Position OverlayPosition
+	Opacity  float64 // Непрозрачность от minOverlayOpacity до 1
+}
+
+// Enabled сообщает, нужно ли наносить надпись.
+func (o TextOverlay) Enabled() bool {
+	return o.Text != ""
+}
+
+// ParseOverlayPosition разбирает расположение надписи
+// (переменная окружения OVERLAY_POSITION или поле формы загрузки).
+func ParseOverlayPosition(value string) (OverlayPosition, error) {
+	position := OverlayPosition(strings.ToLower(strings.TrimSpace(value)))
+	names := make([]string, len(overlayPositions))
+	for i, p := range overlayPositions {
+		if p == position {
+			return position, nil
+		}
+		names[i] = string(p)
+	}
+	return "", fmt.Errorf("неизвестное расположение надписи: %q (допустимо: %s)", value, strings.Join(names, ", "))
+}
+
+// ParseOverlayOpacity разбирает непрозрачность надписи в процентах (5-100)
+// (переменная окружения OVERLAY_OPACITY или поле формы загрузки).
+func ParseOverlayOpacity(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || percent < minOverlayOpacity*100 || percent > 100 {
+		return 0, fmt.Errorf("некорректная непрозрачность надписи: %q (допустимо от %.0f до 100%%)", value, minOverlayOpacity*100)
+	}
+	return percent / 100, nil
+}
+
+// NormalizeOverlayText подготавливает текст надписи: управляющие символы
+// (переводы строк, табуляции) заменяются пробелами, лишние пробелы удаляются.
+func NormalizeOverlayText(text string) (string, error) {
+	text = strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	if n := len([]rune(text)); n > maxOverlayTextLength {
+		return "", fmt.Errorf("текст надписи слишком длинный (%d символов, максимум %d)", n, maxOverlayTextLength)
+	}
+	return text, nil
+}
+
+// Встроенный шрифт загружается один раз при первом использовании.
+var (
+	overlayFontOnce sync.Once
+	overlayFont     *opentype.Font
+	overlayFontErr  error
+)
+
+// overlayFace возвращает начертание встроенного шрифта заданного размера (в пикселях).
+func overlayFace(size float64) (font.Face, error) {
+	overlayFontOnce.Do(func() {
+		overlayFont, overlayFontErr = opentype.Parse(gobold.TTF)
+	})
+	if overlayFontErr != nil {
+		return nil, fmt.Errorf("не удалось загрузить встроенный шрифт: %w", overlayFontErr)
+	}
+	return opentype.NewFace(overlayFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// renderOverlayMask рисует надпись в маску прозрачности размера width x height.
+// Размер шрифта подбирается по размеру изображения и уменьшается, если текст
+// не помещается по ширине. Возвращает маску и смещение тени в пикселях.
+func renderOverlayMask(width, height int, overlay TextOverlay) (*image.Alpha, int, error) {
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	short := min(width, height)
+
+	size := float64(short) / 12
+	if overlay.Position == OverlayTile {
+		size = float64(short) / 16
+	}
+	size = max(size, minOverlayFontSize)
+	face, err := overlayFace(size)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Текст не должен выходить за 90% ширины изображения.
+	if textWidth := font.MeasureString(face, overlay.Text).Ceil(); float64(textWidth) > float64(width)*0.9 {
+		face.Close()
+		size = max(size*float64(width)*0.9/float64(textWidth), minOverlayFontSize)
+		if face, err = overlayFace(size); err != nil {
+			return nil, 0, err
+		}
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	ascent, descent := metrics.Ascent.Ceil(), metrics.Descent.Ceil()
+	textWidth := font.MeasureString(face, overlay.Text).Ceil()
+	textHeight := ascent + descent
+	margin := max(2, int(size/2))
+
+	drawer := &font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	drawAt := func(x, y int) { // (x, y) - левый верхний угол строки
+		drawer.Dot = fixed.P(x, y+ascent)
+		drawer.DrawString(overlay.Text)
+	}
+
+	switch overlay.Position {
+	case OverlayTopLeft:
+		drawAt(margin, margin)
+	case OverlayTopRight:
+		drawAt(width-margin-textWidth, margin)
+	case OverlayBottomLeft:
+		drawAt(margin, height-margin-textHeight)
+	case OverlayBottomRight:
+		drawAt(width-margin-textWidth, height-margin-textHeight)
+	case OverlayTile:
+		// Строки со сдвигом через одну, чтобы надпись нельзя было убрать обрезкой края.
+		stepX, stepY := textWidth+4*margin, textHeight*3
+		for row, y := 0, margin; y < height; row, y = row+1, y+stepY {
+			x := margin - (row%2)*stepX/2
+			for ; x < width; x += stepX {
+				drawAt(x, y)
+			}
+		}
+	default:
+		drawAt((width-textWidth)/2, (height-textHeight)/2)
+	}
+	return mask, max(1, int(size/24)), nil
+}
+
+// compositeOverlay накладывает надпись (белый текст с темной тенью для читаемости
+// на любом фоне) на изображение dst. Маска задана в координатах логического экрана,
+// dst может занимать только его часть (кадры GIF).
+func compositeOverlay(dst draw.Image, mask *image.Alpha, shadow int, opacity float64) {
+	alpha := uint8(opacity*255 + 0.5)
+	r := dst.Bounds().Intersect(mask.Bounds())
+	shadowMask := image.Point{X: -shadow, Y: -shadow}
+	draw.DrawMask(dst, r, image.NewUniform(color.NRGBA{0, 0, 0, alpha}), image.Point{}, mask, r.Min.Add(shadowMask), draw.Over)
+	draw.DrawMask(dst, r, image.NewUniform(color.NRGBA{255, 255, 255, alpha}), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// applyTextOverlay возвращает копию изображения с нанесенной надписью.
+func applyTextOverlay(img image.Image, overlay TextOverlay) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	mask, shadow, err := renderOverlayMask(bounds.Dx(), bounds.Dy(), overlay)
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	compositeOverlay(dst, mask, shadow, overlay.Opacity)
+	return dst, nil
+}
+
+// applyGIFTextOverlay наносит надпись на каждый кадр анимации. Надпись рисуется
+// в координатах логического экрана, поэтому на всех кадрах она остается на месте.
+// Цвета надписи приводятся к палитре кадра (ближайшие доступные цвета).
+func applyGIFTextOverlay(anim *gif.GIF, overlay TextOverlay) error {
+	screen := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if screen.Empty() {
+		screen = image.Rectangle{}
+		for _, frame := range anim.Image {
+			screen = screen.Union(frame.Bounds())
+		}
+	}
+	mask, shadow, err := renderOverlayMask(screen.Dx(), screen.Dy(), overlay)
+	if err != nil {
+		return err
+	}
+	for _, frame := range anim.Image {
+		bounds := frame.Bounds()
+		rgba := image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, frame, bounds.Min, draw.Src)
+		compositeOverlay(rgba, mask, shadow, overlay.Opacity)
+		draw.Draw(frame, bounds, rgba, bounds.Min, draw.Src)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"               // Для декодирования сохраненного файла
+	"image"               // Для тестовых изображений
+	"image/color"         // Для цвета фона
+	"image/color/palette" // Для палитры кадров GIF
+	"image/gif"           // Для кадров анимации
+	"image/png"           // Для сквозной проверки
+	"os"                  // Для чтения сохраненного файла
+	"path/filepath"       // Для пути к сохраненному файлу
+	"strings"             // Для длинного текста
+	"testing"             // Для тестов
+)
+
+// testGray возвращает однотонное серое изображение.
+func testGray(w, h int, v uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = v, v, v, 255
+	}
+	return img
+}
+
+// maskBounds возвращает наименьший прямоугольник, содержащий все ненулевые точки маски.
+func maskBounds(mask *image.Alpha) image.Rectangle {
+	var r image.Rectangle
+	b := mask.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if mask.AlphaAt(x, y).A > 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// maxChange возвращает наибольшее отклонение красного канала от v в rect.
+func maxChange(img image.Image, rect image.Rectangle, v uint8) int {
+	change := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			change = max(change, int(r>>8)-int(v), int(v)-int(r>>8))
+		}
+	}
+	return change
+}
+
+func TestRenderOverlayMask(t *testing.T) {
+	const w, h = 400, 300
+	tests := []struct {
+		position OverlayPosition
+		area     image.Rectangle // Область, в которой должна оказаться надпись
+	}{
+		{OverlayTopLeft, image.Rect(0, 0, w/2+40, h/3)},
+		{OverlayTopRight, image.Rect(w/2-40, 0, w, h/3)},
+		{OverlayBottomLeft, image.Rect(0, h*2/3, w/2+40, h)},
+		{OverlayBottomRight, image.Rect(w/2-40, h*2/3, w, h)},
+		{OverlayCenter, image.Rect(w/4, h/3, w*3/4, h*2/3)},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.position), func(t *testing.T) {
+			mask, shadow, err := renderOverlayMask(w, h, TextOverlay{Text: "Иванов 01.02", Position: tt.position, Opacity: 1})
+			if err != nil {
+				t.Fatalf("renderOverlayMask: %v", err)
+			}
+			got := maskBounds(mask)
+			if got.Empty() {
+				t.Fatalf("надпись не нарисована")
+			}
+			if !got.In(tt.area) {
+				t.Errorf("надпись занимает %v, ожидалось внутри %v", got, tt.area)
+			}
+			if shadow < 1 {
+				t.Errorf("смещение тени %d", shadow)
+			}
+		})
+	}
+
+	t.Run("по центру симметрично", func(t *testing.T) {
+		mask, _, err := renderOverlayMask(w, h, TextOverlay{Text: "Иванов 01.02", Position: OverlayCenter, Opacity: 1})
+		if err != nil {
+			t.Fatalf("renderOverlayMask: %v", err)
+		}
+		got := maskBounds(mask)
+		if left, right := got.Min.X, w-got.Max.X; left-right > 8 || right-left > 8 {
+			t.Errorf("отступы слева %d и справа %d различаются", left, right)
+		}
+	})
+
+	t.Run("замостить", func(t *testing.T) {
+		mask, _, err := renderOverlayMask(w, h, TextOverlay{Text: "Иванов", Position: OverlayTile, Opacity: 1})
+		if err != nil {
+			t.Fatalf("renderOverlayMask: %v", err)
+		}
+		// Надпись есть в каждой трети изображения по обеим осям.
+		for row := 0; row < 3; row++ {
+			for col := 0; col < 3; col++ {
+				cell := image.Rect(col*w/3, row*h/3, (col+1)*w/3, (row+1)*h/3)
+				if maskBounds(mask.SubImage(cell).(*image.Alpha)).Empty() {
+					t.Errorf("нет надписи в области %v", cell)
+				}
+			}
+		}
+	})
+
+	t.Run("длинный текст умещается по ширине", func(t *testing.T) {
+		mask, _, err := renderOverlayMask(w, h, TextOverlay{Text: strings.Repeat("не пересылать ", 5), Position: OverlayCenter, Opacity: 1})
+		if err != nil {
+			t.Fatalf("renderOverlayMask: %v", err)
+		}
+		if got := maskBounds(mask); got.Min.X <= 0 || got.Max.X >= w {
+			t.Errorf("текст выходит за край: %v", got)
+		}
+	})
+}
+
+func TestApplyTextOverlay(t *testing.T) {
+	const bg = 100
+	src := testGray(200, 120, bg)
+	overlay := TextOverlay{Text: "Иванов", Position: OverlayBottomRight, Opacity: 1}
+	full, err := applyTextOverlay(src, overlay)
+	if err != nil {
+		t.Fatalf("applyTextOverlay: %v", err)
+	}
+	if maxChange(src, src.Bounds(), bg) != 0 {
+		t.Fatalf("исходное изображение изменено")
+	}
+	// Белый текст и черная тень при полной непрозрачности.
+	var white, black bool
+	for i := 0; i < len(full.Pix); i += 4 {
+		white = white || full.Pix[i] == 255
+		black = black || full.Pix[i] == 0
+	}
+	if !white || !black {
+		t.Errorf("нет белого текста (%v) или черной тени (%v)", white, black)
+	}
+	if c := maxChange(full, image.Rect(0, 0, 200, 60), bg); c != 0 {
+		t.Errorf("верхняя половина изменена на %d", c)
+	}
+
+	t.Run("непрозрачность", func(t *testing.T) {
+		overlay := overlay
+		overlay.Opacity = 0.3
+		faint, err := applyTextOverlay(src, overlay)
+		if err != nil {
+			t.Fatalf("applyTextOverlay: %v", err)
+		}
+		// Наибольшее изменение - белый текст: 0,3 * (255 - 100) ≈ 47.
+		if c := maxChange(faint, faint.Bounds(), bg); c < 40 || c > 52 {
+			t.Errorf("изменение %d при непрозрачности 30%%, ожидалось около 47", c)
+		}
+	})
+
+	t.Run("вложенное изображение", func(t *testing.T) {
+		big := testGray(300, 200, bg)
+		sub := big.SubImage(image.Rect(50, 40, 250, 160))
+		got, err := applyTextOverlay(sub, overlay)
+		if err != nil {
+			t.Fatalf("applyTextOverlay: %v", err)
+		}
+		if got.Bounds() != image.Rect(0, 0, 200, 120) {
+			t.Fatalf("размер %v", got.Bounds())
+		}
+		for i := range got.Pix {
+			if got.Pix[i] != full.Pix[i] {
+				t.Fatalf("результат отличается от изображения с нулевым началом координат")
+			}
+		}
+	})
+}
+
+func TestApplyGIFTextOverlay(t *testing.T) {
+	gray := color.Palette(palette.Plan9).Index(color.Gray{Y: 100})
+	frames := []*image.Paletted{
+		image.NewPaletted(image.Rect(0, 0, 200, 120), palette.Plan9),
+		image.NewPaletted(image.Rect(100, 60, 200, 120), palette.Plan9), // Правая нижняя четверть
+		image.NewPaletted(image.Rect(0, 0, 100, 60), palette.Plan9),     // Левая верхняя четверть
+	}
+	for _, f := range frames {
+		for i := range f.Pix {
+			f.Pix[i] = uint8(gray)
+		}
+	}
+	anim := &gif.GIF{Image: frames, Delay: []int{10, 10, 10}, Config: image.Config{Width: 200, Height: 120}}
+	overlay := TextOverlay{Text: "Иванов", Position: OverlayBottomRight, Opacity: 1}
+	if err := applyGIFTextOverlay(anim, overlay); err != nil {
+		t.Fatalf("applyGIFTextOverlay: %v", err)
+	}
+
+	// Надпись в координатах логического экрана: на кадре со смещением она совпадает
+	// с надписью первого кадра, а кадр вне надписи не меняется.
+	changed := 0
+	for y := 60; y < 120; y++ {
+		for x := 100; x < 200; x++ {
+			if frames[0].ColorIndexAt(x, y) != frames[1].ColorIndexAt(x, y) {
+				t.Fatalf("пиксель (%d,%d) кадров различается", x, y)
+			}
+			if frames[1].ColorIndexAt(x, y) != uint8(gray) {
+				changed++
+			}
+		}
+	}
+	if changed == 0 {
+		t.Errorf("надпись не нанесена на кадр со смещением")
+	}
+	for _, v := range frames[2].Pix {
+		if v != uint8(gray) {
+			t.Fatalf("кадр вне надписи изменен")
+		}
+	}
+}
+
+func TestParseOverlaySettings(t *testing.T) {
+	t.Run("расположение", func(t *testing.T) {
+		for _, p := range overlayPositions {
+			if got, err := ParseOverlayPosition(" " + strings.ToUpper(string(p)) + " "); got != p || err != nil {
+				t.Errorf("%q: %q, %v", p, got, err)
+			}
+		}
+		for _, value := range []string{"", "middle", "top"} {
+			if _, err := ParseOverlayPosition(value); err == nil {
+				t.Errorf("%q: ожидалась ошибка", value)
+			}
+		}
+	})
+
+	t.Run("непрозрачность", func(t *testing.T) {
+		for value, want := range map[string]float64{"50": 0.5, " 5% ": 0.05, "100": 1, "12.5": 0.125} {
+			if got, err := ParseOverlayOpacity(value); got != want || err != nil {
+				t.Errorf("%q: %v, %v; ожидалось %v", value, got, err, want)
+			}
+		}
+		for _, value := range []string{"", "4", "0", "101", "-50", "half", "0.5"} {
+			if _, err := ParseOverlayOpacity(value); err == nil {
+				t.Errorf("%q: ожидалась ошибка", value)
+			}
+		}
+	})
+
+	t.Run("текст", func(t *testing.T) {
+		for input, want := range map[string]string{
+			"  Для Иванова\n\t01.02.2025  ": "Для Иванова 01.02.2025",
+			"a\x00b\x1bc": "a b c",
+			" \r\n ":      "",
+		} {
+			if got, err := NormalizeOverlayText(input); got != want || err != nil {
+				t.Errorf("%q: %q, %v; ожидалось %q", input, got, err, want)
+			}
+		}
+		if _, err := NormalizeOverlayText(strings.Repeat("я", maxOverlayTextLength)); err != nil {
+			t.Errorf("текст максимальной длины: %v", err)
+		}
+		if _, err := NormalizeOverlayText(strings.Repeat("я", maxOverlayTextLength+1)); err == nil {
+			t.Errorf("слишком длинный текст: ожидалась ошибка")
+		}
+		if (TextOverlay{Position: OverlayCenter, Opacity: 1}).Enabled() {
+			t.Errorf("надпись без текста включена")
+		}
+	})
+}
+
+func TestProcessImageAppliesOverlay(t *testing.T) {
+	const bg = 100
+	input := testPNGImage(t, testGray(240, 160, bg))
+	for _, tt := range []struct {
+		name    string
+		overlay TextOverlay
+		changed bool
+	}{
+		{"без надписи", TextOverlay{Position: OverlayTopLeft, Opacity: 1}, false},
+		{"левый верхний угол", TextOverlay{Text: "Для Иванова", Position: OverlayTopLeft, Opacity: 0.8}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultProcessOptions()
+			opts.Overlay = tt.overlay
+			dir := t.TempDir()
+			stored, _, err := ProcessAndSaveData("shot.png", input, dir, opts)
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData: %v", err)
+			}
+			path := filepath.Join(dir, stored)
+			if err := VerifyCleanFile(path, opts); err != nil {
+				t.Errorf("VerifyCleanFile: %v", err)
+			}
+			clean, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(clean))
+			if err != nil {
+				t.Fatalf("png.Decode: %v", err)
+			}
+			if c := maxChange(img, image.Rect(0, 0, 120, 40), bg); (c > 0) != tt.changed {
+				t.Errorf("изменение в левом верхнем углу %d", c)
+			}
+			if c := maxChange(img, image.Rect(0, 80, 240, 160), bg); c != 0 {
+				t.Errorf("нижняя половина изменена на %d", c)
+			}
+		})
+	}
+}
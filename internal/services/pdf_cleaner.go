@@ -0,0 +1,561 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"   // Для сборки очищенного документа
+	"fmt"     // Для форматирования ошибок и записи объектов
+	"sort"    // Для детерминированного порядка ключей словарей
+	"strconv" // Для записи чисел
+	"strings" // Для форматирования дат
+)
+
+// Очистка PDF.
+//
+// Документ не редактируется на месте, а собирается заново: из каталога (/Root)
+// обходятся только достижимые объекты, им присваиваются новые номера, и они
+// записываются в один раздел с классической таблицей перекрестных ссылок.
+// Поэтому в результат не попадают:
+//   - словарь Info (автор, программа, даты) и идентификаторы документа (ID) - новый
+//     трейлер содержит только Size и Root;
+//   - старые версии объектов из инкрементальных обновлений (история правок) и
+//     объекты, на которые больше никто не ссылается;
+// а при обходе дополнительно удаляются XMP-потоки (Metadata), действия JavaScript и
+// запуска программ, вложенные файлы (EmbeddedFiles, аннотации FileAttachment),
+// данные приложений (PieceInfo), миниатюры страниц и формы XFA.
+// Встроенные JPEG-изображения (DCTDecode) очищаются так же, как загруженные JPEG
+// (stripJPEGMetadata), и сверяются со списком блокировки.
+
+// pdfRemovedKeys - ключи словарей, которые удаляются вместе со значениями,
+// и названия блоков для отчета.
+var pdfRemovedKeys = map[pdfName]string{
+	"Metadata":      "XMP",
+	"PieceInfo":     "данные приложений (PieceInfo)",
+	"LastModified":  "даты изменения",
+	"JavaScript":    "JavaScript",
+	"EmbeddedFiles": "вложенные файлы",
+	"AF":            "вложенные файлы",
+	"Collection":    "вложенные файлы",
+	"Thumb":         "миниатюры страниц",
+	"XFA":           "формы XFA",
+}
+
+// pdfRemovedActions - типы действий, которые удаляются: выполнение скриптов, запуск
+// программ и переходы во вложенные (удаленные) файлы.
+var pdfRemovedActions = map[pdfName]string{
+	"JavaScript": "JavaScript",
+	"Launch":     "запуск программ",
+	"GoToE":      "вложенные файлы",
+}
+
+// pdfInfoLabels - подписи полей словаря Info, которые попадают в комментарии отчета.
+var pdfInfoLabels = map[pdfName]string{
+	"Title":    "Заголовок",
+	"Subject":  "Тема",
+	"Keywords": "Ключевые слова",
+}
+
+// pdfCleaner - состояние обхода документа.
+type pdfCleaner struct {
+	doc     *pdfDocument
+	opts    ProcessOptions
+	report  *MetadataReport
+	numbers map[int]int    // Старый номер объекта -> новый
+	objects []any          // Очищенные объекты по новым номерам (с 1)
+	removed map[string]int // Удаленные блоки для отчета
+	jpegs   int            // Встроенные JPEG, в которых были метаданные
+}
+
+// cleanPDF очищает документ и возвращает его заново собранную копию и отчет
+// о найденных метаданных.
+func cleanPDF(data []byte, opts ProcessOptions) ([]byte, *MetadataReport, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &pdfCleaner{
+		doc:     doc,
+		opts:    opts,
+		report:  &MetadataReport{Format: "pdf"},
+		numbers: make(map[int]int),
+		removed: make(map[string]int),
+	}
+
+	// Старые версии Info из истории изменений тоже попадают в отчет: история удаляется вместе с ними.
+	if ref, ok := doc.trailer["Info"].(pdfRef); ok {
+		for _, version := range doc.versions(ref.num) {
+			if info, ok := version.(pdfDict); ok {
+				c.analyzeInfo(info)
+			}
+		}
+	}
+	if info, ok := doc.resolve(doc.trailer["Info"]).(pdfDict); ok {
+		c.analyzeInfo(info)
+		c.report.addBlock("PDF: Info")
+	}
+	if _, ok := doc.trailer["ID"]; ok {
+		c.report.addBlock("PDF: идентификатор документа (ID)")
+	}
+	if updates := pdfUpdateCount(doc); updates > 0 {
+		c.report.addBlock(fmt.Sprintf("PDF: история изменений (%d)", updates))
+	}
+
+	// Каталог обходится первым и получает номер 1.
+	if _, err := c.value(doc.trailer["Root"]); err != nil {
+		return nil, nil, err
+	}
+	if len(c.objects) == 0 {
+		return nil, nil, fmt.Errorf("%w: не найден каталог документа", ErrInvalidPDF)
+	}
+	catalog, ok := c.objects[0].(pdfDict)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: некорректный каталог документа", ErrInvalidPDF)
+	}
+	catalog["Type"] = pdfName("Catalog")
+
+	names := make([]string, 0, len(c.removed))
+	for name := range c.removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.report.addBlock(fmt.Sprintf("PDF: %s (%d)", name, c.removed[name]))
+	}
+	if c.jpegs > 0 {
+		c.report.addBlock(fmt.Sprintf("PDF: метаданные встроенных JPEG (%d)", c.jpegs))
+	}
+	sort.Strings(c.report.Timestamps)
+	return c.write(), c.report, nil
+}
+
+// pdfUpdateCount оценивает количество инкрементальных обновлений: каждое добавляет
+// в конец файла новый раздел и маркер %%EOF. У линеаризованных документов первый
+// раздел состоит из двух частей, это не обновление.
+func pdfUpdateCount(doc *pdfDocument) int {
+	eofs := bytes.Count(doc.data, []byte("%%EOF"))
+	if p := bytes.Index(doc.data[:min(len(doc.data), 1024)], []byte("/Linearized")); p >= 0 && eofs > 1 {
+		eofs--
+	}
+	return max(eofs-1, doc.sections-1, 0)
+}
+
+// analyzeInfo переносит в отчет поля словаря Info.
+func (c *pdfCleaner) analyzeInfo(info pdfDict) {
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s, ok := c.doc.resolve(info[pdfName(key)]).(pdfString)
+		if !ok {
+			continue
+		}
+		value := decodePDFText(s)
+		switch key {
+		case "Author":
+			c.report.addUnique(&c.report.Authors, value)
+		case "Creator", "Producer":
+			c.report.addUnique(&c.report.Software, value)
+		case "CreationDate":
+			c.report.addTimestamp("PDF создание", formatPDFDate(value))
+		case "ModDate":
+			c.report.addTimestamp("PDF изменение", formatPDFDate(value))
+		case "Trapped":
+		default:
+			label := pdfInfoLabels[pdfName(key)]
+			if label == "" {
+				label = key // Нестандартные поля, добавленные программами
+			}
+			if strings.TrimSpace(value) != "" {
+				c.report.addUnique(&c.report.Comments, label+": "+value)
+			}
+		}
+	}
+}
+
+// formatPDFDate переводит дату PDF "D:YYYYMMDDHHmmSSOHH'mm'" в вид "YYYY-MM-DD HH:mm:SS +HH:mm".
+// Строки в другом формате возвращаются как есть.
+func formatPDFDate(value string) string {
+	s := strings.TrimPrefix(strings.TrimSpace(value), "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 || digits%2 != 0 {
+		return value
+	}
+	// Недостающие части даты по стандарту равны 01 (месяц и день) и 00 (время).
+	full := s[:digits] + "0101000000"[digits-4:]
+	out := fmt.Sprintf("%s-%s-%s %s:%s:%s", full[0:4], full[4:6], full[6:8], full[8:10], full[10:12], full[12:14])
+	zone := strings.ReplaceAll(s[digits:], "'", "")
+	switch {
+	case zone == "Z":
+		out += " UTC"
+	case len(zone) == 5 && (zone[0] == '+' || zone[0] == '-'):
+		out += " " + zone[:3] + ":" + zone[3:]
+	}
+	return out
+}
+
+// value возвращает очищенное значение. Ссылки на объекты заменяются ссылками с новыми
+// номерами (объект очищается при первом обращении), удаленные объекты дают nil.
+func (c *pdfCleaner) value(obj any) (any, error) {
+	switch v := obj.(type) {
+	case pdfRef:
+		return c.reference(v)
+	case pdfArray:
+		out := make(pdfArray, 0, len(v))
+		for _, item := range v {
+			clean, err := c.value(item)
+			if err != nil {
+				return nil, err
+			}
+			if clean == nil && item != nil {
+				continue // Удаленный объект (например, аннотация с вложенным файлом)
+			}
+			out = append(out, clean)
+		}
+		return out, nil
+	case pdfDict:
+		if c.dropped(v) {
+			return nil, nil
+		}
+		return c.dict(v)
+	case *pdfStream:
+		if c.dropped(v.dict) {
+			return nil, nil
+		}
+		return c.stream(v)
+	}
+	return obj, nil
+}
+
+// droppedObject - dropped для косвенного объекта любого типа.
+func (c *pdfCleaner) droppedObject(obj any) bool {
+	switch v := obj.(type) {
+	case pdfDict:
+		return c.dropped(v)
+	case *pdfStream:
+		return c.dropped(v.dict)
+	}
+	return false
+}
+
+// reference очищает объект, на который указывает ссылка, и возвращает новую ссылку.
+func (c *pdfCleaner) reference(ref pdfRef) (any, error) {
+	if num, ok := c.numbers[ref.num]; ok {
+		if num == 0 {
+			return nil, nil // Объект удален
+		}
+		return pdfRef{num: num}, nil
+	}
+	obj := c.doc.object(ref.num)
+	if obj == nil || c.droppedObject(obj) {
+		c.numbers[ref.num] = 0
+		return nil, nil
+	}
+	// Номер присваивается до очистки содержимого: объекты ссылаются друг на друга
+	// (страница на родителя, родитель на страницы).
+	num := len(c.objects) + 1
+	c.numbers[ref.num] = num
+	c.objects = append(c.objects, nil)
+	var clean any
+	var err error
+	switch v := obj.(type) {
+	case pdfDict:
+		clean, err = c.dict(v)
+	case *pdfStream:
+		clean, err = c.stream(v)
+	default:
+		clean, err = c.value(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if clean == nil {
+		c.numbers[ref.num] = 0
+		c.objects[num-1] = nil // Номер остается занятым свободной записью
+		return nil, nil
+	}
+	c.objects[num-1] = clean
+	return pdfRef{num: num}, nil
+}
+
+// dropped определяет, удаляется ли объект целиком, и учитывает его в отчете.
+func (c *pdfCleaner) dropped(dict pdfDict) bool {
+	typ, _ := c.doc.resolve(dict["Type"]).(pdfName)
+	subtype, _ := c.doc.resolve(dict["Subtype"]).(pdfName)
+	action, _ := c.doc.resolve(dict["S"]).(pdfName)
+	switch {
+	case typ == "EmbeddedFile" || typ == "Filespec" && dict["EF"] != nil:
+		c.removed["вложенные файлы"]++
+	case subtype == "FileAttachment":
+		c.removed["вложенные файлы"]++
+	case typ == "Metadata":
+		c.removed["XMP"]++
+	case pdfRemovedActions[action] != "" && (typ == "" || typ == "Action"):
+		c.removed[pdfRemovedActions[action]]++
+	default:
+		return false
+	}
+	return true
+}
+
+// dict очищает словарь: удаляет ключи из pdfRemovedKeys и очищает значения.
+func (c *pdfCleaner) dict(dict pdfDict) (pdfDict, error) {
+	out := make(pdfDict, len(dict))
+	for key, value := range dict {
+		if block, ok := pdfRemovedKeys[key]; ok {
+			c.removedKey(key, block, value)
+			continue
+		}
+		clean, err := c.value(value)
+		if err != nil {
+			return nil, err
+		}
+		if clean != nil {
+			out[key] = clean
+		}
+	}
+	return out, nil
+}
+
+// removedKey учитывает удаленный ключ в отчете. Содержимое XMP и даты изменения
+// переносятся в отчет, чтобы пользователь видел, что было удалено.
+func (c *pdfCleaner) removedKey(key pdfName, block string, value any) {
+	switch resolved := c.doc.resolve(value).(type) {
+	case *pdfStream:
+		if key == "Metadata" {
+			if packet, err := c.doc.decodeStream(resolved); err == nil {
+				analyzeXMP(packet, c.report)
+			}
+		}
+		if key == "Thumb" {
+			c.report.Thumbnails++
+		}
+	case pdfString:
+		if key == "LastModified" {
+			c.report.addTimestamp("PDF изменение", formatPDFDate(decodePDFText(resolved)))
+		}
+	case pdfDict:
+		if key == "EmbeddedFiles" || key == "JavaScript" {
+			// Дерево имен: считаем листья (пары имя-значение).
+			c.removed[block] += c.countNames(resolved, 0)
+			return
+		}
+	}
+	c.removed[block]++
+}
+
+// countNames считает записи дерева имен (Names/Kids).
+func (c *pdfCleaner) countNames(node pdfDict, depth int) int {
+	if depth > pdfMaxDepth {
+		return 0
+	}
+	count := 0
+	if names, ok := c.doc.resolve(node["Names"]).(pdfArray); ok {
+		count += len(names) / 2
+	}
+	if kids, ok := c.doc.resolve(node["Kids"]).(pdfArray); ok {
+		for _, kid := range kids {
+			if dict, ok := c.doc.resolve(kid).(pdfDict); ok {
+				count += c.countNames(dict, depth+1)
+			}
+		}
+	}
+	return count
+}
+
+// stream очищает поток: словарь очищается как обычный, а встроенные JPEG проходят
+// очистку метаданных. Данные остальных потоков (содержимое страниц, шрифты) копируются.
+func (c *pdfCleaner) stream(s *pdfStream) (any, error) {
+	dict, err := c.dict(s.dict)
+	if err != nil {
+		return nil, err
+	}
+	data := s.data
+	if subtype, _ := c.doc.resolve(s.dict["Subtype"]).(pdfName); subtype == "Image" {
+		if data, err = c.jpegImage(s, dict); err != nil {
+			return nil, err
+		}
+	}
+	delete(dict, "Length") // Записывается заново
+	return &pdfStream{dict: dict, data: data}, nil
+}
+
+// jpegImage очищает изображение DCTDecode (в том числе дополнительно сжатое FlateDecode)
+// и возвращает новые данные потока. Остальные изображения возвращаются без изменений.
+func (c *pdfCleaner) jpegImage(s *pdfStream, dict pdfDict) ([]byte, error) {
+	filters, params := c.doc.streamFilters(s)
+	if len(filters) == 0 || filters[len(filters)-1] != "DCTDecode" && filters[len(filters)-1] != "DCT" {
+		return s.data, nil
+	}
+	last := len(filters) - 1
+	data, err := c.doc.applyFilters(s.data, filters[:last], params[:last])
+	if err != nil {
+		return nil, err
+	}
+
+	clean, embedded, err := cleanEmbeddedImage(data, c.opts)
+	if err != nil {
+		// Обе ошибки остаются доступны errors.Is/As (совпадение со списком блокировки,
+		// превышение ограничений размера).
+		return nil, fmt.Errorf("%w: встроенное изображение: %w", ErrInvalidPDF, err)
+	}
+	if embedded != nil && embedded.HasFindings() {
+		c.jpegs++
+		mergeReport(c.report, embedded)
+	}
+
+	// Очищенный JPEG записывается без внешнего сжатия: фильтр остается только DCTDecode.
+	if last > 0 {
+		dict["Filter"] = pdfName("DCTDecode")
+		delete(dict, "DecodeParms")
+		if params[last] != nil {
+			dict["DecodeParms"] = params[last]
+		}
+	}
+	return clean, nil
+}
+
+// mergeReport переносит находки отчета о вложенном файле в общий отчет.
+// Удаленные блоки не переносятся: в общем отчете вложенный файл учитывается одной строкой.
+func mergeReport(dst, src *MetadataReport) {
+	if dst.GPS == nil {
+		dst.GPS = src.GPS
+	}
+	if dst.CameraMake == "" {
+		dst.CameraMake = src.CameraMake
+	}
+	if dst.CameraModel == "" {
+		dst.CameraModel = src.CameraModel
+	}
+	for _, list := range []struct{ dst, src *[]string }{
+		{&dst.SerialNumbers, &src.SerialNumbers},
+		{&dst.Timestamps, &src.Timestamps},
+		{&dst.Software, &src.Software},
+		{&dst.Authors, &src.Authors},
+		{&dst.Comments, &src.Comments},
+	} {
+		for _, value := range *list.src {
+			dst.addUnique(list.dst, value)
+		}
+	}
+	dst.C2PA = dst.C2PA || src.C2PA
+	dst.Thumbnails += src.Thumbnails
+}
+
+// write собирает очищенный документ: заголовок, объекты, таблицу перекрестных ссылок
+// и трейлер только с Size и Root.
+func (c *pdfCleaner) write() []byte {
+	var out bytes.Buffer
+	// Строка с байтами > 127 после заголовка сообщает программам, что файл двоичный.
+	fmt.Fprintf(&out, "%%PDF-%s\n%%\xE2\xE3\xCF\xD3\n", c.doc.version)
+	offsets := make([]int, len(c.objects))
+	for i, obj := range c.objects {
+		if obj == nil {
+			continue
+		}
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		if s, ok := obj.(*pdfStream); ok {
+			dict := make(pdfDict, len(s.dict)+1)
+			for key, value := range s.dict {
+				dict[key] = value
+			}
+			dict["Length"] = pdfNumber(strconv.Itoa(len(s.data)))
+			writePDFValue(&out, dict)
+			out.WriteString("\nstream\n")
+			out.Write(s.data)
+			out.WriteString("\nendstream")
+		} else {
+			writePDFValue(&out, obj)
+		}
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(c.objects)+1)
+	for _, offset := range offsets {
+		if offset == 0 {
+			out.WriteString("0000000000 00000 f \n")
+		} else {
+			fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+		}
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(c.objects)+1, xref)
+	return out.Bytes()
+}
+
+// writePDFValue записывает прямой объект. Ключи словарей записываются по алфавиту,
+// чтобы результат не зависел от порядка обхода map.
+func writePDFValue(out *bytes.Buffer, obj any) {
+	switch v := obj.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(v))
+	case pdfNumber:
+		out.WriteString(string(v))
+	case pdfName:
+		writePDFName(out, v)
+	case pdfString:
+		writePDFString(out, v)
+	case pdfRef:
+		fmt.Fprintf(out, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		out.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				out.WriteByte(' ')
+			}
+			writePDFValue(out, item)
+		}
+		out.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		out.WriteString("<<")
+		for _, key := range keys {
+			writePDFName(out, pdfName(key))
+			out.WriteByte(' ')
+			writePDFValue(out, v[pdfName(key)])
+		}
+		out.WriteString(">>")
+	}
+}
+
+// writePDFName записывает имя, экранируя служебные и непечатные символы (#XX).
+func writePDFName(out *bytes.Buffer, name pdfName) {
+	out.WriteByte('/')
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		if b < '!' || b > '~' || b == '#' || isPDFDelimiter(b) {
+			fmt.Fprintf(out, "#%02X", b)
+		} else {
+			out.WriteByte(b)
+		}
+	}
+}
+
+// writePDFString записывает строку в скобках. Экранируются скобки, обратная косая
+// черта и символы конца строки (иначе читатель заменит CR на LF).
+func writePDFString(out *bytes.Buffer, s pdfString) {
+	out.WriteByte('(')
+	for _, b := range s {
+		switch b {
+		case '(', ')', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(b)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\n':
+			out.WriteString(`\n`)
+		default:
+			out.WriteByte(b)
+		}
+	}
+	out.WriteByte(')')
+}
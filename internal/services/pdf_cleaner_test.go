@@ -0,0 +1,188 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"   // Для сборки документов
+	"errors"  // Для проверки ошибок-маркеров
+	"fmt"     // Для записи объектов и таблицы ссылок
+	"strings" // Для проверки результата
+	"testing" // Для тестов
+)
+
+// pdfTestObjects - объекты тестового документа: каталог с XMP, скриптом при открытии,
+// деревьями имен JavaScript и EmbeddedFiles, страница с аннотацией-вложением и Info.
+var pdfTestObjects = []string{
+	`<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R /OpenAction 8 0 R` +
+		` /Names << /JavaScript 6 0 R /EmbeddedFiles 7 0 R >> >>`,
+	`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+	`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 100] /Contents 4 0 R /Annots [10 0 R]` +
+		` /AA << /O << /S /Launch /F (calc.exe) >> >> >>`,
+	pdfTestStream(`<< >>`, "0 0 m 10 10 l S"),
+	pdfTestStream(`<< /Type /Metadata /Subtype /XML >>`, `<x:xmpmeta xmlns:x="adobe:ns:meta/">`+
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about=""`+
+		` xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:CreatorTool="XmpWriter 1.0">`+
+		`<dc:creator><rdf:Seq><rdf:li>XmpAuthor</rdf:li></rdf:Seq></dc:creator></rdf:Description></rdf:RDF></x:xmpmeta>`),
+	`<< /Names [(init) 8 0 R] >>`,
+	`<< /Names [(secret.txt) 9 0 R] >>`,
+	`<< /S /JavaScript /JS (app.alert\(1\)) >>`,
+	`<< /Type /Filespec /F (secret.txt) /EF << /F 11 0 R >> >>`,
+	`<< /Type /Annot /Subtype /FileAttachment /FS 9 0 R /Rect [0 0 10 10] >>`,
+	pdfTestStream(`<< /Type /EmbeddedFile >>`, "attached payload"),
+	`<< /Author (InfoAuthor) /Producer (InfoProducer) /Title (Secret plan) /CreationDate (D:20240101120000+03'00') >>`,
+}
+
+// pdfTestStream записывает поток с длиной.
+func pdfTestStream(dict, content string) string {
+	return fmt.Sprintf("%s /Length %d >>\nstream\n%s\nendstream", strings.TrimSuffix(dict, ">>"), len(content), content)
+}
+
+// buildTestPDF собирает документ с классической таблицей перекрестных ссылок.
+// Объекты нумеруются с 1 в порядке следования.
+func buildTestPDF(objects []string, trailer string) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return out.Bytes()
+}
+
+// pdfTestTrailer - трейлер тестового документа с Info и ID.
+const pdfTestTrailer = `/Root 1 0 R /Info 12 0 R /ID [<0123456789ABCDEF> <0123456789ABCDEF>]`
+
+func TestCleanPDF(t *testing.T) {
+	brokenXref := buildTestPDF(pdfTestObjects, pdfTestTrailer)
+	start := bytes.LastIndex(brokenXref, []byte("startxref"))
+	brokenXref = append(brokenXref[:start:start], []byte("startxref\n999999\n%%EOF\n")...)
+
+	// Инкрементальное обновление: новая версия Info с другим автором.
+	updated := buildTestPDF(pdfTestObjects, pdfTestTrailer)
+	prev := bytes.LastIndex(updated, []byte("startxref"))
+	var prevXref int
+	fmt.Sscanf(string(updated[prev+len("startxref"):]), "%d", &prevXref)
+	offset := len(updated)
+	updated = append(updated, []byte("12 0 obj\n<< /Author (UpdateAuthor) /ModDate (D:20240202120000Z) >>\nendobj\n")...)
+	xref := len(updated)
+	updated = append(updated, []byte(fmt.Sprintf("xref\n12 1\n%010d 00000 n \ntrailer\n<< /Size 13 %s /Prev %d >>\nstartxref\n%d\n%%%%EOF\n",
+		offset, pdfTestTrailer, prevXref, xref))...)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		authors []string
+		blocks  []string
+	}{
+		{
+			name:    "все виды метаданных",
+			input:   buildTestPDF(pdfTestObjects, pdfTestTrailer),
+			authors: []string{"InfoAuthor", "XmpAuthor"},
+			blocks: []string{"PDF: Info", "PDF: идентификатор документа (ID)", "PDF: XMP (1)", "PDF: JavaScript (2)",
+				"PDF: вложенные файлы", "PDF: запуск программ (1)"},
+		},
+		{
+			name:    "неверное смещение таблицы ссылок",
+			input:   brokenXref,
+			authors: []string{"InfoAuthor", "XmpAuthor"},
+			blocks:  []string{"PDF: Info", "PDF: идентификатор документа (ID)", "PDF: XMP (1)"},
+		},
+		{
+			name:    "история изменений",
+			input:   updated,
+			authors: []string{"InfoAuthor", "UpdateAuthor"},
+			blocks:  []string{"PDF: Info", "PDF: история изменений (1)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, report, err := cleanPDF(tt.input, DefaultProcessOptions())
+			if err != nil {
+				t.Fatalf("cleanPDF: %v", err)
+			}
+			out := string(clean)
+			for _, s := range []string{"/Info", "/ID", "/Metadata", "XmpAuthor", "InfoAuthor", "UpdateAuthor", "Secret plan",
+				"/JavaScript", "app.alert", "/EmbeddedFiles", "/EmbeddedFile", "secret.txt", "attached payload",
+				"FileAttachment", "/Launch", "calc.exe"} {
+				if strings.Contains(out, s) {
+					t.Errorf("в результате осталось %q", s)
+				}
+			}
+			for _, s := range []string{"/MediaBox", "0 0 m 10 10 l S"} {
+				if !strings.Contains(out, s) {
+					t.Errorf("в результате нет %q", s)
+				}
+			}
+			if n := strings.Count(out, "%%EOF"); n != 1 {
+				t.Errorf("%%%%EOF встречается %d раз", n)
+			}
+			for _, author := range tt.authors {
+				if !containsString(report.Authors, author) {
+					t.Errorf("в отчете нет автора %q: %q", author, report.Authors)
+				}
+			}
+			for _, block := range tt.blocks {
+				if !containsString(report.RemovedBlocks, block) {
+					t.Errorf("в отчете нет %q: %q", block, report.RemovedBlocks)
+				}
+			}
+
+			findings, err := verifyPDF(clean, newVerifyPolicy(DefaultProcessOptions()))
+			if err != nil || len(findings) > 0 {
+				t.Errorf("verifyPDF: %v %q", err, findings)
+			}
+			// Очищенный документ при повторной очистке ничего не теряет и не содержит находок.
+			again, report, err := cleanPDF(clean, DefaultProcessOptions())
+			if err != nil || report.HasFindings() || !bytes.Equal(again, clean) {
+				t.Errorf("повторная очистка: %v %q", err, report.RemovedBlocks)
+			}
+		})
+	}
+}
+
+func TestCleanPDFRejects(t *testing.T) {
+	full := buildTestPDF(pdfTestObjects, pdfTestTrailer)
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"нет заголовка", []byte("not a pdf"), ErrInvalidPDF},
+		{"обрыв до первого объекта", full[:len("%PDF-1.7\n1 0 ob")], ErrInvalidPDF},
+		{"обрыв без каталога", buildTestPDF(pdfTestObjects[1:4], "/Root 9 0 R")[:200], ErrInvalidPDF},
+		{"зашифрованный", buildTestPDF(pdfTestObjects, pdfTestTrailer+" /Encrypt << /Filter /Standard >>"), ErrEncryptedPDF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := cleanPDF(tt.input, DefaultProcessOptions())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ожидалась ошибка %v, получено %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCleanPDFTruncated(t *testing.T) {
+	// Файл оборван после страниц: таблицы ссылок и трейлера нет, документ
+	// восстанавливается по объектам, и результат проходит проверку.
+	full := buildTestPDF(pdfTestObjects, pdfTestTrailer)
+	cut := bytes.Index(full, []byte("5 0 obj"))
+	clean, _, err := cleanPDF(full[:cut], DefaultProcessOptions())
+	if err != nil {
+		t.Fatalf("cleanPDF: %v", err)
+	}
+	if !bytes.Contains(clean, []byte("0 0 m 10 10 l S")) {
+		t.Errorf("содержимое страницы потеряно")
+	}
+	findings, err := verifyPDF(clean, newVerifyPolicy(DefaultProcessOptions()))
+	if err != nil || len(findings) > 0 {
+		t.Errorf("verifyPDF: %v %q", err, findings)
+	}
+}
@@ -0,0 +1,896 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для поиска ключевых слов
+	"compress/zlib" // Для распаковки потоков FlateDecode
+	"errors"        // Для ошибок-маркеров
+	"fmt"           // Для форматирования ошибок
+	"io"            // Для ограниченного чтения распакованных данных
+	"regexp"        // Для восстановления таблицы объектов
+	"sort"          // Для порядка объектов при восстановлении
+	"strconv"       // Для разбора чисел
+	"unicode/utf16" // Для текстовых строк PDF в UTF-16
+)
+
+// Разбор PDF: объекты, таблицы перекрестных ссылок (классические и потоки XRef, в том
+// числе цепочки инкрементальных обновлений), потоки объектов (ObjStm) и восстановление
+// таблицы сканированием файла, если она повреждена. Объекты читаются по требованию:
+// для очистки нужны только объекты, достижимые из каталога документа.
+
+// ErrInvalidPDF - файл определен как PDF, но его не удалось разобрать.
+var ErrInvalidPDF = errors.New("некорректный PDF")
+
+// ErrEncryptedPDF - зашифрованный PDF: без пароля нельзя ни прочитать, ни очистить метаданные.
+var ErrEncryptedPDF = errors.New("зашифрованные PDF не поддерживаются")
+
+// Ограничения разбора.
+const (
+	pdfMaxObjects       = 1 << 20  // Максимальный номер объекта
+	pdfMaxDepth         = 64       // Максимальная вложенность массивов и словарей
+	pdfMaxDecodedStream = 64 << 20 // Максимальный размер распакованного потока, байт
+	pdfMaxXrefSections  = 1024     // Максимальная длина цепочки таблиц (инкрементальных обновлений)
+)
+
+// Типы объектов PDF. Числа хранятся в исходной записи (pdfNumber), чтобы при записи
+// документа не менялась точность; null - это nil, логические значения - bool.
+type (
+	pdfName   string
+	pdfNumber string
+	pdfString []byte
+	pdfArray  []any
+	pdfDict   map[pdfName]any
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		data []byte // Данные в исходном (закодированном) виде
+	}
+)
+
+// pdfInt возвращает целое значение числа.
+func pdfInt(obj any) (int64, bool) {
+	n, ok := obj.(pdfNumber)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(string(n), 10, 64)
+	return v, err == nil
+}
+
+// pdfXrefEntry - запись таблицы перекрестных ссылок.
+type pdfXrefEntry struct {
+	kind   byte  // 0 - свободный объект, 1 - объект в файле, 2 - объект в потоке объектов
+	offset int64 // Смещение объекта (kind 1) или номер потока объектов (kind 2)
+	index  int   // Номер объекта в потоке объектов (kind 2)
+}
+
+// pdfDocument - разобранный документ.
+type pdfDocument struct {
+	data      []byte
+	version   string // Версия из заголовка ("1.7")
+	xref      map[int]pdfXrefEntry
+	trailer   pdfDict
+	sections  int // Количество таблиц перекрестных ссылок в цепочке
+	cache     map[int]any
+	objStms   map[int]map[int]any // Разобранные потоки объектов
+	resolving map[int]bool        // Объекты, которые читаются сейчас (защита от циклов)
+}
+
+// pdfHeaderPattern - заголовок файла с версией.
+var pdfHeaderPattern = regexp.MustCompile(`%PDF-(\d\.\d)`)
+
+// parsePDF разбирает документ: заголовок, цепочку таблиц перекрестных ссылок и трейлер.
+// Зашифрованные документы отклоняются (ErrEncryptedPDF).
+func parsePDF(data []byte) (*pdfDocument, error) {
+	header := pdfHeaderPattern.FindSubmatch(data[:min(len(data), 1024)])
+	if header == nil {
+		return nil, fmt.Errorf("%w: отсутствует заголовок %%PDF", ErrInvalidPDF)
+	}
+	d := &pdfDocument{data: data, version: string(header[1])}
+	d.reset()
+	if err := d.readXrefChain(); err != nil || !d.hasCatalog() {
+		// Таблица повреждена (или смещения в ней неверны): восстанавливаем ее по самим объектам,
+		// как это делают программы просмотра.
+		d.reset()
+		if err := d.reconstructXref(); err != nil {
+			return nil, err
+		}
+	}
+	if _, encrypted := d.trailer["Encrypt"]; encrypted {
+		return nil, ErrEncryptedPDF
+	}
+	if !d.hasCatalog() {
+		return nil, fmt.Errorf("%w: не найден каталог документа", ErrInvalidPDF)
+	}
+	return d, nil
+}
+
+func (d *pdfDocument) reset() {
+	d.xref = make(map[int]pdfXrefEntry)
+	d.trailer = nil
+	d.sections = 0
+	d.cache = make(map[int]any)
+	d.objStms = make(map[int]map[int]any)
+	d.resolving = make(map[int]bool)
+}
+
+// hasCatalog сообщает, ссылается ли трейлер на словарь каталога.
+func (d *pdfDocument) hasCatalog() bool {
+	if _, ok := d.trailer["Root"].(pdfRef); !ok {
+		return false
+	}
+	_, ok := d.resolve(d.trailer["Root"]).(pdfDict)
+	return ok
+}
+
+// readXrefChain читает последнюю таблицу (по startxref) и все предыдущие по ссылкам Prev.
+// Записи более новых таблиц имеют приоритет.
+func (d *pdfDocument) readXrefChain() error {
+	start := bytes.LastIndex(d.data, []byte("startxref"))
+	if start < 0 {
+		return fmt.Errorf("%w: не найден startxref", ErrInvalidPDF)
+	}
+	p := &pdfParser{data: d.data, pos: start + len("startxref")}
+	offset, ok := pdfInt(p.mustObject())
+	visited := make(map[int64]bool)
+	for ok && !visited[offset] {
+		if len(visited) >= pdfMaxXrefSections {
+			return fmt.Errorf("%w: слишком длинная цепочка таблиц", ErrInvalidPDF)
+		}
+		visited[offset] = true
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+		// Гибридные файлы: дополнительный поток XRef для читателей PDF 1.5.
+		if stm, hasStm := pdfInt(trailer["XRefStm"]); hasStm && !visited[stm] {
+			visited[stm] = true
+			if _, err := d.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		offset, ok = pdfInt(trailer["Prev"])
+	}
+	if d.trailer == nil {
+		return fmt.Errorf("%w: не найдена таблица перекрестных ссылок", ErrInvalidPDF)
+	}
+	d.sections = len(visited)
+	return nil
+}
+
+// readXrefSection читает одну таблицу (классическую или поток XRef) и возвращает ее трейлер.
+func (d *pdfDocument) readXrefSection(offset int64) (pdfDict, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, fmt.Errorf("%w: смещение таблицы за пределами файла", ErrInvalidPDF)
+	}
+	p := &pdfParser{data: d.data, pos: int(offset)}
+	p.skipSpace()
+	if !p.keyword("xref") {
+		return d.readXrefStream(int(offset))
+	}
+	for {
+		p.skipSpace()
+		if p.keyword("trailer") {
+			trailer, ok := p.mustObject().(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("%w: некорректный трейлер", ErrInvalidPDF)
+			}
+			return trailer, nil
+		}
+		first, ok1 := pdfInt(p.mustObject())
+		count, ok2 := pdfInt(p.mustObject())
+		if !ok1 || !ok2 || first < 0 || count < 0 || first+count > pdfMaxObjects {
+			return nil, fmt.Errorf("%w: некорректный подраздел таблицы", ErrInvalidPDF)
+		}
+		for i := int64(0); i < count; i++ {
+			entryOffset, ok1 := pdfInt(p.mustObject())
+			_, ok2 := pdfInt(p.mustObject())
+			p.skipSpace()
+			kind := p.word()
+			if !ok1 || !ok2 || kind != "n" && kind != "f" {
+				return nil, fmt.Errorf("%w: некорректная запись таблицы", ErrInvalidPDF)
+			}
+			entry := pdfXrefEntry{}
+			if kind == "n" {
+				entry = pdfXrefEntry{kind: 1, offset: entryOffset}
+			}
+			d.addXrefEntry(int(first+i), entry)
+		}
+	}
+}
+
+// readXrefStream читает таблицу в виде потока XRef (PDF 1.5).
+func (d *pdfDocument) readXrefStream(offset int) (pdfDict, error) {
+	obj, err := d.readObjectAt(offset, -1)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("%w: по смещению таблицы нет ни xref, ни потока XRef", ErrInvalidPDF)
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	var widths [3]int
+	w, _ := d.resolve(stream.dict["W"]).(pdfArray)
+	if len(w) != 3 {
+		return nil, fmt.Errorf("%w: некорректный параметр W потока XRef", ErrInvalidPDF)
+	}
+	for i := range widths {
+		v, ok := pdfInt(d.resolve(w[i]))
+		if !ok || v < 0 || v > 8 {
+			return nil, fmt.Errorf("%w: некорректный параметр W потока XRef", ErrInvalidPDF)
+		}
+		widths[i] = int(v)
+	}
+	rowLength := widths[0] + widths[1] + widths[2]
+	size, _ := pdfInt(d.resolve(stream.dict["Size"]))
+	index, _ := d.resolve(stream.dict["Index"]).(pdfArray)
+	if index == nil {
+		index = pdfArray{pdfNumber("0"), pdfNumber(strconv.FormatInt(size, 10))}
+	}
+	field := func(row []byte, from, width int, fallback int64) int64 {
+		if width == 0 {
+			return fallback
+		}
+		var v int64
+		for _, b := range row[from : from+width] {
+			v = v<<8 | int64(b)
+		}
+		return v
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		first, ok1 := pdfInt(index[i])
+		count, ok2 := pdfInt(index[i+1])
+		if !ok1 || !ok2 || first < 0 || count < 0 || first+count > pdfMaxObjects {
+			return nil, fmt.Errorf("%w: некорректный параметр Index потока XRef", ErrInvalidPDF)
+		}
+		for n := int64(0); n < count && rowLength > 0 && pos+rowLength <= len(data); n++ {
+			row := data[pos : pos+rowLength]
+			pos += rowLength
+			entry := pdfXrefEntry{}
+			switch field(row, 0, widths[0], 1) {
+			case 1:
+				entry = pdfXrefEntry{kind: 1, offset: field(row, widths[0], widths[1], 0)}
+			case 2:
+				entry = pdfXrefEntry{kind: 2, offset: field(row, widths[0], widths[1], 0), index: int(field(row, widths[0]+widths[1], widths[2], 0))}
+			}
+			d.addXrefEntry(int(first+n), entry)
+		}
+	}
+	return stream.dict, nil
+}
+
+// addXrefEntry добавляет запись, если объект еще не описан более новой таблицей.
+func (d *pdfDocument) addXrefEntry(num int, entry pdfXrefEntry) {
+	if _, exists := d.xref[num]; !exists {
+		d.xref[num] = entry
+	}
+}
+
+// pdfObjectPattern - начало косвенного объекта "N G obj".
+var pdfObjectPattern = regexp.MustCompile(`(\d{1,7})[ \t\r\n\f\x00]+(\d{1,5})[ \t\r\n\f\x00]+obj\b`)
+
+// reconstructXref восстанавливает таблицу, находя все объекты в файле (при повторах
+// действует последний - так устроены инкрементальные обновления). Трейлер берется
+// последний найденный, а если его нет - ищется объект каталога.
+func (d *pdfDocument) reconstructXref() error {
+	for _, match := range pdfObjectPattern.FindAllSubmatchIndex(d.data, -1) {
+		if match[0] > 0 && !isPDFWhitespace(d.data[match[0]-1]) && !isPDFDelimiter(d.data[match[0]-1]) {
+			continue // Число - часть другого слова
+		}
+		num, _ := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		if num > 0 && num < pdfMaxObjects {
+			d.xref[num] = pdfXrefEntry{kind: 1, offset: int64(match[0])}
+		}
+	}
+	if len(d.xref) == 0 {
+		return fmt.Errorf("%w: объекты не найдены", ErrInvalidPDF)
+	}
+	nums := make([]int, 0, len(d.xref))
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	// Объекты из потоков объектов (у них нет записи "N G obj" в файле).
+	for _, num := range nums {
+		if stream, ok := d.object(num).(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			for inner := range d.objectStream(num) {
+				d.addXrefEntry(inner, pdfXrefEntry{kind: 2, offset: int64(num)})
+			}
+		}
+	}
+
+	if pos := bytes.LastIndex(d.data, []byte("trailer")); pos >= 0 {
+		p := &pdfParser{data: d.data, pos: pos + len("trailer")}
+		d.trailer, _ = p.mustObject().(pdfDict)
+	}
+	if !d.hasCatalog() {
+		for _, num := range nums {
+			if stream, ok := d.object(num).(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+				d.trailer = stream.dict // Поток XRef содержит поля трейлера
+			}
+		}
+	}
+	if !d.hasCatalog() {
+		for num, entry := range d.xref {
+			if dict, ok := d.object(num).(pdfDict); ok && entry.kind != 0 && dict["Type"] == pdfName("Catalog") {
+				d.trailer = pdfDict{"Root": pdfRef{num: num}}
+				break
+			}
+		}
+	}
+	if d.trailer == nil {
+		return fmt.Errorf("%w: не найден трейлер", ErrInvalidPDF)
+	}
+	d.sections = 1
+	return nil
+}
+
+// versions возвращает все записанные в файле версии объекта num, включая версии,
+// замененные инкрементальными обновлениями (для отчета об удаленной истории).
+func (d *pdfDocument) versions(num int) []any {
+	var versions []any
+	for _, match := range pdfObjectPattern.FindAllSubmatchIndex(d.data, -1) {
+		if n, _ := strconv.Atoi(string(d.data[match[2]:match[3]])); n != num {
+			continue
+		}
+		if obj, err := d.readObjectAt(match[0], num); err == nil {
+			versions = append(versions, obj)
+		}
+	}
+	return versions
+}
+
+// resolve возвращает объект, на который указывает ссылка (или сам объект, если это не ссылка).
+func (d *pdfDocument) resolve(obj any) any {
+	if ref, ok := obj.(pdfRef); ok {
+		return d.object(ref.num)
+	}
+	return obj
+}
+
+// object возвращает косвенный объект по номеру (nil, если его нет или он поврежден).
+func (d *pdfDocument) object(num int) any {
+	if obj, ok := d.cache[num]; ok {
+		return obj
+	}
+	entry, ok := d.xref[num]
+	if !ok || entry.kind == 0 || d.resolving[num] {
+		return nil
+	}
+	d.resolving[num] = true
+	defer delete(d.resolving, num)
+
+	var obj any
+	switch entry.kind {
+	case 1:
+		obj, _ = d.readObjectAt(int(entry.offset), num)
+	case 2:
+		obj = d.objectStream(int(entry.offset))[num]
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+// readObjectAt читает косвенный объект "N G obj ... endobj" по смещению.
+// Если num >= 0, номер объекта должен совпадать.
+func (d *pdfDocument) readObjectAt(offset, num int) (any, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("%w: смещение объекта за пределами файла", ErrInvalidPDF)
+	}
+	p := &pdfParser{data: d.data, pos: offset}
+	n, ok1 := pdfInt(p.mustObject())
+	_, ok2 := pdfInt(p.mustObject())
+	p.skipSpace()
+	if !ok1 || !ok2 || !p.keyword("obj") || num >= 0 && n != int64(num) {
+		return nil, fmt.Errorf("%w: по смещению %d нет объекта %d", ErrInvalidPDF, offset, num)
+	}
+	obj, err := p.object()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	dict, isDict := obj.(pdfDict)
+	if !isDict || !p.keyword("stream") {
+		return obj, nil
+	}
+	// После "stream" идет CRLF или LF (некоторые программы пишут только CR).
+	if p.pos < len(d.data) && d.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(d.data) && d.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	if length, ok := pdfInt(d.resolve(dict["Length"])); ok && length >= 0 && int64(start)+length <= int64(len(d.data)) {
+		end := start + int(length)
+		check := &pdfParser{data: d.data, pos: end}
+		check.skipSpace()
+		if check.keyword("endstream") {
+			return &pdfStream{dict: dict, data: d.data[start:end]}, nil
+		}
+	}
+	// Длина неверна: данные потока - до ключевого слова endstream.
+	end := bytes.Index(d.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("%w: поток объекта %d не закончен", ErrInvalidPDF, num)
+	}
+	data := d.data[start : start+end]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return &pdfStream{dict: dict, data: data}, nil
+}
+
+// objectStream разбирает поток объектов (ObjStm) и возвращает его объекты по номерам.
+func (d *pdfDocument) objectStream(num int) map[int]any {
+	if objects, ok := d.objStms[num]; ok {
+		return objects
+	}
+	objects := make(map[int]any)
+	d.objStms[num] = objects
+	stream, ok := d.object(num).(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+		return objects
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return objects
+	}
+	count, _ := pdfInt(d.resolve(stream.dict["N"]))
+	first, _ := pdfInt(d.resolve(stream.dict["First"]))
+	if first < 0 || first > int64(len(data)) {
+		return objects
+	}
+	header := &pdfParser{data: data[:first]}
+	for i := int64(0); i < count && i < pdfMaxObjects; i++ {
+		inner, ok1 := pdfInt(header.mustObject())
+		offset, ok2 := pdfInt(header.mustObject())
+		if !ok1 || !ok2 || offset < 0 || first+offset >= int64(len(data)) {
+			break
+		}
+		p := &pdfParser{data: data, pos: int(first + offset)}
+		if obj, err := p.object(); err == nil {
+			if _, exists := objects[int(inner)]; !exists {
+				objects[int(inner)] = obj
+			}
+		}
+	}
+	return objects
+}
+
+// streamFilters возвращает фильтры потока и их параметры.
+func (d *pdfDocument) streamFilters(stream *pdfStream) ([]pdfName, []pdfDict) {
+	var filters []pdfName
+	var params []pdfDict
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{f}
+	case pdfArray:
+		for _, item := range f {
+			name, _ := d.resolve(item).(pdfName)
+			filters = append(filters, name)
+		}
+	}
+	switch p := d.resolve(stream.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []pdfDict{p}
+	case pdfArray:
+		for _, item := range p {
+			dict, _ := d.resolve(item).(pdfDict)
+			params = append(params, dict)
+		}
+	}
+	for len(params) < len(filters) {
+		params = append(params, nil)
+	}
+	return filters, params
+}
+
+// decodeStream распаковывает поток. Поддерживается FlateDecode (с предикторами PNG),
+// этого достаточно для служебных потоков (XRef, ObjStm, XMP).
+func (d *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	filters, params := d.streamFilters(stream)
+	return d.applyFilters(stream.data, filters, params)
+}
+
+func (d *pdfDocument) applyFilters(data []byte, filters []pdfName, params []pdfDict) ([]byte, error) {
+	for i, filter := range filters {
+		switch filter {
+		case "FlateDecode", "Fl":
+			var err error
+			if data, err = inflatePDF(data); err != nil {
+				return nil, err
+			}
+			if data, err = d.unpredict(data, params[i]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: фильтр %s не поддерживается", ErrInvalidPDF, filter)
+		}
+	}
+	return data, nil
+}
+
+// inflatePDF распаковывает zlib-данные с ограничением размера. Оборванные данные
+// (частая ошибка генераторов PDF) возвращаются в распакованной части.
+func inflatePDF(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPDF, err)
+	}
+	defer reader.Close()
+	out, err := io.ReadAll(io.LimitReader(reader, pdfMaxDecodedStream+1))
+	if len(out) > pdfMaxDecodedStream {
+		return nil, fmt.Errorf("%w: поток больше %d МБ после распаковки", ErrInvalidPDF, pdfMaxDecodedStream>>20)
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && len(out) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPDF, err)
+	}
+	return out, nil
+}
+
+// unpredict отменяет предиктор PNG (Predictor >= 10), который обычно применяется к потокам XRef.
+func (d *pdfDocument) unpredict(data []byte, params pdfDict) ([]byte, error) {
+	predictor, _ := pdfInt(d.resolve(params["Predictor"]))
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("%w: предиктор TIFF не поддерживается", ErrInvalidPDF)
+	}
+	param := func(name pdfName, fallback int64) int64 {
+		if v, ok := pdfInt(d.resolve(params[name])); ok && v > 0 && v <= 1<<16 {
+			return v
+		}
+		return fallback
+	}
+	colors, bits, columns := param("Colors", 1), param("BitsPerComponent", 8), param("Columns", 1)
+	bpp := int(max(1, colors*bits/8))
+	rowLength := int((columns*colors*bits + 7) / 8)
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLength)
+	for pos := 0; pos+1+rowLength <= len(data); pos += 1 + rowLength {
+		filter, row := data[pos], append([]byte(nil), data[pos+1:pos+1+rowLength]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += prev[i]
+			case 3:
+				row[i] += byte((int(left) + int(prev[i])) / 2)
+			case 4:
+				row[i] += paethPredictor(left, prev[i], upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// paethPredictor - предиктор Paeth (PNG).
+func paethPredictor(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// pdfParser - лексический и синтаксический разбор объектов PDF.
+type pdfParser struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
+
+// skipSpace пропускает пробелы и комментарии.
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case isPDFWhitespace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word читает последовательность обычных символов (число или ключевое слово).
+func (p *pdfParser) word() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFWhitespace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// keyword пропускает ключевое слово, если оно следует в текущей позиции.
+func (p *pdfParser) keyword(word string) bool {
+	end := p.pos + len(word)
+	if end > len(p.data) || string(p.data[p.pos:end]) != word {
+		return false
+	}
+	if end < len(p.data) && !isPDFWhitespace(p.data[end]) && !isPDFDelimiter(p.data[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// mustObject читает объект, возвращая nil при ошибке.
+func (p *pdfParser) mustObject() any {
+	obj, _ := p.object()
+	return obj
+}
+
+// object читает прямой объект (ссылка "N G R" тоже считается прямым объектом).
+func (p *pdfParser) object() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("%w: неожиданный конец данных", ErrInvalidPDF)
+	}
+	switch p.data[p.pos] {
+	case '/':
+		p.pos++
+		return p.name(), nil
+	case '(':
+		p.pos++
+		return p.literalString(), nil
+	case '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			p.pos += 2
+			return p.dict()
+		}
+		p.pos++
+		return p.hexString(), nil
+	case '[':
+		p.pos++
+		return p.array()
+	}
+	start := p.pos
+	word := p.word()
+	switch word {
+	case "":
+		p.pos++ // Недопустимый символ (например, лишняя скобка)
+		return nil, fmt.Errorf("%w: неожиданный символ по смещению %d", ErrInvalidPDF, start)
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if _, err := strconv.ParseFloat(word, 64); err != nil {
+		return nil, fmt.Errorf("%w: неожиданное слово %q по смещению %d", ErrInvalidPDF, word, start)
+	}
+	// Целое число может быть началом ссылки "N G R".
+	if num, err := strconv.Atoi(word); err == nil && num >= 0 {
+		save := p.pos
+		p.skipSpace()
+		if gen, err := strconv.Atoi(p.word()); err == nil && gen >= 0 {
+			p.skipSpace()
+			if p.keyword("R") {
+				return pdfRef{num: num, gen: gen}, nil
+			}
+		}
+		p.pos = save
+	}
+	return pdfNumber(word), nil
+}
+
+func (p *pdfParser) enter() error {
+	if p.depth++; p.depth > pdfMaxDepth {
+		return fmt.Errorf("%w: слишком глубокая вложенность объектов", ErrInvalidPDF)
+	}
+	return nil
+}
+
+func (p *pdfParser) dict() (any, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	dict := make(pdfDict)
+	for {
+		p.skipSpace()
+		if p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		key, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("%w: ключ словаря не является именем", ErrInvalidPDF)
+		}
+		value, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		if value != nil { // Значение null равносильно отсутствию ключа
+			dict[name] = value
+		}
+	}
+}
+
+func (p *pdfParser) array() (any, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	array := pdfArray{}
+	for {
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			return array, nil
+		}
+		value, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+}
+
+// name читает имя, раскрывая последовательности #XX.
+func (p *pdfParser) name() pdfName {
+	raw := p.word()
+	if !bytes.ContainsRune([]byte(raw), '#') {
+		return pdfName(raw)
+	}
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return pdfName(out)
+}
+
+// literalString читает строку в скобках (со вложенными скобками и экранированием).
+func (p *pdfParser) literalString() pdfString {
+	var out []byte
+	level := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			level++
+		case ')':
+			if level--; level == 0 {
+				return out
+			}
+		case '\r':
+			// Конец строки внутри строки всегда означает LF.
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				p.pos++
+			}
+			c = '\n'
+		case '\\':
+			if p.pos >= len(p.data) {
+				return out
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// Перенос строки после обратной косой черты не входит в строку.
+				if e == '\r' && p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e // \( \) \\ и неизвестные последовательности
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hexString читает шестнадцатеричную строку <...>.
+func (p *pdfParser) hexString() pdfString {
+	var out []byte
+	var digits []byte
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		if c := p.data[p.pos]; !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	p.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	for i := 0; i+1 < len(digits); i += 2 {
+		if v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8); err == nil {
+			out = append(out, byte(v))
+		}
+	}
+	return out
+}
+
+// decodePDFText декодирует текстовую строку PDF: UTF-16BE или UTF-8 с BOM, иначе
+// PDFDocEncoding (для печатных символов совпадает с Latin-1).
+func decodePDFText(s pdfString) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF:
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case len(s) >= 3 && s[0] == 0xEF && s[1] == 0xBB && s[2] == 0xBF:
+		return string(s[3:])
+	}
+	runes := make([]rune, len(s))
+	for i, b := range s {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки результата
+	"encoding/binary" // Для чтения длин чанков (big-endian)
+	"fmt"             // Для форматирования ошибок
+	"hash/crc32"      // Для проверки контрольных сумм чанков
+)
+
+// pngSignature - 8-байтовая сигнатура, с которой начинается любой PNG-файл.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngAllowedChunks - чанки, которые переносятся в очищенный файл.
+// Это только данные, необходимые для отображения изображения:
+//   - IHDR, PLTE, IDAT, IEND - обязательные чанки PNG;
+//   - tRNS - прозрачность;
+//   - acTL, fcTL, fdAT - управление анимацией и кадры APNG.
+//
+// Все остальное удаляется: текстовые чанки (tEXt, zTXt, iTXt), EXIF (eXIf),
+// время изменения (tIME), цветовые профили и прочие вспомогательные чанки,
+// а также приватные чанки программ.
+var pngAllowedChunks = map[string]bool{
+	"IHDR": true,
+	"PLTE": true,
+	"IDAT": true,
+	"IEND": true,
+	"tRNS": true,
+	"acTL": true,
+	"fcTL": true,
+	"fdAT": true,
+}
+
+// pngChunk описывает один чанк PNG-файла.
+type pngChunk struct {
+	Type string // Тип чанка ("IHDR", "tEXt" и т.д.)
+	Data []byte // Данные чанка без длины, типа и CRC
+}
+
+// readPNGChunks разбирает поток чанков PNG до IEND включительно с проверкой CRC.
+// Данные после IEND игнорируются.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("отсутствует сигнатура PNG")
+	}
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for {
+		if pos+12 > len(data) {
+			return nil, fmt.Errorf("PNG обрезан: отсутствует чанк IEND")
+		}
+		length := binary.BigEndian.Uint32(data[pos:])
+		if uint64(pos)+12+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("некорректная длина чанка по смещению %d", pos)
+		}
+		typ := data[pos+4 : pos+8]
+		body := data[pos+8 : pos+8+int(length)]
+		crc := binary.BigEndian.Uint32(data[pos+8+int(length):])
+		if crc32.ChecksumIEEE(data[pos+4:pos+8+int(length)]) != crc {
+			return nil, fmt.Errorf("неверная контрольная сумма чанка %q", typ)
+		}
+		chunks = append(chunks, pngChunk{Type: string(typ), Data: body})
+		pos += 12 + int(length)
+		if string(typ) == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+// writePNGChunk записывает чанк с длиной и пересчитанной контрольной суммой.
+func writePNGChunk(out *bytes.Buffer, typ string, body []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(body)))
+	copy(header[4:], typ)
+	out.Write(header[:])
+	out.Write(body)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	out.Write(sum[:])
+}
+
+// stripPNGMetadata переписывает поток чанков PNG, оставляя только чанки из
+// pngAllowedChunks. Сжатые данные изображения (IDAT, fdAT) копируются без
+// перекомпрессии, поэтому качество и кадры анимации APNG сохраняются.
+// Данные после IEND отбрасываются.
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].Type != "IHDR" {
+		return nil, fmt.Errorf("первым чанком PNG должен быть IHDR")
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(pngSignature)
+	for _, chunk := range chunks {
+		if pngAllowedChunks[chunk.Type] {
+			writePNGChunk(&out, chunk.Type, chunk.Data)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// isAPNG сообщает, содержит ли PNG управляющий чанк анимации acTL.
+func isAPNG(chunks []pngChunk) bool {
+	for _, chunk := range chunks {
+		if chunk.Type == "acTL" {
+			return true
+		}
+		if chunk.Type == "IDAT" {
+			// acTL обязан идти до первого IDAT.
+			return false
+		}
+	}
+	return false
+}
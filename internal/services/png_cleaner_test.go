@@ -0,0 +1,219 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки файлов
+	"encoding/binary" // Для полей чанков APNG
+	"image"           // Для сравнения пикселей
+	"image/png"       // Для кодирования и декодирования
+	"slices"          // Для сравнения списков чанков
+	"testing"         // Для тестов
+)
+
+// testAPNG собирает анимированный PNG из двух кадров: первый кадр - обычные IDAT,
+// второй - fdAT с данными IDAT другого изображения того же размера.
+func testAPNG(t *testing.T, extra ...pngChunk) []byte {
+	t.Helper()
+	encode := func(img image.Image) []pngChunk {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("png.Encode: %v", err)
+		}
+		chunks, err := readPNGChunks(buf.Bytes())
+		if err != nil {
+			t.Fatalf("readPNGChunks: %v", err)
+		}
+		return chunks
+	}
+	first, second := encode(testGradient(16, 8)), encode(testBlocks(16, 8))
+	u32 := func(values ...uint32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	fcTL := func(seq uint32) []byte {
+		// Номер, размер, смещение, задержка 1/10 с, dispose/blend.
+		return append(append(u32(seq, 16, 8, 0, 0), 0, 1, 0, 10), 0, 0)
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	writePNGChunk(&out, "IHDR", first[0].Data)
+	for _, e := range extra {
+		writePNGChunk(&out, e.Type, e.Data)
+	}
+	writePNGChunk(&out, "acTL", u32(2, 0))
+	writePNGChunk(&out, "fcTL", fcTL(0))
+	seq := uint32(1)
+	for _, c := range first {
+		if c.Type == "IDAT" {
+			writePNGChunk(&out, "IDAT", c.Data)
+		}
+	}
+	writePNGChunk(&out, "fcTL", fcTL(seq))
+	seq++
+	for _, c := range second {
+		if c.Type == "IDAT" {
+			writePNGChunk(&out, "fdAT", append(u32(seq), c.Data...))
+			seq++
+		}
+	}
+	writePNGChunk(&out, "tEXt", []byte("Comment\x00после кадров"))
+	writePNGChunk(&out, "IEND", nil)
+	return out.Bytes()
+}
+
+// testBlocks возвращает testImage, увеличенное до w x h без сглаживания.
+func testBlocks(w, h int) *image.NRGBA {
+	src := testImage()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, src.At(x*4/w, y*4/h))
+		}
+	}
+	return img
+}
+
+// pngChunkTypes возвращает типы чанков файла по порядку.
+func pngChunkTypes(t *testing.T, data []byte) []string {
+	t.Helper()
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		t.Fatalf("readPNGChunks: %v", err)
+	}
+	types := make([]string, len(chunks))
+	for i, c := range chunks {
+		types[i] = c.Type
+	}
+	return types
+}
+
+// checkSamePNGPixels проверяет, что оба PNG декодируются в одинаковые пиксели.
+func checkSamePNGPixels(t *testing.T, original, clean []byte) {
+	t.Helper()
+	want, err := png.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("исходный файл не декодируется: %v", err)
+	}
+	got, err := png.Decode(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("очищенный файл не декодируется: %v", err)
+	}
+	b := want.Bounds()
+	if got.Bounds() != b {
+		t.Fatalf("размер %v, ожидался %v", got.Bounds(), b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("пиксель (%d,%d): %v, ожидался %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	metadata := []pngChunk{
+		{Type: "tEXt", Data: []byte("Author\x00Ivanov")},
+		{Type: "zTXt", Data: []byte("Comment\x00\x00x\x9c\x03\x00\x00\x00\x00\x01")},
+		{Type: "iTXt", Data: []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")},
+		{Type: "eXIf", Data: encodeEXIF([]exifEntry{testASCIIEntry(exifTagMake, "Canon")}, nil, nil)},
+		{Type: "tIME", Data: []byte{0x07, 0xE8, 5, 1, 12, 0, 0}},
+		{Type: "iCCP", Data: []byte("Display P3\x00\x00x")},
+		{Type: "prVt", Data: []byte("private")},
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  []string // Ожидаемые чанки результата
+	}{
+		{"PNG", testPNG(t, metadata...), []string{"IHDR", "IDAT", "IEND"}},
+		{"данные после IEND", append(testPNG(t, metadata...), "PK\x03\x04hidden"...), []string{"IHDR", "IDAT", "IEND"}},
+		{"APNG", testAPNG(t, metadata...), []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "IEND"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, err := stripPNGMetadata(tt.input)
+			if err != nil {
+				t.Fatalf("stripPNGMetadata: %v", err)
+			}
+			if got := pngChunkTypes(t, clean); !slices.Equal(got, tt.want) {
+				t.Errorf("чанки %q, ожидались %q", got, tt.want)
+			}
+			checkSamePNGPixels(t, tt.input, clean)
+			findings, err := verifyPNG(clean)
+			if err != nil || len(findings) > 0 {
+				t.Errorf("verifyPNG: %v %q", err, findings)
+			}
+		})
+	}
+
+	t.Run("кадры APNG не меняются", func(t *testing.T) {
+		input := testAPNG(t, metadata...)
+		clean, err := stripPNGMetadata(input)
+		if err != nil {
+			t.Fatalf("stripPNGMetadata: %v", err)
+		}
+		if !isAPNG(mustPNGChunks(t, clean)) {
+			t.Errorf("анимация потеряна")
+		}
+		want := mustPNGChunks(t, input)
+		got := mustPNGChunks(t, clean)
+		for _, typ := range []string{"acTL", "fcTL", "IDAT", "fdAT"} {
+			if !bytes.Equal(joinPNGChunks(want, typ), joinPNGChunks(got, typ)) {
+				t.Errorf("данные %s изменены", typ)
+			}
+		}
+	})
+}
+
+func TestStripPNGMetadataRejects(t *testing.T) {
+	badCRC := testPNG(t)
+	badCRC[len(pngSignature)+8+13] ^= 0xFF // Контрольная сумма IHDR
+	valid := testPNG(t)
+	withoutIEND := valid[:len(valid)-12]
+	var noIHDR bytes.Buffer
+	noIHDR.Write(pngSignature)
+	writePNGChunk(&noIHDR, "tEXt", []byte("a\x00b"))
+	writePNGChunk(&noIHDR, "IEND", nil)
+
+	for _, tt := range []struct {
+		name  string
+		input []byte
+	}{
+		{"неверная контрольная сумма", badCRC},
+		{"нет IEND", withoutIEND},
+		{"первый чанк не IHDR", noIHDR.Bytes()},
+		{"нет сигнатуры", valid[8:]},
+		{"длина чанка за концом файла", append(append([]byte{}, pngSignature...), 0x7F, 0, 0, 0, 'I', 'H', 'D', 'R')},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := stripPNGMetadata(tt.input); err == nil {
+				t.Errorf("ожидалась ошибка")
+			}
+		})
+	}
+}
+
+func mustPNGChunks(t *testing.T, data []byte) []pngChunk {
+	t.Helper()
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		t.Fatalf("readPNGChunks: %v", err)
+	}
+	return chunks
+}
+
+// joinPNGChunks объединяет данные всех чанков типа typ.
+func joinPNGChunks(chunks []pngChunk, typ string) []byte {
+	var out []byte
+	for _, c := range chunks {
+		if c.Type == typ {
+			out = append(out, c.Data...)
+		}
+	}
+	return out
+}
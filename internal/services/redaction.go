@@ -0,0 +1,202 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"encoding/json" // Для разбора областей из формы загрузки
+	"fmt"           // Для форматирования ошибок
+	"image"         // Для работы с изображениями
+	"image/color"   // Для цвета заливки
+	"image/draw"    // Для копирования пикселей
+	"image/gif"     // Для обработки кадров анимации
+	"strings"       // Для нормализации режима
+)
+
+// RedactionMode - способ скрытия области изображения.
+type RedactionMode string
+
+const (
+	// RedactionBlur - сильное размытие (многократный box-blur с большим радиусом).
+	RedactionBlur RedactionMode = "blur"
+	// RedactionPixelate - пикселизация крупными блоками.
+	RedactionPixelate RedactionMode = "pixelate"
+	// RedactionFill - заливка сплошным черным цветом. Самый надежный способ:
+	// размытие и пикселизацию мелкого текста иногда удается частично восстановить.
+	RedactionFill RedactionMode = "fill"
+)
+
+// maxRedactionsPerFile - ограничение на количество областей для одного файла.
+const maxRedactionsPerFile = 64
+
+// RedactionRegion - прямоугольная область, которую нужно скрыть.
+// Координаты задаются в пикселях изображения в том виде, как его показывает
+// просмотрщик (после применения EXIF-ориентации), от левого верхнего угла.
+type RedactionRegion struct {
+	X      int           `json:"x"`
+	Y      int           `json:"y"`
+	Width  int           `json:"width"`
+	Height int           `json:"height"`
+	Mode   RedactionMode `json:"mode"`
+}
+
+// ParseRedactions разбирает JSON с областями скрытия, сгруппированными по имени файла:
+//
+//	{"photo.jpg": [{"x": 10, "y": 20, "width": 100, "height": 40, "mode": "blur"}]}
+//
+// Пустой режим означает заливку (RedactionFill). Пустая строка - нет областей.
+func ParseRedactions(raw string) (map[string][]RedactionRegion, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var byFile map[string][]RedactionRegion
+	if err := json.Unmarshal([]byte(raw), &byFile); err != nil {
+		return nil, fmt.Errorf("некорректный JSON областей скрытия: %w", err)
+	}
+	for name, regions := range byFile {
+		if len(regions) > maxRedactionsPerFile {
+			return nil, fmt.Errorf("файл '%s': слишком много областей скрытия (%d, максимум %d)", name, len(regions), maxRedactionsPerFile)
+		}
+		for i := range regions {
+			r := &regions[i]
+			mode := RedactionMode(strings.ToLower(strings.TrimSpace(string(r.Mode))))
+			switch mode {
+			case "":
+				mode = RedactionFill
+			case RedactionBlur, RedactionPixelate, RedactionFill:
+			default:
+				return nil, fmt.Errorf("файл '%s': неизвестный режим скрытия %q (допустимо: %s, %s, %s)", name, r.Mode, RedactionBlur, RedactionPixelate, RedactionFill)
+			}
+			r.Mode = mode
+			if r.Width <= 0 || r.Height <= 0 {
+				return nil, fmt.Errorf("файл '%s': область %d имеет нулевой размер", name, i+1)
+			}
+		}
+	}
+	return byFile, nil
+}
+
+// applyRedactions возвращает копию изображения со скрытыми областями.
+// Области обрезаются по границам изображения; области целиком за его пределами пропускаются.
+func applyRedactions(img image.Image, regions []RedactionRegion) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	for _, region := range regions {
+		rect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height).
+			Add(bounds.Min).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+		redactRect(dst, rect, region.Mode)
+	}
+	return dst
+}
+
+// redactGIFFrames скрывает области во всех кадрах анимации. Координаты областей
+// относятся к логическому экрану GIF.
+func redactGIFFrames(anim *gif.GIF, regions []RedactionRegion) {
+	for _, frame := range anim.Image {
+		redactPalettedFrame(frame, regions)
+	}
+}
+
+// redactPalettedFrame скрывает области в одном кадре GIF. Кадр обрабатывается
+// в пересечении областей со своими границами, а результат снова приводится
+// к палитре кадра.
+func redactPalettedFrame(frame *image.Paletted, regions []RedactionRegion) {
+	bounds := frame.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, frame, bounds.Min, draw.Src)
+	changed := false
+	for _, region := range regions {
+		rect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+		redactRect(rgba, rect, region.Mode)
+		changed = true
+	}
+	if changed {
+		// draw.Src подбирает для каждого пикселя ближайший цвет палитры кадра.
+		draw.Draw(frame, bounds, rgba, bounds.Min, draw.Src)
+	}
+}
+
+// redactRect применяет режим скрытия к прямоугольнику rect изображения dst.
+// При размытии и пикселизации используются только пиксели внутри rect,
+// поэтому содержимое области не "растекается" за ее пределы.
+func redactRect(dst *image.RGBA, rect image.Rectangle, mode RedactionMode) {
+	switch mode {
+	case RedactionBlur:
+		// Радиус пропорционален размеру области: мелкие детали (текст, черты лица)
+		// должны полностью исчезнуть. Три прохода box-blur приближают гауссово размытие.
+		radius := max(4, min(rect.Dx(), rect.Dy())/6)
+		for pass := 0; pass < 3; pass++ {
+			boxBlur(dst, rect, radius)
+		}
+	case RedactionPixelate:
+		pixelate(dst, rect, max(8, min(rect.Dx(), rect.Dy())/8))
+	default:
+		draw.Draw(dst, rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	}
+}
+
+// boxBlur выполняет горизонтальный и вертикальный проходы усреднения с окном 2*radius+1
+// внутри rect. На краях окно обрезается по границам области.
+func boxBlur(img *image.RGBA, rect image.Rectangle, radius int) {
+	w, h := rect.Dx(), rect.Dy()
+	buf := make([]uint32, 4*max(w, h))
+	line := make([]uint8, 4*max(w, h))
+
+	blurLine := func(n int, offset func(i int) int) {
+		// Префиксные суммы по каждому каналу.
+		for c := 0; c < 4; c++ {
+			sum := uint32(0)
+			for i := 0; i < n; i++ {
+				sum += uint32(img.Pix[offset(i)+c])
+				buf[i*4+c] = sum
+			}
+		}
+		for i := 0; i < n; i++ {
+			lo, hi := max(0, i-radius), min(n-1, i+radius)
+			count := uint32(hi - lo + 1)
+			for c := 0; c < 4; c++ {
+				total := buf[hi*4+c]
+				if lo > 0 {
+					total -= buf[(lo-1)*4+c]
+				}
+				line[i*4+c] = uint8((total + count/2) / count)
+			}
+		}
+		for i := 0; i < n; i++ {
+			copy(img.Pix[offset(i):offset(i)+4], line[i*4:i*4+4])
+		}
+	}
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		blurLine(w, func(i int) int { return img.PixOffset(rect.Min.X+i, y) })
+	}
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		blurLine(h, func(i int) int { return img.PixOffset(x, rect.Min.Y+i) })
+	}
+}
+
+// pixelate заменяет каждый блок size x size внутри rect его средним цветом.
+func pixelate(img *image.RGBA, rect image.Rectangle, size int) {
+	for by := rect.Min.Y; by < rect.Max.Y; by += size {
+		for bx := rect.Min.X; bx < rect.Max.X; bx += size {
+			block := image.Rect(bx, by, bx+size, by+size).Intersect(rect)
+			var sum [4]uint64
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					o := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						sum[c] += uint64(img.Pix[o+c])
+					}
+				}
+			}
+			n := uint64(block.Dx() * block.Dy())
+			avg := color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), uint8(sum[3] / n)}
+			draw.Draw(img, block, image.NewUniform(avg), image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"               // Для кодирования тестовых файлов
+	"image"               // Для тестовых изображений
+	"image/color"         // Для цветов тестовых изображений
+	"image/color/palette" // Для палитры кадров GIF
+	"image/gif"           // Для кадров анимации
+	"image/jpeg"          // Для сквозной проверки
+	"os"                  // Для чтения сохраненного файла
+	"path/filepath"       // Для пути к сохраненному файлу
+	"strings"             // Для проверки текста ошибок
+	"testing"             // Для тестов
+)
+
+// testStripes возвращает изображение с чередующимися черными и белыми столбцами
+// шириной в один пиксель - худший случай для скрытия мелкого текста.
+func testStripes(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(255 * (x % 2))
+			img.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+// checkOutsideUnchanged проверяет, что пиксели вне rect совпадают с исходными.
+func checkOutsideUnchanged(t *testing.T, got, want image.Image, rect image.Rectangle) {
+	t.Helper()
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if image.Pt(x, y).In(rect) {
+				continue
+			}
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("пиксель (%d,%d) вне области изменен: %v, был %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+// grayRange возвращает минимальное и максимальное значение красного канала в rect.
+func grayRange(img *image.RGBA, rect image.Rectangle) (lo, hi uint8) {
+	lo = 255
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			v := img.RGBAAt(x, y).R
+			lo, hi = min(lo, v), max(hi, v)
+		}
+	}
+	return lo, hi
+}
+
+func TestApplyRedactions(t *testing.T) {
+	src := testStripes(100, 60)
+	rect := image.Rect(20, 10, 68, 50)
+	region := RedactionRegion{X: 20, Y: 10, Width: 48, Height: 40}
+
+	t.Run("заливка", func(t *testing.T) {
+		region := region
+		region.Mode = RedactionFill
+		got := applyRedactions(src, []RedactionRegion{region})
+		if lo, hi := grayRange(got, rect); lo != 0 || hi != 0 {
+			t.Errorf("область не залита черным: значения %d..%d", lo, hi)
+		}
+		checkOutsideUnchanged(t, got, src, rect)
+	})
+
+	t.Run("размытие", func(t *testing.T) {
+		region := region
+		region.Mode = RedactionBlur
+		got := applyRedactions(src, []RedactionRegion{region})
+		// Полосы шириной в пиксель исчезают: внутри области остается почти ровный серый.
+		if lo, hi := grayRange(got, rect); hi-lo > 16 || lo < 100 || hi > 155 {
+			t.Errorf("полосы различимы после размытия: значения %d..%d", lo, hi)
+		}
+		checkOutsideUnchanged(t, got, src, rect)
+	})
+
+	t.Run("пикселизация", func(t *testing.T) {
+		region := region
+		region.Mode = RedactionPixelate
+		got := applyRedactions(src, []RedactionRegion{region})
+		// Блоки 8x8 от левого верхнего угла области заполнены средним цветом.
+		for by := rect.Min.Y; by < rect.Max.Y; by += 8 {
+			for bx := rect.Min.X; bx < rect.Max.X; bx += 8 {
+				block := image.Rect(bx, by, bx+8, by+8).Intersect(rect)
+				if lo, hi := grayRange(got, block); lo != hi || lo < 120 || lo > 135 {
+					t.Fatalf("блок %v неоднороден или не усреднен: %d..%d", block, lo, hi)
+				}
+			}
+		}
+		checkOutsideUnchanged(t, got, src, rect)
+	})
+
+	t.Run("исходное изображение не меняется", func(t *testing.T) {
+		before := append([]uint8(nil), src.Pix...)
+		applyRedactions(src, []RedactionRegion{{X: 0, Y: 0, Width: 100, Height: 60, Mode: RedactionBlur}})
+		if !bytes.Equal(before, src.Pix) {
+			t.Errorf("applyRedactions изменила исходное изображение")
+		}
+	})
+
+	t.Run("области за границами", func(t *testing.T) {
+		got := applyRedactions(src, []RedactionRegion{
+			{X: 90, Y: 50, Width: 50, Height: 50, Mode: RedactionFill}, // Частично за границей
+			{X: 200, Y: 0, Width: 10, Height: 10, Mode: RedactionFill}, // Целиком за границей
+			{X: -5, Y: -5, Width: 8, Height: 8, Mode: RedactionBlur},   // Отрицательные координаты
+		})
+		if lo, hi := grayRange(got, image.Rect(90, 50, 100, 60)); lo != 0 || hi != 0 {
+			t.Errorf("обрезанная область не залита: %d..%d", lo, hi)
+		}
+		checkOutsideUnchanged(t, got, src, image.Rect(90, 50, 100, 60).Union(image.Rect(0, 0, 3, 3)))
+	})
+
+	t.Run("изображение со смещенными границами", func(t *testing.T) {
+		sub := src.SubImage(image.Rect(10, 10, 60, 60))
+		got := applyRedactions(sub, []RedactionRegion{{X: 0, Y: 0, Width: 5, Height: 5, Mode: RedactionFill}})
+		// Координаты области отсчитываются от левого верхнего угла изображения.
+		if lo, hi := grayRange(got, image.Rect(10, 10, 15, 15)); lo != 0 || hi != 0 {
+			t.Errorf("область не залита: %d..%d", lo, hi)
+		}
+		checkOutsideUnchanged(t, got, sub, image.Rect(10, 10, 15, 15))
+	})
+}
+
+func TestRedactGIFFrames(t *testing.T) {
+	whiteIndex := uint8(len(palette.Plan9) - 1) // Последний цвет Plan9 - белый
+	frames := []*image.Paletted{
+		image.NewPaletted(image.Rect(0, 0, 40, 40), palette.Plan9),
+		image.NewPaletted(image.Rect(20, 20, 40, 40), palette.Plan9), // Кадр в правом нижнем углу
+		image.NewPaletted(image.Rect(0, 0, 10, 10), palette.Plan9),   // Кадр вне области
+	}
+	for _, f := range frames {
+		for i := range f.Pix {
+			f.Pix[i] = whiteIndex
+		}
+	}
+	anim := &gif.GIF{Image: frames, Delay: []int{10, 10, 10}}
+	redactGIFFrames(anim, []RedactionRegion{{X: 15, Y: 15, Width: 10, Height: 10, Mode: RedactionFill}})
+
+	black := func(f *image.Paletted, x, y int) bool {
+		r, g, b, _ := f.At(x, y).RGBA()
+		return r == 0 && g == 0 && b == 0
+	}
+	// Координаты области относятся к логическому экрану, а не к кадру.
+	if !black(frames[0], 15, 15) || !black(frames[0], 24, 24) || black(frames[0], 25, 25) || black(frames[0], 14, 14) {
+		t.Errorf("первый кадр скрыт неверно")
+	}
+	if !black(frames[1], 20, 20) || !black(frames[1], 24, 24) || black(frames[1], 25, 20) {
+		t.Errorf("кадр со смещением скрыт неверно")
+	}
+	for _, v := range frames[2].Pix {
+		if v != whiteIndex {
+			t.Fatalf("кадр вне области изменен")
+		}
+	}
+}
+
+func TestParseRedactions(t *testing.T) {
+	byFile, err := ParseRedactions(`{"a.jpg": [{"x": 1, "y": 2, "width": 3, "height": 4}, {"x": 0, "y": 0, "width": 5, "height": 5, "mode": " Blur "}]}`)
+	if err != nil {
+		t.Fatalf("ParseRedactions: %v", err)
+	}
+	want := []RedactionRegion{{X: 1, Y: 2, Width: 3, Height: 4, Mode: RedactionFill}, {Width: 5, Height: 5, Mode: RedactionBlur}}
+	if got := byFile["a.jpg"]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("области %+v, ожидались %+v", got, want)
+	}
+	if byFile, err := ParseRedactions("  "); byFile != nil || err != nil {
+		t.Errorf("пустая строка: %v, %v", byFile, err)
+	}
+
+	tooMany := `{"a.jpg": [` + strings.Repeat(`{"width": 1, "height": 1},`, maxRedactionsPerFile) + `{"width": 1, "height": 1}]}`
+	for _, tt := range []struct {
+		name, raw, want string
+	}{
+		{"некорректный JSON", `{"a.jpg": [`, "некорректный JSON"},
+		{"неизвестный режим", `{"a.jpg": [{"width": 1, "height": 1, "mode": "erase"}]}`, "неизвестный режим"},
+		{"нулевой размер", `{"a.jpg": [{"width": 0, "height": 1}]}`, "нулевой размер"},
+		{"отрицательный размер", `{"a.jpg": [{"width": 5, "height": -1}]}`, "нулевой размер"},
+		{"слишком много областей", tooMany, "слишком много"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRedactions(tt.raw); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ошибка %v, ожидалась содержащая %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessImageRedactsAfterOrientation(t *testing.T) {
+	// Файл хранит пиксели "как с сенсора" 64x32 и тег Orientation=6: на экране он 32x64.
+	// Область задается в координатах показанного изображения.
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testStripes(64, 32), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	input := insertJPEGSegments(encoded.Bytes(), []jpegSegment{testEXIFSegment([]exifEntry{newShortEntry(exifTagOrientation, 6)}, nil, nil)})
+
+	opts := DefaultProcessOptions()
+	opts.Redactions = []RedactionRegion{{X: 0, Y: 0, Width: 16, Height: 16, Mode: RedactionFill}}
+	dir := t.TempDir()
+	stored, _, err := ProcessAndSaveData("photo.jpg", input, dir, opts)
+	if err != nil {
+		t.Fatalf("ProcessAndSaveData: %v", err)
+	}
+	clean, err := os.ReadFile(filepath.Join(dir, stored))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 64 || jpegOrientation(clean) != 1 {
+		t.Fatalf("размер %v, ориентация %d: поворот не применен к пикселям", img.Bounds(), jpegOrientation(clean))
+	}
+	for _, p := range []image.Point{{2, 2}, {13, 13}, {8, 2}} {
+		checkColor(t, "скрытая область", img.At(p.X, p.Y), color.NRGBA{A: 255}, 12)
+	}
+	// Вне области полосы сохраняются (после поворота они горизонтальные).
+	_, g1, _, _ := img.At(20, 40).RGBA()
+	_, g2, _, _ := img.At(20, 41).RGBA()
+	if d := int(g1>>8) - int(g2>>8); d < 150 && d > -150 {
+		t.Errorf("полосы вне области потеряны: %d и %d", g1>>8, g2>>8)
+	}
+}
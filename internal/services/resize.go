@@ -0,0 +1,122 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"fmt"       // Для форматирования ошибок
+	"image"     // Для работы с изображениями
+	"image/gif" // Для уменьшения кадров анимации
+	"strconv"   // Для разбора размера
+	"strings"   // Для нормализации значений настроек
+
+	// Сторонние библиотеки
+	"golang.org/x/image/draw" // Для качественного масштабирования (Catmull-Rom)
+)
+
+// Уменьшение изображения при загрузке: получателю 48-мегапиксельного снимка с телефона
+// обычно достаточно посмотреть его на экране. Уменьшенный файл занимает меньше места
+// на диске и выдает меньше деталей (отражения, текст на заднем плане).
+// Изображения, которые уже меньше заданного размера, не увеличиваются.
+
+// ResizePreset - готовый вариант ограничения размера.
+type ResizePreset string
+
+const (
+	ResizeOriginal ResizePreset = "original" // Без уменьшения
+	ResizeScreen   ResizePreset = "screen"   // Для просмотра на экране компьютера
+	ResizeChat     ResizePreset = "chat"     // Для быстрого просмотра в мессенджере
+)
+
+// resizePresetEdges - длинная сторона для каждого варианта, пикселей (0 - без уменьшения).
+var resizePresetEdges = map[ResizePreset]int{
+	ResizeOriginal: 0,
+	ResizeScreen:   2560,
+	ResizeChat:     1280,
+}
+
+// Допустимые значения максимальной длинной стороны.
+const (
+	minLongEdge = 64
+	maxLongEdge = DefaultMaxImageWidth
+)
+
+// ParseResizePreset разбирает вариант ограничения размера и возвращает максимальную
+// длинную сторону в пикселях (переменная окружения RESIZE_PRESET или поле формы загрузки).
+func ParseResizePreset(value string) (int, error) {
+	edge, ok := resizePresetEdges[ResizePreset(strings.ToLower(strings.TrimSpace(value)))]
+	if !ok {
+		return 0, fmt.Errorf("неизвестный вариант размера: %q (допустимо: %s, %s, %s)", value, ResizeOriginal, ResizeScreen, ResizeChat)
+	}
+	return edge, nil
+}
+
+// ParseMaxLongEdge разбирает максимальную длинную сторону в пикселях
+// (переменная окружения MAX_LONG_EDGE или поле формы загрузки). 0 - без уменьшения.
+func ParseMaxLongEdge(value string) (int, error) {
+	edge, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || edge != 0 && (edge < minLongEdge || edge > maxLongEdge) {
+		return 0, fmt.Errorf("некорректная длинная сторона: %q (допустимо от %d до %d пикселей или 0 - без уменьшения)", value, minLongEdge, maxLongEdge)
+	}
+	return edge, nil
+}
+
+// fitLongEdge возвращает размеры, в которые вписывается изображение width x height
+// с длинной стороной не больше maxEdge (с сохранением пропорций, не меньше 1 пикселя).
+func fitLongEdge(width, height, maxEdge int) (int, int) {
+	if maxEdge <= 0 || max(width, height) <= maxEdge {
+		return width, height
+	}
+	if width >= height {
+		return maxEdge, max(1, (height*maxEdge+width/2)/width)
+	}
+	return max(1, (width*maxEdge+height/2)/height), maxEdge
+}
+
+// resizeImage уменьшает изображение фильтром Catmull-Rom (бикубическая интерполяция
+// с учетом всех исходных пикселей при уменьшении - без муара и "лесенок").
+func resizeImage(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := fitLongEdge(bounds.Dx(), bounds.Dy(), maxEdge)
+	if width == bounds.Dx() && height == bounds.Dy() {
+		return img
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// resizeGIF уменьшает все кадры анимации и логический экран. Кадры палитровые,
+// поэтому используется ближайший сосед: интерполяция дала бы цвета вне палитры
+// кадра и испортила бы прозрачный индекс.
+func resizeGIF(anim *gif.GIF, maxEdge int) {
+	screenWidth, screenHeight := anim.Config.Width, anim.Config.Height
+	if screenWidth <= 0 || screenHeight <= 0 {
+		screen := image.Rectangle{}
+		for _, frame := range anim.Image {
+			screen = screen.Union(frame.Bounds())
+		}
+		screenWidth, screenHeight = screen.Max.X, screen.Max.Y
+	}
+	width, height := fitLongEdge(screenWidth, screenHeight, maxEdge)
+	if width == screenWidth && height == screenHeight {
+		return
+	}
+	scale := func(v, from, to int) int { return (v*to + from/2) / from }
+	for i, frame := range anim.Image {
+		b := frame.Bounds()
+		r := image.Rect(scale(b.Min.X, screenWidth, width), scale(b.Min.Y, screenHeight, height),
+			scale(b.Max.X, screenWidth, width), scale(b.Max.Y, screenHeight, height))
+		// Кадр не должен исчезнуть полностью (у него может быть важная задержка).
+		if r.Dx() == 0 {
+			r.Max.X = min(r.Min.X+1, width)
+			r.Min.X = r.Max.X - 1
+		}
+		if r.Dy() == 0 {
+			r.Max.Y = min(r.Min.Y+1, height)
+			r.Min.Y = r.Max.Y - 1
+		}
+		resized := image.NewPaletted(r, frame.Palette)
+		draw.NearestNeighbor.Scale(resized, r, frame, b, draw.Src, nil)
+		anim.Image[i] = resized
+	}
+	anim.Config.Width, anim.Config.Height = width, height
+}
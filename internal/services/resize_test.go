@@ -0,0 +1,215 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для кодирования тестовых файлов
+	"image"         // Для тестовых изображений
+	"image/color"   // Для проверки цветов
+	"image/gif"     // Для кодирования анимации
+	"image/jpeg"    // Для кодирования JPEG
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"testing"       // Для тестов
+)
+
+// testSmooth возвращает градиент без резких переходов (у testGradient синий канал
+// переполняется), чтобы цвет после уменьшения можно было сравнить с исходным.
+func testSmooth(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestFitLongEdge(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height, edge int
+		wantW, wantH        int
+	}{
+		{"альбомная", 4000, 3000, 1280, 1280, 960},
+		{"книжная", 3000, 4000, 1280, 960, 1280},
+		{"квадрат", 500, 500, 64, 64, 64},
+		{"округление", 1000, 333, 100, 100, 33},
+		{"уже меньше", 800, 600, 1280, 800, 600},
+		{"равна ограничению", 1280, 720, 1280, 1280, 720},
+		{"без ограничения", 8000, 6000, 0, 8000, 6000},
+		{"узкая полоса", 10000, 2, 100, 100, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, h := fitLongEdge(tt.width, tt.height, tt.edge); w != tt.wantW || h != tt.wantH {
+				t.Errorf("fitLongEdge(%d, %d, %d) = %dx%d, ожидалось %dx%d", tt.width, tt.height, tt.edge, w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	src := testSmooth(400, 100)
+	got := resizeImage(src, 100)
+	if got.Bounds() != image.Rect(0, 0, 100, 25) {
+		t.Fatalf("размер %v, ожидался 100x25", got.Bounds())
+	}
+	// Плавный градиент после уменьшения остается тем же градиентом.
+	for _, p := range []image.Point{{10, 5}, {50, 12}, {90, 20}} {
+		want := src.RGBAAt(p.X*4+2, p.Y*4+2)
+		checkColor(t, "градиент", got.At(p.X, p.Y), color.NRGBA{R: want.R, G: want.G, B: want.B, A: 255}, 6)
+	}
+
+	if small := resizeImage(src, 400); small != image.Image(src) {
+		t.Errorf("изображение не больше ограничения изменено")
+	}
+
+	t.Run("вложенное изображение", func(t *testing.T) {
+		big := testSmooth(600, 300)
+		sub := big.SubImage(image.Rect(100, 100, 500, 200))
+		got := resizeImage(sub, 200)
+		if got.Bounds() != image.Rect(0, 0, 200, 50) {
+			t.Fatalf("размер %v, ожидался 200x50", got.Bounds())
+		}
+		want := big.RGBAAt(100+2*100+1, 100+2*25+1)
+		checkColor(t, "центр", got.At(100, 25), color.NRGBA{R: want.R, G: want.G, B: want.B, A: 255}, 6)
+	})
+}
+
+func TestResizeGIF(t *testing.T) {
+	anim := testAnimation()
+	palettes := []color.Palette{anim.Image[0].Palette, anim.Image[1].Palette, anim.Image[2].Palette}
+	resizeGIF(anim, 8)
+
+	if anim.Config.Width != 8 || anim.Config.Height != 6 {
+		t.Fatalf("логический экран %dx%d, ожидался 8x6", anim.Config.Width, anim.Config.Height)
+	}
+	// Кадры и их смещения масштабируются вместе с экраном.
+	for i, want := range []image.Rectangle{image.Rect(0, 0, 8, 6), image.Rect(2, 1, 6, 5), image.Rect(0, 0, 8, 6)} {
+		frame := anim.Image[i]
+		if frame.Bounds() != want {
+			t.Errorf("кадр %d: %v, ожидался %v", i, frame.Bounds(), want)
+		}
+		if len(frame.Palette) != len(palettes[i]) {
+			t.Errorf("кадр %d: палитра изменена", i)
+		}
+	}
+	// Ближайший сосед: индекс пикселя берется из исходного кадра без смешивания.
+	// Исходный индекс в точке (x, y) первого кадра - (x + y) % 256.
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			got := int(anim.Image[0].ColorIndexAt(x, y))
+			if got != (2*x+2*y)%256 && got != (2*x+2*y+1)%256 && got != (2*x+2*y+2)%256 {
+				t.Fatalf("пиксель (%d,%d): индекс %d не из исходного кадра", x, y, got)
+			}
+		}
+	}
+	if len(anim.Delay) != 3 || anim.Delay[2] != 200 {
+		t.Errorf("задержки %v", anim.Delay)
+	}
+
+	t.Run("маленький кадр не исчезает", func(t *testing.T) {
+		anim := &gif.GIF{
+			Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 200, 100), testAnimation().Image[0].Palette), image.NewPaletted(image.Rect(199, 99, 200, 100), testAnimation().Image[0].Palette)},
+			Delay:  []int{10, 500},
+			Config: image.Config{Width: 200, Height: 100},
+		}
+		resizeGIF(anim, 20)
+		if r := anim.Image[1].Bounds(); r.Dx() != 1 || r.Dy() != 1 || !r.In(image.Rect(0, 0, 20, 10)) {
+			t.Errorf("кадр %v, ожидался 1x1 внутри экрана 20x10", r)
+		}
+	})
+
+	t.Run("меньше ограничения", func(t *testing.T) {
+		anim := testAnimation()
+		resizeGIF(anim, 64)
+		if anim.Config.Width != 16 || anim.Image[1].Bounds() != image.Rect(4, 2, 12, 10) {
+			t.Errorf("анимация меньше ограничения изменена")
+		}
+	})
+}
+
+func TestParseResizeSettings(t *testing.T) {
+	for value, want := range map[string]int{"original": 0, " Screen ": 2560, "CHAT": 1280} {
+		if got, err := ParseResizePreset(value); got != want || err != nil {
+			t.Errorf("ParseResizePreset(%q) = %d, %v; ожидалось %d", value, got, err, want)
+		}
+	}
+	if _, err := ParseResizePreset("thumbnail"); err == nil {
+		t.Errorf("ParseResizePreset: неизвестный вариант принят")
+	}
+
+	for value, want := range map[string]int{"0": 0, " 64 ": 64, "1920": 1920} {
+		if got, err := ParseMaxLongEdge(value); got != want || err != nil {
+			t.Errorf("ParseMaxLongEdge(%q) = %d, %v; ожидалось %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "63", "-1", "1e3", "big"} {
+		if _, err := ParseMaxLongEdge(value); err == nil {
+			t.Errorf("ParseMaxLongEdge(%q): ожидалась ошибка", value)
+		}
+	}
+	if _, err := ParseMaxLongEdge("999999"); err == nil {
+		t.Errorf("ParseMaxLongEdge: значение больше %d принято", maxLongEdge)
+	}
+}
+
+func TestProcessImageResizes(t *testing.T) {
+	var rotated bytes.Buffer
+	if err := jpeg.Encode(&rotated, testGradient(300, 200), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	var animation bytes.Buffer
+	if err := gif.EncodeAll(&animation, testAnimation()); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		filename    string
+		input       []byte
+		edge        int
+		wantW       int
+		wantH       int
+		resizedFrom string
+	}{
+		{"PNG", "a.png", testPNGImage(t, testGradient(300, 200)), 150, 150, 100, "300x200"},
+		{"JPEG", "a.jpg", rotated.Bytes(), 64, 64, 43, "300x200"},
+		{"JPEG с ориентацией", "a.jpg", insertJPEGSegments(rotated.Bytes(), []jpegSegment{testEXIFSegment([]exifEntry{newShortEntry(exifTagOrientation, 6)}, nil, nil)}), 150, 100, 150, "200x300"},
+		{"меньше ограничения", "a.png", testPNGImage(t, testGradient(120, 80)), 150, 120, 80, ""},
+		{"GIF", "a.gif", animation.Bytes(), 8, 8, 6, "16x12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultProcessOptions()
+			opts.MaxLongEdge = tt.edge
+			dir := t.TempDir()
+			stored, report, err := ProcessAndSaveData(tt.filename, tt.input, dir, opts)
+			if err != nil {
+				t.Fatalf("ProcessAndSaveData: %v", err)
+			}
+			path := filepath.Join(dir, stored)
+			if err := VerifyCleanFile(path, opts); err != nil {
+				t.Errorf("VerifyCleanFile: %v", err)
+			}
+			clean, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			config, _, err := image.DecodeConfig(bytes.NewReader(clean))
+			if err != nil {
+				t.Fatalf("DecodeConfig: %v", err)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Errorf("сохранено %dx%d, ожидалось %dx%d", config.Width, config.Height, tt.wantW, tt.wantH)
+			}
+			// Размеры из отчета записываются в БД и должны совпадать с сохраненным файлом.
+			if report.Width != config.Width || report.Height != config.Height {
+				t.Errorf("в отчете %dx%d, в файле %dx%d", report.Width, report.Height, config.Width, config.Height)
+			}
+			if report.ResizedFrom != tt.resizedFrom {
+				t.Errorf("ResizedFrom = %q, ожидалось %q", report.ResizedFrom, tt.resizedFrom)
+			}
+		})
+	}
+}
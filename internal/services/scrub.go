@@ -0,0 +1,189 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	crand "crypto/rand" // Для начального значения генератора шума
+	"image"             // Для работы с изображениями
+	"image/color"       // Для работы с палитрами
+	"image/draw"        // Для приведения изображений к NRGBA
+	"image/gif"         // Для обработки кадров анимации
+	"math/rand/v2"      // Для быстрого генератора случайных бит (ChaCha8)
+)
+
+// "Глубокая очистка" пикселей.
+//
+// Перекодирование удаляет блоки метаданных, но не трогает данные, спрятанные
+// в самих пикселях:
+//   - полностью прозрачные пиксели PNG хранят исходные значения RGB, невидимые
+//     на экране (в них можно спрятать изображение или текст);
+//   - неиспользуемые записи палитры переносятся в файл как есть;
+//   - младшие биты каналов (особенно 16-битных) - классическое место для
+//     стеганографии и невидимых водяных знаков.
+
+// ScrubOptions - параметры глубокой очистки пикселей.
+type ScrubOptions struct {
+	Enabled      bool // Обнулять RGB прозрачных пикселей и сжимать палитры
+	ReduceDepth  bool // Переводить 16-битные изображения в 8-битные
+	RandomizeLSB bool // Заменять младшие биты каналов случайными значениями
+}
+
+// newSecureRand создает быстрый генератор случайных чисел с криптографически случайным
+// начальным значением, чтобы добавленный шум нельзя было воспроизвести и вычесть.
+func newSecureRand() *rand.Rand {
+	var seed [32]byte
+	_, _ = crand.Read(seed[:]) // crypto/rand.Read не возвращает ошибок на поддерживаемых платформах
+	return rand.New(rand.NewChaCha8(seed))
+}
+
+// deepScrub возвращает изображение с очищенными "скрытыми" пиксельными данными.
+func deepScrub(img image.Image, opts ScrubOptions) image.Image {
+	rng := newSecureRand()
+	switch src := img.(type) {
+	case *image.Paletted:
+		scrubPaletted(src, opts, rng)
+		return src
+	case *image.Gray:
+		if opts.RandomizeLSB {
+			randomizeLowBits(src.Pix, 1, rng)
+		}
+		return src
+	case *image.Gray16:
+		if opts.ReduceDepth {
+			gray := image.NewGray(src.Bounds())
+			draw.Draw(gray, gray.Bounds(), src, src.Bounds().Min, draw.Src)
+			return deepScrub(gray, opts)
+		}
+		if opts.RandomizeLSB {
+			randomize16BitLowBytes(src.Pix, 1, rng)
+		}
+		return src
+	case *image.NRGBA64:
+		if opts.ReduceDepth {
+			break // Ниже будет переведено в NRGBA
+		}
+		zeroTransparent16(src.Pix)
+		if opts.RandomizeLSB {
+			randomize16BitLowBytes(src.Pix, 4, rng)
+			zeroTransparent16(src.Pix)
+		}
+		return src
+	}
+
+	// Все остальные модели (NRGBA, RGBA, RGBA64, YCbCr, CMYK...) приводятся к 8-битному NRGBA:
+	// в нем прозрачные пиксели явно хранят RGB, которые и нужно обнулить.
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	if opts.RandomizeLSB {
+		randomizeLowBits(nrgba.Pix, 4, rng)
+	}
+	zeroTransparent(nrgba.Pix)
+	return nrgba
+}
+
+// scrubGIF очищает все кадры анимации. Глобальная палитра удаляется (каждый кадр
+// получает собственную сжатую палитру), так как в ней могут оставаться неиспользуемые цвета.
+func scrubGIF(anim *gif.GIF, opts ScrubOptions) {
+	rng := newSecureRand()
+	for _, frame := range anim.Image {
+		scrubPaletted(frame, opts, rng)
+	}
+	anim.Config.ColorModel = nil
+	anim.BackgroundIndex = 0
+}
+
+// scrubPaletted сжимает палитру до реально используемых цветов, обнуляет RGB
+// прозрачных записей и, при необходимости, случайно меняет младшие биты цветов палитры.
+func scrubPaletted(img *image.Paletted, opts ScrubOptions, rng *rand.Rand) {
+	// Индексы, которые встречаются в пикселях (в пределах границ изображения).
+	var used [256]bool
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for _, idx := range row {
+			used[idx] = true
+		}
+	}
+
+	var remap [256]uint8
+	compact := make(color.Palette, 0, len(img.Palette))
+	for i, c := range img.Palette {
+		if !used[i] {
+			continue
+		}
+		nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+		if opts.RandomizeLSB && nc.A != 0 {
+			nc.R ^= uint8(rng.IntN(2))
+			nc.G ^= uint8(rng.IntN(2))
+			nc.B ^= uint8(rng.IntN(2))
+		}
+		if nc.A == 0 {
+			nc = color.NRGBA{}
+		}
+		remap[i] = uint8(len(compact))
+		compact = append(compact, nc)
+	}
+	if len(compact) == 0 {
+		compact = append(compact, color.NRGBA{}) // Пустое изображение: палитра не может быть пустой
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for i, idx := range row {
+			row[i] = remap[idx]
+		}
+	}
+	img.Palette = compact
+}
+
+// zeroTransparent обнуляет RGB полностью прозрачных пикселей в буфере NRGBA (8 бит).
+func zeroTransparent(pix []uint8) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		if pix[i+3] == 0 {
+			pix[i], pix[i+1], pix[i+2] = 0, 0, 0
+		}
+	}
+}
+
+// zeroTransparent16 обнуляет RGB полностью прозрачных пикселей в буфере NRGBA64.
+func zeroTransparent16(pix []uint8) {
+	for i := 0; i+7 < len(pix); i += 8 {
+		if pix[i+6] == 0 && pix[i+7] == 0 {
+			clear(pix[i : i+6])
+		}
+	}
+}
+
+// randomizeLowBits заменяет младший бит каждого канала случайным значением.
+// stride - количество байт на пиксель; альфа-канал (4-й байт при stride 4) не меняется,
+// чтобы не сделать непрозрачные пиксели полупрозрачными и наоборот.
+func randomizeLowBits(pix []uint8, stride int, rng *rand.Rand) {
+	var bits uint64
+	left := 0
+	for i := range pix {
+		if stride == 4 && i%4 == 3 {
+			continue
+		}
+		if left == 0 {
+			bits, left = rng.Uint64(), 64
+		}
+		pix[i] = pix[i]&^1 | uint8(bits&1)
+		bits >>= 1
+		left--
+	}
+}
+
+// randomize16BitLowBytes заменяет младший байт каждого 16-битного канала (big-endian)
+// случайным значением. Для 16-битных изображений именно младший байт
+// практически не виден и может нести скрытые данные. channels - количество каналов
+// на пиксель; при 4 каналах альфа-канал не меняется (как в randomizeLowBits).
+func randomize16BitLowBytes(pix []uint8, channels int, rng *rand.Rand) {
+	for i := 1; i < len(pix); i += 2 {
+		if channels == 4 && (i/2)%4 == 3 {
+			continue
+		}
+		pix[i] = uint8(rng.Uint32())
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"         // Для чтения результата
+	"image"         // Для тестовых изображений
+	"image/color"   // Для палитр и цветов
+	"image/gif"     // Для очистки анимации
+	"image/png"     // Для декодирования результата
+	"os"            // Для чтения сохраненного файла
+	"path/filepath" // Для пути к сохраненному файлу
+	"testing"       // Для тестов
+)
+
+// testHiddenPixels возвращает изображение 64x64, в котором левая половина полностью
+// прозрачна, но хранит "спрятанные" значения RGB, а правая - непрозрачный градиент.
+func testHiddenPixels() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if x < 32 {
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 3), B: 0xA5, A: 0})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 0x80, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestDeepScrubZeroesTransparentPixels(t *testing.T) {
+	src := testHiddenPixels()
+	src.SetNRGBA(40, 40, color.NRGBA{R: 10, G: 20, B: 30, A: 1}) // Почти прозрачный пиксель виден и не меняется
+	want := image.NewNRGBA(src.Bounds())
+	copy(want.Pix, src.Pix)
+
+	got, ok := deepScrub(src, ScrubOptions{Enabled: true}).(*image.NRGBA)
+	if !ok {
+		t.Fatalf("ожидалось *image.NRGBA")
+	}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c, w := got.NRGBAAt(x, y), want.NRGBAAt(x, y)
+			if w.A == 0 && c != (color.NRGBA{}) {
+				t.Fatalf("прозрачный пиксель (%d,%d) хранит %v", x, y, c)
+			}
+			if w.A != 0 && c != w {
+				t.Fatalf("видимый пиксель (%d,%d) изменен: %v, был %v", x, y, c, w)
+			}
+		}
+	}
+
+	t.Run("16 бит", func(t *testing.T) {
+		src := image.NewNRGBA64(image.Rect(0, 0, 2, 1))
+		src.SetNRGBA64(0, 0, color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9ABC})
+		src.SetNRGBA64(1, 0, color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9ABC, A: 0xFFFF})
+		got := deepScrub(src, ScrubOptions{Enabled: true}).(*image.NRGBA64)
+		if c := got.NRGBA64At(0, 0); c != (color.NRGBA64{}) {
+			t.Errorf("прозрачный пиксель хранит %v", c)
+		}
+		if c := got.NRGBA64At(1, 0); c != (color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9ABC, A: 0xFFFF}) {
+			t.Errorf("видимый пиксель изменен: %v", c)
+		}
+
+		reduced, ok := deepScrub(src, ScrubOptions{Enabled: true, ReduceDepth: true}).(*image.NRGBA)
+		if !ok {
+			t.Fatalf("при ReduceDepth ожидалось *image.NRGBA")
+		}
+		if c := reduced.NRGBAAt(0, 0); c != (color.NRGBA{}) {
+			t.Errorf("8 бит: прозрачный пиксель хранит %v", c)
+		}
+		if c := reduced.NRGBAAt(1, 0); c != (color.NRGBA{R: 0x12, G: 0x56, B: 0x9A, A: 0xFF}) {
+			t.Errorf("8 бит: видимый пиксель %v", c)
+		}
+	})
+
+	t.Run("полутоновое 16 бит", func(t *testing.T) {
+		src := image.NewGray16(image.Rect(0, 0, 2, 1))
+		src.SetGray16(0, 0, color.Gray16{Y: 0xABCD})
+		if _, ok := deepScrub(src, ScrubOptions{Enabled: true, ReduceDepth: true}).(*image.Gray); !ok {
+			t.Errorf("при ReduceDepth ожидалось *image.Gray")
+		}
+		got := deepScrub(src, ScrubOptions{Enabled: true, RandomizeLSB: true}).(*image.Gray16)
+		if got.Pix[0] != 0xAB {
+			t.Errorf("старший байт изменен: %02x", got.Pix[0])
+		}
+	})
+}
+
+func TestScrubPalettedCompactsPalette(t *testing.T) {
+	pal := color.Palette{
+		color.NRGBA{R: 255, A: 255},
+		color.NRGBA{G: 255, A: 255},                  // Не используется
+		color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0}, // Прозрачный цвет со скрытым RGB
+		color.NRGBA{B: 255, A: 255},
+		color.NRGBA{R: 1, G: 2, B: 3, A: 255}, // Не используется
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 3, 1), pal)
+	img.Pix = []uint8{0, 2, 3}
+	before := []color.Color{img.At(0, 0), img.At(2, 0)}
+
+	scrubPaletted(img, ScrubOptions{Enabled: true}, newSecureRand())
+	if len(img.Palette) != 3 {
+		t.Fatalf("палитра из %d цветов, ожидалось 3: %v", len(img.Palette), img.Palette)
+	}
+	if img.At(0, 0) != before[0] || img.At(2, 0) != before[1] {
+		t.Errorf("видимые цвета изменены: %v %v", img.At(0, 0), img.At(2, 0))
+	}
+	if c := img.At(1, 0); c != (color.NRGBA{}) {
+		t.Errorf("прозрачный цвет палитры хранит %v", c)
+	}
+	for _, c := range img.Palette {
+		if c == pal[1] || c == pal[4] {
+			t.Errorf("неиспользуемый цвет %v остался в палитре", c)
+		}
+	}
+
+	t.Run("анимация", func(t *testing.T) {
+		frame := image.NewPaletted(image.Rect(0, 0, 2, 1), pal)
+		frame.Pix = []uint8{4, 4}
+		anim := &gif.GIF{Image: []*image.Paletted{frame}, Config: image.Config{ColorModel: pal, Width: 2, Height: 1}, BackgroundIndex: 3}
+		scrubGIF(anim, ScrubOptions{Enabled: true})
+		if anim.Config.ColorModel != nil || anim.BackgroundIndex != 0 || len(frame.Palette) != 1 {
+			t.Errorf("глобальная палитра %v, фон %d, палитра кадра %v", anim.Config.ColorModel, anim.BackgroundIndex, frame.Palette)
+		}
+	})
+}
+
+func TestDeepScrubRandomizesLowBits(t *testing.T) {
+	// В младших битах спрятано сообщение: все единицы.
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = 0x81
+	}
+	want := append([]uint8(nil), src.Pix...)
+
+	got := deepScrub(src, ScrubOptions{Enabled: true, RandomizeLSB: true}).(*image.NRGBA)
+	kept, total := 0, 0
+	for i, v := range got.Pix {
+		if i%4 == 3 {
+			if v != want[i] {
+				t.Fatalf("альфа-канал изменен")
+			}
+			continue
+		}
+		if v&^1 != want[i]&^1 {
+			t.Fatalf("байт %d: изменены не только младшие биты (%02x, было %02x)", i, v, want[i])
+		}
+		total++
+		if v&1 == 1 {
+			kept++
+		}
+	}
+	// Сообщение не переживает очистку: совпадает примерно половина бит, как у случайных.
+	if share := float64(kept) / float64(total); share < 0.45 || share > 0.55 {
+		t.Errorf("сохранилось %.0f%% бит сообщения", share*100)
+	}
+}
+
+func TestProcessImageDeepScrub(t *testing.T) {
+	input := testPNGImage(t, testHiddenPixels())
+	opts := DefaultProcessOptions()
+	opts.Scrub = ScrubOptions{Enabled: true}
+	dir := t.TempDir()
+	stored, _, err := ProcessAndSaveData("hidden.png", input, dir, opts)
+	if err != nil {
+		t.Fatalf("ProcessAndSaveData: %v", err)
+	}
+	clean, err := os.ReadFile(filepath.Join(dir, stored))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	src := testHiddenPixels()
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if x < 32 && got != (color.NRGBA{}) {
+				t.Fatalf("прозрачный пиксель (%d,%d) хранит %v", x, y, got)
+			}
+			if x >= 32 && got != src.NRGBAAt(x, y) {
+				t.Fatalf("видимый пиксель (%d,%d) изменен: %v", x, y, got)
+			}
+		}
+	}
+}
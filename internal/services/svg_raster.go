@@ -0,0 +1,1761 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для разбора документа и встроенных изображений
+	"encoding/base64" // Для встроенных изображений (data:)
+	"encoding/xml"    // Для разбора очищенного SVG
+	"errors"          // Для признака конца документа
+	"fmt"             // Для форматирования ошибок
+	"image"           // Для работы с изображениями
+	"image/color"     // Для цветов заливки и обводки
+	"io"              // Для признака конца документа
+	"math"            // Для геометрии
+	"regexp"          // Для разбора transform
+	"sort"            // Для порядка правил CSS
+	"strconv"         // Для разбора чисел
+	"strings"         // Для разбора атрибутов
+	"sync"            // Для однократной загрузки шрифтов
+
+	// Сторонние библиотеки
+	"golang.org/x/image/colornames"            // Именованные цвета CSS
+	"golang.org/x/image/draw"                  // Для встроенных изображений (аффинное преобразование)
+	"golang.org/x/image/font"                  // Для отрисовки текста
+	"golang.org/x/image/font/gofont/gobold"    // Встроенный полужирный шрифт
+	"golang.org/x/image/font/gofont/goregular" // Встроенный обычный шрифт
+	"golang.org/x/image/font/sfnt"             // Для контуров букв
+	"golang.org/x/image/math/f64"              // Для матрицы преобразования изображений
+	"golang.org/x/image/math/fixed"            // Для координат текста
+	"golang.org/x/image/vector"                // Растеризатор контуров
+)
+
+// Растеризация SVG в PNG (по выбору пользователя или когда к изображению нужно применить
+// пиксельные операции: надпись, водяной знак и т.п.). Растеризуется уже очищенный документ.
+//
+// Поддерживается подмножество SVG, которого хватает для макетов и иконок: фигуры и контуры
+// (включая дуги), заливка и обводка сплошным цветом и градиентами, пунктир, прозрачность,
+// преобразования, вложенные svg, use/symbol, простые таблицы стилей (селекторы по элементу,
+// классу и id), текст встроенным шрифтом и встроенные растровые изображения.
+// Не поддерживаются: правило заливки evenodd (используется nonzero), обрезка (clipPath),
+// маски, фильтры, узоры (pattern), маркеры, текст вдоль контура и пользовательские шрифты.
+
+// Ограничения растеризации.
+const (
+	svgMaxRasterEdge   = 4096 // Максимальная длинная сторона результата, пикселей
+	svgDefaultWidth    = 300  // Размер по умолчанию (как у браузеров), если он не задан
+	svgDefaultHeight   = 150
+	svgMaxUseDepth     = 16     // Максимальная вложенность use (защита от циклов)
+	svgMaxElements     = 100000 // Максимальное количество отрисовываемых элементов (с учетом use)
+	svgMaxDashes       = 100000 // Максимальное количество штрихов пунктира в одной обводке
+	svgMaxCoordinate   = 1e6    // Координаты за этим пределом обрезаются (переполнение растеризатора)
+	svgDefaultFontSize = 16.0   // Размер шрифта по умолчанию
+	svgCurveTolerance  = 0.25   // Допустимое отклонение при разбиении кривых на отрезки (для обводки), пикселей
+)
+
+// svgInheritedProperties - свойства оформления, которые наследуются дочерними элементами.
+var svgInheritedProperties = map[string]bool{
+	"fill": true, "fill-opacity": true, "fill-rule": true,
+	"stroke": true, "stroke-width": true, "stroke-opacity": true, "stroke-linecap": true,
+	"stroke-linejoin": true, "stroke-dasharray": true, "stroke-dashoffset": true,
+	"color": true, "visibility": true, "font-size": true, "font-family": true, "font-weight": true,
+	"text-anchor": true, "stop-color": false,
+}
+
+// svgNode - элемент очищенного документа (или текстовый узел с именем "#text").
+type svgNode struct {
+	name     string
+	attrs    map[string]string
+	children []*svgNode
+	text     string
+}
+
+// svgCSSRule - правило таблицы стилей с простым селектором.
+type svgCSSRule struct {
+	tag, id     string
+	classes     []string
+	decls       map[string]string
+	specificity int
+	order       int
+}
+
+// svgDocument - разобранный документ.
+type svgDocument struct {
+	root  *svgNode
+	ids   map[string]*svgNode
+	rules []svgCSSRule
+}
+
+// svgMatrix - аффинное преобразование: x' = a*x + c*y + e, y' = b*x + d*y + f.
+type svgMatrix [6]float64
+
+var svgIdentity = svgMatrix{1, 0, 0, 1, 0, 0}
+
+// mul возвращает m * n (сначала применяется n, затем m).
+func (m svgMatrix) mul(n svgMatrix) svgMatrix {
+	return svgMatrix{
+		m[0]*n[0] + m[2]*n[1], m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3], m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4], m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m svgMatrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// scale - средний масштаб преобразования (для толщины линий и размера шрифта).
+func (m svgMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// invert возвращает обратное преобразование (для вырожденного - единичное).
+func (m svgMatrix) invert() svgMatrix {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return svgIdentity
+	}
+	a, b, c, d := m[3]/det, -m[1]/det, -m[2]/det, m[0]/det
+	return svgMatrix{a, b, c, d, -(a*m[4] + c*m[5]), -(b*m[4] + d*m[5])}
+}
+
+func svgTranslate(x, y float64) svgMatrix { return svgMatrix{1, 0, 0, 1, x, y} }
+func svgScale(x, y float64) svgMatrix     { return svgMatrix{x, 0, 0, y, 0, 0} }
+
+// svgPoint - точка контура.
+type svgPoint struct{ x, y float64 }
+
+// svgSegment - команда контура в абсолютных координатах: 'M', 'L', 'Q', 'C' или 'Z'.
+type svgSegment struct {
+	op  byte
+	pts [3]svgPoint
+}
+
+// svgPaint - способ закраски: нет, сплошной цвет или градиент.
+type svgPaint struct {
+	none     bool
+	color    color.NRGBA
+	gradient *svgNode
+}
+
+// rasterizeSVG растеризует очищенный SVG. Размер результата определяется атрибутами
+// width/height/viewBox и ограничивается maxEdge (0 - svgMaxRasterEdge).
+func rasterizeSVG(data []byte, maxEdge int) (*image.RGBA, error) {
+	doc, err := parseSVGDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	width, height := svgIntrinsicSize(doc.root)
+	limit := float64(svgMaxRasterEdge)
+	if maxEdge > 0 && float64(maxEdge) < limit {
+		limit = float64(maxEdge)
+	}
+	scale := 1.0
+	if long := math.Max(width, height); long > limit {
+		scale = limit / long
+	}
+	w, h := max(1, int(math.Round(width*scale))), max(1, int(math.Round(height*scale)))
+
+	r := &svgRenderer{
+		doc:       doc,
+		dst:       image.NewRGBA(image.Rect(0, 0, w, h)),
+		rasterize: vector.NewRasterizer(w, h),
+	}
+	viewport := svgScale(float64(w)/width, float64(h)/height)
+	vbTransform, vbWidth, vbHeight := svgViewBoxTransform(doc.root.attrs, width, height)
+	r.viewportWidth, r.viewportHeight = vbWidth, vbHeight
+	r.renderChildren(doc.root, r.computeStyle(doc.root, nil), viewport.mul(vbTransform), 1)
+	return r.dst, nil
+}
+
+// svgSize возвращает собственный размер рисунка в пикселях (для отчета о сохраненном SVG).
+func svgSize(data []byte) (int, int, error) {
+	doc, err := parseSVGDocument(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	width, height := svgIntrinsicSize(doc.root)
+	return int(math.Round(width)), int(math.Round(height)), nil
+}
+
+// parseSVGDocument разбирает очищенный документ в дерево и собирает таблицы стилей.
+func parseSVGDocument(data []byte) (*svgDocument, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	doc := &svgDocument{ids: make(map[string]*svgNode)}
+	var stack []*svgNode
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSVG, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &svgNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			if id := node.attrs["id"]; id != "" {
+				if _, exists := doc.ids[id]; !exists {
+					doc.ids[id] = node
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else {
+				doc.root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			if node := stack[len(stack)-1]; node.name == "style" {
+				doc.rules = append(doc.rules, parseSVGStyleSheet(node.text, len(doc.rules))...)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			parent := stack[len(stack)-1]
+			parent.text += string(t)
+			parent.children = append(parent.children, &svgNode{name: "#text", text: string(t)})
+		}
+	}
+	if doc.root == nil || doc.root.name != "svg" {
+		return nil, fmt.Errorf("%w: корневой элемент не svg", ErrInvalidSVG)
+	}
+	// Порядок применения: по специфичности, при равной - по порядку в документе.
+	sort.SliceStable(doc.rules, func(i, j int) bool { return doc.rules[i].specificity < doc.rules[j].specificity })
+	return doc, nil
+}
+
+// svgSelectorPartPattern - часть простого селектора: элемент, .класс или #id.
+var svgSelectorPartPattern = regexp.MustCompile(`[.#]?[^.#]+`)
+
+// parseSVGStyleSheet разбирает таблицу стилей. Поддерживаются только простые селекторы
+// (элемент, .класс, #id и их сочетания без пробелов); остальные правила пропускаются.
+func parseSVGStyleSheet(css string, order int) []svgCSSRule {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	var rules []svgCSSRule
+	for _, block := range strings.Split(css, "}") {
+		selectors, body, ok := strings.Cut(block, "{")
+		if !ok || strings.Contains(selectors, "@") {
+			continue
+		}
+		decls := parseSVGDeclarations(body)
+		for _, selector := range strings.Split(selectors, ",") {
+			selector = strings.TrimSpace(selector)
+			if selector == "" || strings.ContainsAny(selector, " >+~[:") {
+				continue
+			}
+			rule := svgCSSRule{decls: decls, order: order}
+			order++
+			for _, part := range svgSelectorPartPattern.FindAllString(selector, -1) {
+				switch part[0] {
+				case '.':
+					rule.classes = append(rule.classes, part[1:])
+					rule.specificity += 10
+				case '#':
+					rule.id = part[1:]
+					rule.specificity += 100
+				default:
+					if part != "*" {
+						rule.tag = part
+						rule.specificity++
+					}
+				}
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseSVGDeclarations разбирает объявления CSS "свойство: значение; ...".
+func parseSVGDeclarations(body string) map[string]string {
+	decls := make(map[string]string)
+	for _, decl := range strings.Split(body, ";") {
+		name, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		decls[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return decls
+}
+
+// svgIntrinsicSize возвращает размер рисунка в пикселях по атрибутам корневого элемента.
+func svgIntrinsicSize(root *svgNode) (float64, float64) {
+	width, okW := parseSVGLength(root.attrs["width"], 0)
+	height, okH := parseSVGLength(root.attrs["height"], 0)
+	vb, okVB := parseSVGViewBox(root.attrs["viewBox"])
+	switch {
+	case okW && okH:
+	case okVB && okW:
+		height = width * vb[3] / vb[2]
+	case okVB && okH:
+		width = height * vb[2] / vb[3]
+	case okVB:
+		width, height = vb[2], vb[3]
+	default:
+		width, height = svgDefaultWidth, svgDefaultHeight
+	}
+	if width <= 0 || height <= 0 || math.IsInf(width, 0) || math.IsInf(height, 0) {
+		return svgDefaultWidth, svgDefaultHeight
+	}
+	return width, height
+}
+
+// parseSVGViewBox разбирает атрибут viewBox (min-x, min-y, ширина, высота).
+func parseSVGViewBox(value string) ([4]float64, bool) {
+	numbers := parseSVGNumbers(value)
+	if len(numbers) != 4 || numbers[2] <= 0 || numbers[3] <= 0 {
+		return [4]float64{}, false
+	}
+	return [4]float64{numbers[0], numbers[1], numbers[2], numbers[3]}, true
+}
+
+// svgViewBoxTransform возвращает преобразование из координат viewBox в область
+// width x height с учетом preserveAspectRatio, а также размеры области в координатах
+// viewBox (для процентов).
+func svgViewBoxTransform(attrs map[string]string, width, height float64) (svgMatrix, float64, float64) {
+	vb, ok := parseSVGViewBox(attrs["viewBox"])
+	if !ok {
+		return svgIdentity, width, height
+	}
+	sx, sy := width/vb[2], height/vb[3]
+	align, mode, _ := strings.Cut(strings.TrimSpace(attrs["preserveAspectRatio"]), " ")
+	if align == "" {
+		align = "xMidYMid"
+	}
+	if align != "none" {
+		if strings.TrimSpace(mode) == "slice" {
+			sx = math.Max(sx, sy)
+		} else {
+			sx = math.Min(sx, sy)
+		}
+		sy = sx
+	}
+	tx, ty := -vb[0]*sx, -vb[1]*sy
+	switch {
+	case strings.Contains(align, "xMid"):
+		tx += (width - vb[2]*sx) / 2
+	case strings.Contains(align, "xMax"):
+		tx += width - vb[2]*sx
+	}
+	switch {
+	case strings.Contains(align, "YMid"):
+		ty += (height - vb[3]*sy) / 2
+	case strings.Contains(align, "YMax"):
+		ty += height - vb[3]*sy
+	}
+	return svgMatrix{sx, 0, 0, sy, tx, ty}, vb[2], vb[3]
+}
+
+// svgRenderer - состояние растеризации.
+type svgRenderer struct {
+	doc                           *svgDocument
+	dst                           *image.RGBA
+	rasterize                     *vector.Rasterizer
+	useDepth                      int
+	rendered                      int     // Отрисовано элементов (защита от размножения через use)
+	viewportWidth, viewportHeight float64 // Размер области просмотра в пользовательских координатах
+}
+
+// computeStyle вычисляет свойства оформления элемента: унаследованные от родителя,
+// затем атрибуты оформления, правила таблицы стилей и атрибут style (в порядке возрастания приоритета).
+func (r *svgRenderer) computeStyle(node *svgNode, parent map[string]string) map[string]string {
+	style := make(map[string]string)
+	for name, value := range parent {
+		if svgInheritedProperties[name] {
+			style[name] = value
+		}
+	}
+	set := func(name, value string) {
+		if value == "inherit" {
+			if inherited, ok := parent[name]; ok {
+				style[name] = inherited
+			}
+			return
+		}
+		style[name] = value
+	}
+	for name, value := range node.attrs {
+		if svgAttributes[name] && name != "style" && name != "class" && name != "id" && name != "transform" {
+			set(name, strings.TrimSpace(value))
+		}
+	}
+	classes := strings.Fields(node.attrs["class"])
+	for _, rule := range r.doc.rules {
+		if rule.matches(node, classes) {
+			for name, value := range rule.decls {
+				set(name, value)
+			}
+		}
+	}
+	for name, value := range parseSVGDeclarations(node.attrs["style"]) {
+		set(name, value)
+	}
+	return style
+}
+
+// matches проверяет, подходит ли элемент под селектор правила.
+func (rule svgCSSRule) matches(node *svgNode, classes []string) bool {
+	if rule.tag != "" && rule.tag != node.name || rule.id != "" && rule.id != node.attrs["id"] {
+		return false
+	}
+	for _, want := range rule.classes {
+		found := false
+		for _, class := range classes {
+			found = found || class == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// renderChildren отрисовывает дочерние элементы.
+func (r *svgRenderer) renderChildren(node *svgNode, style map[string]string, m svgMatrix, opacity float64) {
+	for _, child := range node.children {
+		if child.name == "#text" {
+			continue
+		}
+		r.render(child, style, m, opacity)
+		if node.name == "switch" {
+			return // switch отображает только первый подходящий элемент
+		}
+	}
+}
+
+// render отрисовывает элемент с учетом преобразования родителя m и прозрачности группы.
+func (r *svgRenderer) render(node *svgNode, parentStyle map[string]string, m svgMatrix, opacity float64) {
+	// Вложенные use размножают элементы экспоненциально (по два use на каждом
+	// из 16 уровней - уже 65536 копий), поэтому их общее количество ограничено.
+	if r.rendered++; r.rendered > svgMaxElements {
+		return
+	}
+	style := r.computeStyle(node, parentStyle)
+	if style["display"] == "none" {
+		return
+	}
+	m = m.mul(parseSVGTransform(node.attrs["transform"]))
+	if value, ok := style["opacity"]; ok {
+		opacity *= parseSVGOpacity(value)
+	}
+	if opacity <= 0 {
+		return
+	}
+
+	switch node.name {
+	case "g", "a", "switch":
+		r.renderChildren(node, style, m, opacity)
+	case "svg":
+		x, _ := parseSVGLength(node.attrs["x"], r.viewportWidth)
+		y, _ := parseSVGLength(node.attrs["y"], r.viewportHeight)
+		width, okW := parseSVGLength(node.attrs["width"], r.viewportWidth)
+		height, okH := parseSVGLength(node.attrs["height"], r.viewportHeight)
+		if !okW {
+			width = r.viewportWidth
+		}
+		if !okH {
+			height = r.viewportHeight
+		}
+		vbTransform, _, _ := svgViewBoxTransform(node.attrs, width, height)
+		r.renderChildren(node, style, m.mul(svgTranslate(x, y)).mul(vbTransform), opacity)
+	case "use":
+		r.renderUse(node, style, m, opacity)
+	case "path", "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		if style["visibility"] == "hidden" || style["visibility"] == "collapse" {
+			return
+		}
+		segments := r.shapeSegments(node)
+		if len(segments) == 0 {
+			return
+		}
+		if node.name != "line" { // Отрезок не имеет площади
+			r.fillPath(segments, style, m, opacity)
+		}
+		r.strokePath(segments, style, m, opacity)
+	case "text":
+		r.renderText(node, style, m, opacity)
+	case "image":
+		r.renderImage(node, m, opacity)
+	}
+	// defs, symbol, style, градиенты, clipPath, mask, pattern, marker, filter напрямую не отображаются.
+}
+
+// renderUse отрисовывает элемент, на который ссылается use.
+func (r *svgRenderer) renderUse(node *svgNode, style map[string]string, m svgMatrix, opacity float64) {
+	target := r.doc.ids[strings.TrimPrefix(node.attrs["href"], "#")]
+	if target == nil || r.useDepth >= svgMaxUseDepth {
+		return
+	}
+	r.useDepth++
+	defer func() { r.useDepth-- }()
+
+	x, _ := parseSVGLength(node.attrs["x"], r.viewportWidth)
+	y, _ := parseSVGLength(node.attrs["y"], r.viewportHeight)
+	m = m.mul(svgTranslate(x, y))
+	if target.name == "symbol" {
+		symbolStyle := r.computeStyle(target, style)
+		width, okW := parseSVGLength(node.attrs["width"], r.viewportWidth)
+		height, okH := parseSVGLength(node.attrs["height"], r.viewportHeight)
+		if okW && okH {
+			vbTransform, _, _ := svgViewBoxTransform(target.attrs, width, height)
+			m = m.mul(vbTransform)
+		}
+		r.renderChildren(target, symbolStyle, m, opacity)
+		return
+	}
+	r.render(target, style, m, opacity)
+}
+
+// shapeSegments возвращает контур фигуры в пользовательских координатах.
+func (r *svgRenderer) shapeSegments(node *svgNode) []svgSegment {
+	length := func(name string, ref float64) float64 {
+		v, _ := parseSVGLength(node.attrs[name], ref)
+		return v
+	}
+	w, h := r.viewportWidth, r.viewportHeight
+	switch node.name {
+	case "path":
+		return parseSVGPath(node.attrs["d"])
+	case "rect":
+		x, y, width, height := length("x", w), length("y", h), length("width", w), length("height", h)
+		if width <= 0 || height <= 0 {
+			return nil
+		}
+		rx, okX := parseSVGLength(node.attrs["rx"], w)
+		ry, okY := parseSVGLength(node.attrs["ry"], h)
+		if !okX {
+			rx = ry
+		}
+		if !okY {
+			ry = rx
+		}
+		rx, ry = math.Min(math.Max(rx, 0), width/2), math.Min(math.Max(ry, 0), height/2)
+		if rx == 0 || ry == 0 {
+			return []svgSegment{
+				{op: 'M', pts: [3]svgPoint{{x, y}}}, {op: 'L', pts: [3]svgPoint{{x + width, y}}},
+				{op: 'L', pts: [3]svgPoint{{x + width, y + height}}}, {op: 'L', pts: [3]svgPoint{{x, y + height}}}, {op: 'Z'},
+			}
+		}
+		var p svgPathBuilder
+		p.moveTo(x+rx, y)
+		p.lineTo(x+width-rx, y)
+		p.arcTo(rx, ry, 0, false, true, x+width, y+ry)
+		p.lineTo(x+width, y+height-ry)
+		p.arcTo(rx, ry, 0, false, true, x+width-rx, y+height)
+		p.lineTo(x+rx, y+height)
+		p.arcTo(rx, ry, 0, false, true, x, y+height-ry)
+		p.lineTo(x, y+ry)
+		p.arcTo(rx, ry, 0, false, true, x+rx, y)
+		p.close()
+		return p.segments
+	case "circle", "ellipse":
+		cx, cy := length("cx", w), length("cy", h)
+		rx, ry := length("rx", w), length("ry", h)
+		if node.name == "circle" {
+			rx = length("r", math.Hypot(w, h)/math.Sqrt2)
+			ry = rx
+		}
+		if rx <= 0 || ry <= 0 {
+			return nil
+		}
+		var p svgPathBuilder
+		p.moveTo(cx+rx, cy)
+		p.arcTo(rx, ry, 0, false, true, cx, cy+ry)
+		p.arcTo(rx, ry, 0, false, true, cx-rx, cy)
+		p.arcTo(rx, ry, 0, false, true, cx, cy-ry)
+		p.arcTo(rx, ry, 0, false, true, cx+rx, cy)
+		p.close()
+		return p.segments
+	case "line":
+		return []svgSegment{
+			{op: 'M', pts: [3]svgPoint{{length("x1", w), length("y1", h)}}},
+			{op: 'L', pts: [3]svgPoint{{length("x2", w), length("y2", h)}}},
+		}
+	case "polyline", "polygon":
+		numbers := parseSVGNumbers(node.attrs["points"])
+		var segments []svgSegment
+		for i := 0; i+1 < len(numbers); i += 2 {
+			op := byte('L')
+			if i == 0 {
+				op = 'M'
+			}
+			segments = append(segments, svgSegment{op: op, pts: [3]svgPoint{{numbers[i], numbers[i+1]}}})
+		}
+		if node.name == "polygon" && len(segments) > 0 {
+			segments = append(segments, svgSegment{op: 'Z'})
+		}
+		return segments
+	}
+	return nil
+}
+
+// paint разбирает значение fill/stroke.
+func (r *svgRenderer) paint(value string, style map[string]string) svgPaint {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "url(") {
+		if match := cssURLPattern.FindStringSubmatch(value); match != nil {
+			id := strings.TrimPrefix(strings.TrimSpace(match[1]+match[2]+match[3]), "#")
+			if node := r.doc.ids[id]; node != nil && (node.name == "linearGradient" || node.name == "radialGradient") {
+				return svgPaint{gradient: node}
+			}
+		}
+		// Запасной цвет после url(...) используется, если ссылка не поддерживается.
+		value = strings.TrimSpace(value[strings.Index(value, ")")+1:])
+		if value == "" {
+			return svgPaint{none: true}
+		}
+	}
+	if value == "currentColor" {
+		value = style["color"]
+	}
+	c, ok := parseSVGColor(value)
+	if !ok {
+		return svgPaint{none: true}
+	}
+	return svgPaint{color: c}
+}
+
+// source возвращает источник цвета для растеризатора: сплошной цвет или градиент.
+func (r *svgRenderer) source(paint svgPaint, alpha float64, m svgMatrix, segments []svgSegment) image.Image {
+	if paint.gradient != nil {
+		if gradient := r.newGradient(paint.gradient, alpha, m, segments); gradient != nil {
+			return gradient
+		}
+		return nil
+	}
+	c := paint.color
+	c.A = uint8(math.Round(float64(c.A) * alpha))
+	if c.A == 0 {
+		return nil
+	}
+	return image.NewUniform(c)
+}
+
+// fillPath заливает контур.
+func (r *svgRenderer) fillPath(segments []svgSegment, style map[string]string, m svgMatrix, opacity float64) {
+	value, ok := style["fill"]
+	if !ok {
+		value = "black"
+	}
+	paint := r.paint(value, style)
+	if paint.none {
+		return
+	}
+	alpha := opacity
+	if value, ok := style["fill-opacity"]; ok {
+		alpha *= parseSVGOpacity(value)
+	}
+	src := r.source(paint, alpha, m, segments)
+	if src == nil {
+		return
+	}
+	device := make([]svgSegment, len(segments))
+	for i, seg := range segments {
+		device[i].op = seg.op
+		for j := range seg.pts {
+			device[i].pts[j] = svgDevice(m, seg.pts[j])
+		}
+	}
+	r.rasterizeDevice(device, src)
+}
+
+// rasterizeDevice закрашивает контур в координатах устройства (каждый подконтур
+// замыкается). Растеризуется только рамка контура: закраска всего холста для
+// каждой фигуры сделала бы рисунки из тысяч мелких фигур очень медленными.
+func (r *svgRenderer) rasterizeDevice(segments []svgSegment, src image.Image) {
+	minX, minY, maxX, maxY := svgBounds(segments)
+	area := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1).Intersect(r.dst.Rect)
+	if area.Empty() {
+		return
+	}
+	z := r.rasterize
+	z.Reset(area.Dx(), area.Dy())
+	ox, oy := float64(area.Min.X), float64(area.Min.Y)
+	at := func(p svgPoint) (float32, float32) { return float32(p.x - ox), float32(p.y - oy) }
+	open := false
+	for _, seg := range segments {
+		p0x, p0y := at(seg.pts[0])
+		switch seg.op {
+		case 'M':
+			if open {
+				z.ClosePath()
+			}
+			z.MoveTo(p0x, p0y)
+			open = true
+		case 'L':
+			z.LineTo(p0x, p0y)
+		case 'Q':
+			p1x, p1y := at(seg.pts[1])
+			z.QuadTo(p0x, p0y, p1x, p1y)
+		case 'C':
+			p1x, p1y := at(seg.pts[1])
+			p2x, p2y := at(seg.pts[2])
+			z.CubeTo(p0x, p0y, p1x, p1y, p2x, p2y)
+		case 'Z':
+			if open {
+				z.ClosePath()
+			}
+			open = false
+		}
+	}
+	if open {
+		z.ClosePath()
+	}
+	z.Draw(r.dst, area, src, area.Min)
+}
+
+// svgDevice переводит точку в координаты устройства (с обрезкой слишком больших значений).
+func svgDevice(m svgMatrix, p svgPoint) svgPoint {
+	x, y := m.apply(p.x, p.y)
+	clamp := func(v float64) float64 {
+		if math.IsNaN(v) {
+			return 0
+		}
+		return math.Max(-svgMaxCoordinate, math.Min(svgMaxCoordinate, v))
+	}
+	return svgPoint{clamp(x), clamp(y)}
+}
+
+// strokePath обводит контур: контур разбивается на отрезки (в координатах устройства),
+// каждый отрезок превращается в прямоугольник нужной толщины, а в углах и на концах
+// добавляются круги (скругленные соединения и концы).
+func (r *svgRenderer) strokePath(segments []svgSegment, style map[string]string, m svgMatrix, opacity float64) {
+	paint := r.paint(style["stroke"], style)
+	if style["stroke"] == "" || paint.none {
+		return
+	}
+	scale := m.scale()
+	width := 1.0
+	if value, ok := style["stroke-width"]; ok {
+		width, _ = parseSVGLength(value, math.Hypot(r.viewportWidth, r.viewportHeight)/math.Sqrt2)
+	}
+	halfWidth := width * scale / 2
+	if halfWidth <= 0 {
+		return
+	}
+	alpha := opacity
+	if value, ok := style["stroke-opacity"]; ok {
+		alpha *= parseSVGOpacity(value)
+	}
+	src := r.source(paint, alpha, m, segments)
+	if src == nil {
+		return
+	}
+
+	polylines := flattenSVGPath(segments, m)
+	if dashes := parseSVGNumbers(style["stroke-dasharray"]); len(dashes) > 0 {
+		offset, _ := parseSVGLength(style["stroke-dashoffset"], 0)
+		polylines = dashSVGPolylines(polylines, dashes, offset, scale)
+	}
+	capStyle := style["stroke-linecap"]
+	var outline []svgSegment // Прямоугольники отрезков и круги соединений в координатах устройства
+	for _, line := range polylines {
+		pts := line.points
+		if len(pts) == 1 || len(pts) == 2 && pts[0] == pts[1] {
+			if capStyle == "round" {
+				svgCircle(&outline, pts[0], halfWidth)
+			}
+			continue
+		}
+		for i := 0; i+1 < len(pts); i++ {
+			a, b := pts[i], pts[i+1]
+			dx, dy := b.x-a.x, b.y-a.y
+			length := math.Hypot(dx, dy)
+			if length == 0 {
+				continue
+			}
+			ux, uy := dx/length, dy/length
+			// Квадратные концы продлевают крайние отрезки открытой линии на половину толщины.
+			if capStyle == "square" && !line.closed {
+				if i == 0 {
+					a = svgPoint{a.x - ux*halfWidth, a.y - uy*halfWidth}
+				}
+				if i+2 == len(pts) {
+					b = svgPoint{b.x + ux*halfWidth, b.y + uy*halfWidth}
+				}
+			}
+			nx, ny := -uy*halfWidth, ux*halfWidth
+			svgPolygon(&outline, []svgPoint{{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny}, {b.x - nx, b.y - ny}, {a.x - nx, a.y - ny}})
+		}
+		// Соединения отрезков и скругленные концы.
+		for i, p := range pts {
+			end := i == 0 || i == len(pts)-1
+			if !end || line.closed || capStyle == "round" {
+				svgCircle(&outline, p, halfWidth)
+			}
+		}
+	}
+	r.rasterizeDevice(outline, src)
+}
+
+// svgPolyline - часть контура, разбитая на отрезки (в координатах устройства).
+type svgPolyline struct {
+	points []svgPoint
+	closed bool
+}
+
+// flattenSVGPath разбивает контур на ломаные в координатах устройства.
+func flattenSVGPath(segments []svgSegment, m svgMatrix) []svgPolyline {
+	var lines []svgPolyline
+	var current *svgPolyline
+	device := func(p svgPoint) svgPoint { return svgDevice(m, p) }
+	for _, seg := range segments {
+		if seg.op != 'M' && current == nil {
+			continue
+		}
+		switch seg.op {
+		case 'M':
+			lines = append(lines, svgPolyline{points: []svgPoint{device(seg.pts[0])}})
+			current = &lines[len(lines)-1]
+		case 'L':
+			current.points = append(current.points, device(seg.pts[0]))
+		case 'Q', 'C':
+			start := current.points[len(current.points)-1]
+			ctrl := []svgPoint{start, device(seg.pts[0]), device(seg.pts[1])}
+			if seg.op == 'C' {
+				ctrl = append(ctrl, device(seg.pts[2]))
+			}
+			// Количество отрезков - по длине ломаной управляющих точек.
+			var length float64
+			for i := 0; i+1 < len(ctrl); i++ {
+				length += math.Hypot(ctrl[i+1].x-ctrl[i].x, ctrl[i+1].y-ctrl[i].y)
+			}
+			steps := max(2, min(256, int(math.Sqrt(length/svgCurveTolerance))))
+			for i := 1; i <= steps; i++ {
+				current.points = append(current.points, bezierPoint(ctrl, float64(i)/float64(steps)))
+			}
+		case 'Z':
+			current.points = append(current.points, current.points[0])
+			current.closed = true
+			// Следующая команда без M продолжает контур из начальной точки.
+			lines = append(lines, svgPolyline{points: []svgPoint{current.points[0]}})
+			current = &lines[len(lines)-1]
+		}
+	}
+	// Ломаные из одной точки после Z не рисуются.
+	result := lines[:0]
+	for i, line := range lines {
+		if len(line.points) > 1 || i == len(lines)-1 && len(line.points) == 1 && (i == 0 || !lines[i-1].closed) {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// bezierPoint вычисляет точку кривой Безье (алгоритм де Кастельжо).
+func bezierPoint(ctrl []svgPoint, t float64) svgPoint {
+	pts := append([]svgPoint(nil), ctrl...)
+	for n := len(pts) - 1; n > 0; n-- {
+		for i := 0; i < n; i++ {
+			pts[i] = svgPoint{pts[i].x + (pts[i+1].x-pts[i].x)*t, pts[i].y + (pts[i+1].y-pts[i].y)*t}
+		}
+	}
+	return pts[0]
+}
+
+// dashSVGPolylines разбивает ломаные на штрихи по stroke-dasharray.
+func dashSVGPolylines(lines []svgPolyline, dashes []float64, offset, scale float64) []svgPolyline {
+	if len(dashes)%2 == 1 {
+		dashes = append(dashes, dashes...)
+	}
+	var total float64
+	for i := range dashes {
+		dashes[i] = math.Abs(dashes[i]) * scale
+		total += dashes[i]
+	}
+	if total <= 0 {
+		return lines
+	}
+	// Слишком частый пунктир на длинной линии дал бы миллионы штрихов - такая линия рисуется сплошной.
+	var length float64
+	for _, line := range lines {
+		for i := 0; i+1 < len(line.points); i++ {
+			length += math.Hypot(line.points[i+1].x-line.points[i].x, line.points[i+1].y-line.points[i].y)
+		}
+	}
+	if length/total*float64(len(dashes)/2) > svgMaxDashes {
+		return lines
+	}
+	var result []svgPolyline
+	for _, line := range lines {
+		// Начальная позиция в шаблоне с учетом смещения.
+		index, remaining := 0, dashes[0]
+		pos := math.Mod(offset*scale, total)
+		if pos < 0 {
+			pos += total
+		}
+		for pos > 0 {
+			if pos < remaining {
+				remaining -= pos
+				break
+			}
+			pos -= remaining
+			index = (index + 1) % len(dashes)
+			remaining = dashes[index]
+		}
+		var current []svgPoint
+		if index%2 == 0 {
+			current = []svgPoint{line.points[0]}
+		}
+		for i := 0; i+1 < len(line.points); i++ {
+			a, b := line.points[i], line.points[i+1]
+			length := math.Hypot(b.x-a.x, b.y-a.y)
+			done := 0.0
+			for length-done > remaining {
+				done += remaining
+				p := svgPoint{a.x + (b.x-a.x)*done/length, a.y + (b.y-a.y)*done/length}
+				if index%2 == 0 {
+					result = append(result, svgPolyline{points: append(current, p)})
+					current = nil
+				} else {
+					current = []svgPoint{p}
+				}
+				index = (index + 1) % len(dashes)
+				remaining = dashes[index]
+			}
+			remaining -= length - done
+			if index%2 == 0 {
+				current = append(current, b)
+			}
+		}
+		if index%2 == 0 && len(current) > 1 {
+			result = append(result, svgPolyline{points: current})
+		}
+	}
+	return result
+}
+
+// svgPolygon добавляет к контуру многоугольник с положительной ориентацией
+// (одинаковая ориентация нужна, чтобы перекрывающиеся части обводки не вычитались).
+func svgPolygon(path *[]svgSegment, pts []svgPoint) {
+	var area float64
+	for i := range pts {
+		j := (i + 1) % len(pts)
+		area += pts[i].x*pts[j].y - pts[j].x*pts[i].y
+	}
+	if area < 0 {
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	*path = append(*path, svgSegment{op: 'M', pts: [3]svgPoint{pts[0]}})
+	for _, p := range pts[1:] {
+		*path = append(*path, svgSegment{op: 'L', pts: [3]svgPoint{p}})
+	}
+	*path = append(*path, svgSegment{op: 'Z'})
+}
+
+// svgCircle добавляет к контуру круг (многоугольник с положительной ориентацией).
+func svgCircle(path *[]svgSegment, c svgPoint, radius float64) {
+	n := max(8, min(64, int(radius*2)))
+	pts := make([]svgPoint, n)
+	for i := range pts {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = svgPoint{c.x + radius*math.Cos(angle), c.y + radius*math.Sin(angle)}
+	}
+	svgPolygon(path, pts)
+}
+
+// svgGradient - градиент как источник цвета для растеризатора.
+type svgGradient struct {
+	radial      bool
+	x1, y1      float64 // Начало (линейный) или центр (радиальный)
+	x2, y2, rad float64 // Конец (линейный) или радиус (радиальный)
+	spread      string
+	offsets     []float64
+	colors      []color.NRGBA
+	inverse     svgMatrix // Из координат устройства в координаты градиента
+}
+
+// gradientAttr возвращает атрибут градиента с учетом наследования через href.
+func (r *svgRenderer) gradientAttr(node *svgNode, name string) string {
+	for depth := 0; node != nil && depth < svgMaxUseDepth; depth++ {
+		if value, ok := node.attrs[name]; ok {
+			return value
+		}
+		node = r.doc.ids[strings.TrimPrefix(node.attrs["href"], "#")]
+	}
+	return ""
+}
+
+// newGradient создает источник цвета для градиента с учетом единиц (по рамке фигуры
+// или в пользовательских координатах) и gradientTransform.
+func (r *svgRenderer) newGradient(node *svgNode, alpha float64, m svgMatrix, segments []svgSegment) image.Image {
+	// Точки остановки: свои или унаследованные через href.
+	stopsNode := node
+	for depth := 0; stopsNode != nil && depth < svgMaxUseDepth; depth++ {
+		if hasChild(stopsNode, "stop") {
+			break
+		}
+		stopsNode = r.doc.ids[strings.TrimPrefix(stopsNode.attrs["href"], "#")]
+	}
+	if stopsNode == nil {
+		return nil
+	}
+	g := &svgGradient{radial: node.name == "radialGradient", spread: r.gradientAttr(node, "spreadMethod")}
+	last := 0.0
+	for _, stop := range stopsNode.children {
+		if stop.name != "stop" {
+			continue
+		}
+		style := r.computeStyle(stop, nil)
+		offset := parseSVGOpacity(stop.attrs["offset"]) // Число или проценты, 0-1
+		offset = math.Max(offset, last)
+		last = offset
+		c, ok := parseSVGColor(style["stop-color"])
+		if !ok {
+			c = color.NRGBA{A: 255}
+			if style["stop-color"] == "none" || style["stop-color"] == "transparent" {
+				c.A = 0
+			}
+		}
+		stopAlpha := alpha
+		if value, ok := style["stop-opacity"]; ok {
+			stopAlpha *= parseSVGOpacity(value)
+		}
+		c.A = uint8(math.Round(float64(c.A) * stopAlpha))
+		g.offsets = append(g.offsets, offset)
+		g.colors = append(g.colors, c)
+	}
+	if len(g.colors) == 0 {
+		return nil
+	}
+
+	userSpace := r.gradientAttr(node, "gradientUnits") == "userSpaceOnUse"
+	coord := func(name, fallback string, ref float64) float64 {
+		value := r.gradientAttr(node, name)
+		if value == "" {
+			value = fallback
+		}
+		if !userSpace {
+			ref = 1 // Проценты - доли рамки фигуры
+		}
+		v, _ := parseSVGLength(value, ref)
+		return v
+	}
+	w, h := r.viewportWidth, r.viewportHeight
+	if g.radial {
+		g.x1, g.y1 = coord("cx", "50%", w), coord("cy", "50%", h)
+		g.rad = coord("r", "50%", math.Hypot(w, h)/math.Sqrt2)
+	} else {
+		g.x1, g.y1 = coord("x1", "0%", w), coord("y1", "0%", h)
+		g.x2, g.y2 = coord("x2", "100%", w), coord("y2", "0%", h)
+	}
+
+	space := m
+	if !userSpace {
+		minX, minY, maxX, maxY := svgBounds(segments)
+		if maxX <= minX || maxY <= minY {
+			return nil
+		}
+		space = space.mul(svgMatrix{maxX - minX, 0, 0, maxY - minY, minX, minY})
+	}
+	space = space.mul(parseSVGTransform(r.gradientAttr(node, "gradientTransform")))
+	g.inverse = space.invert()
+	return g
+}
+
+// hasChild сообщает, есть ли у элемента дочерний элемент с заданным именем.
+func hasChild(node *svgNode, name string) bool {
+	for _, child := range node.children {
+		if child.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// svgBounds возвращает рамку контура (по всем точкам, включая управляющие).
+func svgBounds(segments []svgSegment) (minX, minY, maxX, maxY float64) {
+	minX, minY, maxX, maxY = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, seg := range segments {
+		n := map[byte]int{'M': 1, 'L': 1, 'Q': 2, 'C': 3}[seg.op]
+		for _, p := range seg.pts[:n] {
+			minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+			maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+		}
+	}
+	return minX, minY, maxX, maxY
+}
+
+func (g *svgGradient) ColorModel() color.Model { return color.NRGBAModel }
+
+func (g *svgGradient) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+// At возвращает цвет градиента в пикселе (x, y) устройства.
+func (g *svgGradient) At(x, y int) color.Color {
+	px, py := g.inverse.apply(float64(x)+0.5, float64(y)+0.5)
+	var t float64
+	if g.radial {
+		if g.rad > 0 {
+			t = math.Hypot(px-g.x1, py-g.y1) / g.rad
+		}
+	} else {
+		dx, dy := g.x2-g.x1, g.y2-g.y1
+		if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+			t = ((px-g.x1)*dx + (py-g.y1)*dy) / lengthSq
+		}
+	}
+	switch g.spread {
+	case "repeat":
+		t -= math.Floor(t)
+	case "reflect":
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+	if t <= g.offsets[0] {
+		return g.colors[0]
+	}
+	for i := 1; i < len(g.offsets); i++ {
+		if t <= g.offsets[i] {
+			span := g.offsets[i] - g.offsets[i-1]
+			if span <= 0 {
+				return g.colors[i]
+			}
+			f := (t - g.offsets[i-1]) / span
+			a, b := g.colors[i-1], g.colors[i]
+			mix := func(u, v uint8) uint8 { return uint8(math.Round(float64(u) + (float64(v)-float64(u))*f)) }
+			return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+		}
+	}
+	return g.colors[len(g.colors)-1]
+}
+
+// Встроенные шрифты для текста загружаются один раз.
+var (
+	svgFontsOnce        sync.Once
+	svgRegular, svgBold *sfnt.Font
+	svgFontsErr         error
+)
+
+// svgGlyphPPEM - размер, в котором загружаются контуры букв (потом масштабируются до
+// нужного): координаты контуров - числа с фиксированной точкой 26.6, и при мелком
+// шрифте в пользовательских единицах им не хватило бы точности.
+const svgGlyphPPEM = 1024
+
+// loadSVGFonts загружает встроенные шрифты (Go Regular и Go Bold).
+func loadSVGFonts() error {
+	svgFontsOnce.Do(func() {
+		if svgRegular, svgFontsErr = sfnt.Parse(goregular.TTF); svgFontsErr == nil {
+			svgBold, svgFontsErr = sfnt.Parse(gobold.TTF)
+		}
+	})
+	return svgFontsErr
+}
+
+// svgTextState - состояние вывода текста: позиция пера (в пользовательских координатах),
+// сдвиг по text-anchor и режим (измерение ширины или отрисовка).
+type svgTextState struct {
+	pen   svgPoint
+	shift float64
+	first bool
+	draw  bool
+}
+
+// renderText отрисовывает текст встроенным шрифтом. Буквы превращаются в контуры
+// и закрашиваются как обычные фигуры, поэтому для текста работают преобразования,
+// градиенты и обводка. Поддерживаются x, y, dx, dy (первые значения списков),
+// text-anchor и вложенные tspan; поворот отдельных букв и текст вдоль контура не поддерживаются.
+func (r *svgRenderer) renderText(node *svgNode, style map[string]string, m svgMatrix, opacity float64) {
+	if loadSVGFonts() != nil {
+		return
+	}
+	state := &svgTextState{first: true}
+	// text-anchor относится ко всему тексту, поэтому сначала измеряется его ширина.
+	if anchor := style["text-anchor"]; anchor == "middle" || anchor == "end" {
+		r.renderTextRun(node, style, m, opacity, state)
+		startX, _ := svgFirstLength(node.attrs["x"], r.viewportWidth)
+		width := state.pen.x - startX
+		if dx, ok := svgFirstLength(node.attrs["dx"], r.viewportWidth); ok {
+			width -= dx
+		}
+		state = &svgTextState{first: true, shift: -width}
+		if anchor == "middle" {
+			state.shift = -width / 2
+		}
+	}
+	state.draw = true
+	r.renderTextRun(node, style, m, opacity, state)
+}
+
+// renderTextRun выводит содержимое text или tspan и сдвигает перо на ширину текста.
+func (r *svgRenderer) renderTextRun(node *svgNode, style map[string]string, m svgMatrix, opacity float64, state *svgTextState) {
+	if x, ok := svgFirstLength(node.attrs["x"], r.viewportWidth); ok {
+		state.pen.x = x
+	}
+	if y, ok := svgFirstLength(node.attrs["y"], r.viewportHeight); ok {
+		state.pen.y = y
+	}
+	if dx, ok := svgFirstLength(node.attrs["dx"], r.viewportWidth); ok {
+		state.pen.x += dx
+	}
+	if dy, ok := svgFirstLength(node.attrs["dy"], r.viewportHeight); ok {
+		state.pen.y += dy
+	}
+
+	for _, child := range node.children {
+		switch child.name {
+		case "#text":
+			// Пробелы схлопываются, как в браузере (xml:space не поддерживается).
+			text := strings.Join(strings.Fields(child.text), " ")
+			if text == "" {
+				continue
+			}
+			if !state.first && strings.IndexAny(child.text[:1], " \t\r\n") == 0 {
+				text = " " + text
+			}
+			if last := child.text[len(child.text)-1:]; strings.ContainsAny(last, " \t\r\n") {
+				text += " "
+			}
+			r.drawText(text, style, m, opacity, state)
+			state.first = false
+		case "tspan", "a":
+			childStyle := r.computeStyle(child, style)
+			if childStyle["display"] == "none" {
+				continue
+			}
+			r.renderTextRun(child, childStyle, m, opacity, state)
+		}
+	}
+}
+
+// drawText выводит строку в позиции пера и сдвигает перо на ширину строки.
+// В режиме измерения строка не рисуется.
+func (r *svgRenderer) drawText(text string, style map[string]string, m svgMatrix, opacity float64, state *svgTextState) {
+	size := svgDefaultFontSize
+	if value, ok := style["font-size"]; ok {
+		if v, ok := parseSVGLength(value, svgDefaultFontSize); ok && v > 0 {
+			size = v
+		}
+	}
+	f := svgRegular
+	if weight := style["font-weight"]; weight == "bold" || weight == "bolder" || len(weight) == 3 && weight >= "600" {
+		f = svgBold
+	}
+
+	var buf sfnt.Buffer
+	ppem := fixed.I(svgGlyphPPEM)
+	scale := size / svgGlyphPPEM / 64 // Из единиц 26.6 в пользовательские
+	x := state.pen.x + state.shift
+	var segments []svgSegment
+	var prev sfnt.GlyphIndex
+	for _, ch := range text {
+		index, err := f.GlyphIndex(&buf, ch)
+		if err != nil {
+			continue
+		}
+		if prev != 0 && index != 0 {
+			if kern, err := f.Kern(&buf, prev, index, ppem, font.HintingNone); err == nil {
+				x += float64(kern) * scale
+			}
+		}
+		prev = index
+		if state.draw {
+			glyph, err := f.LoadGlyph(&buf, index, ppem, nil)
+			if err != nil {
+				continue
+			}
+			point := func(p fixed.Point26_6) svgPoint {
+				return svgPoint{x + float64(p.X)*scale, state.pen.y + float64(p.Y)*scale}
+			}
+			for _, seg := range glyph {
+				switch seg.Op {
+				case sfnt.SegmentOpMoveTo:
+					if len(segments) > 0 {
+						segments = append(segments, svgSegment{op: 'Z'})
+					}
+					segments = append(segments, svgSegment{op: 'M', pts: [3]svgPoint{point(seg.Args[0])}})
+				case sfnt.SegmentOpLineTo:
+					segments = append(segments, svgSegment{op: 'L', pts: [3]svgPoint{point(seg.Args[0])}})
+				case sfnt.SegmentOpQuadTo:
+					segments = append(segments, svgSegment{op: 'Q', pts: [3]svgPoint{point(seg.Args[0]), point(seg.Args[1])}})
+				case sfnt.SegmentOpCubeTo:
+					segments = append(segments, svgSegment{op: 'C', pts: [3]svgPoint{point(seg.Args[0]), point(seg.Args[1]), point(seg.Args[2])}})
+				}
+			}
+		}
+		if advance, err := f.GlyphAdvance(&buf, index, ppem, font.HintingNone); err == nil {
+			x += float64(advance) * scale
+		}
+	}
+	state.pen.x = x - state.shift
+	if !state.draw || len(segments) == 0 || style["visibility"] == "hidden" {
+		return
+	}
+	segments = append(segments, svgSegment{op: 'Z'})
+	r.fillPath(segments, style, m, opacity)
+	r.strokePath(segments, style, m, opacity)
+}
+
+// svgFirstLength возвращает первое значение из списка длин (x="10 20 30").
+func svgFirstLength(value string, ref float64) (float64, bool) {
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	return parseSVGLength(fields[0], ref)
+}
+
+// renderImage отрисовывает встроенное растровое изображение (после очистки
+// других источников не остается) с учетом преобразования и preserveAspectRatio.
+func (r *svgRenderer) renderImage(node *svgNode, m svgMatrix, opacity float64) {
+	_, payload, ok := strings.Cut(node.attrs["href"], ",")
+	if !ok {
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return
+	}
+	b := img.Bounds()
+	x, _ := parseSVGLength(node.attrs["x"], r.viewportWidth)
+	y, _ := parseSVGLength(node.attrs["y"], r.viewportHeight)
+	width, okW := parseSVGLength(node.attrs["width"], r.viewportWidth)
+	height, okH := parseSVGLength(node.attrs["height"], r.viewportHeight)
+	if !okW {
+		width = float64(b.Dx())
+	}
+	if !okH {
+		height = float64(b.Dy())
+	}
+	attrs := map[string]string{
+		"viewBox":             fmt.Sprintf("%d %d %d %d", b.Min.X, b.Min.Y, b.Dx(), b.Dy()),
+		"preserveAspectRatio": node.attrs["preserveAspectRatio"],
+	}
+	fit, _, _ := svgViewBoxTransform(attrs, width, height)
+	t := m.mul(svgTranslate(x, y)).mul(fit)
+
+	var src image.Image = img
+	if opacity < 1 {
+		faded := image.NewNRGBA(b)
+		draw.Draw(faded, b, img, b.Min, draw.Src)
+		for i := 3; i < len(faded.Pix); i += 4 {
+			faded.Pix[i] = uint8(float64(faded.Pix[i]) * opacity)
+		}
+		src = faded
+	}
+	draw.ApproxBiLinear.Transform(r.dst, f64.Aff3{t[0], t[2], t[4], t[1], t[3], t[5]}, src, b, draw.Over, nil)
+}
+
+// svgNumberPattern - число в синтаксисе SVG (знак, дробная часть, экспонента).
+var svgNumberPattern = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// parseSVGNumbers разбирает список чисел ("1,2 3-4.5.5" -> 1 2 3 -4.5 0.5).
+func parseSVGNumbers(value string) []float64 {
+	var numbers []float64
+	for _, match := range svgNumberPattern.FindAllString(value, -1) {
+		if v, err := strconv.ParseFloat(match, 64); err == nil {
+			numbers = append(numbers, v)
+		}
+	}
+	return numbers
+}
+
+// parseSVGLength разбирает длину с единицами измерения. Проценты считаются от ref.
+func parseSVGLength(value string, ref float64) (float64, bool) {
+	value = strings.TrimSpace(value)
+	match := svgNumberPattern.FindStringIndex(value)
+	if match == nil || match[0] != 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(value[:match[1]], 64)
+	if err != nil {
+		return 0, false
+	}
+	switch strings.TrimSpace(value[match[1]:]) {
+	case "", "px":
+	case "%":
+		v = v / 100 * ref
+	case "pt":
+		v *= 4.0 / 3
+	case "pc":
+		v *= 16
+	case "mm":
+		v *= 96 / 25.4
+	case "cm":
+		v *= 96 / 2.54
+	case "in":
+		v *= 96
+	case "em", "rem":
+		v *= svgDefaultFontSize
+	case "ex":
+		v *= svgDefaultFontSize / 2
+	default:
+		return 0, false
+	}
+	return v, true
+}
+
+// parseSVGOpacity разбирает прозрачность (число или проценты), ограничивая ее диапазоном 0-1.
+func parseSVGOpacity(value string) float64 {
+	v, ok := parseSVGLength(value, 1)
+	if !ok {
+		return 1
+	}
+	return math.Max(0, math.Min(1, v))
+}
+
+// parseSVGColor разбирает цвет: имя, #rgb, #rgba, #rrggbb, #rrggbbaa, rgb() и rgba().
+func parseSVGColor(value string) (color.NRGBA, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "" || value == "none":
+		return color.NRGBA{}, false
+	case value == "transparent":
+		return color.NRGBA{}, true
+	case strings.HasPrefix(value, "#"):
+		hex := value[1:]
+		if len(hex) == 3 || len(hex) == 4 {
+			expanded := make([]byte, 0, 8)
+			for i := range hex {
+				expanded = append(expanded, hex[i], hex[i])
+			}
+			hex = string(expanded)
+		}
+		if len(hex) == 6 {
+			hex += "ff"
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 8 || err != nil {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+	case strings.HasPrefix(value, "rgb"):
+		open, end := strings.IndexByte(value, '('), strings.IndexByte(value, ')')
+		if open < 0 || end < open {
+			return color.NRGBA{}, false
+		}
+		parts := strings.FieldsFunc(value[open+1:end], func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+		if len(parts) < 3 {
+			return color.NRGBA{}, false
+		}
+		var channels [4]uint8
+		channels[3] = 255
+		for i, part := range parts[:min(4, len(parts))] {
+			ref := 255.0
+			if i == 3 {
+				ref = 1
+			}
+			v, ok := parseSVGLength(part, ref)
+			if !ok {
+				return color.NRGBA{}, false
+			}
+			if i == 3 {
+				v *= 255
+			}
+			channels[i] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+		}
+		return color.NRGBA{channels[0], channels[1], channels[2], channels[3]}, true
+	}
+	if c, ok := colornames.Map[value]; ok {
+		return color.NRGBA{c.R, c.G, c.B, c.A}, true
+	}
+	return color.NRGBA{}, false
+}
+
+// svgTransformPattern - одна функция преобразования в атрибуте transform.
+var svgTransformPattern = regexp.MustCompile(`(matrix|translate|scale|rotate|skewX|skewY)\s*\(([^)]*)\)`)
+
+// parseSVGTransform разбирает атрибут transform (список функций применяется слева направо).
+func parseSVGTransform(value string) svgMatrix {
+	m := svgIdentity
+	for _, match := range svgTransformPattern.FindAllStringSubmatch(value, -1) {
+		args := parseSVGNumbers(match[2])
+		arg := func(i int, fallback float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return fallback
+		}
+		var t svgMatrix
+		switch match[1] {
+		case "matrix":
+			if len(args) != 6 {
+				continue
+			}
+			t = svgMatrix{args[0], args[1], args[2], args[3], args[4], args[5]}
+		case "translate":
+			t = svgTranslate(arg(0, 0), arg(1, 0))
+		case "scale":
+			sx := arg(0, 1)
+			t = svgScale(sx, arg(1, sx))
+		case "rotate":
+			angle := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			cos, sin := math.Cos(angle), math.Sin(angle)
+			t = svgTranslate(cx, cy).mul(svgMatrix{cos, sin, -sin, cos, 0, 0}).mul(svgTranslate(-cx, -cy))
+		case "skewX":
+			t = svgMatrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = svgMatrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		}
+		m = m.mul(t)
+	}
+	return m
+}
+
+// svgPathBuilder собирает контур в абсолютных координатах.
+type svgPathBuilder struct {
+	segments    []svgSegment
+	current     svgPoint // Текущая точка
+	start       svgPoint // Начало текущего подконтура
+	lastControl svgPoint // Последняя управляющая точка (для S и T)
+	lastOp      byte
+}
+
+func (p *svgPathBuilder) moveTo(x, y float64) {
+	p.current, p.start = svgPoint{x, y}, svgPoint{x, y}
+	p.segments = append(p.segments, svgSegment{op: 'M', pts: [3]svgPoint{p.current}})
+	p.lastOp = 'M'
+}
+
+func (p *svgPathBuilder) lineTo(x, y float64) {
+	p.current = svgPoint{x, y}
+	p.segments = append(p.segments, svgSegment{op: 'L', pts: [3]svgPoint{p.current}})
+	p.lastOp = 'L'
+}
+
+func (p *svgPathBuilder) quadTo(x1, y1, x, y float64) {
+	p.lastControl, p.current = svgPoint{x1, y1}, svgPoint{x, y}
+	p.segments = append(p.segments, svgSegment{op: 'Q', pts: [3]svgPoint{p.lastControl, p.current}})
+	p.lastOp = 'Q'
+}
+
+func (p *svgPathBuilder) cubeTo(x1, y1, x2, y2, x, y float64) {
+	p.lastControl, p.current = svgPoint{x2, y2}, svgPoint{x, y}
+	p.segments = append(p.segments, svgSegment{op: 'C', pts: [3]svgPoint{{x1, y1}, p.lastControl, p.current}})
+	p.lastOp = 'C'
+}
+
+func (p *svgPathBuilder) close() {
+	p.segments = append(p.segments, svgSegment{op: 'Z'})
+	p.current = p.start
+	p.lastOp = 'Z'
+}
+
+// arcTo добавляет дугу эллипса (параметры как в команде A), приближая ее кубическими
+// кривыми (по одной на каждые 90 градусов).
+func (p *svgPathBuilder) arcTo(rx, ry, rotation float64, large, sweep bool, x, y float64) {
+	x0, y0 := p.current.x, p.current.y
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || x0 == x && y0 == y {
+		p.lineTo(x, y)
+		return
+	}
+	// Преобразование из конечных точек в центр (SVG 1.1, приложение F.6.5).
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	dx, dy := (x0-x)/2, (y0-y)/2
+	x1p, y1p := cosPhi*dx+sinPhi*dy, -sinPhi*dx+cosPhi*dy
+	if lambda := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry); lambda > 1 {
+		rx, ry = rx*math.Sqrt(lambda), ry*math.Sqrt(lambda)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		coef = -coef
+	}
+	cxp, cyp := coef*rx*y1p/ry, -coef*ry*x1p/rx
+	cx, cy := cosPhi*cxp-sinPhi*cyp+(x0+x)/2, sinPhi*cxp+cosPhi*cyp+(y0+y)/2
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	delta := angle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	point := func(t float64) (float64, float64) {
+		ex, ey := rx*math.Cos(t), ry*math.Sin(t)
+		return cosPhi*ex - sinPhi*ey + cx, sinPhi*ex + cosPhi*ey + cy
+	}
+	derivative := func(t float64) (float64, float64) {
+		ex, ey := -rx*math.Sin(t), ry*math.Cos(t)
+		return cosPhi*ex - sinPhi*ey, sinPhi*ex + cosPhi*ey
+	}
+	for i := 0; i < n; i++ {
+		t1, t2 := theta+float64(i)*step, theta+float64(i+1)*step
+		ax, ay := point(t1)
+		bx, by := point(t2)
+		dax, day := derivative(t1)
+		dbx, dby := derivative(t2)
+		if i == n-1 {
+			bx, by = x, y // Точное попадание в конечную точку
+		}
+		p.cubeTo(ax+k*dax, ay+k*day, bx-k*dbx, by-k*dby, bx, by)
+	}
+	p.lastOp = 'A'
+}
+
+// parseSVGPath разбирает атрибут d. При ошибке возвращается уже разобранная часть
+// (так же поступают браузеры).
+func parseSVGPath(d string) []svgSegment {
+	var p svgPathBuilder
+	s := svgPathScanner{data: d}
+	var command byte
+	for {
+		s.skipSeparators()
+		if s.pos >= len(s.data) {
+			break
+		}
+		if c := s.data[s.pos]; strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0 {
+			command = c
+			s.pos++
+		} else if command == 0 {
+			break
+		}
+		relative := command >= 'a'
+		base := svgPoint{}
+		if relative {
+			base = p.current
+		}
+		ok := true
+		switch command | 0x20 { // Нижний регистр
+		case 'm':
+			x, y, okXY := s.pair()
+			if ok = okXY; ok {
+				p.moveTo(base.x+x, base.y+y)
+				// Следующие пары после M - неявные L.
+				if relative {
+					command = 'l'
+				} else {
+					command = 'L'
+				}
+			}
+		case 'l':
+			x, y, okXY := s.pair()
+			if ok = okXY; ok {
+				p.lineTo(base.x+x, base.y+y)
+			}
+		case 'h':
+			x, okX := s.number()
+			if ok = okX; ok {
+				if !relative {
+					base.x = 0
+				}
+				p.lineTo(base.x+x, p.current.y)
+			}
+		case 'v':
+			y, okY := s.number()
+			if ok = okY; ok {
+				if !relative {
+					base.y = 0
+				}
+				p.lineTo(p.current.x, base.y+y)
+			}
+		case 'c':
+			x1, y1, ok1 := s.pair()
+			x2, y2, ok2 := s.pair()
+			x, y, ok3 := s.pair()
+			if ok = ok1 && ok2 && ok3; ok {
+				p.cubeTo(base.x+x1, base.y+y1, base.x+x2, base.y+y2, base.x+x, base.y+y)
+			}
+		case 's':
+			x2, y2, ok2 := s.pair()
+			x, y, ok3 := s.pair()
+			if ok = ok2 && ok3; ok {
+				x1, y1 := p.current.x, p.current.y
+				if p.lastOp == 'C' {
+					x1, y1 = 2*p.current.x-p.lastControl.x, 2*p.current.y-p.lastControl.y
+				}
+				p.cubeTo(x1, y1, base.x+x2, base.y+y2, base.x+x, base.y+y)
+			}
+		case 'q':
+			x1, y1, ok1 := s.pair()
+			x, y, ok2 := s.pair()
+			if ok = ok1 && ok2; ok {
+				p.quadTo(base.x+x1, base.y+y1, base.x+x, base.y+y)
+			}
+		case 't':
+			x, y, okXY := s.pair()
+			if ok = okXY; ok {
+				x1, y1 := p.current.x, p.current.y
+				if p.lastOp == 'Q' {
+					x1, y1 = 2*p.current.x-p.lastControl.x, 2*p.current.y-p.lastControl.y
+				}
+				p.quadTo(x1, y1, base.x+x, base.y+y)
+			}
+		case 'a':
+			rx, ry, ok1 := s.pair()
+			rotation, ok2 := s.number()
+			large, ok3 := s.flag()
+			sweep, ok4 := s.flag()
+			x, y, ok5 := s.pair()
+			if ok = ok1 && ok2 && ok3 && ok4 && ok5; ok {
+				p.arcTo(rx, ry, rotation, large, sweep, base.x+x, base.y+y)
+			}
+		case 'z':
+			p.close()
+			command = 0 // После Z числа без команды недопустимы
+		}
+		if !ok || len(p.segments) > 0 && p.segments[0].op != 'M' {
+			break
+		}
+	}
+	if len(p.segments) > 0 && p.segments[0].op != 'M' {
+		return nil
+	}
+	return p.segments
+}
+
+// svgPathScanner читает числа и флаги из атрибута d.
+type svgPathScanner struct {
+	data string
+	pos  int
+}
+
+func (s *svgPathScanner) skipSeparators() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n,", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+func (s *svgPathScanner) number() (float64, bool) {
+	s.skipSeparators()
+	match := svgNumberPattern.FindStringIndex(s.data[s.pos:])
+	if match == nil || match[0] != 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s.data[s.pos:s.pos+match[1]], 64)
+	s.pos += match[1]
+	return v, err == nil
+}
+
+func (s *svgPathScanner) pair() (float64, float64, bool) {
+	x, okX := s.number()
+	y, okY := s.number()
+	return x, y, okX && okY
+}
+
+// flag читает флаг дуги: одну цифру 0 или 1 (флаги могут идти без разделителей: "a1 1 0 00 1 1").
+func (s *svgPathScanner) flag() (bool, bool) {
+	s.skipSeparators()
+	if s.pos >= len(s.data) || s.data[s.pos] != '0' && s.data[s.pos] != '1' {
+		return false, false
+	}
+	s.pos++
+	return s.data[s.pos-1] == '1', true
+}
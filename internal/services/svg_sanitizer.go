@@ -0,0 +1,603 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"           // Для сборки очищенного документа
+	"encoding/base64" // Для встроенных растровых изображений (data:)
+	"encoding/xml"    // Для разбора SVG
+	"errors"          // Для ошибки-маркера
+	"fmt"             // Для форматирования ошибок
+	"image"           // Для перекодирования встроенных изображений
+	"image/png"       // Для перекодирования встроенных изображений в PNG
+	"io"              // Для признака конца документа
+	"regexp"          // Для очистки CSS
+	"sort"            // Для стабильного порядка в отчете
+	"strings"         // Для разбора атрибутов
+)
+
+// Очистка SVG. SVG - это XML-документ, и помимо рисунка в нем могут быть скрипты,
+// обработчики событий, ссылки на внешние ресурсы (загружаются при просмотре и выдают
+// получателя), foreignObject с произвольным HTML, блоки метаданных, служебные данные
+// редакторов (пространства имен sodipodi, inkscape, Illustrator, Sketch) с именами
+// авторов и путями к файлам, а также комментарии.
+//
+// Очистка построена на списках разрешенного: в результат попадают только известные
+// элементы и атрибуты SVG, все остальное удаляется. Встроенные растровые изображения
+// (data:) перекодируются в PNG без метаданных.
+
+// ErrInvalidSVG - файл определен как SVG, но его не удалось разобрать.
+var ErrInvalidSVG = errors.New("некорректный SVG")
+
+// Пространства имен.
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+	dcNamespace    = "http://purl.org/dc/elements/1.1/"
+)
+
+// Ограничения документа.
+const (
+	svgMaxDepth          = 256      // Максимальная вложенность элементов
+	svgMaxEmbeddedPixels = 1 << 24  // Максимальный размер встроенного растрового изображения (16 Мп)
+	svgMaxReportValue    = 200      // Максимальная длина строки в отчете
+	svgMaxEntityValue    = 256      // Максимальная длина значения сущности из DOCTYPE
+	svgMaxEntityTotal    = 1 << 20  // Максимальный суммарный объем подстановок сущностей из DOCTYPE
+	svgMaxOutput         = 64 << 20 // Максимальный размер очищенного документа
+)
+
+// svgElements - разрешенные элементы SVG (в пространстве имен SVG).
+// Не входят: script, foreignObject, metadata, title, desc, элементы анимации
+// (через set/animate можно подменить href на javascript:) и feImage (внешние ссылки).
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "a": true, "switch": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true, "image": true, "style": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true,
+	"clipPath": true, "mask": true, "marker": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feConvolveMatrix": true, "feDiffuseLighting": true, "feDisplacementMap": true, "feDistantLight": true,
+	"feDropShadow": true, "feFlood": true, "feFuncA": true, "feFuncB": true, "feFuncG": true, "feFuncR": true,
+	"feGaussianBlur": true, "feMerge": true, "feMergeNode": true, "feMorphology": true, "feOffset": true,
+	"fePointLight": true, "feSpecularLighting": true, "feSpotLight": true, "feTile": true, "feTurbulence": true,
+}
+
+// svgRemovedElements - категории удаляемых элементов SVG для отчета.
+var svgRemovedElements = map[string]string{
+	"script":           "script",
+	"foreignObject":    "foreignObject",
+	"metadata":         "metadata",
+	"title":            "title/desc",
+	"desc":             "title/desc",
+	"animate":          "анимация",
+	"animateMotion":    "анимация",
+	"animateTransform": "анимация",
+	"set":              "анимация",
+	"feImage":          "внешние ссылки",
+}
+
+// svgAttributes - разрешенные атрибуты без пространства имен: геометрия, оформление,
+// градиенты, фильтры и текст. Атрибуты data-*, обработчики событий (on*) и атрибуты
+// редакторов не входят.
+var svgAttributes = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		id class style transform href
+		x y x1 y1 x2 y2 cx cy r rx ry fx fy fr width height d points pathLength
+		viewBox preserveAspectRatio
+		offset gradientUnits gradientTransform spreadMethod
+		patternUnits patternContentUnits patternTransform clipPathUnits maskUnits maskContentUnits
+		markerWidth markerHeight markerUnits refX refY orient
+		dx dy rotate textLength lengthAdjust startOffset method spacing
+		filterUnits primitiveUnits in in2 result stdDeviation mode operator k1 k2 k3 k4 values type
+		tableValues slope intercept amplitude exponent kernelMatrix order divisor bias targetX targetY
+		edgeMode preserveAlpha surfaceScale diffuseConstant specularConstant specularExponent
+		kernelUnitLength scale xChannelSelector yChannelSelector radius azimuth elevation z
+		pointsAtX pointsAtY pointsAtZ limitingConeAngle baseFrequency numOctaves seed stitchTiles
+		fill fill-opacity fill-rule stroke stroke-width stroke-opacity stroke-linecap stroke-linejoin
+		stroke-miterlimit stroke-dasharray stroke-dashoffset opacity color display visibility
+		clip-path clip-rule mask filter marker-start marker-mid marker-end
+		stop-color stop-opacity flood-color flood-opacity lighting-color
+		font-family font-size font-weight font-style font-variant font-stretch
+		text-anchor dominant-baseline alignment-baseline baseline-shift letter-spacing word-spacing
+		text-decoration writing-mode direction unicode-bidi
+		shape-rendering text-rendering image-rendering color-interpolation color-interpolation-filters
+		paint-order vector-effect overflow mix-blend-mode isolation transform-origin`) {
+		svgAttributes[name] = true
+	}
+}
+
+// svgEditorNamespaces - пространства имен редакторов (для отчета).
+var svgEditorNamespaces = map[string]string{
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd": "sodipodi",
+	"http://www.inkscape.org/namespaces/inkscape":        "inkscape",
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":         "Illustrator",
+	"http://ns.adobe.com/Graphs/1.0/":                    "Illustrator",
+	"http://ns.adobe.com/Extensibility/1.0/":             "Illustrator",
+	"http://www.bohemiancoding.com/sketch/ns":            "Sketch",
+	"http://www.figma.com/figma/ns":                      "Figma",
+}
+
+// Шаблоны очистки CSS (элементы style и атрибуты style).
+var (
+	cssImportPattern    = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssURLPattern       = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)]*))\s*\)`)
+	cssCommentPattern   = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssDangerousPattern = regexp.MustCompile(`(?i)(-moz-binding|behavior)\s*:[^;}]*;?`)
+	svgTextEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlEntityPattern    = regexp.MustCompile(`<!ENTITY\s+([A-Za-z_][\w.-]*)\s+"([^"<&%]*)"\s*>`)
+)
+
+// svgSanitizer - состояние очистки одного документа.
+type svgSanitizer struct {
+	out       bytes.Buffer
+	removed   map[string]int // Категория удаленных данных -> количество
+	report    *MetadataReport
+	namespace []map[string]string // Стек объявлений префиксов пространств имен
+	metadata  int                 // Глубина вложенности внутри удаляемого metadata (для сбора авторов)
+	dcField   string              // Текущее поле Dublin Core внутри metadata
+	blocked   error               // Встроенное изображение совпало со списком блокировки
+}
+
+// sanitizeSVG очищает SVG-документ и возвращает очищенный документ и отчет
+// о найденных и удаленных данных.
+func sanitizeSVG(data []byte) ([]byte, *MetadataReport, error) {
+	s := &svgSanitizer{
+		removed:   make(map[string]int),
+		report:    &MetadataReport{Format: "svg"},
+		namespace: []map[string]string{{"xml": xmlNamespace, "xlink": xlinkNamespace}}, // xlink часто не объявляют
+	}
+	s.out.WriteString(xml.Header)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+	// Именованные сущности HTML (&nbsp; и т.п.) раскрываются в символы. Сущности из DOCTYPE
+	// (Illustrator объявляет так пространства имен) добавляются по мере чтения; их значения
+	// подставляются как есть, без рекурсивного раскрытия. Рекурсии нет, но и одна длинная
+	// сущность, на которую много ссылок, раздувает документ квадратично, поэтому значения
+	// сущностей ограничены по длине, а суммарный объем подстановок считается заранее -
+	// по количеству ссылок в документе - до того, как декодер их раскроет.
+	entities := make(map[string]string, len(xml.HTMLEntity))
+	for name, value := range xml.HTMLEntity {
+		entities[name] = value
+	}
+	decoder.Entity = entities
+
+	var (
+		depth     int    // Текущая глубина вложенности
+		skipFrom  = -1   // Глубина удаляемого поддерева (-1 - не удаляется)
+		root      string // Имя корневого элемента
+		inStyle   bool   // Внутри разрешенного элемента style
+		expansion int    // Объем подстановок сущностей из DOCTYPE
+	)
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSVG, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth > svgMaxDepth {
+				return nil, nil, fmt.Errorf("%w: слишком глубокая вложенность элементов", ErrInvalidSVG)
+			}
+			s.pushNamespaces(t.Attr)
+			space, local := s.resolve(t.Name.Space), t.Name.Local
+			if depth == 1 {
+				root = local
+				if space != svgNamespace || local != "svg" {
+					return nil, nil, fmt.Errorf("%w: корневой элемент <%s> не является svg", ErrInvalidSVG, t.Name.Local)
+				}
+			}
+			if skipFrom >= 0 {
+				s.collectMetadataField(space, local)
+				continue
+			}
+			if !s.allowedElement(space, local, t.Name.Space) {
+				skipFrom = depth
+				if local == "metadata" && space == svgNamespace {
+					s.metadata = depth
+				}
+				continue
+			}
+			attrs := s.sanitizeAttributes(local, t.Attr)
+			if local == "image" && !hasAttribute(attrs, "href") {
+				// Изображение без допустимого источника ничего не отображает.
+				skipFrom = depth
+				continue
+			}
+			s.writeStart(local, attrs, depth == 1)
+			inStyle = local == "style"
+
+		case xml.EndElement:
+			s.namespace = s.namespace[:len(s.namespace)-1]
+			switch {
+			case skipFrom >= 0:
+				if depth == s.metadata {
+					s.metadata = 0
+				}
+				s.dcField = ""
+				if depth == skipFrom {
+					skipFrom = -1
+				}
+			default:
+				s.out.WriteString("</" + t.Name.Local + ">")
+				inStyle = false
+			}
+			depth--
+
+		case xml.CharData:
+			if skipFrom >= 0 {
+				if s.metadata > 0 && s.dcField != "" {
+					addReportValue(&s.report.Authors, string(t))
+				}
+				continue
+			}
+			if depth == 0 {
+				continue // Пробелы вне корневого элемента
+			}
+			text := string(t)
+			if inStyle {
+				text = s.sanitizeCSS(text)
+			}
+			svgTextEscaper.WriteString(&s.out, text) // Переводы строк сохраняются как есть
+
+		case xml.Comment:
+			s.removed["комментарии"]++
+			// Комментарии редакторов: "Generator: Adobe Illustrator 27.0.0, SVG Export Plug-In".
+			if comment := strings.TrimSpace(string(t)); strings.HasPrefix(comment, "Generator:") {
+				addReportValue(&s.report.Software, strings.TrimSpace(strings.TrimPrefix(comment, "Generator:")))
+			} else {
+				addReportValue(&s.report.Comments, comment)
+			}
+
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				s.removed["инструкции обработки"]++ // Например, xml-stylesheet со внешней ссылкой
+			}
+
+		case xml.Directive:
+			s.removed["DOCTYPE"]++ // Сам DOCTYPE в результат не переносится
+			for _, match := range xmlEntityPattern.FindAllSubmatch(t, -1) {
+				if len(match[2]) > svgMaxEntityValue {
+					return nil, nil, fmt.Errorf("%w: слишком длинное значение сущности %s", ErrInvalidSVG, match[1])
+				}
+				// Ссылки считаются по всему документу (в том числе в комментариях) - с запасом.
+				expansion += bytes.Count(data, []byte("&"+string(match[1])+";")) * len(match[2])
+				if expansion > svgMaxEntityTotal {
+					return nil, nil, fmt.Errorf("%w: слишком большой объем подстановок сущностей", ErrInvalidSVG)
+				}
+				entities[string(match[1])] = string(match[2])
+			}
+		}
+		if s.out.Len() > svgMaxOutput {
+			return nil, nil, fmt.Errorf("%w: очищенный документ больше %d МБ", ErrInvalidSVG, svgMaxOutput>>20)
+		}
+	}
+	if s.blocked != nil {
+		return nil, nil, s.blocked // Запрещенное изображение нельзя "спрятать" внутри SVG
+	}
+	if root == "" {
+		return nil, nil, fmt.Errorf("%w: документ не содержит элементов", ErrInvalidSVG)
+	}
+	if depth != 0 {
+		return nil, nil, fmt.Errorf("%w: документ обрывается внутри элемента", ErrInvalidSVG)
+	}
+
+	// Удаленные данные в отчете - в стабильном порядке.
+	categories := make([]string, 0, len(s.removed))
+	for category := range s.removed {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		s.report.RemovedBlocks = append(s.report.RemovedBlocks, fmt.Sprintf("SVG: %s (%d)", category, s.removed[category]))
+	}
+	return s.out.Bytes(), s.report, nil
+}
+
+// pushNamespaces добавляет в стек объявления префиксов элемента.
+func (s *svgSanitizer) pushNamespaces(attrs []xml.Attr) {
+	scope := make(map[string]string)
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			scope[""] = attr.Value
+		case attr.Name.Space == "xmlns":
+			scope[attr.Name.Local] = attr.Value
+		}
+	}
+	s.namespace = append(s.namespace, scope)
+}
+
+// resolve возвращает пространство имен для префикса с учетом вложенных объявлений.
+func (s *svgSanitizer) resolve(prefix string) string {
+	for i := len(s.namespace) - 1; i >= 0; i-- {
+		if uri, ok := s.namespace[i][prefix]; ok {
+			return uri
+		}
+	}
+	if prefix == "" {
+		return svgNamespace // SVG без объявления пространства имен (встречается у старых редакторов)
+	}
+	return prefix
+}
+
+// allowedElement проверяет элемент и учитывает удаленные в отчете.
+func (s *svgSanitizer) allowedElement(space, local, prefix string) bool {
+	if space != svgNamespace {
+		if editor, ok := svgEditorNamespaces[space]; ok {
+			s.removed["данные редактора "+editor]++
+		} else {
+			s.removed["элементы других пространств имен ("+prefix+")"]++
+		}
+		if local == "namedview" && space == "http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd" {
+			addReportValue(&s.report.Software, "Inkscape/sodipodi")
+		}
+		return false
+	}
+	if svgElements[local] {
+		return true
+	}
+	if category, ok := svgRemovedElements[local]; ok {
+		s.removed[category]++
+	} else {
+		s.removed["неизвестные элементы"]++
+	}
+	return false
+}
+
+// collectMetadataField отмечает поля Dublin Core с авторством внутри metadata.
+func (s *svgSanitizer) collectMetadataField(space, local string) {
+	if s.metadata == 0 || space != dcNamespace {
+		return
+	}
+	switch local {
+	case "creator", "rights", "publisher", "contributor":
+		s.dcField = local
+	}
+}
+
+// sanitizeAttributes оставляет только разрешенные атрибуты элемента.
+func (s *svgSanitizer) sanitizeAttributes(element string, attrs []xml.Attr) []xml.Attr {
+	clean := make([]xml.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		prefix, local := attr.Name.Space, attr.Name.Local
+		// Объявления пространств имен не переносятся: в результате используются только SVG и XLink.
+		if prefix == "xmlns" || prefix == "" && local == "xmlns" {
+			continue
+		}
+		space := ""
+		if prefix != "" {
+			space = s.resolve(prefix)
+		}
+		switch {
+		case strings.HasPrefix(strings.ToLower(local), "on") && space == "":
+			s.removed["обработчики событий"]++
+			continue
+		case space == xmlNamespace && local == "space":
+			clean = append(clean, xml.Attr{Name: xml.Name{Space: "xml", Local: "space"}, Value: attr.Value})
+			continue
+		case space == xlinkNamespace && local == "href":
+			// xlink:href приводится к href (SVG 2), ниже проверяется как обычная ссылка.
+		case space != "":
+			if editor, ok := svgEditorNamespaces[space]; ok {
+				s.removed["данные редактора "+editor]++
+				if editor == "inkscape" && local == "version" {
+					addReportValue(&s.report.Software, "Inkscape "+attr.Value)
+				}
+			} else {
+				s.removed["атрибуты других пространств имен"]++
+			}
+			continue
+		case !svgAttributes[local]:
+			s.removed["прочие атрибуты"]++ // data-*, атрибуты редакторов без пространства имен и т.п.
+			continue
+		}
+
+		value := attr.Value
+		switch {
+		case local == "href":
+			var ok bool
+			if value, ok = s.sanitizeHref(element, value); !ok {
+				continue
+			}
+			clean = append(clean, xml.Attr{Name: xml.Name{Local: "href"}, Value: value})
+			continue
+		case local == "style":
+			value = s.sanitizeCSS(value)
+		case hasExternalURL(value):
+			s.removed["внешние ссылки"]++
+			continue
+		}
+		clean = append(clean, xml.Attr{Name: xml.Name{Local: local}, Value: value})
+	}
+	return clean
+}
+
+// sanitizeHref проверяет ссылку. Разрешены ссылки внутри документа (#id), а для image -
+// встроенные растровые изображения, которые перекодируются в PNG без метаданных.
+func (s *svgSanitizer) sanitizeHref(element, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "#") && element != "a" {
+		return value, true
+	}
+	if element == "image" && strings.HasPrefix(strings.ToLower(value), "data:image/") {
+		clean, err := reencodeDataImage(value)
+		if err != nil {
+			if errors.Is(err, ErrBlockedContent) {
+				s.blocked = err
+			}
+			s.removed["некорректные встроенные изображения"]++
+			return "", false
+		}
+		if clean != value {
+			s.removed["метаданные встроенных изображений"]++ // Уже очищенное изображение не меняется
+		}
+		return clean, true
+	}
+	s.removed["внешние ссылки"]++
+	return "", false
+}
+
+// reencodeDataImage декодирует встроенное изображение data:image/...;base64 и кодирует
+// его в PNG заново: так из него удаляются все метаданные. Изображение также сверяется
+// со списком блокировки.
+func reencodeDataImage(uri string) (string, error) {
+	header, payload, ok := strings.Cut(uri, ",")
+	if !ok || !strings.HasSuffix(strings.ToLower(header), ";base64") {
+		return "", fmt.Errorf("поддерживаются только встроенные изображения в base64")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return "", err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > svgMaxEmbeddedPixels {
+		return "", fmt.Errorf("%w: встроенное изображение %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	if err := checkBlocklist(img, nil, 1); err != nil {
+		return "", err
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes()), nil
+}
+
+// sanitizeCSS очищает таблицу стилей или значение атрибута style: удаляет @import,
+// комментарии, внешние url() и устаревшие механизмы выполнения кода (-moz-binding, behavior).
+func (s *svgSanitizer) sanitizeCSS(css string) string {
+	if n := len(cssCommentPattern.FindAllStringIndex(css, -1)); n > 0 {
+		s.removed["комментарии"] += n
+		css = cssCommentPattern.ReplaceAllString(css, "")
+	}
+	if n := len(cssImportPattern.FindAllStringIndex(css, -1)); n > 0 {
+		s.removed["внешние ссылки"] += n
+		css = cssImportPattern.ReplaceAllString(css, "")
+	}
+	if n := len(cssDangerousPattern.FindAllStringIndex(css, -1)); n > 0 {
+		s.removed["опасные свойства CSS"] += n
+		css = cssDangerousPattern.ReplaceAllString(css, "")
+	}
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		if isLocalURL(match) {
+			return match
+		}
+		s.removed["внешние ссылки"]++
+		return "none"
+	})
+}
+
+// hasExternalURL сообщает, содержит ли значение атрибута url() на внешний ресурс.
+func hasExternalURL(value string) bool {
+	for _, match := range cssURLPattern.FindAllString(value, -1) {
+		if !isLocalURL(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalURL сообщает, указывает ли url(...) на элемент внутри документа (#id).
+func isLocalURL(match string) bool {
+	parts := cssURLPattern.FindStringSubmatch(match)
+	target := strings.TrimSpace(parts[1] + parts[2] + parts[3])
+	return strings.HasPrefix(target, "#")
+}
+
+// hasAttribute сообщает, есть ли среди атрибутов атрибут с заданным именем.
+func hasAttribute(attrs []xml.Attr, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// writeStart записывает открывающий тег. Корневой элемент получает объявление
+// пространства имен SVG.
+func (s *svgSanitizer) writeStart(local string, attrs []xml.Attr, root bool) {
+	s.out.WriteString("<" + local)
+	if root {
+		s.out.WriteString(` xmlns="` + svgNamespace + `"`)
+	}
+	for _, attr := range attrs {
+		name := attr.Name.Local
+		if attr.Name.Space != "" {
+			name = attr.Name.Space + ":" + name
+		}
+		s.out.WriteString(" " + name + `="`)
+		xml.EscapeText(&s.out, []byte(attr.Value))
+		s.out.WriteString(`"`)
+	}
+	s.out.WriteString(">")
+}
+
+// addReportValue добавляет строку в список отчета (без пустых значений и повторов).
+func addReportValue(list *[]string, value string) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return
+	}
+	if runes := []rune(value); len(runes) > svgMaxReportValue {
+		value = string(runes[:svgMaxReportValue]) + "..."
+	}
+	for _, existing := range *list {
+		if existing == value {
+			return
+		}
+	}
+	*list = append(*list, value)
+}
+
+// isSVG определяет SVG по началу файла: после необязательных BOM, XML-объявления,
+// комментариев и DOCTYPE должен идти элемент svg.
+func isSVG(head []byte) bool {
+	text := bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	for {
+		text = bytes.TrimLeft(text, " \t\r\n")
+		switch {
+		case bytes.HasPrefix(text, []byte("<?")):
+			end := bytes.Index(text, []byte("?>"))
+			if end < 0 {
+				return false
+			}
+			text = text[end+2:]
+		case bytes.HasPrefix(text, []byte("<!--")):
+			end := bytes.Index(text, []byte("-->"))
+			if end < 0 {
+				return false
+			}
+			text = text[end+3:]
+		case bytes.HasPrefix(text, []byte("<!")):
+			end := bytes.IndexByte(text, '>')
+			// DOCTYPE с внутренним подмножеством: <!DOCTYPE svg [ <!ENTITY ...> ]>
+			if open := bytes.IndexByte(text, '['); open >= 0 && open < end {
+				if end = bytes.Index(text, []byte("]>")); end >= 0 {
+					end++
+				}
+			}
+			if end < 0 {
+				return false
+			}
+			text = text[end+1:]
+		default:
+			return bytes.HasPrefix(text, []byte("<svg")) || bytes.HasPrefix(text, []byte("<svg:svg"))
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"errors"  // Для проверки ошибки-маркера
+	"strings" // Для сборки документов и проверки результата
+	"testing" // Для тестов
+	"time"    // Для ограничения времени очистки
+)
+
+// svgTestDocument собирает документ SVG с заданным содержимым корневого элемента.
+func svgTestDocument(body string) string {
+	return `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="10" height="10">` + body + `</svg>`
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		forbidden []string // Не должно остаться в результате
+		kept      []string // Должно остаться в результате
+		removed   string   // Категория в отчете (RemovedBlocks)
+	}{
+		{
+			name:      "script",
+			input:     svgTestDocument(`<script>alert(1)</script><script xlink:href="https://evil.example/x.js"/><rect width="1" height="1"/>`),
+			forbidden: []string{"script", "alert", "evil.example"},
+			kept:      []string{`<rect width="1" height="1">`},
+			removed:   "SVG: script (2)",
+		},
+		{
+			name:      "обработчики событий",
+			input:     svgTestDocument(`<rect width="1" height="1" onclick="alert(1)" onload="alert(2)" ONMOUSEOVER="alert(3)"/>`),
+			forbidden: []string{"onclick", "onload", "ONMOUSEOVER", "alert"},
+			kept:      []string{`<rect width="1" height="1">`},
+		},
+		{
+			name: "внешние ссылки",
+			input: svgTestDocument(`<image width="1" height="1" href="https://evil.example/a.png"/>` +
+				`<use xlink:href="http://evil.example/sprite.svg#icon"/><a href="javascript:alert(1)"><rect width="1" height="1"/></a>` +
+				`<use href="#local"/>`),
+			forbidden: []string{"evil.example", "javascript", "<image"},
+			kept:      []string{`<use href="#local">`},
+		},
+		{
+			name: "CSS url() и @import",
+			input: svgTestDocument(`<style>@import url("https://evil.example/a.css"); @import 'http://evil.example/b.css';` +
+				` rect { fill: url(https://evil.example/c) } circle { fill: url(#grad) }</style>` +
+				`<rect width="1" height="1" style="fill: url('//evil.example/d'); stroke: red"/>`),
+			forbidden: []string{"@import", "evil.example"},
+			kept:      []string{"url(#grad)", "stroke: red"},
+		},
+		{
+			name: "foreignObject",
+			input: svgTestDocument(`<foreignObject width="10" height="10"><div xmlns="http://www.w3.org/1999/xhtml">` +
+				`<iframe src="https://evil.example/"></iframe>секрет</div></foreignObject>`),
+			forbidden: []string{"foreignObject", "iframe", "evil.example", "секрет"},
+			removed:   "SVG: foreignObject (1)",
+		},
+		{
+			name: "пространства имен редакторов",
+			input: `<svg xmlns="http://www.w3.org/2000/svg" xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd"` +
+				` xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" sodipodi:docname="C:\Users\ivanov\plan.svg"` +
+				` inkscape:version="1.3" width="10" height="10"><sodipodi:namedview inkscape:document-units="mm"/>` +
+				`<g inkscape:label="Слой 1" inkscape:groupmode="layer"><rect width="1" height="1" data-author="ivanov"/></g></svg>`,
+			forbidden: []string{"sodipodi", "inkscape", "ivanov", "Слой", "data-author"},
+			kept:      []string{"<g>", `<rect width="1" height="1">`},
+		},
+		{
+			name: "комментарии и metadata",
+			input: `<?xml version="1.0"?><!-- Generator: Adobe Illustrator 27.0.0, SVG Export Plug-In -->` +
+				svgTestDocument(`<!-- Автор: Иванов --><metadata><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"`+
+					` xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:creator>Иванов</dc:creator></rdf:RDF></metadata>`+
+					`<title>Секретный план</title><rect width="1" height="1"/>`),
+			forbidden: []string{"<!--", "Illustrator", "Иванов", "metadata", "Секретный"},
+			kept:      []string{`<rect width="1" height="1">`},
+			removed:   "SVG: комментарии (2)",
+		},
+		{
+			name: "сущности Illustrator",
+			input: `<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd" [` +
+				`<!ENTITY ns_svg "http://www.w3.org/2000/svg"><!ENTITY ns_ai "http://ns.adobe.com/AdobeIllustrator/10.0/">]>` +
+				`<svg xmlns="&ns_svg;" xmlns:i="&ns_ai;" width="10" height="10" i:viewOrigin="0 0"><rect width="1" height="1"/></svg>`,
+			forbidden: []string{"DOCTYPE", "ENTITY", "viewOrigin", "adobe"},
+			kept:      []string{`<rect width="1" height="1">`},
+			removed:   "SVG: DOCTYPE (1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clean, report, err := sanitizeSVG([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("sanitizeSVG: %v", err)
+			}
+			out := string(clean)
+			for _, s := range tt.forbidden {
+				if strings.Contains(out, s) {
+					t.Errorf("в результате осталось %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.kept {
+				if !strings.Contains(out, s) {
+					t.Errorf("в результате нет %q:\n%s", s, out)
+				}
+			}
+			if tt.removed != "" && !containsString(report.RemovedBlocks, tt.removed) {
+				t.Errorf("в отчете нет %q: %q", tt.removed, report.RemovedBlocks)
+			}
+
+			// Очищенный документ проходит проверку: повторная очистка ничего не находит
+			// и не меняет его.
+			findings, err := verifySVG(clean)
+			if err != nil || len(findings) > 0 {
+				t.Errorf("verifySVG: %v %q", err, findings)
+			}
+		})
+	}
+}
+
+func TestSanitizeSVGReport(t *testing.T) {
+	input := `<!-- Generator: Adobe Illustrator 27.0.0 -->` + svgTestDocument(`<metadata>`+
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/">`+
+		`<dc:creator><rdf:Bag><rdf:li>Иванов</rdf:li></rdf:Bag></dc:creator></rdf:RDF></metadata><!-- черновик -->`)
+	_, report, err := sanitizeSVG([]byte(input))
+	if err != nil {
+		t.Fatalf("sanitizeSVG: %v", err)
+	}
+	if !containsString(report.Software, "Adobe Illustrator 27.0.0") {
+		t.Errorf("Software = %q", report.Software)
+	}
+	if !containsString(report.Authors, "Иванов") {
+		t.Errorf("Authors = %q", report.Authors)
+	}
+	if !containsString(report.Comments, "черновик") {
+		t.Errorf("Comments = %q", report.Comments)
+	}
+}
+
+func TestSanitizeSVGRejects(t *testing.T) {
+	// Квадратичное раздувание: одна длинная сущность и много ссылок на нее.
+	entityBomb := func(valueLen, refs int) string {
+		return `<!DOCTYPE svg [<!ENTITY a "` + strings.Repeat("x", valueLen) + `">]>` +
+			svgTestDocument(`<text>`+strings.Repeat("&a;", refs)+`</text>`)
+	}
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"длинная сущность", entityBomb(200<<10, 5000)},
+		{"много подстановок короткой сущности", entityBomb(svgMaxEntityValue, 5000)},
+		{"неизвестная сущность", svgTestDocument(`<text>&unknown;</text>`)},
+		{"корневой элемент не svg", `<html xmlns="http://www.w3.org/1999/xhtml"></html>`},
+		{"обрыв документа", `<svg xmlns="http://www.w3.org/2000/svg"><g>`},
+		{"слишком глубокая вложенность", svgTestDocument(strings.Repeat("<g>", svgMaxDepth) + strings.Repeat("</g>", svgMaxDepth))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, _, err := sanitizeSVG([]byte(tt.input))
+			if !errors.Is(err, ErrInvalidSVG) {
+				t.Fatalf("ожидалась ErrInvalidSVG, получено %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("отказ занял %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestRasterizeSVG(t *testing.T) {
+	clean, _, err := sanitizeSVG([]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="100" height="50" viewBox="0 0 10 5">` +
+		`<style>.red { fill: #ff0000 }</style><rect class="red" width="5" height="5"/><rect x="5" width="5" height="5" fill="blue"/></svg>`))
+	if err != nil {
+		t.Fatalf("sanitizeSVG: %v", err)
+	}
+	img, err := rasterizeSVG(clean, 0)
+	if err != nil {
+		t.Fatalf("rasterizeSVG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 100 || size.Y != 50 {
+		t.Fatalf("размер %v, ожидался 100x50", size)
+	}
+	if c := img.RGBAAt(25, 25); c.R != 255 || c.B != 0 || c.A != 255 {
+		t.Errorf("левая половина: %v, ожидался красный", c)
+	}
+	if c := img.RGBAAt(75, 25); c.B != 255 || c.R != 0 || c.A != 255 {
+		t.Errorf("правая половина: %v, ожидался синий", c)
+	}
+
+	// Размер ограничивается длинной стороной.
+	img, err = rasterizeSVG(clean, 20)
+	if err != nil {
+		t.Fatalf("rasterizeSVG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 20 || size.Y != 10 {
+		t.Errorf("размер %v, ожидался 20x10", size)
+	}
+}
+
+// containsString сообщает, содержит ли список строку (или строку, в которую она входит).
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if strings.Contains(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,886 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"archive/zip"     // Для проверки записей архива документов Office
+	"bytes"           // Для проверки сигнатур
+	"encoding/base64" // Для встроенных изображений SVG
+	"encoding/binary" // Для чтения длин сегментов JPEG
+	"encoding/xml"    // Для разбора XMP
+	"errors"          // Для определения ошибки утечки
+	"fmt"             // Для форматирования ошибок и описаний находок
+	"io"              // Для признака конца XMP-пакета
+	"log"             // Для логирования каждого вердикта
+	"math"            // Для сравнения координат GPS
+	"os"              // Для чтения сохраненного файла
+	"path/filepath"   // Для имени файла в логе
+	"sort"            // Для порядка находок в PDF
+	"strings"         // Для объединения находок
+)
+
+// Независимая проверка очищенного файла.
+//
+// Очистка не считается успешной только потому, что кодер отработал без ошибок:
+// после записи файл заново читается с диска и проверяется отдельным разбором.
+// Проверка не использует результаты очистки и допускает только то, что сервис
+// мог записать сам: структурные блоки формата и метаданные, явно разрешенные
+// настройками (ориентация, огрубленные координаты, список разрешенных полей).
+// Все остальное (EXIF, XMP, IPTC, ICC, текстовые чанки, комментарии и расширения
+// GIF, данные после конца изображения) считается утечкой.
+
+// ErrMetadataLeak возвращается, если в сохраненном файле найдены метаданные.
+var ErrMetadataLeak = errors.New("в очищенном файле обнаружены метаданные")
+
+// verifyPolicy - что допускается в очищенном файле при заданных настройках.
+type verifyPolicy struct {
+	ifd0Tags     map[uint16]bool   // Допустимые теги IFD0
+	exifTags     map[uint16]bool   // Допустимые теги Exif SubIFD
+	gpsTags      map[uint16]bool   // Допустимые теги GPS IFD
+	gpsPrecision GPSPrecision      // Точность, до которой должны быть огрублены координаты
+	asciiTags    map[uint16]bool   // Теги, которые обязаны иметь тип ASCII
+	xmpNames     map[xml.Name]bool // Допустимые свойства XMP
+	iptcDatasets map[byte]bool     // Допустимые наборы данных IPTC (запись 2)
+}
+
+// newVerifyPolicy строит политику проверки по параметрам обработки.
+func newVerifyPolicy(opts ProcessOptions) verifyPolicy {
+	policy := verifyPolicy{
+		// Ориентация может сохраняться при lossless-очистке JPEG.
+		ifd0Tags:     map[uint16]bool{exifTagOrientation: true},
+		exifTags:     map[uint16]bool{},
+		gpsTags:      map[uint16]bool{},
+		asciiTags:    map[uint16]bool{},
+		xmpNames:     map[xml.Name]bool{},
+		iptcDatasets: map[byte]bool{},
+	}
+	if opts.GPSPrecision.Keeps() {
+		policy.gpsPrecision = opts.GPSPrecision
+		for _, tag := range []uint16{exifTagGPSVersionID, exifTagGPSLatitudeRef, exifTagGPSLatitude, exifTagGPSLongitudeRef, exifTagGPSLongitude} {
+			policy.gpsTags[tag] = true
+		}
+	}
+	for name, ok := range opts.MetadataAllowlist {
+		field, known := metadataFields[name]
+		if !ok || !known {
+			continue
+		}
+		switch field.kind {
+		case fieldEXIF:
+			if field.exifSubIFD {
+				policy.exifTags[field.exifTag] = true
+			} else {
+				policy.ifd0Tags[field.exifTag] = true
+			}
+			policy.asciiTags[field.exifTag] = true
+		case fieldXMP:
+			policy.xmpNames[xml.Name{Space: field.xmpNamespace, Local: field.xmpName}] = true
+		case fieldIPTC:
+			policy.iptcDatasets[field.iptcDataset] = true
+		}
+	}
+	if len(policy.iptcDatasets) > 0 {
+		policy.iptcDatasets[0] = true // Версия записи 2
+	}
+	return policy
+}
+
+// VerifyCleanFile заново читает сохраненный файл и проверяет, что в нем нет метаданных,
+// кроме разрешенных параметрами opts. Результат проверки всегда записывается в лог.
+// Возвращает ошибку, оборачивающую ErrMetadataLeak, если найдены метаданные,
+// или ошибку чтения/разбора файла; в обоих случаях файл нельзя публиковать.
+func VerifyCleanFile(path string, opts ProcessOptions) error {
+	name := filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("ПРОВЕРКА ОЧИСТКИ: файл '%s': ошибка чтения: %v", name, err)
+		return fmt.Errorf("не удалось прочитать файл для проверки: %w", err)
+	}
+
+	policy := newVerifyPolicy(opts)
+	var format string
+	var findings []string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, jpegMarkerSOI, 0xFF}):
+		format = "jpeg"
+		findings, err = verifyJPEG(data, policy)
+	case bytes.HasPrefix(data, pngSignature):
+		format = "png"
+		findings, err = verifyPNG(data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		format = "gif"
+		findings, err = verifyGIF(data)
+	case isSVG(data):
+		format = "svg"
+		findings, err = verifySVG(data)
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		format = "pdf"
+		findings, err = verifyPDF(data, policy)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		format = "ooxml"
+		findings, err = verifyOOXML(data, policy, 0)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		format = "flac"
+		findings, err = verifyAudio(data, "audio/flac")
+	case bytes.HasPrefix(data, []byte("OggS")):
+		format = "ogg"
+		findings, err = verifyAudio(data, "audio/ogg")
+	case bytes.HasPrefix(data, []byte("ID3")) || mpegFrameSize(data) > 0:
+		format = "mp3"
+		findings, err = verifyAudio(data, "audio/mpeg")
+	default:
+		err = fmt.Errorf("неизвестный формат сохраненного файла")
+	}
+	if err != nil {
+		log.Printf("ПРОВЕРКА ОЧИСТКИ: файл '%s' (%s): НЕ ПРОЙДЕНА, файл не разобран: %v", name, format, err)
+		return fmt.Errorf("не удалось проверить очищенный файл: %w", err)
+	}
+	if len(findings) > 0 {
+		log.Printf("ПРОВЕРКА ОЧИСТКИ: файл '%s' (%s): НЕ ПРОЙДЕНА: %s", name, format, strings.Join(findings, "; "))
+		return fmt.Errorf("%w: %s", ErrMetadataLeak, strings.Join(findings, "; "))
+	}
+	log.Printf("ПРОВЕРКА ОЧИСТКИ: файл '%s' (%s): пройдена, метаданных не найдено", name, format)
+	return nil
+}
+
+// verifyJPEG проходит по всем сегментам JPEG, включая сегменты между сканами
+// прогрессивного файла, и данные после EOI.
+func verifyJPEG(data []byte, policy verifyPolicy) ([]string, error) {
+	var findings []string
+	pos := 2
+	for {
+		if pos >= len(data) {
+			return append(findings, "отсутствует маркер конца изображения (EOI)"), nil
+		}
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("ожидался маркер JPEG по смещению %d", pos)
+		}
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			continue
+		}
+		marker := data[pos]
+		pos++
+
+		switch {
+		case marker == jpegMarkerEOI:
+			if pos < len(data) {
+				findings = append(findings, fmt.Sprintf("данные после конца изображения (%d байт)", len(data)-pos))
+			}
+			return findings, nil
+		case (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01:
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("обрезанный сегмент 0xFF%02X", marker)
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, fmt.Errorf("некорректная длина сегмента 0xFF%02X: %d", marker, length)
+		}
+		p := data[pos+2 : pos+length]
+		pos += length
+
+		switch {
+		case marker == jpegMarkerAPP0:
+			if !bytes.HasPrefix(p, []byte("JFIF\x00")) || len(p) != jfifMinimalLength || p[12] != 0 || p[13] != 0 {
+				findings = append(findings, "APP0 с дополнительными данными (миниатюра или JFXX)")
+			}
+		case marker == jpegMarkerAPP1 && bytes.HasPrefix(p, exifSignature):
+			findings = append(findings, verifyEXIF(p[len(exifSignature):], policy)...)
+		case marker == jpegMarkerAPP1 && bytes.HasPrefix(p, xmpSignature):
+			findings = append(findings, verifyXMP(p[len(xmpSignature):], policy)...)
+		case marker == jpegMarkerAPP13 && bytes.HasPrefix(p, photoshopSignature):
+			findings = append(findings, verifyIPTC(p[len(photoshopSignature):], policy)...)
+		case marker == jpegMarkerAPP2 && bytes.HasPrefix(p, []byte("ICC_PROFILE\x00")):
+			findings = append(findings, "ICC-профиль")
+		case marker == jpegMarkerAPP14:
+			if !bytes.HasPrefix(p, []byte("Adobe")) || len(p) != 12 {
+				findings = append(findings, "APP14 с дополнительными данными")
+			}
+		case marker >= jpegMarkerAPP0 && marker <= jpegMarkerAPP15:
+			findings = append(findings, fmt.Sprintf("блок APP%d", marker-jpegMarkerAPP0))
+		case marker == jpegMarkerCOM:
+			findings = append(findings, "комментарий (COM)")
+		case marker >= 0xF0 && marker <= 0xFD:
+			findings = append(findings, fmt.Sprintf("зарезервированный маркер 0xFF%02X", marker))
+		}
+
+		if marker == jpegMarkerSOS {
+			pos = findJPEGScanEnd(data, pos)
+		}
+	}
+}
+
+// verifyEXIF проверяет, что EXIF содержит только теги, допустимые политикой,
+// и не содержит миниатюры.
+func verifyEXIF(tiff []byte, policy verifyPolicy) []string {
+	ex, err := parseEXIF(tiff)
+	if err != nil {
+		return []string{fmt.Sprintf("EXIF, который не удалось разобрать (%v)", err)}
+	}
+	var findings []string
+	check := func(dir string, entries []exifEntry, allowed map[uint16]bool) {
+		for _, e := range entries {
+			switch {
+			case !allowed[e.Tag]:
+				findings = append(findings, fmt.Sprintf("EXIF %s: тег 0x%04X", dir, e.Tag))
+			case policy.asciiTags[e.Tag] && e.Type != exifTypeASCII:
+				findings = append(findings, fmt.Sprintf("EXIF %s: тег 0x%04X не текстового типа", dir, e.Tag))
+			}
+		}
+	}
+	// Указатели на вложенные каталоги допустимы, если сами каталоги проходят проверку.
+	ifd0Allowed := map[uint16]bool{exifTagExifIFD: true, exifTagGPSIFD: true}
+	for tag := range policy.ifd0Tags {
+		ifd0Allowed[tag] = true
+	}
+	check("IFD0", ex.IFD0, ifd0Allowed)
+	check("Exif", ex.Exif, policy.exifTags)
+	check("GPS", ex.GPS, policy.gpsTags)
+	// Разрешены только огрубленные координаты: центр ячейки сетки заданной точности
+	// при повторном огрублении не меняется (с точностью до округления при записи).
+	if lat, lon, ok := ex.GPSCoordinates(); ok && policy.gpsPrecision.Keeps() {
+		cellLat, cellLon := coarsenGPS(lat, lon, policy.gpsPrecision)
+		if math.Abs(cellLat-lat) > 1e-5 || math.Abs(cellLon-lon) > 1e-5 {
+			findings = append(findings, fmt.Sprintf("EXIF GPS: координаты точнее допустимого (%s)", policy.gpsPrecision.Description()))
+		}
+	}
+	if len(ex.IFD1) > 0 || len(ex.Thumbnail) > 0 {
+		findings = append(findings, "миниатюра EXIF")
+	}
+	return findings
+}
+
+// xmpStructuralNamespaces - пространства имен служебных элементов XMP-пакета.
+var xmpStructuralNamespaces = map[string]bool{
+	rdfNamespace:     true,
+	"adobe:ns:meta/": true,
+}
+
+// verifyXMP проверяет, что XMP-пакет содержит только свойства, допустимые политикой.
+func verifyXMP(packet []byte, policy verifyPolicy) []string {
+	if len(policy.xmpNames) == 0 {
+		return []string{"XMP"}
+	}
+	var findings []string
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	depth := 0 // Глубина внутри допустимого свойства (его содержимое не проверяется)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				findings = append(findings, fmt.Sprintf("XMP, который не удалось разобрать (%v)", err))
+			}
+			return findings
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth > 0 {
+				depth++
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue // Объявления пространств имен
+				}
+				if attr.Name.Space == rdfNamespace && attr.Name.Local == "about" {
+					continue
+				}
+				if !policy.xmpNames[attr.Name] {
+					findings = append(findings, fmt.Sprintf("свойство XMP %s", attr.Name.Local))
+				}
+			}
+			switch {
+			case policy.xmpNames[t.Name]:
+				depth = 1
+			case !xmpStructuralNamespaces[t.Name.Space]:
+				findings = append(findings, fmt.Sprintf("свойство XMP %s", t.Name.Local))
+			}
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+}
+
+// verifyIPTC проверяет ресурсы Photoshop: допускается только блок IPTC
+// с наборами данных, разрешенными политикой.
+func verifyIPTC(data []byte, policy verifyPolicy) []string {
+	if len(policy.iptcDatasets) == 0 {
+		return []string{"IPTC/Photoshop"}
+	}
+	var findings []string
+	forEachPhotoshopResource(data, func(id uint16, body []byte) {
+		if id != photoshopResourceIPTC {
+			findings = append(findings, fmt.Sprintf("ресурс Photoshop 0x%04X", id))
+			return
+		}
+		complete := forEachIPTCDataset(body, func(record, dataset byte, value []byte) {
+			if record != 2 || !policy.iptcDatasets[dataset] {
+				findings = append(findings, fmt.Sprintf("IPTC %d:%d", record, dataset))
+			}
+		})
+		if !complete {
+			findings = append(findings, "IPTC, который не удалось разобрать")
+		}
+	})
+	return findings
+}
+
+// verifyPNG проверяет, что PNG содержит только чанки, необходимые для отображения,
+// и не содержит данных после IEND.
+func verifyPNG(data []byte) ([]string, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	var findings []string
+	end := len(pngSignature)
+	for _, chunk := range chunks {
+		end += 12 + len(chunk.Data)
+		if !pngAllowedChunks[chunk.Type] {
+			findings = append(findings, fmt.Sprintf("чанк %s", chunk.Type))
+		}
+	}
+	if end < len(data) {
+		findings = append(findings, fmt.Sprintf("данные после конца изображения (%d байт)", len(data)-end))
+	}
+	return findings, nil
+}
+
+// verifySVG разбирает SVG заново (без очистки) и проверяет каждый элемент и атрибут:
+// допускаются только элементы и атрибуты SVG, которые записывает очистка, ссылки внутри
+// документа (#id) и встроенные PNG без метаданных. DOCTYPE, комментарии, инструкции
+// обработки, данные редакторов, обработчики событий и внешние ссылки (в том числе в CSS)
+// считаются утечкой.
+func verifySVG(data []byte) ([]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+	counts := make(map[string]int)
+	var findings []string
+	root, inStyle := false, false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if !root {
+				root = true
+				if t.Name.Space != svgNamespace || t.Name.Local != "svg" {
+					return nil, fmt.Errorf("корневой элемент <%s> не является svg", t.Name.Local)
+				}
+			}
+			switch {
+			case t.Name.Space != svgNamespace:
+				counts["элементы других пространств имен"]++
+			case !svgElements[t.Name.Local]:
+				counts["элемент <"+t.Name.Local+">"]++
+			}
+			for _, attr := range t.Attr {
+				for _, finding := range verifySVGAttribute(t.Name.Local, attr) {
+					counts[finding]++
+				}
+			}
+			inStyle = t.Name.Local == "style"
+		case xml.EndElement:
+			inStyle = false
+		case xml.CharData:
+			if inStyle {
+				for _, finding := range verifyCSS(string(t)) {
+					counts[finding]++
+				}
+			}
+		case xml.Comment:
+			counts["комментарии"]++
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				counts["инструкции обработки"]++
+			}
+		case xml.Directive:
+			counts["DOCTYPE"]++
+		}
+	}
+	if !root {
+		return nil, fmt.Errorf("документ не содержит элементов")
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		findings = append(findings, fmt.Sprintf("SVG: %s (%d)", name, counts[name]))
+	}
+	return findings, nil
+}
+
+// verifySVGAttribute проверяет атрибут элемента SVG.
+func verifySVGAttribute(element string, attr xml.Attr) []string {
+	space, local := attr.Name.Space, attr.Name.Local
+	switch {
+	case space == "" && local == "xmlns":
+		if attr.Value != svgNamespace {
+			return []string{"объявления других пространств имен"}
+		}
+		return nil
+	case space == "xmlns":
+		if local != "xlink" || attr.Value != xlinkNamespace {
+			return []string{"объявления других пространств имен"}
+		}
+		return nil
+	case space == xmlNamespace && local == "space":
+		return nil
+	case (space == xlinkNamespace || space == "xlink") && local == "href":
+	case space != "":
+		return []string{"атрибуты других пространств имен"}
+	case strings.HasPrefix(strings.ToLower(local), "on"):
+		return []string{"обработчики событий"}
+	case !svgAttributes[local]:
+		return []string{"атрибут " + local}
+	}
+
+	value := strings.TrimSpace(attr.Value)
+	switch {
+	case local == "href" && strings.HasPrefix(value, "#"):
+		return nil
+	case local == "href" && element == "image" && strings.HasPrefix(value, "data:"):
+		return verifySVGDataImage(value)
+	case local == "href":
+		return []string{"внешние ссылки"}
+	}
+	return verifyCSS(value) // style и атрибуты оформления могут содержать url()
+}
+
+// verifySVGDataImage проверяет встроенное изображение: очистка перекодирует их в PNG.
+func verifySVGDataImage(uri string) []string {
+	const prefix = "data:image/png;base64,"
+	if !strings.HasPrefix(uri, prefix) {
+		return []string{"встроенные изображения не в PNG"}
+	}
+	raw, err := base64.StdEncoding.DecodeString(uri[len(prefix):])
+	if err != nil || !bytes.HasPrefix(raw, pngSignature) {
+		return []string{"встроенные изображения, которые не удалось разобрать"}
+	}
+	pngFindings, err := verifyPNG(raw)
+	if err != nil {
+		return []string{"встроенные изображения, которые не удалось разобрать"}
+	}
+	for i, finding := range pngFindings {
+		pngFindings[i] = "встроенный PNG: " + finding
+	}
+	return pngFindings
+}
+
+// verifyCSS проверяет таблицу стилей или значение атрибута: импорт, внешние url(),
+// комментарии и устаревшие механизмы выполнения кода.
+func verifyCSS(css string) []string {
+	lower := strings.ToLower(css)
+	var findings []string
+	if strings.Contains(lower, "@import") {
+		findings = append(findings, "@import в CSS")
+	}
+	if strings.Contains(lower, "/*") {
+		findings = append(findings, "комментарии CSS")
+	}
+	for _, name := range []string{"-moz-binding", "behavior", "expression("} {
+		if strings.Contains(lower, name) {
+			findings = append(findings, "опасные свойства CSS")
+			break
+		}
+	}
+	// Каждый url( должен указывать на элемент документа: url(#id), url('#id'), url("#id").
+	for rest := lower; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len("url("):]
+		target := strings.TrimLeft(rest, " \t\r\n\"'")
+		if !strings.HasPrefix(target, "#") {
+			findings = append(findings, "внешние ссылки в CSS")
+			break
+		}
+	}
+	return findings
+}
+
+// verifyAudio разбирает аудиофайл заново (без очистки) и ищет теги: ID3v2, ID3v1, APE
+// и Lyrics3 в MP3 и FLAC, блоки метаданных FLAC, кроме STREAMINFO и SEEKTABLE,
+// и непустые пакеты комментариев потоков Ogg.
+func verifyAudio(data []byte, contentType string) ([]string, error) {
+	findings := verifyAudioTrailer(data)
+	var streamFindings []string
+	var err error
+	switch contentType {
+	case "audio/mpeg":
+		streamFindings, err = verifyMP3(data)
+	case "audio/flac":
+		streamFindings, err = verifyFLAC(data)
+	case "audio/ogg":
+		streamFindings, err = verifyOgg(data)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, streamFindings...), nil
+}
+
+// verifyAudioTrailer ищет теги, которые записываются в конец файла.
+func verifyAudioTrailer(data []byte) []string {
+	var findings []string
+	n := len(data)
+	if n >= 128 && bytes.HasPrefix(data[n-128:], []byte("TAG")) {
+		findings = append(findings, "ID3v1")
+	}
+	if bytes.Contains(data[max(0, n-256):], []byte("APETAGEX")) {
+		findings = append(findings, "APE")
+	}
+	if bytes.Contains(data[max(0, n-256):], []byte("LYRICS200")) || bytes.Contains(data[max(0, n-256):], []byte("LYRICSEND")) {
+		findings = append(findings, "Lyrics3")
+	}
+	if n >= 10 && string(data[n-10:n-7]) == "3DI" {
+		findings = append(findings, "ID3v2 в конце файла")
+	}
+	return findings
+}
+
+// verifyMP3 проходит файл по кадрам MPEG: файл должен состоять только из кадров
+// (последний может быть обрезан).
+func verifyMP3(data []byte) ([]string, error) {
+	var findings []string
+	frames := 0
+	for pos := 0; pos < len(data); {
+		rest := data[pos:]
+		if size := mpegFrameSize(rest); size > 0 {
+			pos += min(size, len(rest))
+			frames++
+			continue
+		}
+		if size, ok := id3v2Size(rest); ok {
+			findings = append(findings, "ID3v2")
+			pos += min(size, len(rest))
+			continue
+		}
+		findings = append(findings, fmt.Sprintf("данные вне аудиокадров (%d байт)", len(rest)))
+		break
+	}
+	if frames == 0 {
+		return nil, fmt.Errorf("не найдены аудиокадры MPEG")
+	}
+	return findings, nil
+}
+
+// verifyFLAC проверяет блоки метаданных FLAC: допускаются только STREAMINFO и SEEKTABLE,
+// сразу за ними должны начинаться аудиокадры.
+func verifyFLAC(data []byte) ([]string, error) {
+	var findings []string
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return nil, fmt.Errorf("отсутствует сигнатура fLaC")
+	}
+	pos := 4
+	for last := false; !last; {
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("обрезанный блок метаданных FLAC")
+		}
+		last = data[pos]&0x80 != 0
+		typ := data[pos] & 0x7F
+		pos += 4 + (int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3]))
+		if typ != 0 && typ != 3 {
+			findings = append(findings, fmt.Sprintf("блок метаданных FLAC %d", typ))
+		}
+	}
+	if pos+2 > len(data) || data[pos] != 0xFF || data[pos+1]&0xFE != 0xF8 {
+		return nil, fmt.Errorf("не найдены аудиокадры FLAC")
+	}
+	return findings, nil
+}
+
+// verifyOgg собирает заголовки каждого логического потока Ogg и проверяет, что пакет
+// комментариев пуст (без строки производителя и полей).
+func verifyOgg(data []byte) ([]string, error) {
+	type stream struct {
+		comment []byte // Ожидаемый пустой пакет комментариев
+		packets int    // Собрано пакетов заголовков
+		partial []byte // Незавершенный пакет
+	}
+	streams := make(map[uint32]*stream)
+	var findings []string
+	for pos := 0; pos < len(data); {
+		if !bytes.HasPrefix(data[pos:], []byte("OggS")) {
+			findings = append(findings, fmt.Sprintf("данные вне страниц Ogg (%d байт)", len(data)-pos))
+			break
+		}
+		page, err := readOggPage(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += page.size
+		s := streams[page.serial]
+		if page.flags&oggBOS != 0 {
+			s = &stream{}
+			switch {
+			case bytes.HasPrefix(page.body, []byte("\x01vorbis")):
+				s.comment = []byte("\x03vorbis\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+			case bytes.HasPrefix(page.body, []byte("OpusHead")):
+				s.comment = []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00")
+			default:
+				findings = append(findings, "поток Ogg неизвестного кодека")
+			}
+			streams[page.serial] = s
+		}
+		if s == nil {
+			return nil, fmt.Errorf("страница Ogg без начала потока")
+		}
+		body := page.body
+		for _, n := range page.lacing {
+			if s.packets >= 2 {
+				break // Комментарии - второй пакет; дальше заголовки кодека и звук
+			}
+			s.partial = append(s.partial, body[:n]...)
+			body = body[n:]
+			if n == 255 {
+				continue
+			}
+			s.packets++
+			if s.packets == 2 && s.comment != nil && !bytes.Equal(s.partial, s.comment) {
+				findings = append(findings, "комментарии потока Ogg")
+			}
+			s.partial = nil
+		}
+	}
+	for _, s := range streams {
+		if s.packets < 2 {
+			return nil, fmt.Errorf("обрезанные заголовки потока Ogg")
+		}
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("не найдены страницы Ogg")
+	}
+	return findings, nil
+}
+
+// verifyPDF заново разбирает документ и проверяет все его объекты (а не только
+// достижимые из каталога): в файле не должно быть Info, ID, XMP, скриптов, вложенных
+// файлов, предыдущих версий объектов и метаданных во встроенных JPEG.
+func verifyPDF(data []byte, policy verifyPolicy) ([]string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	var findings []string
+	if _, ok := doc.trailer["Info"]; ok {
+		findings = append(findings, "словарь Info PDF")
+	}
+	if _, ok := doc.trailer["ID"]; ok {
+		findings = append(findings, "идентификатор документа PDF")
+	}
+	if doc.sections > 1 || bytes.Count(data, []byte("%%EOF")) > 1 {
+		findings = append(findings, "история изменений PDF")
+	}
+	counts := make(map[string]int)
+	// inspect проверяет словарь и вложенные в него прямые объекты (например, действие,
+	// записанное прямо в словаре аннотации, а не отдельным объектом).
+	var inspect func(obj any)
+	inspect = func(obj any) {
+		var dict pdfDict
+		switch v := obj.(type) {
+		case pdfArray:
+			for _, item := range v {
+				inspect(item)
+			}
+			return
+		case pdfDict:
+			dict = v
+		case *pdfStream:
+			dict = v.dict
+		default:
+			return
+		}
+		typ, _ := dict["Type"].(pdfName)
+		action, _ := dict["S"].(pdfName)
+		subtype, _ := dict["Subtype"].(pdfName)
+		for key, block := range pdfRemovedKeys {
+			if _, ok := dict[key]; ok {
+				counts[block+" PDF"]++
+			}
+		}
+		switch {
+		case typ == "Metadata":
+			counts["XMP PDF"]++
+		case typ == "EmbeddedFile" || subtype == "FileAttachment" || dict["EF"] != nil:
+			counts["вложенные файлы PDF"]++
+		case pdfRemovedActions[action] != "":
+			counts[pdfRemovedActions[action]+" PDF"]++
+		}
+		for _, value := range dict {
+			inspect(value)
+		}
+	}
+	for num := range doc.xref {
+		obj := doc.object(num)
+		inspect(obj)
+		stream, ok := obj.(*pdfStream)
+		if !ok {
+			continue
+		}
+		filters, params := doc.streamFilters(stream)
+		if n := len(filters); n > 0 && (filters[n-1] == "DCTDecode" || filters[n-1] == "DCT") {
+			jpegData, err := doc.applyFilters(stream.data, filters[:n-1], params[:n-1])
+			if err != nil {
+				return nil, err
+			}
+			jpegFindings, err := verifyEmbeddedImage(jpegData, policy)
+			if err != nil {
+				return nil, err
+			}
+			for _, finding := range jpegFindings {
+				counts[finding]++
+			}
+		}
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		findings = append(findings, fmt.Sprintf("%s (%d)", name, counts[name]))
+	}
+	return findings, nil
+}
+
+// verifyOOXML проверяет документ Office: пустые свойства документа, отсутствие
+// пользовательских свойств и миниатюры, обезличенные авторы и даты (повторная обработка
+// правилами ooxmlPartRules ничего не меняет), очищенные встроенные изображения и
+// документы, сброшенные даты и дополнительные поля записей архива.
+func verifyOOXML(data []byte, policy verifyPolicy, depth int) ([]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	parts, err := readOOXMLParts(data)
+	if err != nil {
+		return nil, err
+	}
+	var findings []string
+	if archive.Comment != "" {
+		findings = append(findings, "комментарий архива")
+	}
+	for _, file := range archive.File {
+		if file.ModifiedDate != ooxmlZipDate || file.ModifiedTime != 0 || len(file.Extra) > 0 {
+			findings = append(findings, "даты или дополнительные поля записей архива")
+			break
+		}
+	}
+	// Правила применяются заново, с чистым состоянием: уже обезличенные значения не меняются.
+	rewriter := &ooxmlCleaner{report: &MetadataReport{}, names: map[string]string{}, initials: map[string]string{}, removed: map[string]int{}}
+	for _, part := range parts {
+		name := part.name
+		switch {
+		case name == "docProps/core.xml" || name == "docProps/app.xml":
+			if string(part.data) != ooxmlMinimalParts[name] {
+				findings = append(findings, "свойства документа ("+name+")")
+			}
+		case name == "docProps/custom.xml":
+			findings = append(findings, "пользовательские свойства документа")
+		case strings.HasPrefix(name, "docProps/thumbnail."):
+			findings = append(findings, "миниатюра документа")
+		case strings.Contains(name, "/media/"):
+			imageFindings, err := verifyEmbeddedImage(part.data, policy)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			for _, finding := range imageFindings {
+				findings = append(findings, name+": "+finding)
+			}
+		case strings.Contains(name, "/embeddings/") && ooxmlNestedDocument(name):
+			if depth >= ooxmlMaxNestedDepth {
+				return nil, fmt.Errorf("слишком глубокая вложенность документов")
+			}
+			nestedFindings, err := verifyOOXML(part.data, policy, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			for _, finding := range nestedFindings {
+				findings = append(findings, name+": "+finding)
+			}
+		default:
+			for _, rule := range ooxmlPartRules {
+				if rule.parts.MatchString(name) && !bytes.Equal(rewriter.rewrite(part.data, rule), part.data) {
+					findings = append(findings, "авторы, даты или учетные записи в "+name)
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// verifyEmbeddedImage проверяет изображение, встроенное в документ. Форматы без
+// блоков метаданных (BMP; TIFF перекодируется сервисом) и не-изображения не проверяются.
+func verifyEmbeddedImage(data []byte, policy verifyPolicy) ([]string, error) {
+	var findings []string
+	var err error
+	var format string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, jpegMarkerSOI, 0xFF}):
+		format = "JPEG"
+		findings, err = verifyJPEG(data, policy)
+	case bytes.HasPrefix(data, pngSignature):
+		format = "PNG"
+		findings, err = verifyPNG(data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		format = "GIF"
+		findings, err = verifyGIF(data)
+	case isSVG(data[:min(len(data), 512)]):
+		format = "SVG"
+		findings, err = verifySVG(data)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("встроенное изображение %s: %w", format, err)
+	}
+	for i, finding := range findings {
+		findings[i] = "встроенный " + format + ": " + finding
+	}
+	return findings, nil
+}
+
+// verifyGIF проверяет, что GIF не содержит комментариев, текстовых расширений,
+// расширений приложений (кроме счетчика повторов) и данных после завершающего блока.
+func verifyGIF(data []byte) ([]string, error) {
+	structure, err := scanGIF(data)
+	if err != nil {
+		return nil, err
+	}
+	var findings []string
+	for _, ext := range structure.Extensions {
+		switch ext.Label {
+		case 0xF9:
+			// Управление графикой (задержка, прозрачность) - часть изображения.
+		case gifLabelApplication:
+			if len(ext.Data) < 11 || (string(ext.Data[:11]) != "NETSCAPE2.0" && string(ext.Data[:11]) != "ANIMEXTS1.0") {
+				findings = append(findings, "расширение приложения GIF")
+			}
+		case gifLabelComment:
+			findings = append(findings, "комментарий GIF")
+		default:
+			findings = append(findings, fmt.Sprintf("расширение GIF 0x%02X", ext.Label))
+		}
+	}
+	if structure.Trailing > 0 {
+		findings = append(findings, fmt.Sprintf("данные после конца изображения (%d байт)", structure.Trailing))
+	}
+	return findings, nil
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"               // Для сборки файлов
+	"encoding/base64"     // Для встроенных изображений SVG
+	"errors"              // Для проверки ошибки-маркера
+	"image"               // Для тестового изображения
+	"image/color"         // Для заливки тестового изображения
+	"image/color/palette" // Для палитры тестового GIF
+	"image/gif"           // Для кодирования тестового GIF
+	"image/jpeg"          // Для кодирования тестового JPEG
+	"image/png"           // Для кодирования тестового PNG
+	"os"                  // Для записи проверяемого файла
+	"path/filepath"       // Для пути проверяемого файла
+	"strings"             // Для сборки документов
+	"testing"             // Для тестов
+)
+
+// testImage возвращает изображение 4x4 с одной красной точкой.
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	img.Set(1, 1, color.NRGBA{R: 255, A: 255})
+	return img
+}
+
+// testJPEG кодирует изображение 4x4 и вставляет сегменты сразу после SOI.
+func testJPEG(t *testing.T, segments ...jpegSegment) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	return insertJPEGSegments(encoded.Bytes(), segments)
+}
+
+// testEXIFSegment собирает сегмент APP1 с EXIF из записей IFD0, Exif SubIFD и GPS IFD.
+func testEXIFSegment(ifd0, exifIFD, gps []exifEntry) jpegSegment {
+	payload := append(append([]byte{}, exifSignature...), encodeEXIF(ifd0, exifIFD, gps)...)
+	return jpegSegment{Marker: jpegMarkerAPP1, Payload: payload}
+}
+
+// testASCIIEntry создает текстовую запись EXIF.
+func testASCIIEntry(tag uint16, value string) exifEntry {
+	return exifEntry{Tag: tag, Type: exifTypeASCII, Count: uint32(len(value) + 1), Value: []byte(value + "\x00")}
+}
+
+// testIPTCSegment собирает сегмент APP13 с наборами данных записи 2 (номер -> значение).
+func testIPTCSegment(datasets ...[2]string) jpegSegment {
+	var iptc []byte
+	for _, ds := range datasets {
+		iptc = append(iptc, 0x1C, 2, ds[0][0], 0, byte(len(ds[1])))
+		iptc = append(iptc, ds[1]...)
+	}
+	return jpegSegment{Marker: jpegMarkerAPP13, Payload: photoshopIPTCPayload(iptc)}
+}
+
+// testGIF кодирует анимацию из двух кадров и вставляет блоки extra перед завершающим
+// байтом 0x3B; trailing дописывается после него.
+func testGIF(t *testing.T, extra []byte, trailing string) []byte {
+	t.Helper()
+	anim := &gif.GIF{LoopCount: 0}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+		frame.SetColorIndex(i, i, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, anim); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+	data := encoded.Bytes()
+	out := append(append(append([]byte{}, data[:len(data)-1]...), extra...), 0x3B)
+	return append(out, trailing...)
+}
+
+// testPNG кодирует изображение 4x4 и вставляет чанки extra сразу после IHDR.
+func testPNG(t *testing.T, extra ...pngChunk) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	chunks, err := readPNGChunks(encoded.Bytes())
+	if err != nil {
+		t.Fatalf("readPNGChunks: %v", err)
+	}
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i, chunk := range chunks {
+		writePNGChunk(&out, chunk.Type, chunk.Data)
+		if i == 0 {
+			for _, e := range extra {
+				writePNGChunk(&out, e.Type, e.Data)
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// checkVerify проверяет результат проверки: leak - ожидается ли находка.
+func checkVerify(t *testing.T, findings []string, err error, leak bool) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("ошибка проверки: %v", err)
+	}
+	if leak && len(findings) == 0 {
+		t.Errorf("утечка не обнаружена")
+	}
+	if !leak && len(findings) > 0 {
+		t.Errorf("лишние находки: %q", findings)
+	}
+}
+
+func TestVerifySVG(t *testing.T) {
+	dataPNG := func(data []byte) string {
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	leakyPNG := testPNG(t, pngChunk{Type: "tEXt", Data: []byte("Author\x00Ivanov")})
+
+	tests := []struct {
+		name  string
+		input string
+		leak  bool
+	}{
+		{"чистый документ", xmlHeader + `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10">` +
+			`<defs><linearGradient id="g"/></defs><style>rect { fill: url(#g) }</style>` +
+			`<rect width="1" height="1" style="fill: url('#g')"/><use href="#g"/>` +
+			`<image width="4" height="4" href="` + dataPNG(testPNG(t)) + `"/><text xml:space="preserve">a</text></svg>`, false},
+		{"комментарий", svgTestDocument(`<!-- Автор: Иванов -->`), true},
+		{"DOCTYPE", `<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "svg11.dtd">` + svgTestDocument(``), true},
+		{"инструкция обработки", `<?xml-stylesheet href="https://evil.example/a.css"?>` + svgTestDocument(``), true},
+		{"metadata", svgTestDocument(`<metadata>Иванов</metadata>`), true},
+		{"title", svgTestDocument(`<title>Секретный план</title>`), true},
+		{"script", svgTestDocument(`<script>alert(1)</script>`), true},
+		{"foreignObject", svgTestDocument(`<foreignObject width="1" height="1"/>`), true},
+		{"элемент редактора", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd">` +
+			`<sodipodi:namedview/></svg>`, true},
+		{"атрибут редактора", `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape">` +
+			`<g inkscape:label="Слой 1"/></svg>`, true},
+		{"обработчик события", svgTestDocument(`<rect width="1" height="1" onclick="alert(1)"/>`), true},
+		{"атрибут data-*", svgTestDocument(`<rect width="1" height="1" data-author="ivanov"/>`), true},
+		{"внешняя ссылка href", svgTestDocument(`<use href="https://evil.example/sprite.svg#icon"/>`), true},
+		{"внешняя ссылка xlink:href", svgTestDocument(`<use xlink:href="//evil.example/sprite.svg#icon"/>`), true},
+		{"url() в стиле", svgTestDocument(`<rect width="1" height="1" style="fill: url(https://evil.example/p)"/>`), true},
+		{"url() в атрибуте", svgTestDocument(`<rect width="1" height="1" fill="url( 'http://evil.example/p')"/>`), true},
+		{"@import", svgTestDocument(`<style>@import "https://evil.example/a.css";</style>`), true},
+		{"комментарий CSS", svgTestDocument(`<style>/* Иванов */ rect { fill: red }</style>`), true},
+		{"-moz-binding", svgTestDocument(`<style>rect { -moz-binding: none }</style>`), true},
+		{"встроенный JPEG", svgTestDocument(`<image width="1" height="1" href="data:image/jpeg;base64,/9j/2Q=="/>`), true},
+		{"встроенный PNG с tEXt", svgTestDocument(`<image width="1" height="1" href="` + dataPNG(leakyPNG) + `"/>`), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := verifySVG([]byte(tt.input))
+			checkVerify(t, findings, err, tt.leak)
+		})
+	}
+
+	// Очищенный документ с внешней ссылкой и метаданными проходит проверку.
+	clean, _, err := sanitizeSVG([]byte(svgTestDocument(`<metadata>Иванов</metadata><!-- x -->` +
+		`<image width="4" height="4" href="` + dataPNG(leakyPNG) + `"/><use xlink:href="http://evil.example/a#b"/>`)))
+	if err != nil {
+		t.Fatalf("sanitizeSVG: %v", err)
+	}
+	findings, err := verifySVG(clean)
+	checkVerify(t, findings, err, false)
+}
+
+// xmlHeader - объявление XML, с которого начинается очищенный SVG.
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+// testOggFile собирает поток Ogg: заголовок кодека, пакет комментариев и страницу звука.
+func testOggFile(head, comment []byte) []byte {
+	var out bytes.Buffer
+	testOggPage(&out, oggBOS, 0, 0, []int{len(head)}, head)
+	testOggPage(&out, 0, 0, 1, []int{len(comment)}, comment)
+	testOggPage(&out, 0x04, 960, 2, []int{100}, bytes.Repeat([]byte{0x55}, 100))
+	return out.Bytes()
+}
+
+func TestVerifyAudio(t *testing.T) {
+	mp3 := bytes.Join(testMP3Frames(4), nil)
+	streamInfo := testFLACBlock(0, false, bytes.Repeat([]byte{0x11}, 34))
+	flacAudio := append([]byte{0xFF, 0xF8}, bytes.Repeat([]byte{0x33}, 100)...)
+	flac := func(blocks ...[]byte) []byte {
+		out := []byte("fLaC")
+		out = append(out, streamInfo...)
+		for _, block := range blocks {
+			out = append(out, block...)
+		}
+		return append(out, flacAudio...)
+	}
+	opusHead := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	vorbisHead := append([]byte("\x01vorbis"), make([]byte, 22)...)
+	emptyOpusTags := append([]byte("OpusTags"), testVorbisComment("")...)
+	emptyVorbis := append(append([]byte("\x03vorbis"), testVorbisComment("")...), 0x01)
+	id3 := testID3v23([2]string{"TPE1", "\x00Ivanov"})
+
+	tests := []struct {
+		name        string
+		contentType string
+		input       []byte
+		leak        bool
+	}{
+		{"MP3 без тегов", "audio/mpeg", mp3, false},
+		{"MP3 с обрезанным последним кадром", "audio/mpeg", mp3[:len(mp3)-100], false},
+		{"ID3v2 в начале", "audio/mpeg", append(append([]byte{}, id3...), mp3...), true},
+		{"ID3v2 между кадрами", "audio/mpeg", bytes.Join([][]byte{mp3[:417], id3, mp3[417:]}, nil), true},
+		{"ID3v1", "audio/mpeg", append(append([]byte{}, mp3...), testID3v1("Demo", "Ivanov")...), true},
+		{"APE", "audio/mpeg", append(append([]byte{}, mp3...), testAPE([2]string{"Artist", "Ivanov"})...), true},
+		{"Lyrics3", "audio/mpeg", append(append([]byte{}, mp3...), "LYRICSBEGINtext000010LYRICS200"...), true},
+		{"посторонние данные", "audio/mpeg", append(append([]byte{}, mp3...), "Ivanov"...), true},
+
+		{"FLAC без тегов", "audio/flac", flac(testFLACBlock(3, true, make([]byte, 18))), false},
+		{"FLAC с VORBIS_COMMENT", "audio/flac", flac(testFLACBlock(4, true, testVorbisComment("libFLAC", "ARTIST=Ivanov"))), true},
+		{"FLAC с обложкой", "audio/flac", flac(testFLACBlock(6, true, make([]byte, 32))), true},
+		{"FLAC с APPLICATION", "audio/flac", flac(testFLACBlock(2, true, []byte("riffdata"))), true},
+		{"FLAC с ID3v1", "audio/flac", append(flac(testFLACBlock(3, true, make([]byte, 18))), testID3v1("Demo", "Ivanov")...), true},
+
+		{"Opus без тегов", "audio/ogg", testOggFile(opusHead, emptyOpusTags), false},
+		{"Vorbis без тегов", "audio/ogg", testOggFile(vorbisHead, emptyVorbis), false},
+		{"теги Opus", "audio/ogg", testOggFile(opusHead, append([]byte("OpusTags"), testVorbisComment("", "ARTIST=Ivanov")...)), true},
+		{"производитель Opus", "audio/ogg", testOggFile(opusHead, append([]byte("OpusTags"), testVorbisComment("libopus 1.4")...)), true},
+		{"комментарии Vorbis", "audio/ogg", testOggFile(vorbisHead,
+			append(append([]byte("\x03vorbis"), testVorbisComment("", "DATE=2024")...), 0x01)), true},
+		{"ID3v1 после Ogg", "audio/ogg", append(testOggFile(opusHead, emptyOpusTags), testID3v1("Demo", "Ivanov")...), true},
+		{"данные после Ogg", "audio/ogg", append(testOggFile(opusHead, emptyOpusTags), "Ivanov"...), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := verifyAudio(tt.input, tt.contentType)
+			checkVerify(t, findings, err, tt.leak)
+		})
+	}
+
+	// Разобрать нельзя - файл не публикуется.
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		input       []byte
+	}{
+		{"MP3 без кадров", "audio/mpeg", []byte(strings.Repeat("x", 500))},
+		{"FLAC без аудиокадров", "audio/flac", []byte("fLaC\x80\x00\x00\x22" + strings.Repeat("\x00", 34))},
+		{"Ogg без комментариев", "audio/ogg", testOggFile(opusHead, nil)[:28+len(opusHead)]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifyAudio(tt.input, tt.contentType); err == nil {
+				t.Errorf("ожидалась ошибка разбора")
+			}
+		})
+	}
+}
+
+func TestVerifyImages(t *testing.T) {
+	xmp := append(append([]byte{}, xmpSignature...), `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`+
+		`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreatorTool="Editor 1.0"/></rdf:RDF></x:xmpmeta>`...)
+	jfifThumbnail := append([]byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x01\x01"), 1, 2, 3)
+	comment := []byte{0x21, gifLabelComment, 6, 'I', 'v', 'a', 'n', 'o', 'v', 0}
+	application := append([]byte{0x21, gifLabelApplication, 11}, "XMP DataXMP\x04<x/>\x00"...)
+
+	tests := []struct {
+		name string
+		data []byte
+		leak bool
+	}{
+		{"JPEG без метаданных", testJPEG(t), false},
+		{"JPEG с ориентацией", testJPEG(t, testEXIFSegment([]exifEntry{newShortEntry(exifTagOrientation, 6)}, nil, nil)), false},
+		{"JPEG с минимальным APP14 Adobe", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP14, Payload: []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")}), false},
+		{"APP1 Exif", testJPEG(t, testEXIFSegment([]exifEntry{testASCIIEntry(exifTagMake, "Canon")}, nil, nil)), true},
+		{"Exif SubIFD", testJPEG(t, testEXIFSegment(nil, []exifEntry{testASCIIEntry(exifTagBodySerialNumber, "123")}, nil)), true},
+		{"APP1 XMP", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP1, Payload: xmp}), true},
+		{"APP13 IPTC", testJPEG(t, testIPTCSegment([2]string{string(rune(iptcByline)), "Ivanov"})), true},
+		{"APP2 ICC", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP2, Payload: append(append([]byte{}, iccProfileSignature...), 1, 1, 0, 0)}), true},
+		{"APP0 с миниатюрой", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP0, Payload: jfifThumbnail}), true},
+		{"APP14 с дополнительными данными", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP14, Payload: []byte("Adobe\x00\x64\x00\x00\x00\x00\x01Ivanov")}), true},
+		{"APP11", testJPEG(t, jpegSegment{Marker: jpegMarkerAPP0 + 11, Payload: []byte("JP\x00\x01")}), true},
+		{"комментарий JPEG", testJPEG(t, jpegSegment{Marker: jpegMarkerCOM, Payload: []byte("Ivanov")}), true},
+		{"данные после EOI", append(testJPEG(t), "Ivanov"...), true},
+
+		{"PNG без метаданных", testPNG(t), false},
+		{"PNG tEXt", testPNG(t, pngChunk{Type: "tEXt", Data: []byte("Author\x00Ivanov")}), true},
+		{"PNG iTXt", testPNG(t, pngChunk{Type: "iTXt", Data: []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x/>")}), true},
+		{"PNG eXIf", testPNG(t, pngChunk{Type: "eXIf", Data: encodeEXIF([]exifEntry{testASCIIEntry(exifTagMake, "Canon")}, nil, nil)}), true},
+		{"PNG iCCP", testPNG(t, pngChunk{Type: "iCCP", Data: []byte("sRGB\x00\x00x")}), true},
+		{"PNG tIME", testPNG(t, pngChunk{Type: "tIME", Data: []byte{0x07, 0xE8, 1, 1, 0, 0, 0}}), true},
+		{"данные после IEND", append(testPNG(t), "Ivanov"...), true},
+
+		{"GIF без метаданных", testGIF(t, nil, ""), false},
+		{"комментарий GIF", testGIF(t, comment, ""), true},
+		{"расширение приложения GIF", testGIF(t, application, ""), true},
+		{"данные после конца GIF", testGIF(t, nil, "Ivanov"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clean")
+			if err := os.WriteFile(path, tt.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := VerifyCleanFile(path, DefaultProcessOptions())
+			switch {
+			case tt.leak && !errors.Is(err, ErrMetadataLeak):
+				t.Errorf("ожидалась ErrMetadataLeak, получено %v", err)
+			case !tt.leak && err != nil:
+				t.Errorf("VerifyCleanFile: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyJPEGPolicy(t *testing.T) {
+	lat, lon := coarsenGPS(55.7558, 37.6173, GPSPrecisionCity)
+	coarseGPS := gpsEXIFEntries(lat, lon)
+	withAltitude := append(append([]exifEntry{}, coarseGPS...),
+		exifEntry{Tag: exifTagGPSAltitude, Type: exifTypeRational, Count: 1, Value: []byte{0, 0, 0, 150, 0, 0, 0, 1}})
+	allowedXMP := append(append([]byte{}, xmpSignature...), buildXMPPacket(map[string][]string{"xmp:dc:creator": {"Ivanov"}})...)
+	extraXMP := append(append([]byte{}, xmpSignature...), bytes.Replace(buildXMPPacket(map[string][]string{"xmp:dc:creator": {"Ivanov"}}),
+		[]byte(`rdf:about=""`), []byte(`rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreatorTool="Editor 1.0"`), 1)...)
+
+	gps := ProcessOptions{GPSPrecision: GPSPrecisionCity}
+	allow := ProcessOptions{MetadataAllowlist: MetadataAllowlist{"exif:Artist": true, "xmp:dc:creator": true, "iptc:By-line": true}}
+	byline, city := string(rune(iptcByline)), string(rune(iptcCity))
+
+	tests := []struct {
+		name    string
+		opts    ProcessOptions
+		segment jpegSegment
+		leak    bool
+	}{
+		{"огрубленные координаты", gps, testEXIFSegment(nil, nil, coarseGPS), false},
+		{"координаты без разрешения", DefaultProcessOptions(), testEXIFSegment(nil, nil, coarseGPS), true},
+		{"точные координаты", gps, testEXIFSegment(nil, nil, gpsEXIFEntries(55.7558, 37.6173)), true},
+		{"координаты другой точности", ProcessOptions{GPSPrecision: GPSPrecision1km}, testEXIFSegment(nil, nil, coarseGPS), true},
+		{"высота вместе с координатами", gps, testEXIFSegment(nil, nil, withAltitude), true},
+		{"другие теги вместе с координатами", gps, testEXIFSegment([]exifEntry{testASCIIEntry(exifTagModel, "X100")}, nil, coarseGPS), true},
+
+		{"разрешенный тег EXIF", allow, testEXIFSegment([]exifEntry{testASCIIEntry(exifTagArtist, "Ivanov")}, nil, nil), false},
+		{"разрешенный тег не текстового типа", allow, testEXIFSegment([]exifEntry{newShortEntry(exifTagArtist, 1)}, nil, nil), true},
+		{"неразрешенный тег EXIF", allow, testEXIFSegment([]exifEntry{testASCIIEntry(exifTagArtist, "Ivanov"),
+			testASCIIEntry(exifTagSoftware, "Editor")}, nil, nil), true},
+		{"координаты при списке разрешенных", allow, testEXIFSegment(nil, nil, coarseGPS), true},
+		{"разрешенное свойство XMP", allow, jpegSegment{Marker: jpegMarkerAPP1, Payload: allowedXMP}, false},
+		{"неразрешенное свойство XMP", allow, jpegSegment{Marker: jpegMarkerAPP1, Payload: extraXMP}, true},
+		{"разрешенный набор IPTC", allow, testIPTCSegment([2]string{byline, "Ivanov"}), false},
+		{"неразрешенный набор IPTC", allow, testIPTCSegment([2]string{byline, "Ivanov"}, [2]string{city, "Moscow"}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := verifyJPEG(testJPEG(t, tt.segment), newVerifyPolicy(tt.opts))
+			checkVerify(t, findings, err, tt.leak)
+		})
+	}
+}
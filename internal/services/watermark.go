@@ -0,0 +1,290 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"crypto/sha256"   // Для получения зерна псевдослучайной последовательности из ключа
+	"encoding/binary" // Для кодирования идентификатора
+	"errors"          // Для ошибок обнаружения
+	"fmt"             // Для форматирования ошибок
+	"hash/crc32"      // Для контрольной суммы идентификатора
+	"image"           // Для работы с изображениями
+	"image/draw"      // Для приведения изображения к RGBA
+	"math"            // Для интерполяции и статистики
+	"math/rand/v2"    // Для псевдослучайной последовательности (ChaCha8)
+	"strings"         // Для нормализации ключа
+	"sync"            // Для защиты шаблона при смене ключа
+)
+
+// Невидимый водяной знак для расследования утечек.
+//
+// В пиксели встраивается случайный идентификатор (он же сохраняется в записи
+// изображения в БД), по которому можно найти ссылку, через которую утекло изображение.
+// Используется расширение спектра: изображение делится на сетку watermarkGrid x watermarkGrid
+// ячеек в относительных координатах, каждая ячейка отвечает за один бит полезной нагрузки
+// и получает псевдослучайный знак (+1/-1) из последовательности, заданной секретным ключом.
+// Яркость ячейки чуть повышается или понижается (на 1-4 уровня, с плавными переходами
+// между ячейками): на однотонных участках изменение меньше, на текстурных - больше,
+// там его не видно. Шаблон низкочастотный, поэтому переживает повторное
+// JPEG-сжатие, а относительные координаты делают его независимым от масштабирования.
+// Для извлечения яркость каждой ячейки сравнивается со средним соседних ячеек
+// (это убирает само изображение) и коррелируется с последовательностью ключа.
+// Обрезка, поворот и сильное изменение пропорций водяной знак разрушают.
+
+const (
+	watermarkGrid     = 128 // Размер сетки ячеек (в каждом направлении)
+	watermarkIDBits   = 32  // Бит идентификатора
+	watermarkBits     = 48  // Всего бит: идентификатор + 16 бит контрольной суммы
+	watermarkStrength = 3.0 // Базовая амплитуда изменения яркости (уровни 0-255)
+	watermarkMinSize  = 256 // Минимальная сторона изображения, пикселей (ячейка не меньше 2 пикселей)
+
+	// watermarkResidualClip ограничивает вклад одной ячейки при извлечении:
+	// резкие границы объектов не должны перевешивать сотни ячеек с шаблоном.
+	watermarkResidualClip = 4 * watermarkStrength
+
+	// watermarkMinConfidence - минимальная надежность извлечения (средняя корреляция бит
+	// в единицах шума), при которой результат считается найденным.
+	watermarkMinConfidence = 2.5
+)
+
+// watermarkPublicKeys - ключи, опубликованные в исходном коде и примерах конфигурации
+// (прежний ключ по умолчанию и значение из примера .env). С таким ключом водяной знак
+// может извлечь или целенаправленно удалить любой, поэтому они не принимаются.
+var watermarkPublicKeys = map[string]bool{
+	"imagecleaner-default-watermark-key": true,
+	"change-me-watermark-key":            true,
+}
+
+// ErrWatermarkKeyNotSet - секретный ключ водяного знака не задан или является общеизвестным.
+var ErrWatermarkKeyNotSet = errors.New("не задан секретный ключ водяного знака (WATERMARK_KEY)")
+
+// ErrWatermarkNotFound - водяной знак не найден (или поврежден сильнее допустимого).
+var ErrWatermarkNotFound = errors.New("водяной знак не найден")
+
+// ErrImageTooSmallForWatermark - изображение слишком маленькое для надежного водяного знака.
+var ErrImageTooSmallForWatermark = fmt.Errorf("изображение слишком маленькое для водяного знака (нужно не меньше %d пикселей по меньшей стороне)", watermarkMinSize)
+
+// watermarkPattern - псевдослучайное распределение бит по ячейкам и знаки ячеек.
+type watermarkPattern struct {
+	bit  [watermarkGrid * watermarkGrid]uint8   // Номер бита полезной нагрузки для ячейки
+	chip [watermarkGrid * watermarkGrid]float64 // Знак ячейки (+1 или -1)
+}
+
+var (
+	watermarkMu      sync.RWMutex
+	watermarkCurrent *watermarkPattern // nil, пока ключ не задан
+)
+
+// SetWatermarkKey задает секретный ключ водяного знака. Без ключа нельзя ни извлечь,
+// ни целенаправленно удалить водяной знак. Ключ должен совпадать при встраивании
+// и извлечении (команда detect), поэтому менять его после начала работы нельзя.
+// Вызывается один раз при старте приложения. Пустой или общеизвестный ключ
+// не принимается (ErrWatermarkKeyNotSet): водяной знак остается недоступным.
+func SetWatermarkKey(key string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return ErrWatermarkKeyNotSet
+	}
+	if watermarkPublicKeys[key] {
+		return fmt.Errorf("%w: значение %q опубликовано в примере конфигурации", ErrWatermarkKeyNotSet, key)
+	}
+	pattern := newWatermarkPattern(key)
+	watermarkMu.Lock()
+	watermarkCurrent = pattern
+	watermarkMu.Unlock()
+	return nil
+}
+
+// WatermarkAvailable сообщает, задан ли секретный ключ водяного знака.
+func WatermarkAvailable() bool {
+	return currentWatermarkPattern() != nil
+}
+
+func currentWatermarkPattern() *watermarkPattern {
+	watermarkMu.RLock()
+	defer watermarkMu.RUnlock()
+	return watermarkCurrent
+}
+
+// newWatermarkPattern строит шаблон из ключа: ячейки случайно перемешиваются
+// и поровну распределяются между битами, знак каждой ячейки случаен.
+func newWatermarkPattern(key string) *watermarkPattern {
+	seed := sha256.Sum256([]byte("watermark:" + key))
+	rng := rand.New(rand.NewChaCha8(seed))
+	p := &watermarkPattern{}
+	for i, cell := range rng.Perm(len(p.bit)) {
+		p.bit[cell] = uint8(i % watermarkBits)
+		p.chip[cell] = float64(rng.IntN(2)*2 - 1)
+	}
+	return p
+}
+
+// NewWatermarkID возвращает случайный ненулевой идентификатор водяного знака.
+func NewWatermarkID() uint32 {
+	rng := newSecureRand()
+	for {
+		if id := rng.Uint32(); id != 0 {
+			return id
+		}
+	}
+}
+
+// watermarkPayload кодирует идентификатор и его контрольную сумму в знаки бит (+1/-1).
+func watermarkPayload(id uint32) [watermarkBits]float64 {
+	var raw [4]byte
+	binary.BigEndian.PutUint32(raw[:], id)
+	value := uint64(id)<<16 | uint64(crc32.ChecksumIEEE(raw[:])&0xFFFF)
+	var bits [watermarkBits]float64
+	for i := range bits {
+		bits[i] = -1
+		if value>>(watermarkBits-1-i)&1 == 1 {
+			bits[i] = 1
+		}
+	}
+	return bits
+}
+
+// embedWatermark возвращает копию изображения со встроенным идентификатором.
+func embedWatermark(img image.Image, id uint32) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if min(w, h) < watermarkMinSize {
+		return nil, ErrImageTooSmallForWatermark
+	}
+	pattern := currentWatermarkPattern()
+	if pattern == nil {
+		return nil, ErrWatermarkKeyNotSet
+	}
+	bits := watermarkPayload(id)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	// Значение шаблона в центре каждой ячейки с учетом текстуры (маскирующего эффекта).
+	_, activity := watermarkCellStats(dst)
+	var cells [watermarkGrid * watermarkGrid]float64
+	for c := range cells {
+		masking := math.Max(0.4, math.Min(1.4, 0.4+activity[c]/10))
+		cells[c] = pattern.chip[c] * bits[pattern.bit[c]] * watermarkStrength * masking
+	}
+	cellAt := func(cx, cy int) float64 {
+		cx = max(0, min(watermarkGrid-1, cx))
+		cy = max(0, min(watermarkGrid-1, cy))
+		return cells[cy*watermarkGrid+cx]
+	}
+
+	for y := 0; y < h; y++ {
+		// Билинейная интерполяция между центрами ячеек: без резких ступенек на однотонных участках.
+		fy := (float64(y)+0.5)*watermarkGrid/float64(h) - 0.5
+		cy := int(math.Floor(fy))
+		wy := fy - float64(cy)
+		for x := 0; x < w; x++ {
+			fx := (float64(x)+0.5)*watermarkGrid/float64(w) - 0.5
+			cx := int(math.Floor(fx))
+			wx := fx - float64(cx)
+			delta := (cellAt(cx, cy)*(1-wx)+cellAt(cx+1, cy)*wx)*(1-wy) +
+				(cellAt(cx, cy+1)*(1-wx)+cellAt(cx+1, cy+1)*wx)*wy
+
+			o := dst.PixOffset(x, y)
+			a := float64(dst.Pix[o+3])
+			if a == 0 {
+				continue
+			}
+			// Значения предумножены на альфу: изменение масштабируется так же.
+			delta *= a / 255
+			for c := 0; c < 3; c++ {
+				dst.Pix[o+c] = uint8(math.Max(0, math.Min(a, math.Round(float64(dst.Pix[o+c])+delta))))
+			}
+		}
+	}
+	dst.Rect = bounds
+	return dst, nil
+}
+
+// DetectWatermark извлекает идентификатор водяного знака из изображения.
+// Возвращает идентификатор и надежность (средняя корреляция бит в единицах шума).
+// Если водяного знака нет или контрольная сумма не совпала, возвращает ErrWatermarkNotFound.
+func DetectWatermark(img image.Image) (uint32, float64, error) {
+	pattern := currentWatermarkPattern()
+	if pattern == nil {
+		return 0, 0, ErrWatermarkKeyNotSet
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < watermarkGrid || h < watermarkGrid {
+		return 0, 0, fmt.Errorf("%w: изображение слишком маленькое (%dx%d)", ErrWatermarkNotFound, w, h)
+	}
+
+	// Средняя яркость каждой ячейки (в относительных координатах, поэтому масштаб не важен).
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	means, _ := watermarkCellStats(rgba)
+
+	// Остаток ячейки относительно соседей (убирает плавные изменения самого изображения)
+	// коррелируется со знаками ячеек для каждого бита.
+	var correlation [watermarkBits]float64
+	var energy float64
+	var used int
+	for cy := 1; cy < watermarkGrid-1; cy++ {
+		for cx := 1; cx < watermarkGrid-1; cx++ {
+			var neighbours float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if dx != 0 || dy != 0 {
+						neighbours += means[(cy+dy)*watermarkGrid+cx+dx]
+					}
+				}
+			}
+			c := cy*watermarkGrid + cx
+			residual := math.Max(-watermarkResidualClip, math.Min(watermarkResidualClip, means[c]-neighbours/8))
+			correlation[pattern.bit[c]] += residual * pattern.chip[c]
+			energy += residual * residual
+			used++
+		}
+	}
+
+	// Надежность: средняя по битам корреляция в единицах ожидаемого шума.
+	// Для изображения без водяного знака она около 0.8, с водяным знаком - в разы больше.
+	noise := math.Sqrt(energy / watermarkBits)
+	var value uint64
+	var confidence float64
+	for _, corr := range correlation {
+		value <<= 1
+		if corr > 0 {
+			value |= 1
+		}
+		if noise > 0 {
+			confidence += math.Abs(corr) / noise / watermarkBits
+		}
+	}
+
+	id := uint32(value >> (watermarkBits - watermarkIDBits))
+	var raw [4]byte
+	binary.BigEndian.PutUint32(raw[:], id)
+	if id == 0 || uint64(crc32.ChecksumIEEE(raw[:])&0xFFFF) != value&0xFFFF || confidence < watermarkMinConfidence {
+		return 0, confidence, ErrWatermarkNotFound
+	}
+	return id, confidence, nil
+}
+
+// watermarkCellStats возвращает среднюю яркость и стандартное отклонение яркости
+// (оценку текстурности) каждой ячейки сетки.
+func watermarkCellStats(img *image.RGBA) (means, deviations [watermarkGrid * watermarkGrid]float64) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var sums, squares, counts [watermarkGrid * watermarkGrid]float64
+	for y := 0; y < h; y++ {
+		cy := y * watermarkGrid / h
+		for x := 0; x < w; x++ {
+			o := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			c := cy*watermarkGrid + x*watermarkGrid/w
+			lum := 0.299*float64(img.Pix[o]) + 0.587*float64(img.Pix[o+1]) + 0.114*float64(img.Pix[o+2])
+			sums[c] += lum
+			squares[c] += lum * lum
+			counts[c]++
+		}
+	}
+	for c := range means {
+		means[c] = sums[c] / counts[c]
+		deviations[c] = math.Sqrt(math.Max(0, squares[c]/counts[c]-means[c]*means[c]))
+	}
+	return means, deviations
+}
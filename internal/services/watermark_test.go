@@ -0,0 +1,119 @@
+package services
+
+import (
+	// Стандартные библиотеки
+	"bytes"        // Для повторного сжатия JPEG
+	"errors"       // Для проверки ошибок-маркеров
+	"image"        // Для тестового изображения
+	"image/color"  // Для заполнения тестового изображения
+	"image/jpeg"   // Для повторного сжатия
+	"math"         // Для плавного фона
+	"math/rand/v2" // Для текстуры тестового изображения
+	"testing"      // Для тестов
+
+	// Сторонние библиотеки
+	"golang.org/x/image/draw" // Для уменьшения изображения
+)
+
+// testWatermarkPhoto возвращает изображение, похожее на фотографию: плавный фон,
+// несколько однотонных областей и мелкая текстура.
+func testWatermarkPhoto(w, h int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			base := 110 + 60*math.Sin(float64(x)/70)*math.Cos(float64(y)/50)
+			if x > w/2 && y > h/2 {
+				base = 200 // Однотонная область
+			}
+			v := uint8(math.Max(0, math.Min(255, base+rng.NormFloat64()*6)))
+			img.SetRGBA(x, y, color.RGBA{R: v, G: uint8(int(v) * 9 / 10), B: uint8(int(v) * 7 / 10), A: 255})
+		}
+	}
+	return img
+}
+
+// setTestWatermarkKey задает ключ на время теста и восстанавливает прежний шаблон.
+func setTestWatermarkKey(t *testing.T, key string) {
+	t.Helper()
+	previous := currentWatermarkPattern()
+	if err := SetWatermarkKey(key); err != nil {
+		t.Fatalf("SetWatermarkKey: %v", err)
+	}
+	t.Cleanup(func() {
+		watermarkMu.Lock()
+		watermarkCurrent = previous
+		watermarkMu.Unlock()
+	})
+}
+
+func TestWatermarkSurvivesJPEGAndResize(t *testing.T) {
+	setTestWatermarkKey(t, "test-secret-key")
+	const id = 0x5EC0DE42
+	marked, err := embedWatermark(testWatermarkPhoto(800, 600), id)
+	if err != nil {
+		t.Fatalf("embedWatermark: %v", err)
+	}
+
+	// Уменьшение примерно до 0,7 и повторное сжатие JPEG с качеством 75.
+	small := image.NewRGBA(image.Rect(0, 0, 560, 420))
+	draw.CatmullRom.Scale(small, small.Bounds(), marked, marked.Bounds(), draw.Src, nil)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, small, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	decoded, err := jpeg.Decode(&encoded)
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+
+	got, confidence, err := DetectWatermark(decoded)
+	if err != nil {
+		t.Fatalf("DetectWatermark: %v (уверенность %.1f)", err, confidence)
+	}
+	if got != id {
+		t.Errorf("идентификатор %08x, ожидался %08x", got, id)
+	}
+}
+
+func TestWatermarkNotFound(t *testing.T) {
+	setTestWatermarkKey(t, "test-secret-key")
+	photo := testWatermarkPhoto(800, 600)
+	if _, _, err := DetectWatermark(photo); !errors.Is(err, ErrWatermarkNotFound) {
+		t.Errorf("изображение без знака: ожидалась ErrWatermarkNotFound, получено %v", err)
+	}
+
+	// Знак, встроенный другим ключом, не извлекается.
+	marked, err := embedWatermark(photo, 0x5EC0DE42)
+	if err != nil {
+		t.Fatalf("embedWatermark: %v", err)
+	}
+	setTestWatermarkKey(t, "another-secret-key")
+	if _, _, err := DetectWatermark(marked); !errors.Is(err, ErrWatermarkNotFound) {
+		t.Errorf("чужой ключ: ожидалась ErrWatermarkNotFound, получено %v", err)
+	}
+}
+
+func TestSetWatermarkKeyRejectsPublicKeys(t *testing.T) {
+	setTestWatermarkKey(t, "test-secret-key")
+	for _, key := range []string{"", "  ", "change-me-watermark-key", "imagecleaner-default-watermark-key"} {
+		if err := SetWatermarkKey(key); !errors.Is(err, ErrWatermarkKeyNotSet) {
+			t.Errorf("ключ %q: ожидалась ErrWatermarkKeyNotSet, получено %v", key, err)
+		}
+	}
+
+	// Без ключа водяной знак нельзя ни встроить, ни извлечь.
+	watermarkMu.Lock()
+	watermarkCurrent = nil
+	watermarkMu.Unlock()
+	if WatermarkAvailable() {
+		t.Errorf("WatermarkAvailable() = true без ключа")
+	}
+	photo := testWatermarkPhoto(300, 300)
+	if _, err := embedWatermark(photo, 1); !errors.Is(err, ErrWatermarkKeyNotSet) {
+		t.Errorf("embedWatermark: ожидалась ErrWatermarkKeyNotSet, получено %v", err)
+	}
+	if _, _, err := DetectWatermark(photo); !errors.Is(err, ErrWatermarkKeyNotSet) {
+		t.Errorf("DetectWatermark: ожидалась ErrWatermarkKeyNotSet, получено %v", err)
+	}
+}